@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v2"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// DeadLettersCommand will list, inspect, and replay the work which the
+// workers gave up on and moved to the dead-letter queue
+func DeadLettersCommand(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Before: beforeDeadLetters,
+		Name:   "dead-letters",
+		Subcommands: []*cli.Command{
+			{
+				Action: listDeadLetters,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Aliases: []string{"l"},
+						EnvVars: []string{"VRDDT_ADMIN_DEAD_LETTERS_LIMIT"},
+						Name:    "limit",
+						Usage:   "Maximum number of dead letters to list (0 for all of them)",
+						Value:   50,
+					},
+				},
+				Name:  "list",
+				Usage: "List the dead-lettered messages oldest first",
+			},
+			{
+				Action:    inspectDeadLetter,
+				ArgsUsage: "ID",
+				Name:      "inspect",
+				Usage:     "Show everything about a dead-lettered message including its body",
+			},
+			{
+				Action:    replayDeadLetters,
+				ArgsUsage: "ID [ID...]",
+				Name:      "replay",
+				Usage:     "Put dead-lettered messages back on to the queue with their attempts reset",
+			},
+		},
+		Usage: "List, inspect, and replay messages on the dead-letter queue",
+	}
+}
+
+// beforeDeadLetters will initialize the queue
+func beforeDeadLetters(cliContext *cli.Context) (err error) {
+	// TODO: Context
+	ctx := context.TODO()
+
+	// Initialize the queue
+	if err = services.Queue.Init(ctx); err != nil {
+		return
+	}
+
+	return
+}
+
+// inspectDeadLetter will print a single dead letter along with its body
+func inspectDeadLetter(cliContext *cli.Context) (err error) {
+	if cliContext.NArg() != 1 {
+		cli.ShowCommandHelp(cliContext, cliContext.Command.Name)
+		return errors.MissingField("ID")
+	}
+
+	deadLetter, err := services.Queue.GetDeadLetter(context.TODO(), cliContext.Args().First())
+	if err != nil {
+		return
+	}
+
+	fmt.Printf("ID:       %s\n", deadLetter.ID)
+	fmt.Printf("Attempts: %d\n", deadLetter.Attempts)
+	fmt.Printf("Died At:  %s\n", deadLetter.DiedAt.Format(time.RFC3339))
+	fmt.Printf("Reason:   %s\n", deadLetter.Reason)
+	fmt.Printf("Body:\n%s\n", deadLetterBody(deadLetter))
+
+	return
+}
+
+// listDeadLetters will print a line for each dead letter
+func listDeadLetters(cliContext *cli.Context) (err error) {
+	deadLetters, err := services.Queue.DeadLetters(context.TODO(), cliContext.Int("limit"))
+	if err != nil {
+		return
+	}
+
+	for _, deadLetter := range deadLetters {
+		fmt.Printf("%s\t%d\t%s\t%s\n",
+			deadLetter.ID,
+			deadLetter.Attempts,
+			deadLetter.DiedAt.Format(time.RFC3339),
+			deadLetter.Reason,
+		)
+	}
+	loggerHandle.Infof("Listed %d dead letters", len(deadLetters))
+
+	return
+}
+
+// replayDeadLetters will put each of the dead letters given back on to the
+// queue
+func replayDeadLetters(cliContext *cli.Context) (err error) {
+	if cliContext.NArg() == 0 {
+		cli.ShowCommandHelp(cliContext, cliContext.Command.Name)
+		return errors.MissingField("ID")
+	}
+
+	for _, id := range cliContext.Args().Slice() {
+		if err = services.Queue.ReplayDeadLetter(context.TODO(), id); err != nil {
+			return
+		}
+
+		fmt.Printf("Replayed: %s\n", id)
+	}
+
+	return
+}
+
+// deadLetterBody returns a printable version of the body of a dead letter
+func deadLetterBody(deadLetter *queue.DeadLetter) string {
+	if body, ok := deadLetter.Body.([]byte); ok {
+		return string(body)
+	}
+
+	return fmt.Sprintf("%#v", deadLetter.Body)
+}
@@ -98,16 +98,18 @@ func processWithInternalServices(cliContext *cli.Context) (err error) {
 		timeoutTime = 1
 	}
 
+	ctx := context.TODO()
+
 	redditVideo := domain.NewRedditVideo()
 	redditVideo.URL = cliContext.String("reddit-url")
-	err = redditVideo.SetFinalURL()
+	err = redditVideo.SetFinalURL(ctx)
 	if err != nil {
 		return
 	}
 
 	// We only really need this because we want to check that the URL contains
 	// valid JSON and is a video link and not just any other Reddit URL
-	err = redditVideo.SetMetadata()
+	err = redditVideo.SetMetadata(ctx)
 	if err != nil {
 		return
 	}
@@ -117,7 +119,7 @@ func processWithInternalServices(cliContext *cli.Context) (err error) {
 	vrddtVideoRetriever := vrddtvideos.NewRetriever(loggerHandle, services.Store)
 
 	// Check if this already exists in the database
-	dbRedditVideo, err := redditVideoRetriever.GetByURL(context.TODO(), redditVideo.URL)
+	dbRedditVideo, err := redditVideoRetriever.GetByURL(ctx, redditVideo.URL, redditVideo.Quality, redditVideo.Format, redditVideo.Clip)
 	if err != nil {
 		switch errors.Type(err) {
 		case errors.TypeResourceNotFound:
@@ -128,7 +130,7 @@ func processWithInternalServices(cliContext *cli.Context) (err error) {
 		}
 	} else {
 		loggerHandle.Debugf("dbRedditVideo: %#v", dbRedditVideo)
-		dbVrddtVideo, vrddtErr := redditVideoRetriever.GetByID(context.TODO(), dbRedditVideo.VrddtVideoID)
+		dbVrddtVideo, vrddtErr := redditVideoRetriever.GetByID(ctx, dbRedditVideo.VrddtVideoID)
 		if vrddtErr != nil {
 			switch errors.Type(err) {
 			case errors.TypeResourceNotFound:
@@ -147,7 +149,7 @@ func processWithInternalServices(cliContext *cli.Context) (err error) {
 	time.Sleep(time.Millisecond * 100)
 
 	// Push a message on to the queue
-	err = redditVideoConstructor.Push(context.TODO(), redditVideo)
+	err = redditVideoConstructor.Push(ctx, redditVideo)
 	if err != nil {
 		return
 	}
@@ -162,7 +164,7 @@ func processWithInternalServices(cliContext *cli.Context) (err error) {
 			return errors.ConnectionTimeout("vrddt Video Processor", timeoutTime)
 		case <-tick:
 			// If the Reddit URL is not found in the database yet keep checking
-			temporaryRedditVideo, err := redditVideoRetriever.GetByURL(context.TODO(), redditVideo.URL)
+			temporaryRedditVideo, err := redditVideoRetriever.GetByURL(ctx, redditVideo.URL, redditVideo.Quality, redditVideo.Format, redditVideo.Clip)
 			if err != nil {
 				switch errors.Type(err) {
 				case errors.TypeResourceNotFound:
@@ -173,7 +175,7 @@ func processWithInternalServices(cliContext *cli.Context) (err error) {
 					return err
 				}
 			} else {
-				vrddtVideo, errVrddt := vrddtVideoRetriever.GetByID(context.TODO(), temporaryRedditVideo.VrddtVideoID)
+				vrddtVideo, errVrddt := vrddtVideoRetriever.GetByID(ctx, temporaryRedditVideo.VrddtVideoID)
 				if errVrddt != nil {
 					switch errors.Type(err) {
 					case errors.TypeResourceNotFound:
@@ -9,6 +9,7 @@ import (
 
 	"github.com/johnwyles/vrddt-droplets/domain"
 	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
 )
 
 // DownloadLocally will process a Reddit URL using only local resources (i.e. http download and ffmpeg for conversion)
@@ -30,6 +31,38 @@ func DownloadLocally(cfg *config.Config) *cli.Command {
 				Usage:   "Specifies the output file where the final processed video will reside",
 				Value:   "vrddt-output.mp4",
 			},
+			&cli.StringFlag{
+				Aliases: []string{"q"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_LOCALLY_QUALITY"},
+				Name:    "quality",
+				Usage:   "Specifies the quality to download (best, worst, or a maximum height such as 720p)",
+				Value:   domain.QualityBest.String(),
+			},
+			&cli.StringFlag{
+				Aliases: []string{"f"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_LOCALLY_FORMAT"},
+				Name:    "format",
+				Usage:   "Specifies the format to download (mp4, webm, gif, mp3 or m4a)",
+				Value:   domain.FormatMP4.String(),
+			},
+			&cli.StringFlag{
+				Aliases: []string{"s"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_LOCALLY_START"},
+				Name:    "start",
+				Usage:   "Specifies where the clip to download starts (in seconds, a duration such as 1m30s, or a time such as 01:30)",
+			},
+			&cli.StringFlag{
+				Aliases: []string{"e"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_LOCALLY_END"},
+				Name:    "end",
+				Usage:   "Specifies where the clip to download ends (in seconds, a duration such as 1m30s, or a time such as 01:30)",
+			},
+			&cli.StringFlag{
+				Aliases: []string{"d"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_LOCALLY_DURATION"},
+				Name:    "duration",
+				Usage:   "Specifies how long the clip to download is instead of where it ends",
+			},
 		},
 		Name:  "download-locally",
 		Usage: "Download a Reddit video from a given Reddit URL using only local resouces (i.e. http download and ffmpeg for conversion)",
@@ -54,6 +87,27 @@ func beforeDownloadLocally(cliContext *cli.Context) (err error) {
 		return
 	}
 
+	if _, err = domain.ParseQuality(cliContext.String("quality")); err != nil {
+		loggerHandle.Fatalf("You did not supply a valid quality: %s", err)
+		os.Exit(1)
+
+		return
+	}
+
+	if _, err = domain.ParseFormat(cliContext.String("format")); err != nil {
+		loggerHandle.Fatalf("You did not supply a valid format: %s", err)
+		os.Exit(1)
+
+		return
+	}
+
+	if _, err = domain.ParseClip(cliContext.String("start"), cliContext.String("end"), cliContext.String("duration")); err != nil {
+		loggerHandle.Fatalf("You did not supply a valid clip: %s", err)
+		os.Exit(1)
+
+		return
+	}
+
 	if !cliContext.IsSet("output-file") {
 		cli.ShowCommandHelp(cliContext, cliContext.Command.Name)
 		loggerHandle.Fatalf("You have not specified an output file path")
@@ -78,19 +132,43 @@ func beforeDownloadLocally(cliContext *cli.Context) (err error) {
 func downloadLocally(cliContext *cli.Context) (err error) {
 	outputFile := cliContext.String("output-file")
 
+	ctx := context.TODO()
+
 	// Setup a new Reddit video with all the video information
 	redditVideo := domain.NewRedditVideo()
 	redditVideo.URL = cliContext.String("reddit-url")
-	err = redditVideo.SetFinalURL()
+	err = redditVideo.SetFinalURL(ctx)
+	if err != nil {
+		return
+	}
+
+	redditVideo.Quality, err = domain.ParseQuality(cliContext.String("quality"))
+	if err != nil {
+		return
+	}
+
+	redditVideo.Format, err = domain.ParseFormat(cliContext.String("format"))
 	if err != nil {
 		return
 	}
 
-	loggerHandle.Infof("Getting video for Reddit URL: %s", redditVideo.URL)
+	redditVideo.Clip, err = domain.ParseClip(cliContext.String("start"), cliContext.String("end"), cliContext.String("duration"))
+	if err != nil {
+		return
+	}
+
+	options, err := converter.FormatOptions(redditVideo.Format.String())
+	if err != nil {
+		return
+	}
+	options.MaxDuration = redditVideo.Clip.Duration()
+	options.Start = redditVideo.Clip.Start()
+
+	loggerHandle.Infof("Getting video in %s quality as %s for Reddit URL: %s", redditVideo.Quality, redditVideo.Format, redditVideo.URL)
 
 	// We only really need this because we want to check that the URL contains
 	// valid JSON and is a video link and not just any other Reddit URL
-	err = redditVideo.SetMetadata()
+	err = redditVideo.SetMetadata(ctx)
 	if err != nil {
 		return
 	}
@@ -118,12 +196,12 @@ func downloadLocally(cliContext *cli.Context) (err error) {
 
 	loggerHandle.Infof("Converting media for Reddit URL: %s", redditVideo.URL)
 
-	ctx := context.TODO()
 	if err = services.Converter.Convert(
 		ctx,
 		redditVideo.FilePath,
 		redditVideo.RedditAudio.FilePath,
 		outputFile,
+		options,
 	); err != nil {
 		return
 	}
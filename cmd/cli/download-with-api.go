@@ -1,15 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	cli "gopkg.in/urfave/cli.v2"
 
 	"github.com/johnwyles/vrddt-droplets/domain"
 	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 )
 
 // DownloadWithAPI will process a Reddit URL with the vrddt API and download the
@@ -36,9 +40,41 @@ func DownloadWithAPI(cfg *config.Config) *cli.Command {
 				Aliases: []string{"p"},
 				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_WITH_API_POLL"},
 				Name:    "poll",
-				Usage:   "Specifies the amount of time (in milliseconds: 10 to 5000) to wait between polling the database for process completion",
+				Usage:   "Specifies the amount of time (in milliseconds: 10 to 5000) to wait between polling the job for completion",
 				Value:   500,
 			},
+			&cli.StringFlag{
+				Aliases: []string{"q"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_WITH_API_QUALITY"},
+				Name:    "quality",
+				Usage:   "Specifies the quality to download (best, worst, or a maximum height such as 720p)",
+				Value:   domain.QualityBest.String(),
+			},
+			&cli.StringFlag{
+				Aliases: []string{"f"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_WITH_API_FORMAT"},
+				Name:    "format",
+				Usage:   "Specifies the format to download (mp4, webm, gif, mp3 or m4a)",
+				Value:   domain.FormatMP4.String(),
+			},
+			&cli.StringFlag{
+				Aliases: []string{"s"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_WITH_API_START"},
+				Name:    "start",
+				Usage:   "Specifies where the clip to download starts (in seconds, a duration such as 1m30s, or a time such as 01:30)",
+			},
+			&cli.StringFlag{
+				Aliases: []string{"e"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_WITH_API_END"},
+				Name:    "end",
+				Usage:   "Specifies where the clip to download ends (in seconds, a duration such as 1m30s, or a time such as 01:30)",
+			},
+			&cli.StringFlag{
+				Aliases: []string{"d"},
+				EnvVars: []string{"VRDDT_CLI_DOWNLOAD_WITH_API_DURATION"},
+				Name:    "duration",
+				Usage:   "Specifies how long the clip to download is instead of where it ends",
+			},
 		},
 		Name:  "download-with-api",
 		Usage: "Download a Reddit video from a given Reddit URL using the vrddt API service",
@@ -60,34 +96,111 @@ func beforeDownloadWithAPI(cliContext *cli.Context) (err error) {
 	return
 }
 
-// downloadWithAPI will process a Reddit URL using the vrddt API and download the
-// resulting video locally
+// downloadWithAPI will process a Reddit URL using the vrddt API by creating a
+// job and polling it until it is finished
 func downloadWithAPI(cliContext *cli.Context) (err error) {
-	apiURL := cliContext.String("CLI.APIURI") + "/reddit_videos/"
-	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	poll := cliContext.Int("poll")
+	if poll < 10 {
+		poll = 10
+	} else if poll > 5000 {
+		poll = 5000
+	}
+
+	timeout := cliContext.Int("timeout")
+	if timeout < 1 {
+		timeout = 1
+	} else if timeout > 600 {
+		timeout = 600
+	}
+
+	client := &http.Client{
+		Timeout: time.Duration(timeout) * time.Second,
+	}
+	apiURL := cliContext.String("CLI.APIURI") + "/jobs"
+
+	body, err := json.Marshal(map[string]string{
+		"duration": cliContext.String("duration"),
+		"end":      cliContext.String("end"),
+		"format":   cliContext.String("format"),
+		"quality":  cliContext.String("quality"),
+		"start":    cliContext.String("start"),
+		"url":      cliContext.String("reddit-url"),
+	})
 	if err != nil {
-		loggerHandle.Fatalf("NewRequest: %s", err)
+		return
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	job := &apiJob{}
+	if err = doAPIRequest(client, http.MethodPost, apiURL, bytes.NewReader(body), http.StatusAccepted, job); err != nil {
+		return
+	}
+	loggerHandle.Infof("Job '%s' is %s", job.ID.Hex(), job.Status)
+
+	deadline := time.After(time.Duration(timeout) * time.Second)
+	tick := time.NewTicker(time.Duration(poll) * time.Millisecond)
+	defer tick.Stop()
 
-	q := req.URL.Query()
-	q.Add("url", cliContext.String("reddit-url"))
-	req.URL.RawQuery = q.Encode()
+	for !job.Finished() {
+		select {
+		case <-deadline:
+			return errors.ConnectionTimeout("api", timeout)
+		case <-tick.C:
+		}
+
+		status := job.Status
+		if err = doAPIRequest(client, http.MethodGet, apiURL+"/"+job.ID.Hex(), nil, http.StatusOK, job); err != nil {
+			return
+		}
+		if job.Status != status {
+			loggerHandle.Infof("Job '%s' is %s", job.ID.Hex(), job.Status)
+		}
+	}
+
+	if job.Status == domain.JobStatusFailed {
+		return fmt.Errorf("Job '%s' failed: %s", job.ID.Hex(), job.Error)
+	}
+
+	if len(job.VrddtVideos) == 0 {
+		loggerHandle.Infof("vrddt video URL: %s", job.VrddtVideo.URL)
+	}
+	for item, vrddtVideo := range job.VrddtVideos {
+		loggerHandle.Infof("vrddt video URL for item %d: %s", item, vrddtVideo.URL)
+	}
+
+	return
+}
+
+// apiJob is a job as it is returned by the vrddt API
+type apiJob struct {
+	domain.Job
+
+	VrddtVideo  *domain.VrddtVideo   `json:"vrddt_video,omitempty"`
+	VrddtVideos []*domain.VrddtVideo `json:"vrddt_videos,omitempty"`
+}
+
+// doAPIRequest will make a JSON request to the vrddt API and decode the
+// response in to v if it has the expected status
+func doAPIRequest(client *http.Client, method string, apiURL string, body io.Reader, expectedStatus int, v interface{}) (err error) {
+	req, err := http.NewRequest(method, apiURL, body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		loggerHandle.Fatalf("Do: %s", err)
+		return
 	}
 	defer resp.Body.Close()
 
-	vrddtVideo := domain.NewVrddtVideo()
-	if err = json.NewDecoder(resp.Body).Decode(&vrddtVideo); err != nil {
-		loggerHandle.Fatalf("An error was encountered: %s", err)
-		return
+	if resp.StatusCode != expectedStatus {
+		apiErr := &errors.Error{}
+		if decodeErr := json.NewDecoder(resp.Body).Decode(apiErr); decodeErr != nil || apiErr.Message == "" {
+			return fmt.Errorf("Unexpected response from %s %s: %s", method, apiURL, resp.Status)
+		}
+
+		return apiErr
 	}
 
-	loggerHandle.Infof("vrddt video URL: %s", vrddtVideo.URL)
-	return
+	return json.NewDecoder(resp.Body).Decode(v)
 }
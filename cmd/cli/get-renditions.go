@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	cli "gopkg.in/urfave/cli.v2"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+)
+
+// GetRenditions will list the video representations and audio tracks a Reddit
+// URL is available as and which of them would be picked for a quality
+func GetRenditions(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Action: getRenditions,
+		Before: beforeGetRenditions,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Aliases: []string{"r"},
+				EnvVars: []string{"VRDDT_CLI_GET_RENDITIONS_REDDIT_URL"},
+				Name:    "reddit-url",
+				Usage:   "Specifies the Reddit URL to list the renditions of",
+			},
+			&cli.StringFlag{
+				Aliases: []string{"q"},
+				EnvVars: []string{"VRDDT_CLI_GET_RENDITIONS_QUALITY"},
+				Name:    "quality",
+				Usage:   "Specifies the quality to pick renditions for (best, worst, or a maximum height such as 720p)",
+				Value:   domain.QualityBest.String(),
+			},
+		},
+		Name:  "get-renditions",
+		Usage: "List the renditions a Reddit video is available in and which of them would be downloaded",
+	}
+}
+
+// beforeGetRenditions will validate that we have set a Reddit URL
+func beforeGetRenditions(cliContext *cli.Context) (err error) {
+	if !cliContext.IsSet("reddit-url") {
+		cli.ShowCommandHelp(cliContext, cliContext.Command.Name)
+		loggerHandle.Fatalf("A Reddit URL was not given")
+		os.Exit(1)
+
+		return
+	}
+
+	_, err = url.ParseRequestURI(cliContext.String("reddit-url"))
+	if err != nil {
+		loggerHandle.Fatalf("You did not supply a valid Reddit URL: %s", cliContext.String("reddit-url"))
+		os.Exit(1)
+	}
+
+	return
+}
+
+// getRenditions will resolve the media items for a Reddit URL and print the
+// renditions of each marking the ones picked for the quality
+func getRenditions(cliContext *cli.Context) (err error) {
+	quality, err := domain.ParseQuality(cliContext.String("quality"))
+	if err != nil {
+		return
+	}
+
+	source, err := domain.SourceFor(cliContext.String("reddit-url"))
+	if err != nil {
+		return
+	}
+
+	ctx := context.TODO()
+	finalURL, err := source.FinalURL(ctx, cliContext.String("reddit-url"))
+	if err != nil {
+		return
+	}
+
+	items, err := source.Resolve(ctx, finalURL, quality)
+	if err != nil {
+		return
+	}
+
+	fmt.Printf("%s\n%s\n", items[0].Title, items[0].URL)
+	for _, media := range items {
+		if len(items) > 1 {
+			fmt.Printf("\n== Item %d of %d ==\n", media.Item+1, len(items))
+		}
+		printRenditions(media, quality)
+	}
+
+	return
+}
+
+// printRenditions prints the renditions of a media item marking the ones
+// picked for the quality
+func printRenditions(media *domain.SourceMedia, quality domain.Quality) {
+	if media.Manifest == nil {
+		fmt.Printf("\nNo manifest was found so only one rendition is available:\n")
+		fmt.Printf("* video %s\n", media.VideoURL)
+		if media.AudioURL != "" {
+			fmt.Printf("* audio %s\n", media.AudioURL)
+		}
+
+		return
+	}
+
+	fmt.Printf("\nVideo (* picked for %s):\n", quality)
+	for _, video := range media.Manifest.Video {
+		fmt.Printf("%s %5dx%-5d %8d bps  %s\n", pickedMarker(video.URL, media.VideoURL), video.Width, video.Height, video.Bandwidth, video.URL)
+	}
+
+	fmt.Printf("\nAudio (* picked for %s):\n", quality)
+	for _, audio := range media.Manifest.Audio {
+		fmt.Printf("%s %8d bps  %s\n", pickedMarker(audio.URL, media.AudioURL), audio.Bandwidth, audio.URL)
+	}
+}
+
+// pickedMarker returns a "*" for the rendition which was picked
+func pickedMarker(renditionURL string, pickedURL string) string {
+	if renditionURL == pickedURL {
+		return "*"
+	}
+
+	return " "
+}
@@ -50,6 +50,7 @@ func main() {
 			FFmpeg: config.ConverterFFmpegConfig{
 				Path: "/usr/local/bin/ffmpeg",
 			},
+			Type: config.ConverterFFmpeg,
 		},
 		Log: config.LogConfig{
 			Format: "text",
@@ -76,6 +77,15 @@ func main() {
 				Value:       cfg.CLI.APIURI,
 			},
 		),
+		altsrc.NewStringFlag(
+			&cli.StringFlag{
+				Destination: (*string)(&cfg.Converter.Type),
+				EnvVars:     []string{"VRDDT_CONVERTER_TYPE"},
+				Name:        "Converter.Type",
+				Usage:       "Converter for Reddit media (ffmpeg, or mp4 to mux without FFmpeg when possible)",
+				Value:       cfg.Converter.Type.String(),
+			},
+		),
 		altsrc.NewStringFlag(
 			&cli.StringFlag{
 				Aliases:     []string{"lf"},
@@ -159,6 +169,7 @@ func allCommands(cfg *config.Config) []*cli.Command {
 	return []*cli.Command{
 		DownloadWithAPI(cfg),
 		DownloadLocally(cfg),
+		GetRenditions(cfg),
 		// GetMetadata(cfg),
 	}
 }
@@ -184,7 +195,7 @@ func prepareResources(cfg *config.Config) cli.PrepareFunc {
 		}
 
 		// Setup converter
-		services.Converter, err = converter.FFmpeg(&cfg.Converter.FFmpeg, loggerHandle)
+		services.Converter, err = converter.New(&cfg.Converter, loggerHandle)
 		if err != nil {
 			return
 		}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+	cli "gopkg.in/urfave/cli.v2"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/interfaces/pubsub"
+	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
+	"github.com/johnwyles/vrddt-droplets/interfaces/rest"
+	"github.com/johnwyles/vrddt-droplets/interfaces/storage"
+	"github.com/johnwyles/vrddt-droplets/interfaces/store"
+	"github.com/johnwyles/vrddt-droplets/interfaces/web"
+	"github.com/johnwyles/vrddt-droplets/interfaces/worker"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/graceful"
+	"github.com/johnwyles/vrddt-droplets/pkg/middlewares"
+	"github.com/johnwyles/vrddt-droplets/usecases/jobs"
+	"github.com/johnwyles/vrddt-droplets/usecases/redditvideos"
+	"github.com/johnwyles/vrddt-droplets/usecases/vrddtvideos"
+)
+
+// Services holds all of the services shared by everything being served
+type Services struct {
+	Converter converter.Converter
+	PubSub    pubsub.PubSub
+	Queue     queue.Queue
+	Storage   storage.Storage
+	Store     store.Store
+	Workers   []worker.Worker
+}
+
+// serving is what has been asked to be served
+type serving struct {
+	api    bool
+	web    bool
+	worker bool
+}
+
+var (
+	// services are the services shared by everything being served
+	services = &Services{}
+)
+
+// Serve will run the REST API, the worker processor pool, and the web UI (or
+// any of them) in this one process sharing the queue, store, storage, and
+// pub/sub between them
+func Serve(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Action: serve(cfg),
+		After:  afterServe(cfg),
+		Before: beforeServe(cfg),
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Aliases: []string{"a"},
+				EnvVars: []string{"VRDDT_SERVE_ALL"},
+				Name:    "all",
+				Usage:   "Serve the REST API, the worker processor pool, and the web UI",
+			},
+			&cli.BoolFlag{
+				EnvVars: []string{"VRDDT_SERVE_API"},
+				Name:    "api",
+				Usage:   "Serve the REST API",
+			},
+			&cli.BoolFlag{
+				EnvVars: []string{"VRDDT_SERVE_WEB"},
+				Name:    "web",
+				Usage:   "Serve the web UI",
+			},
+			&cli.BoolFlag{
+				EnvVars: []string{"VRDDT_SERVE_WORKER"},
+				Name:    "worker",
+				Usage:   "Run the worker processor pool",
+			},
+		},
+		Name:  "serve",
+		Usage: "Serve the REST API, the worker processor pool, and the web UI in a single process (in-memory queue and store with local storage by default)",
+	}
+}
+
+// afterServe will execute after Action() to cleanup
+func afterServe(cfg *config.Config) cli.AfterFunc {
+	return func(cliContext *cli.Context) (err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// We don't care about any cleanup errors
+		if services.PubSub != nil {
+			services.PubSub.Cleanup(ctx)
+		}
+		if services.Queue != nil {
+			services.Queue.Cleanup(ctx)
+		}
+		if services.Storage != nil {
+			services.Storage.Cleanup(ctx)
+		}
+		if services.Store != nil {
+			services.Store.Cleanup(ctx)
+		}
+
+		return
+	}
+}
+
+// beforeServe will setup and initialize the services needed by what has been
+// asked to be served
+func beforeServe(cfg *config.Config) cli.BeforeFunc {
+	return func(cliContext *cli.Context) (err error) {
+		ctx := context.Background()
+
+		what := servingFrom(cliContext)
+		if !what.api && !what.web && !what.worker {
+			cli.ShowCommandHelp(cliContext, cliContext.Command.Name)
+			return errors.MissingField("all")
+		}
+
+		// The web UI only talks to the API over HTTP so it needs nothing else
+		if !what.api && !what.worker {
+			return
+		}
+
+		if what.worker {
+			if cfg.Worker.Processor.Concurrency < 1 {
+				return errors.InvalidValue("Worker.Processor.Concurrency", "Must process at least one video at a time")
+			}
+
+			// The queue should never hand us more messages than we have
+			// workers to process them
+			cfg.Queue.RabbitMQ.Prefetch = cfg.Worker.Processor.Concurrency
+
+			if services.Converter, err = converter.New(&cfg.Converter, loggerHandle); err != nil {
+				return
+			}
+			if services.Storage, err = storage.New(&cfg.Storage, loggerHandle); err != nil {
+				return
+			}
+		}
+
+		if services.PubSub, err = pubsub.New(&cfg.PubSub, loggerHandle); err != nil {
+			return
+		}
+		if services.Queue, err = queue.New(&cfg.Queue, loggerHandle); err != nil {
+			return
+		}
+		if services.Store, err = store.New(&cfg.Store, loggerHandle); err != nil {
+			return
+		}
+
+		if what.worker {
+			// Each worker holds the work it is processing so every goroutine
+			// in the pool gets its own
+			services.Workers = make([]worker.Worker, cfg.Worker.Processor.Concurrency)
+			for i := range services.Workers {
+				services.Workers[i], err = worker.Processor(
+					&cfg.Worker.Processor,
+					loggerHandle,
+					services.Converter,
+					services.PubSub,
+					services.Queue,
+					services.Store,
+					services.Storage,
+				)
+				if err != nil {
+					return
+				}
+			}
+
+			if err = services.Converter.Init(ctx); err != nil {
+				return
+			}
+			if err = services.Storage.Init(ctx); err != nil {
+				return
+			}
+		}
+
+		if err = services.PubSub.Init(ctx); err != nil {
+			return
+		}
+		if err = services.Queue.Init(ctx); err != nil {
+			return
+		}
+		if err = services.Store.Init(ctx); err != nil {
+			return
+		}
+
+		for _, w := range services.Workers {
+			if err = w.Init(ctx); err != nil {
+				return
+			}
+		}
+
+		return
+	}
+}
+
+// serve will run everything which has been asked to be served until a SIGINT
+// or SIGTERM is received or one of them stops on its own. Work the workers
+// have already started is given the grace timeout to finish once the
+// servers have stopped.
+func serve(cfg *config.Config) cli.ActionFunc {
+	return func(cliContext *cli.Context) (err error) {
+		what := servingFrom(cliContext)
+
+		// Cancelling pool stops the workers from asking for more work
+		pool, stopPool := context.WithCancel(context.Background())
+		defer stopPool()
+
+		// Cancelling jobs abandons the work which has already started
+		jobs, stopJobs := context.WithCancel(context.Background())
+		defer stopJobs()
+
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signals)
+
+		go func() {
+			select {
+			case sig := <-signals:
+				loggerHandle.Warnf("Received %s, shutting down", sig)
+				stopPool()
+			case <-pool.Done():
+				return
+			}
+
+			select {
+			case sig := <-signals:
+				loggerHandle.Warnf("Received %s again, not waiting for work to finish", sig)
+				stopJobs()
+			case <-jobs.Done():
+			}
+		}()
+
+		srv, listen, err := newServer(cfg, what)
+		if err != nil {
+			return
+		}
+
+		workersStopped := make(chan struct{})
+		if what.worker {
+			workers := worker.NewPool(&cfg.Worker.Processor, loggerHandle, services.Workers)
+			go func() {
+				defer close(workersStopped)
+
+				workers.Run(pool, jobs)
+
+				successes, failures := workers.Counts()
+				loggerHandle.Infof("Processor stopped after %d successes and %d errors", successes, failures)
+
+				// There is no point serving requests nothing will process
+				if srv != nil {
+					srv.Stop()
+				}
+			}()
+		} else {
+			close(workersStopped)
+		}
+
+		if srv != nil {
+			if err = listen(); err != nil {
+				loggerHandle.Errorf("Server exited: %s", err)
+			}
+			stopPool()
+		}
+
+		<-workersStopped
+
+		return
+	}
+}
+
+// newServer returns a server for the API and web UI (whichever of them is
+// being served) along with the function to start it. The server is nil if
+// neither of them is being served.
+func newServer(cfg *config.Config, what serving) (srv *graceful.Server, listen func() error, err error) {
+	if !what.api && !what.web {
+		return
+	}
+
+	var webHandler http.Handler
+	if what.web {
+		webController, err := web.New(
+			loggerHandle,
+			cfg.Web.VrddtAPIURI,
+			cfg.Web.TemplateDir,
+			cfg.Web.StaticDir,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		webHandler = middlewares.WithRequestLogging(loggerHandle, webController.Router)
+		webHandler = middlewares.WithRecovery(loggerHandle, webHandler)
+	}
+
+	// The API is the main listener when it is served and the web UI listens
+	// alongside it
+	if !what.api {
+		srv = graceful.NewServer(webHandler, time.Duration(cfg.Web.GracefulTimeout)*time.Second, os.Interrupt, syscall.SIGTERM)
+		srv.Addr = cfg.Web.Address
+		srv.Log = loggerHandle.Errorf
+		serveAlso(srv, "Web", cfg.Web.HTTPAddress, "", "", nil)
+
+		loggerHandle.Infof("Web server is listening as: %s", cfg.Web.Address)
+
+		return srv, listenAndServe(srv, cfg.Web.CertFile, cfg.Web.KeyFile), nil
+	}
+
+	srv = graceful.NewServer(newAPIHandler(cfg), time.Duration(cfg.API.GracefulTimeout)*time.Second, os.Interrupt, syscall.SIGTERM)
+	srv.Addr = cfg.API.Address
+	srv.Log = loggerHandle.Errorf
+	serveAlso(srv, "API", cfg.API.HTTPAddress, "", "", nil)
+
+	if what.web {
+		serveAlso(srv, "Web", cfg.Web.Address, cfg.Web.CertFile, cfg.Web.KeyFile, webHandler)
+		serveAlso(srv, "Web", cfg.Web.HTTPAddress, "", "", webHandler)
+	}
+
+	loggerHandle.Infof("API server is listening as: %s", cfg.API.Address)
+
+	return srv, listenAndServe(srv, cfg.API.CertFile, cfg.API.KeyFile), nil
+}
+
+// newAPIHandler returns the REST API using the shared services which also
+// serves the vrddt videos when they are stored locally
+func newAPIHandler(cfg *config.Config) http.Handler {
+	router := mux.NewRouter()
+
+	// Setup router with default handlers
+	router.NotFoundHandler = http.HandlerFunc(rest.NotFoundHandler)
+	router.MethodNotAllowedHandler = http.HandlerFunc(rest.MethodNotAllowedHandler)
+
+	// Setup API endpoints for jobs
+	jc := jobs.NewConstructor(loggerHandle, services.Queue, services.Store)
+	jr := jobs.NewRetriever(loggerHandle, services.Store)
+	rest.AddJobsAPI(loggerHandle, router, jc, jr)
+
+	// Setup API endpoints for Reddit videos
+	rvc := redditvideos.NewConstructor(loggerHandle, services.Queue, services.Store)
+	rvd := redditvideos.NewDestructor(loggerHandle, services.Queue, services.Store)
+	rvr := redditvideos.NewRetriever(loggerHandle, services.Store)
+	rest.AddRedditVideosAPI(loggerHandle, router, rvc, rvd, rvr, services.PubSub, jc)
+
+	// Setup API endpoints for vrddt videos
+	vvc := vrddtvideos.NewConstructor(loggerHandle, services.Store)
+	vvd := vrddtvideos.NewDestructor(loggerHandle, services.Store)
+	vvr := vrddtvideos.NewRetriever(loggerHandle, services.Store)
+	rest.AddVrddtVideosAPI(loggerHandle, router, vvc, vvd, vvr, rvr, jc)
+
+	// Local storage has nothing else serving the vrddt videos in it so they
+	// are served from under the path of the base URL
+	if cfg.Storage.Type == config.StorageConfigLocal && cfg.Storage.Local.BaseURL != "" {
+		if err := addMedia(router, cfg.Storage.Local.BaseURL, cfg.Storage.Local.Path); err != nil {
+			loggerHandle.Warnf("Not serving locally stored vrddt videos: %s", err)
+		}
+	}
+
+	// Setup API middleware
+	handler := middlewares.WithRequestLogging(loggerHandle, router)
+	handler = middlewares.WithRecovery(loggerHandle, handler)
+	co := cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST"},
+	})
+
+	return co.Handler(handler)
+}
+
+// addMedia will serve the files (but not the directory listings) in the
+// local storage path from under the path of its base URL
+func addMedia(router *mux.Router, baseURL string, path string) (err error) {
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return errors.InvalidValue("Storage.Local.BaseURL", err.Error())
+	}
+
+	prefix := strings.TrimSuffix(parsedURL.Path, "/") + "/"
+	if prefix == "/" {
+		return errors.InvalidValue("Storage.Local.BaseURL", "Must have a path for the vrddt videos to be served from")
+	}
+
+	files := http.StripPrefix(prefix, http.FileServer(http.Dir(path)))
+	router.PathPrefix(prefix).Methods(http.MethodGet, http.MethodHead).Handler(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/") {
+			rest.NotFoundHandler(wr, req)
+			return
+		}
+
+		files.ServeHTTP(wr, req)
+	}))
+
+	loggerHandle.Infof("Serving locally stored vrddt videos from '%s' as: %s", path, baseURL)
+
+	return
+}
+
+// listenAndServe returns the function which starts the server serving HTTPS
+// if there is a certificate or plain HTTP otherwise
+func listenAndServe(srv *graceful.Server, certFile string, keyFile string) func() error {
+	if certFile == "" {
+		return srv.ListenAndServe
+	}
+
+	return func() error {
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	}
+}
+
+// serveAlso will have the server listen on an additional address (if there
+// is one) serving HTTPS if there is a certificate or plain HTTP otherwise
+func serveAlso(srv *graceful.Server, name string, address string, certFile string, keyFile string, handler http.Handler) {
+	if address == "" {
+		return
+	}
+
+	if certFile == "" {
+		srv.Listen(address, handler)
+		loggerHandle.Infof("%s server is also listening for plain HTTP as: %s", name, address)
+		return
+	}
+
+	srv.ListenTLS(address, handler, certFile, keyFile)
+	loggerHandle.Infof("%s server is also listening as: %s", name, address)
+}
+
+// servingFrom returns what has been asked to be served
+func servingFrom(cliContext *cli.Context) serving {
+	all := cliContext.Bool("all")
+
+	return serving{
+		api:    all || cliContext.Bool("api"),
+		web:    all || cliContext.Bool("web"),
+		worker: all || cliContext.Bool("worker"),
+	}
+}
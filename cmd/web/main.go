@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"syscall"
 	"time"
 
 	cli "gopkg.in/urfave/cli.v2"
@@ -110,6 +111,15 @@ func main() {
 				Value:       cfg.Web.GracefulTimeout,
 			},
 		),
+		altsrc.NewStringFlag(
+			&cli.StringFlag{
+				Destination: &cfg.Web.HTTPAddress,
+				EnvVars:     []string{"VRDDT_WEB_HTTP_ADDRESS"},
+				Name:        "Web.HTTPAddress",
+				Usage:       "Web address to also serve plain HTTP on (e.g. for an internal load balancer)",
+				Value:       cfg.Web.HTTPAddress,
+			},
+		),
 		altsrc.NewStringFlag(
 			&cli.StringFlag{
 				Aliases:     []string{"k"},
@@ -253,9 +263,13 @@ func rootAction(cfg *config.Config) cli.ActionFunc {
 		handler := middlewares.WithRequestLogging(loggerHandle, webController.Router)
 		handler = middlewares.WithRecovery(loggerHandle, handler)
 
-		srv := graceful.NewServer(handler, time.Duration(cfg.Web.GracefulTimeout)*time.Second, os.Interrupt)
+		srv := graceful.NewServer(handler, time.Duration(cfg.Web.GracefulTimeout)*time.Second, os.Interrupt, syscall.SIGTERM)
 		srv.Log = loggerHandle.Errorf
 		srv.Addr = cfg.Web.Address
+		if cfg.Web.HTTPAddress != "" {
+			srv.Listen(cfg.Web.HTTPAddress, nil)
+			loggerHandle.Infof("Web server is also listening for plain HTTP as: %s", cfg.Web.HTTPAddress)
+		}
 
 		loggerHandle.Infof("Web server is listening as: %s", cfg.Web.Address)
 		if err := srv.ListenAndServeTLS(cfg.Web.CertFile, cfg.Web.KeyFile); err != nil {
@@ -2,34 +2,46 @@ package main
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	cli "gopkg.in/urfave/cli.v2"
 
-	"github.com/johnwyles/vrddt-droplets/domain"
 	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
+	"github.com/johnwyles/vrddt-droplets/interfaces/worker"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 )
 
 // Processor will process a Reddit URL into a vrddt video using our internal
 // services
 func Processor(cfg *config.Config) *cli.Command {
 	return &cli.Command{
-		Action: processor,
+		Action: processor(cfg),
 		After:  afterProcessor(cfg),
 		Before: beforeProcessor(cfg),
 		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Aliases: []string{"n"},
+				EnvVars: []string{"VRDDT_WORKER_CONVERTER_CONCURRENCY"},
+				Name:    "concurrency",
+				Usage:   "Number of videos to process at once (overrides Worker.Processor.Concurrency)",
+				Value:   1,
+			},
 			&cli.IntFlag{
 				Aliases: []string{"e"},
 				EnvVars: []string{"VRDDT_WORKER_CONVERTER_MAX_ERRORS"},
 				Name:    "max-errors",
-				Usage:   "Maximum number of errors to encounter before exitings process",
+				Usage:   "Maximum number of errors to encounter before exitings process (overrides Worker.Processor.MaxErrors)",
 				Value:   10,
 			},
 			&cli.IntFlag{
 				Aliases: []string{"s"},
 				EnvVars: []string{"VRDDT_WORKER_CONVERTER_SLEEP"},
 				Name:    "sleep",
-				Usage:   "Amount of time to sleep (in milliseconds) between requests",
+				Usage:   "Amount of time to sleep (in milliseconds) after an error before asking for more work (overrides Worker.Processor.Sleep)",
 				Value:   5090,
 			},
 		},
@@ -41,11 +53,14 @@ func Processor(cfg *config.Config) *cli.Command {
 // afterProcessor will execute after Action() to cleanup
 func afterProcessor(cfg *config.Config) cli.AfterFunc {
 	return func(cliContext *cli.Context) (err error) {
-		// TODO: Context
-		ctx := context.TODO()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
 
 		// We don't care about any cleanup errors
-		services.Queue.Cleanup(ctx)
+		if services.Queue != nil {
+			services.Queue.Cleanup(ctx)
+		}
+		services.PubSub.Cleanup(ctx)
 		services.Store.Cleanup(ctx)
 		services.Storage.Cleanup(ctx)
 
@@ -56,14 +71,51 @@ func afterProcessor(cfg *config.Config) cli.AfterFunc {
 // beforeConverter will validate before the command is run
 func beforeProcessor(cfg *config.Config) cli.BeforeFunc {
 	return func(cliContext *cli.Context) (err error) {
-		// TODO: Context
-		ctx := context.TODO()
+		ctx := context.Background()
+
+		if cliContext.IsSet("concurrency") {
+			cfg.Worker.Processor.Concurrency = cliContext.Int("concurrency")
+		}
+		if cfg.Worker.Processor.Concurrency < 1 {
+			return errors.InvalidValue("concurrency", "Must process at least one video at a time")
+		}
+
+		// Setup the queue so that it never hands us more messages than we
+		// have workers to process them
+		cfg.Queue.RabbitMQ.Prefetch = cfg.Worker.Processor.Concurrency
+		services.Queue, err = queue.New(&cfg.Queue, loggerHandle)
+		if err != nil {
+			return
+		}
+
+		// Each worker holds the work it is processing so every goroutine in
+		// the pool gets its own
+		services.Workers = make([]worker.Worker, cfg.Worker.Processor.Concurrency)
+		for i := range services.Workers {
+			services.Workers[i], err = worker.Processor(
+				&cfg.Worker.Processor,
+				loggerHandle,
+				services.Converter,
+				services.PubSub,
+				services.Queue,
+				services.Store,
+				services.Storage,
+			)
+			if err != nil {
+				return
+			}
+		}
 
 		// Initialize the converter
 		if err = services.Converter.Init(ctx); err != nil {
 			return
 		}
 
+		// Initialize the pub/sub
+		if err = services.PubSub.Init(ctx); err != nil {
+			return
+		}
+
 		// Initialize the queue
 		if err = services.Queue.Init(ctx); err != nil {
 			return
@@ -79,9 +131,11 @@ func beforeProcessor(cfg *config.Config) cli.BeforeFunc {
 			return
 		}
 
-		// Initialize the worker
-		if err = services.Worker.Init(ctx); err != nil {
-			return
+		// Initialize the workers
+		for _, w := range services.Workers {
+			if err = w.Init(ctx); err != nil {
+				return
+			}
 		}
 
 		return
@@ -90,82 +144,55 @@ func beforeProcessor(cfg *config.Config) cli.BeforeFunc {
 
 // processor is the main function which will perform work: digesting Reddit URLs
 // from the queue, downloading the video, converting the file to a vrddt video,
-// storing the viceo in storage, and saving the results in our data store
-func processor(cliContext *cli.Context) (err error) {
-	errs := make(chan error, 0)
-	successes := make(chan bool, 0)
-	errorCount := 0
-	successCount := 0
-	messageCount := 0
+// storing the viceo in storage, and saving the results in our data store. A
+// goroutine is started for each worker and they all stop asking for work once
+// a SIGINT or SIGTERM is received or too many errors have happened. Work which
+// has already started is given the grace timeout to finish before it is put
+// back on to the queue.
+func processor(cfg *config.Config) cli.ActionFunc {
+	return func(cliContext *cli.Context) (err error) {
+		// Cancelling pool stops the workers from asking for more work
+		pool, stopPool := context.WithCancel(context.Background())
+		defer stopPool()
 
-	for {
-		messageCount++
+		// Cancelling jobs abandons the work which has already started
+		jobs, stopJobs := context.WithCancel(context.Background())
+		defer stopJobs()
 
-		go func() {
-			// TODO: How do we use context? Study
-			// ctx := context.Background()
-			ctx := context.TODO()
-
-			if err := services.Worker.GetWork(ctx); err != nil {
-				loggerHandle.Errorf("Error getting element of work: %s", err)
-				errs <- err
-				successes <- false
-				return
-			}
-			loggerHandle.Infof("Received new request (%d) for work", messageCount)
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signals)
 
-			if err = services.Worker.DoWork(ctx); err != nil {
-				loggerHandle.Errorf("Unable to perform work: %s", err)
-				errs <- err
-				successes <- false
+		go func() {
+			select {
+			case sig := <-signals:
+				loggerHandle.Warnf("Received %s, no longer asking for work", sig)
+				stopPool()
+			case <-pool.Done():
 				return
 			}
-			loggerHandle.Infof("Performing work on request (%d)", messageCount)
 
-			if err = services.Worker.CompleteWork(ctx); err != nil {
-				loggerHandle.Errorf("Unable to complete work: %s", err)
-				errs <- err
-				successes <- false
-				return
+			select {
+			case sig := <-signals:
+				loggerHandle.Warnf("Received %s again, not waiting for work to finish", sig)
+				stopJobs()
+			case <-jobs.Done():
 			}
-			loggerHandle.Infof("Completed work for request (%d)", messageCount)
-
-			successes <- true
-			// ctx.Done()
-			return
 		}()
 
-		select {
-		case err := <-errs:
-			switch err {
-			case domain.ErrJSONTitle, domain.ErrJSONVideoURL, domain.ErrNotDASH:
-				loggerHandle.Warnf("Warning while processing media: %s", err)
-			default:
-				errorCount++
-				loggerHandle.Warnf("Error (#%d of %d allowed) while processing media: %s",
-					errorCount,
-					cliContext.Int("max-errors"),
-					err,
-				)
-			}
-		case success := <-successes:
-			successCount++
-			loggerHandle.Infof("Success (#%d): %#v", successCount, success)
+		if cliContext.IsSet("max-errors") {
+			cfg.Worker.Processor.MaxErrors = cliContext.Int("max-errors")
 		}
-
-		// Let's take a break
-		time.Sleep(time.Duration(cliContext.Int64("sleep")) * time.Millisecond)
-
-		// We have exceeded the max-error count so break out of the loop
-		// This will exit the infinite for-loop because we exceeded "max-error"
-		if errorCount >= cliContext.Int("max-errors") {
-			loggerHandle.Errorf("Maximum errors (#%d) while processing videos", errorCount)
-			break
+		if cliContext.IsSet("sleep") {
+			cfg.Worker.Processor.Sleep = cliContext.Int("sleep")
 		}
-	}
 
-	close(errs)
-	close(successes)
+		workers := worker.NewPool(&cfg.Worker.Processor, loggerHandle, services.Workers)
+		workers.Run(pool, jobs)
+
+		successes, failures := workers.Counts()
+		loggerHandle.Infof("Processor stopped after %d successes and %d errors", successes, failures)
 
-	return
+		return
+	}
 }
@@ -0,0 +1,176 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// Clip is the range of time of a video a vrddt video is made from written as
+// "<start>-<end>" in seconds (e.g. "10-25.5"). The end is left out for a clip
+// which runs to the end of the video and no clip at all is the whole video.
+type Clip string
+
+// NewClip will return the clip from the start up to the end, where an end of
+// zero is the end of the video. Both are rounded to the millisecond.
+func NewClip(start time.Duration, end time.Duration) Clip {
+	start = start.Round(time.Millisecond)
+	end = end.Round(time.Millisecond)
+	if start <= 0 && end <= 0 {
+		return ""
+	}
+
+	clip := formatClipTime(start) + "-"
+	if end > 0 {
+		clip += formatClipTime(end)
+	}
+
+	return Clip(clip)
+}
+
+// ParseClip will return the clip for a start and either an end or a duration,
+// any of which may be left empty. Each is a number of seconds (e.g. "12.5"),
+// a duration (e.g. "1m30s") or a time (e.g. "01:30.5").
+func ParseClip(start string, end string, duration string) (clip Clip, err error) {
+	startTime, err := parseClipTime("start", start)
+	if err != nil {
+		return
+	}
+	endTime, err := parseClipTime("end", end)
+	if err != nil {
+		return
+	}
+	durationTime, err := parseClipTime("duration", duration)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case strings.TrimSpace(end) != "" && strings.TrimSpace(duration) != "":
+		return "", errors.InvalidValue("duration", "Only one of end and duration can be given")
+	case strings.TrimSpace(duration) != "":
+		if durationTime <= 0 {
+			return "", errors.InvalidValue("duration", fmt.Sprintf("The duration '%s' must be more than zero", duration))
+		}
+		endTime = startTime + durationTime
+	case strings.TrimSpace(end) != "":
+		if endTime <= startTime {
+			return "", errors.InvalidValue("end", fmt.Sprintf("The end '%s' must be after the start", end))
+		}
+	}
+
+	return NewClip(startTime, endTime), nil
+}
+
+// Duration returns the duration of the clip or zero if it runs to the end of
+// the video
+func (c Clip) Duration() time.Duration {
+	start, end, _ := c.Range()
+	if end == 0 {
+		return 0
+	}
+
+	return end - start
+}
+
+// End returns where the clip ends in the video or zero if it runs to the end
+// of the video
+func (c Clip) End() time.Duration {
+	_, end, _ := c.Range()
+
+	return end
+}
+
+// Range returns where the clip starts and ends in the video, where an end of
+// zero is the end of the video
+func (c Clip) Range() (start time.Duration, end time.Duration, err error) {
+	if c == "" {
+		return
+	}
+
+	parts := strings.Split(string(c), "-")
+	if len(parts) != 2 {
+		return 0, 0, errors.InvalidValue("clip", fmt.Sprintf("The clip '%s' is not a start and an end", c))
+	}
+	if start, err = parseClipTime("clip", parts[0]); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClipTime("clip", parts[1]); err != nil {
+		return 0, 0, err
+	}
+	if end != 0 && end <= start {
+		return 0, 0, errors.InvalidValue("clip", fmt.Sprintf("The clip '%s' ends before it starts", c))
+	}
+
+	return
+}
+
+// Start returns where the clip starts in the video
+func (c Clip) Start() time.Duration {
+	start, _, _ := c.Range()
+
+	return start
+}
+
+func (c Clip) String() string {
+	return string(c)
+}
+
+// formatClipTime returns a time in a clip as seconds
+func formatClipTime(value time.Duration) string {
+	return strconv.FormatFloat(value.Seconds(), 'f', -1, 64)
+}
+
+// parseClipTime returns the time for the value of a field of a clip which is
+// zero when the value is empty
+func parseClipTime(field string, value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	var parsed time.Duration
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(seconds) && !math.IsInf(seconds, 0) {
+		parsed = time.Duration(seconds * float64(time.Second))
+	} else if duration, err := time.ParseDuration(value); err == nil {
+		parsed = duration
+	} else if clock, ok := parseClock(value); ok {
+		parsed = clock
+	} else {
+		return 0, errors.InvalidValue(field, fmt.Sprintf("The time '%s' is not seconds, a duration or a time", value))
+	}
+
+	if parsed < 0 {
+		return 0, errors.InvalidValue(field, fmt.Sprintf("The time '%s' can not be negative", value))
+	}
+
+	return parsed.Round(time.Millisecond), nil
+}
+
+// parseClock returns the time for a value written as "[hh:]mm:ss[.ms]"
+func parseClock(value string) (clock time.Duration, ok bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return
+	}
+
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || seconds < 0 || seconds >= 60 {
+		return
+	}
+	clock = time.Duration(seconds * float64(time.Second))
+
+	for i, unit := range []time.Duration{time.Minute, time.Hour}[:len(parts)-1] {
+		count, err := strconv.Atoi(parts[len(parts)-2-i])
+		if err != nil || count < 0 {
+			return 0, false
+		}
+		clock += time.Duration(count) * unit
+	}
+
+	return clock, true
+}
@@ -0,0 +1,66 @@
+package domain_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+func TestParseClip(suite *testing.T) {
+	suite.Parallel()
+
+	cases := []struct {
+		start     string
+		end       string
+		duration  string
+		clip      domain.Clip
+		clipStart time.Duration
+		clipEnd   time.Duration
+		errField  string
+	}{
+		{clip: ""},
+		{start: "0", clip: ""},
+		{start: "10", clip: "10-", clipStart: 10 * time.Second},
+		{start: "10", end: "25.5", clip: "10-25.5", clipStart: 10 * time.Second, clipEnd: 25500 * time.Millisecond},
+		{start: "1m", duration: "1m30s", clip: "60-150", clipStart: time.Minute, clipEnd: 150 * time.Second},
+		{start: "01:02.25", end: "1:00:00", clip: "62.25-3600", clipStart: 62250 * time.Millisecond, clipEnd: time.Hour},
+		{end: "0.0004", errField: "end"},
+		{end: "5", clipEnd: 5 * time.Second, clip: "0-5"},
+		{start: "10", end: "5", errField: "end"},
+		{start: "-1", errField: "start"},
+		{start: "soon", errField: "start"},
+		{start: "inf", errField: "start"},
+		{end: "10", duration: "5", errField: "duration"},
+		{duration: "0", errField: "duration"},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			clip, err := domain.ParseClip(cs.start, cs.end, cs.duration)
+			if cs.errField != "" {
+				if errors.Type(err) != errors.TypeInvalidValue || err.(*errors.Error).Context["field"] != cs.errField {
+					t.Errorf("expecting an invalid value for '%s', got: %v", cs.errField, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if clip != cs.clip {
+				t.Errorf("expecting clip '%s', got '%s'", cs.clip, clip)
+			}
+
+			start, end, err := clip.Range()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if start != cs.clipStart || end != cs.clipEnd {
+				t.Errorf("expecting the clip to be %s to %s, got %s to %s", cs.clipStart, cs.clipEnd, start, end)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// dashMPD is the part of an MPEG-DASH manifest (.mpd) needed to find the
+// representations in it
+type dashMPD struct {
+	BaseURL string       `xml:"BaseURL"`
+	Periods []dashPeriod `xml:"Period"`
+}
+
+type dashPeriod struct {
+	AdaptationSets []dashAdaptationSet `xml:"AdaptationSet"`
+	BaseURL        string              `xml:"BaseURL"`
+}
+
+type dashAdaptationSet struct {
+	BaseURL         string               `xml:"BaseURL"`
+	Codecs          string               `xml:"codecs,attr"`
+	ContentType     string               `xml:"contentType,attr"`
+	MimeType        string               `xml:"mimeType,attr"`
+	Representations []dashRepresentation `xml:"Representation"`
+}
+
+type dashRepresentation struct {
+	Bandwidth int    `xml:"bandwidth,attr"`
+	BaseURL   string `xml:"BaseURL"`
+	Codecs    string `xml:"codecs,attr"`
+	Height    int    `xml:"height,attr"`
+	MimeType  string `xml:"mimeType,attr"`
+	Width     int    `xml:"width,attr"`
+}
+
+// ParseDASHManifest will return the video representations and audio tracks
+// in an MPEG-DASH manifest with their URLs resolved against the URL the
+// manifest was fetched from. Only representations addressed by a BaseURL
+// (i.e. a single file each, which is what Reddit serves) are supported.
+func ParseDASHManifest(data []byte, manifestURL string) (manifest *Manifest, err error) {
+	mpd := dashMPD{}
+	if err = xml.Unmarshal(data, &mpd); err != nil {
+		return nil, errors.InvalidValue("manifest", fmt.Sprintf("Not an MPEG-DASH manifest: %s", err))
+	}
+
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return nil, errors.InvalidValue("manifest", err.Error())
+	}
+	base = resolveURL(base, mpd.BaseURL)
+
+	manifest = &Manifest{}
+	for _, period := range mpd.Periods {
+		periodBase := resolveURL(base, period.BaseURL)
+
+		for _, set := range period.AdaptationSets {
+			setBase := resolveURL(periodBase, set.BaseURL)
+
+			for _, representation := range set.Representations {
+				if strings.TrimSpace(representation.BaseURL) == "" {
+					continue
+				}
+				streamURL := resolveURL(setBase, representation.BaseURL).String()
+
+				codecs := representation.Codecs
+				if codecs == "" {
+					codecs = set.Codecs
+				}
+
+				switch dashContentType(set, representation) {
+				case "audio":
+					manifest.Audio = append(manifest.Audio, AudioTrack{
+						Bandwidth: representation.Bandwidth,
+						Codecs:    codecs,
+						URL:       streamURL,
+					})
+				case "video":
+					manifest.Video = append(manifest.Video, VideoRepresentation{
+						Bandwidth: representation.Bandwidth,
+						Codecs:    codecs,
+						Height:    representation.Height,
+						URL:       streamURL,
+						Width:     representation.Width,
+					})
+				}
+			}
+		}
+	}
+
+	if len(manifest.Video) == 0 {
+		return nil, errors.InvalidValue("manifest", "MPEG-DASH manifest does not have any video representations")
+	}
+	manifest.sort()
+
+	return
+}
+
+// dashContentType returns whether the representation is "audio" or "video"
+// from whichever of the content type, MIME type or dimensions are given
+func dashContentType(set dashAdaptationSet, representation dashRepresentation) string {
+	for _, value := range []string{set.ContentType, representation.MimeType, set.MimeType} {
+		if value == "" {
+			continue
+		}
+		return strings.SplitN(value, "/", 2)[0]
+	}
+
+	if representation.Height > 0 || representation.Width > 0 {
+		return "video"
+	}
+
+	return "audio"
+}
+
+// resolveURL returns the reference resolved against the base URL or the base
+// URL when there is no reference
+func resolveURL(base *url.URL, reference string) *url.URL {
+	reference = strings.TrimSpace(reference)
+	if reference == "" {
+		return base
+	}
+
+	resolved, err := url.Parse(reference)
+	if err != nil {
+		return base
+	}
+
+	return base.ResolveReference(resolved)
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// EventStage represents how far along the processing of a Reddit URL is.
+type EventStage string
+
+const (
+	// EventStageMetadataFetched is published once the title, audio URL, and
+	// video URL for the Reddit post are known.
+	EventStageMetadataFetched EventStage = "metadata_fetched"
+
+	// EventStageVideoDownloaded is published once the Reddit video has been
+	// downloaded.
+	EventStageVideoDownloaded EventStage = "video_downloaded"
+
+	// EventStageAudioDownloaded is published once the Reddit audio has been
+	// downloaded. It is never published for posts without audio.
+	EventStageAudioDownloaded EventStage = "audio_downloaded"
+
+	// EventStageConverting is published while the Reddit media is being
+	// converted in to a vrddt video along with the percentage done.
+	EventStageConverting EventStage = "converting"
+
+	// EventStageUploaded is published once the vrddt video is in storage.
+	EventStageUploaded EventStage = "uploaded"
+
+	// EventStageDone is published along with the vrddt video once the Reddit
+	// URL has been processed.
+	EventStageDone EventStage = "done"
+
+	// EventStageFailed is published along with the error once the Reddit
+	// URL will not be processed.
+	EventStageFailed EventStage = "failed"
+)
+
+// Event represents progress made processing a Reddit URL.
+type Event struct {
+	// CreatedAt represents the time at which the event happened.
+	CreatedAt time.Time `json:"created_at,omitempty"`
+
+	// Clip is the range of time of the video being processed.
+	Clip Clip `json:"clip,omitempty"`
+
+	// Error is the reason processing failed.
+	Error string `json:"error,omitempty"`
+
+	// Format is the format the Reddit URL is being processed in to.
+	Format Format `json:"format,omitempty"`
+
+	// Item is the position of the media item of the Reddit post (e.g. in a
+	// gallery) being processed.
+	Item int `json:"item,omitempty"`
+
+	// JobID is the ID of the job which requested the Reddit URL be
+	// processed, if there was one.
+	JobID bson.ObjectId `json:"job_id,omitempty"`
+
+	// Progress is the percentage (0 to 100) of the stage which is done.
+	Progress float64 `json:"progress,omitempty"`
+
+	// Quality is the quality the Reddit URL is being processed in.
+	Quality Quality `json:"quality,omitempty"`
+
+	// RedditURL is the Reddit URL being processed.
+	RedditURL string `json:"reddit_url,omitempty"`
+
+	// Stage is how far along processing is.
+	Stage EventStage `json:"stage,omitempty"`
+
+	// VrddtVideo is the resulting vrddt video once processing is done.
+	VrddtVideo *VrddtVideo `json:"vrddt_video,omitempty"`
+
+	// VrddtVideos are all of the resulting vrddt videos once processing is
+	// done when the Reddit post has several media items (e.g. a gallery) of
+	// which VrddtVideo is the first.
+	VrddtVideos []*VrddtVideo `json:"vrddt_videos,omitempty"`
+}
+
+// NewEvent will return a new event for the stage of processing a Reddit URL.
+func NewEvent(redditURL string, stage EventStage) *Event {
+	return &Event{
+		CreatedAt: time.Now(),
+		RedditURL: redditURL,
+		Stage:     stage,
+	}
+}
+
+// Finished returns true if no more events will follow the event.
+func (event Event) Finished() bool {
+	return event.Stage == EventStageDone || event.Stage == EventStageFailed
+}
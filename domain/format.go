@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+const (
+	// FormatGIF is a looping animated GIF without any audio
+	FormatGIF Format = "gif"
+
+	// FormatM4A is only the audio as AAC in an MPEG-4 container
+	FormatM4A Format = "m4a"
+
+	// FormatMP3 is only the audio as MP3
+	FormatMP3 Format = "mp3"
+
+	// FormatMP4 is H.264 video and AAC audio in an MPEG-4 container
+	FormatMP4 Format = "mp4"
+
+	// FormatWebM is VP9 video and Opus audio in a WebM container
+	FormatWebM Format = "webm"
+)
+
+// Formats are the formats vrddt videos can be made in
+var Formats = []Format{FormatMP4, FormatWebM, FormatGIF, FormatMP3, FormatM4A}
+
+// Format is the format a vrddt video is made in.
+type Format string
+
+// ParseFormat will return the format for its name in any case. No format at
+// all is FormatMP4.
+func ParseFormat(value string) (format Format, err error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return FormatMP4, nil
+	}
+
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		if value == string(format) {
+			return format, nil
+		}
+		names[i] = string(format)
+	}
+
+	return "", errors.InvalidValue("format", fmt.Sprintf("Unknown format '%s' (must be one of: %s)", value, strings.Join(names, ", ")))
+}
+
+// AudioOnly returns whether the format only has the audio of a video
+func (f Format) AudioOnly() bool {
+	return f == FormatM4A || f == FormatMP3
+}
+
+// ContentType returns the media type of a file in the format, which is the
+// one for FormatMP4 if no format is set
+func (f Format) ContentType() string {
+	switch f {
+	case FormatGIF:
+		return "image/gif"
+	case FormatM4A:
+		return "audio/mp4"
+	case FormatMP3:
+		return "audio/mpeg"
+	case FormatWebM:
+		return "video/webm"
+	}
+
+	return "video/mp4"
+}
+
+// Extension returns the file name extension for the format, which is the one
+// for FormatMP4 if no format is set
+func (f Format) Extension() string {
+	if f == "" {
+		return "." + string(FormatMP4)
+	}
+
+	return "." + string(f)
+}
+
+func (f Format) String() string {
+	return string(f)
+}
@@ -0,0 +1,54 @@
+package domain_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+func TestParseFormat(suite *testing.T) {
+	suite.Parallel()
+
+	cases := []struct {
+		value       string
+		contentType string
+		expectErr   bool
+		extension   string
+		format      domain.Format
+	}{
+		{value: "", contentType: "video/mp4", extension: ".mp4", format: domain.FormatMP4},
+		{value: "mp4", contentType: "video/mp4", extension: ".mp4", format: domain.FormatMP4},
+		{value: " GIF ", contentType: "image/gif", extension: ".gif", format: domain.FormatGIF},
+		{value: "webm", contentType: "video/webm", extension: ".webm", format: domain.FormatWebM},
+		{value: "mp3", contentType: "audio/mpeg", extension: ".mp3", format: domain.FormatMP3},
+		{value: "m4a", contentType: "audio/mp4", extension: ".m4a", format: domain.FormatM4A},
+		{value: "avi", expectErr: true},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			format, err := domain.ParseFormat(cs.value)
+			if cs.expectErr {
+				if errors.Type(err) != errors.TypeInvalidValue {
+					t.Errorf("expecting error type '%s', got: %v", errors.TypeInvalidValue, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if format != cs.format {
+				t.Errorf("expecting format '%s', got '%s'", cs.format, format)
+			}
+			if format.Extension() != cs.extension {
+				t.Errorf("expecting extension '%s', got '%s'", cs.extension, format.Extension())
+			}
+			if format.ContentType() != cs.contentType {
+				t.Errorf("expecting content type '%s', got '%s'", cs.contentType, format.ContentType())
+			}
+		})
+	}
+}
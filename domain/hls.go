@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// ParseHLSPlaylist will return the video representations (variant streams)
+// and audio tracks (audio renditions) in an HLS master playlist with their
+// URLs resolved against the URL the playlist was fetched from. The URLs are
+// to media playlists which are downloaded by joining their segments.
+func ParseHLSPlaylist(data []byte, playlistURL string) (manifest *Manifest, err error) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, errors.InvalidValue("playlist", err.Error())
+	}
+
+	lines := hlsLines(data)
+	if len(lines) == 0 || lines[0] != "#EXTM3U" {
+		return nil, errors.InvalidValue("playlist", "Not an HLS playlist")
+	}
+
+	manifest = &Manifest{}
+	for i := 1; i < len(lines); i++ {
+		tag, attributes := hlsTag(lines[i])
+		switch tag {
+		case "#EXT-X-MEDIA":
+			if attributes["TYPE"] != "AUDIO" || attributes["URI"] == "" {
+				continue
+			}
+			// Audio renditions do not have a bandwidth so the last one listed
+			// is taken to be the best
+			manifest.Audio = append(manifest.Audio, AudioTrack{
+				URL: resolveURL(base, attributes["URI"]).String(),
+			})
+		case "#EXT-X-STREAM-INF":
+			// The URI of a variant stream is the line following its tag
+			if i+1 >= len(lines) || strings.HasPrefix(lines[i+1], "#") {
+				continue
+			}
+			i++
+
+			representation := VideoRepresentation{
+				Codecs: attributes["CODECS"],
+				URL:    resolveURL(base, lines[i]).String(),
+			}
+			representation.Bandwidth, _ = strconv.Atoi(attributes["BANDWIDTH"])
+			if resolution := strings.SplitN(attributes["RESOLUTION"], "x", 2); len(resolution) == 2 {
+				representation.Width, _ = strconv.Atoi(resolution[0])
+				representation.Height, _ = strconv.Atoi(resolution[1])
+			}
+			manifest.Video = append(manifest.Video, representation)
+		}
+	}
+
+	if len(manifest.Video) == 0 {
+		return nil, errors.InvalidValue("playlist", "HLS playlist does not have any variant streams")
+	}
+	manifest.sort()
+
+	return
+}
+
+// parseHLSSegments will return the URLs of the segments in an HLS media
+// playlist in the order they are played resolved against the URL the
+// playlist was fetched from. A segment holding the initialization section
+// (EXT-X-MAP) comes first.
+func parseHLSSegments(data []byte, playlistURL string) (segments []string, err error) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, errors.InvalidValue("playlist", err.Error())
+	}
+
+	lines := hlsLines(data)
+	if len(lines) == 0 || lines[0] != "#EXTM3U" {
+		return nil, errors.InvalidValue("playlist", "Not an HLS playlist")
+	}
+
+	for _, line := range lines[1:] {
+		tag, attributes := hlsTag(line)
+		switch {
+		case tag == "#EXT-X-KEY" && attributes["METHOD"] != "NONE":
+			return nil, errors.NotImplemented("playlist", "Encrypted HLS segments are not supported")
+		case tag == "#EXT-X-MAP" && attributes["URI"] != "":
+			segments = append(segments, resolveURL(base, attributes["URI"]).String())
+		case tag == "#EXT-X-STREAM-INF":
+			return nil, errors.InvalidValue("playlist", "HLS playlist is a master playlist and not a media playlist")
+		case !strings.HasPrefix(line, "#"):
+			segments = append(segments, resolveURL(base, line).String())
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, errors.InvalidValue("playlist", "HLS playlist does not have any segments")
+	}
+
+	return
+}
+
+// hlsLines returns the lines of a playlist which are not blank
+func hlsLines(data []byte) (lines []string) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return
+}
+
+// hlsTag splits a playlist line into its tag and its attribute list (e.g.
+// `#EXT-X-MEDIA:TYPE=AUDIO,URI="audio.m3u8"`) where quoted values may contain
+// commas
+func hlsTag(line string) (tag string, attributes map[string]string) {
+	attributes = map[string]string{}
+	if !strings.HasPrefix(line, "#") {
+		return
+	}
+
+	parts := strings.SplitN(line, ":", 2)
+	tag = parts[0]
+	if len(parts) == 1 {
+		return
+	}
+
+	list := parts[1]
+	for list != "" {
+		equals := strings.Index(list, "=")
+		if equals < 0 {
+			break
+		}
+		name := strings.TrimSpace(list[:equals])
+		list = list[equals+1:]
+
+		var value string
+		if strings.HasPrefix(list, `"`) {
+			end := strings.Index(list[1:], `"`)
+			if end < 0 {
+				value, list = list[1:], ""
+			} else {
+				value, list = list[1:end+1], list[end+2:]
+			}
+		} else if comma := strings.Index(list, ","); comma >= 0 {
+			value, list = list[:comma], list[comma:]
+		} else {
+			value, list = list, ""
+		}
+		attributes[name] = value
+
+		list = strings.TrimPrefix(list, ",")
+	}
+
+	return
+}
+
+// hlsPlaylistURL reports whether the URL is for an HLS playlist rather than
+// a stream which can be downloaded as it is
+func hlsPlaylistURL(streamURL string) bool {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
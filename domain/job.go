@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"net/url"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// JobStatus represents the stage of processing a job is in.
+type JobStatus string
+
+const (
+	// JobStatusQueued is a job which is waiting on the queue for a worker.
+	JobStatusQueued JobStatus = "queued"
+
+	// JobStatusDownloading is a job whose Reddit media is being downloaded.
+	JobStatusDownloading JobStatus = "downloading"
+
+	// JobStatusConverting is a job whose Reddit media is being converted in
+	// to a vrddt video.
+	JobStatusConverting JobStatus = "converting"
+
+	// JobStatusUploading is a job whose vrddt video is being uploaded to
+	// storage.
+	JobStatusUploading JobStatus = "uploading"
+
+	// JobStatusDone is a job which has finished with a vrddt video.
+	JobStatusDone JobStatus = "done"
+
+	// JobStatusFailed is a job which could not be finished.
+	JobStatusFailed JobStatus = "failed"
+)
+
+// Job represents a request to turn a Reddit URL in to a vrddt video.
+type Job struct {
+	// Meta holds the generic information about the job.
+	Meta `json:",inline" bson:",inline"`
+
+	// Clip is the range of time of the video the Reddit URL was requested
+	// for.
+	Clip Clip `json:"clip,omitempty" bson:"clip,omitempty"`
+
+	// Error is the reason the job failed.
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+
+	// Format is the format the Reddit URL was requested in.
+	Format Format `json:"format,omitempty" bson:"format,omitempty"`
+
+	// Quality is the quality the Reddit URL was requested in.
+	Quality Quality `json:"quality,omitempty" bson:"quality,omitempty"`
+
+	// RedditURL is the Reddit URL the job was requested for.
+	RedditURL string `json:"reddit_url,omitempty" bson:"reddit_url,omitempty"`
+
+	// Status is the stage of processing the job is in.
+	Status JobStatus `json:"status,omitempty" bson:"status,omitempty"`
+
+	// VrddtVideoID is the ID of the resulting vrddt video once the job is
+	// done.
+	VrddtVideoID bson.ObjectId `json:"vrddt_video_id,omitempty" bson:"vrddt_video_id,omitempty"`
+
+	// VrddtVideoIDs are the IDs of all of the resulting vrddt videos once the
+	// job is done when the Reddit post has several media items (e.g. a
+	// gallery) of which VrddtVideoID is the first.
+	VrddtVideoIDs []bson.ObjectId `json:"vrddt_video_ids,omitempty" bson:"vrddt_video_ids,omitempty"`
+}
+
+// NewJob will return a new queued job.
+func NewJob() *Job {
+	return &Job{
+		Meta:   NewMeta(),
+		Status: JobStatusQueued,
+	}
+}
+
+// Finished returns true if the job will not change status again.
+func (job Job) Finished() bool {
+	return job.Status == JobStatusDone || job.Status == JobStatusFailed
+}
+
+// Validate performs validation of the job.
+func (job Job) Validate() error {
+	if err := job.Meta.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := url.ParseRequestURI(job.RedditURL); err != nil {
+		return errors.MissingField("RedditURL")
+	}
+
+	switch job.Status {
+	case JobStatusQueued, JobStatusDownloading, JobStatusConverting, JobStatusUploading, JobStatusFailed:
+	case JobStatusDone:
+		if !job.VrddtVideoID.Valid() {
+			return errors.MissingField("VrddtVideoID")
+		}
+	default:
+		return errors.InvalidValue("Status", string(job.Status))
+	}
+
+	return nil
+}
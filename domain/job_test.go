@@ -0,0 +1,103 @@
+package domain_test
+
+import (
+	"fmt"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+)
+
+func TestJob_Validate(suite *testing.T) {
+	suite.Parallel()
+
+	validMeta := domain.Meta{
+		ID: bson.NewObjectId(),
+	}
+
+	invalidURL := "foo.html"
+	validURL := "https://www.reddit.com/r/funny/comments/aor7zs/the_way_this_pigeon_waddles/"
+
+	cases := []struct {
+		job       domain.Job
+		expectErr bool
+	}{
+		{
+			job:       domain.Job{},
+			expectErr: true,
+		},
+		{
+			job: domain.Job{
+				Meta: validMeta,
+			},
+			expectErr: true,
+		},
+		{
+			job: domain.Job{
+				Meta:      validMeta,
+				RedditURL: invalidURL,
+				Status:    domain.JobStatusQueued,
+			},
+			expectErr: true,
+		},
+		{
+			job: domain.Job{
+				Meta:      validMeta,
+				RedditURL: validURL,
+				Status:    domain.JobStatusQueued,
+			},
+			expectErr: false,
+		},
+		{
+			job: domain.Job{
+				Meta:      validMeta,
+				RedditURL: validURL,
+				Status:    domain.JobStatus("paused"),
+			},
+			expectErr: true,
+		},
+		{
+			job: domain.Job{
+				Meta:      validMeta,
+				RedditURL: validURL,
+				Status:    domain.JobStatusDone,
+			},
+			expectErr: true,
+		},
+		{
+			job: domain.Job{
+				Meta:         validMeta,
+				RedditURL:    validURL,
+				Status:       domain.JobStatusDone,
+				VrddtVideoID: bson.NewObjectId(),
+			},
+			expectErr: false,
+		},
+		{
+			job: domain.Job{
+				Error:     "Unable to download",
+				Meta:      validMeta,
+				RedditURL: validURL,
+				Status:    domain.JobStatusFailed,
+			},
+			expectErr: false,
+		},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("#%d", id), func(t *testing.T) {
+			err := cs.job.Validate()
+			if err != nil {
+				if !cs.expectErr {
+					t.Errorf("was not expecting error, got '%s'", err)
+				}
+				return
+			}
+
+			if cs.expectErr {
+				t.Errorf("was expecting error, got nil")
+			}
+		})
+	}
+}
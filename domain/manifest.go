@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+const (
+	// QualityBest picks the video representation with the most pixels and
+	// the audio track with the highest bandwidth
+	QualityBest Quality = "best"
+
+	// QualityWorst picks the video representation with the fewest pixels and
+	// the audio track with the lowest bandwidth
+	QualityWorst Quality = "worst"
+)
+
+// Quality is which of the representations of some media is wanted. Besides
+// QualityBest and QualityWorst it may be a maximum height such as "720p".
+type Quality string
+
+// ParseQuality will return the quality for "best", "worst", or a maximum
+// height with or without a "p" suffix (e.g. "720" or "720p"). No quality at
+// all is the best quality.
+func ParseQuality(value string) (quality Quality, err error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "", string(QualityBest):
+		return QualityBest, nil
+	case string(QualityWorst):
+		return QualityWorst, nil
+	}
+
+	height, err := strconv.Atoi(strings.TrimSuffix(value, "p"))
+	if err != nil || height <= 0 {
+		return "", errors.InvalidValue("quality", fmt.Sprintf("Unknown quality '%s' (must be one of: best, worst, or a maximum height such as 720p)", value))
+	}
+
+	return Quality(fmt.Sprintf("%dp", height)), nil
+}
+
+// MaxHeight returns the maximum height of the quality or 0 if it is not
+// limited by height
+func (q Quality) MaxHeight() (height int) {
+	height, _ = strconv.Atoi(strings.TrimSuffix(string(q), "p"))
+
+	return
+}
+
+func (q Quality) String() string {
+	return string(q)
+}
+
+// AudioTrack is one of the audio streams media is available as
+type AudioTrack struct {
+	// Bandwidth is the bits per second of the stream
+	Bandwidth int `json:"bandwidth,omitempty"`
+
+	// Codecs are the codecs of the stream (e.g. "mp4a.40.2")
+	Codecs string `json:"codecs,omitempty"`
+
+	// URL is where the stream can be downloaded from
+	URL string `json:"url"`
+}
+
+// VideoRepresentation is one of the resolutions a video is available in
+type VideoRepresentation struct {
+	// Bandwidth is the bits per second of the stream
+	Bandwidth int `json:"bandwidth,omitempty"`
+
+	// Codecs are the codecs of the stream (e.g. "avc1.4d401f")
+	Codecs string `json:"codecs,omitempty"`
+
+	// Height is the height of the video in pixels
+	Height int `json:"height,omitempty"`
+
+	// URL is where the stream can be downloaded from
+	URL string `json:"url"`
+
+	// Width is the width of the video in pixels
+	Width int `json:"width,omitempty"`
+}
+
+// Manifest lists the video representations and audio tracks some media is
+// available as, e.g. from an MPEG-DASH manifest or an HLS playlist
+type Manifest struct {
+	// Audio are the audio tracks from the lowest to the highest bandwidth
+	Audio []AudioTrack `json:"audio,omitempty"`
+
+	// Video are the video representations from the fewest to the most
+	// pixels
+	Video []VideoRepresentation `json:"video,omitempty"`
+}
+
+// Select picks the video representation and, if there is any, the audio
+// track for the quality. A maximum height picks the best representation
+// which is not taller than it or the smallest one if they all are.
+func (m *Manifest) Select(quality Quality) (video *VideoRepresentation, audio *AudioTrack, err error) {
+	if len(m.Video) == 0 {
+		return nil, nil, errors.ResourceNotFound("video representation", quality.String())
+	}
+	m.sort()
+
+	switch quality {
+	case QualityWorst:
+		video = &m.Video[0]
+	case QualityBest, "":
+		video = &m.Video[len(m.Video)-1]
+	default:
+		maxHeight := quality.MaxHeight()
+		if maxHeight <= 0 {
+			return nil, nil, errors.InvalidValue("quality", quality.String())
+		}
+
+		video = &m.Video[0]
+		for i := range m.Video {
+			if m.Video[i].Height <= maxHeight {
+				video = &m.Video[i]
+			}
+		}
+	}
+
+	if len(m.Audio) > 0 {
+		audio = &m.Audio[len(m.Audio)-1]
+		if quality == QualityWorst {
+			audio = &m.Audio[0]
+		}
+	}
+
+	return
+}
+
+// sort orders the video representations by their pixels and the audio
+// tracks by their bandwidth using the bandwidth to break any ties
+func (m *Manifest) sort() {
+	sort.SliceStable(m.Video, func(i, j int) bool {
+		a, b := m.Video[i], m.Video[j]
+		if a.Height*a.Width != b.Height*b.Width {
+			return a.Height*a.Width < b.Height*b.Width
+		}
+		return a.Bandwidth < b.Bandwidth
+	})
+	sort.SliceStable(m.Audio, func(i, j int) bool {
+		return m.Audio[i].Bandwidth < m.Audio[j].Bandwidth
+	})
+}
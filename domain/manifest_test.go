@@ -0,0 +1,177 @@
+package domain_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// dashManifest is an MPEG-DASH manifest like the ones Reddit serves
+const dashManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" mediaPresentationDuration="PT20.5S" minBufferTime="PT1.500S" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static">
+  <Period duration="PT20.5S">
+    <AdaptationSet segmentAlignment="true" subsegmentAlignment="true" subsegmentStartsWithSAP="1" maxWidth="1280" maxHeight="720" maxFrameRate="30" par="16:9">
+      <Representation id="VIDEO-1" mimeType="video/mp4" codecs="avc1.4d401f" width="1280" height="720" frameRate="30" sar="1:1" startWithSAP="1" bandwidth="2372938">
+        <BaseURL>DASH_720.mp4</BaseURL>
+        <SegmentBase indexRangeExact="true" indexRange="910-1001"><Initialization range="0-909"/></SegmentBase>
+      </Representation>
+      <Representation id="VIDEO-2" mimeType="video/mp4" codecs="avc1.4d401e" width="480" height="270" frameRate="30" sar="1:1" startWithSAP="1" bandwidth="548275">
+        <BaseURL>DASH_240.mp4</BaseURL>
+      </Representation>
+      <Representation id="VIDEO-3" mimeType="video/mp4" codecs="avc1.4d401f" width="854" height="480" frameRate="30" sar="1:1" startWithSAP="1" bandwidth="1178438">
+        <BaseURL>DASH_480.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" segmentAlignment="true">
+      <Representation id="AUDIO-1" mimeType="audio/mp4" codecs="mp4a.40.2" bandwidth="129244" audioSamplingRate="48000">
+        <BaseURL>DASH_audio.mp4</BaseURL>
+      </Representation>
+      <Representation id="AUDIO-2" mimeType="audio/mp4" codecs="mp4a.40.2" bandwidth="65128" audioSamplingRate="48000">
+        <BaseURL>https://audio.v.redd.it/abc/DASH_AUDIO_64.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+// hlsPlaylist is an HLS master playlist like the ones Reddit serves
+const hlsPlaylist = `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="600k",NAME="audio",DEFAULT=YES,AUTOSELECT=YES,URI="HLS_AUDIO_160_K.m3u8"
+
+#EXT-X-STREAM-INF:BANDWIDTH=1178438,RESOLUTION=854x480,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="600k"
+HLS_480.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2372938,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="600k"
+HLS_720.m3u8
+`
+
+func TestParseDASHManifest(t *testing.T) {
+	manifest, err := domain.ParseDASHManifest([]byte(dashManifest), "https://v.redd.it/abc/DASHPlaylist.mpd?a=1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := &domain.Manifest{
+		Audio: []domain.AudioTrack{
+			{Bandwidth: 65128, Codecs: "mp4a.40.2", URL: "https://audio.v.redd.it/abc/DASH_AUDIO_64.mp4"},
+			{Bandwidth: 129244, Codecs: "mp4a.40.2", URL: "https://v.redd.it/abc/DASH_audio.mp4"},
+		},
+		Video: []domain.VideoRepresentation{
+			{Bandwidth: 548275, Codecs: "avc1.4d401e", Height: 270, URL: "https://v.redd.it/abc/DASH_240.mp4", Width: 480},
+			{Bandwidth: 1178438, Codecs: "avc1.4d401f", Height: 480, URL: "https://v.redd.it/abc/DASH_480.mp4", Width: 854},
+			{Bandwidth: 2372938, Codecs: "avc1.4d401f", Height: 720, URL: "https://v.redd.it/abc/DASH_720.mp4", Width: 1280},
+		},
+	}
+	if !reflect.DeepEqual(manifest, expected) {
+		t.Errorf("expecting %#v, got %#v", expected, manifest)
+	}
+
+	if _, err = domain.ParseDASHManifest([]byte("<html></html>"), "https://v.redd.it/abc/DASHPlaylist.mpd"); errors.Type(err) != errors.TypeInvalidValue {
+		t.Errorf("expecting error type '%s' for a manifest without video, got: %v", errors.TypeInvalidValue, err)
+	}
+}
+
+func TestParseHLSPlaylist(t *testing.T) {
+	manifest, err := domain.ParseHLSPlaylist([]byte(hlsPlaylist), "https://v.redd.it/abc/HLSPlaylist.m3u8")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := &domain.Manifest{
+		Audio: []domain.AudioTrack{
+			{URL: "https://v.redd.it/abc/HLS_AUDIO_160_K.m3u8"},
+		},
+		Video: []domain.VideoRepresentation{
+			{Bandwidth: 1178438, Codecs: "avc1.4d401f,mp4a.40.2", Height: 480, URL: "https://v.redd.it/abc/HLS_480.m3u8", Width: 854},
+			{Bandwidth: 2372938, Codecs: "avc1.4d401f,mp4a.40.2", Height: 720, URL: "https://v.redd.it/abc/HLS_720.m3u8", Width: 1280},
+		},
+	}
+	if !reflect.DeepEqual(manifest, expected) {
+		t.Errorf("expecting %#v, got %#v", expected, manifest)
+	}
+
+	if _, err = domain.ParseHLSPlaylist([]byte(dashManifest), "https://v.redd.it/abc/HLSPlaylist.m3u8"); errors.Type(err) != errors.TypeInvalidValue {
+		t.Errorf("expecting error type '%s' for something other than a playlist, got: %v", errors.TypeInvalidValue, err)
+	}
+}
+
+func TestParseQuality(suite *testing.T) {
+	suite.Parallel()
+
+	cases := []struct {
+		value     string
+		expectErr bool
+		quality   domain.Quality
+	}{
+		{value: "", quality: domain.QualityBest},
+		{value: "best", quality: domain.QualityBest},
+		{value: " Worst ", quality: domain.QualityWorst},
+		{value: "720", quality: "720p"},
+		{value: "480p", quality: "480p"},
+		{value: "0p", expectErr: true},
+		{value: "hd", expectErr: true},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			quality, err := domain.ParseQuality(cs.value)
+			if cs.expectErr {
+				if errors.Type(err) != errors.TypeInvalidValue {
+					t.Errorf("expecting error type '%s', got: %v", errors.TypeInvalidValue, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if quality != cs.quality {
+				t.Errorf("expecting quality '%s', got '%s'", cs.quality, quality)
+			}
+		})
+	}
+}
+
+func TestManifest_Select(suite *testing.T) {
+	suite.Parallel()
+
+	cases := []struct {
+		quality domain.Quality
+		audio   string
+		video   string
+	}{
+		{quality: domain.QualityBest, audio: "DASH_audio.mp4", video: "DASH_720.mp4"},
+		{quality: domain.QualityWorst, audio: "DASH_AUDIO_64.mp4", video: "DASH_240.mp4"},
+		{quality: "480p", audio: "DASH_audio.mp4", video: "DASH_480.mp4"},
+		{quality: "1080p", audio: "DASH_audio.mp4", video: "DASH_720.mp4"},
+		{quality: "144p", audio: "DASH_audio.mp4", video: "DASH_240.mp4"},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			manifest, err := domain.ParseDASHManifest([]byte(dashManifest), "https://v.redd.it/abc/DASHPlaylist.mpd")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			video, audio, err := manifest.Select(cs.quality)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !strings.HasSuffix(video.URL, "/"+cs.video) {
+				t.Errorf("expecting video '%s', got '%s'", cs.video, video.URL)
+			}
+			if !strings.HasSuffix(audio.URL, "/"+cs.audio) {
+				t.Errorf("expecting audio '%s', got '%s'", cs.audio, audio.URL)
+			}
+		})
+	}
+
+	if _, _, err := (&domain.Manifest{}).Select(domain.QualityBest); errors.Type(err) != errors.TypeResourceNotFound {
+		suite.Errorf("expecting error type '%s' without any video, got: %v", errors.TypeResourceNotFound, err)
+	}
+}
@@ -0,0 +1,448 @@
+package domain
+
+import (
+	"context"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/peter-jozsa/jsonpath"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// TODO: Incorporate errors into pkg/errors
+
+const (
+	// JSONPathForPost is the JSON path to find the data for a Reddit post
+	JSONPathForPost = `$.data.children[0].data`
+
+	// JSONPathForTitle is the JSON path to find the title for a Reddit post
+	JSONPathForTitle = `$.data.children[0].data.title`
+
+	// RedditSourceName is the name the Reddit source is registered under
+	RedditSourceName = "reddit"
+
+	// redditMaxCrosspostDepth is how many crosspost parents are followed to
+	// find the post with the media
+	redditMaxCrosspostDepth = 5
+)
+
+var (
+	// ErrJSONTitle is the error returned when the JSON does not parse in order to find the title
+	ErrJSONTitle = errors.New("JSON data does not have exactly one match for the Title: " + JSONPathForTitle)
+
+	// ErrJSONVideoURL is the error returned when the JSON does not parse in order to find the video URL
+	ErrJSONVideoURL = errors.New("JSON data does not have a video in the media, secure media, preview, crosspost parent or gallery of the post: " + JSONPathForPost)
+
+	// JSONPathsForRedditVideo are the JSON paths, relative to the data for a
+	// Reddit post, to find the video for the post in the order they are tried
+	JSONPathsForRedditVideo = []string{
+		`$.media.reddit_video`,
+		`$.secure_media.reddit_video`,
+		`$.preview.reddit_video_preview`,
+	}
+
+	// ErrNotDASH is the error returned when the video URL found when
+	// attempting to set the audio URL is not a URL containing "DASH_"
+	ErrNotDASH = errors.New("The Reddit video URL does not seem to contain a DASH video")
+
+	// KnownRedditDomains are all of the known Reddit domains prefixed with a "." so
+	// that we do not process any requests for domains which contain a known
+	// Reddit domain name at the end of them (e.g. "foo-reddit.com")
+	KnownRedditDomains = []string{
+		".redd.it",
+		".reddit.com",
+		".redditstatic.com",
+	}
+
+	// RedditDomain will be what to prepend to arbitrary URIs that
+	// come in by a request that we will attempt to locate a valid Reddit URL
+	RedditDomain = "www.reddit.com"
+
+	// TemporaryAudioFilePrefix is the file prefix for the file that will hold
+	// the contents of the audio downloaded
+	TemporaryAudioFilePrefix = "vrddt-input-reddit-audio*.mp4"
+
+	// TemporaryVideoFilePrefix is the file prefix for the file that will hold
+	// the contents of the video downloaded
+	TemporaryVideoFilePrefix = "vrddt-input-reddit-video*.mp4"
+)
+
+// redditSource resolves Reddit posts from the JSON Reddit serves for them
+type redditSource struct{}
+
+// NewRedditSource will return the source for videos posted to Reddit
+func NewRedditSource() Source {
+	return &redditSource{}
+}
+
+// Download will download the video and, if there is any, the audio of the
+// Reddit post. Plenty of videos on Reddit do not have audio so it is not an
+// error if the audio can not be downloaded.
+func (r *redditSource) Download(ctx context.Context, media *SourceMedia) (files *SourceFiles, err error) {
+	videoFile, err := downloadStreamToTemporaryFile(ctx, media.VideoURL, TemporaryVideoFilePrefix)
+	if err != nil {
+		if videoFile != nil {
+			os.Remove(videoFile.Name())
+		}
+		return nil, err
+	}
+	files = &SourceFiles{VideoPath: videoFile.Name()}
+
+	if media.AudioURL == "" {
+		return
+	}
+
+	audioFile, audioErr := downloadStreamToTemporaryFile(ctx, media.AudioURL, TemporaryAudioFilePrefix)
+	if audioErr != nil {
+		if audioFile != nil {
+			os.Remove(audioFile.Name())
+		}
+		return
+	}
+	files.AudioPath = audioFile.Name()
+
+	return
+}
+
+// FinalURL will follow any redirects, e.g. from a "v.redd.it" link, to the
+// URL of the Reddit post
+func (r *redditSource) FinalURL(ctx context.Context, rawURL string) (finalURL string, err error) {
+	return getFinalURL(ctx, rawURL)
+}
+
+// Match will validate that whatever has been thrown at us is actually a
+// Reddit URL and saves us time and trouble
+func (r *redditSource) Match(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, validDomain := range KnownRedditDomains {
+		if strings.HasSuffix(host, validDomain) || host == strings.TrimPrefix(validDomain, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Name is the name the Reddit source is registered under
+func (r *redditSource) Name() string {
+	return RedditSourceName
+}
+
+// Resolve sets the title from the JSON for a Reddit post and the video URL
+// and audio URL for the quality of every video in the post. A crossposted
+// video is found by following the crosspost parents and a video which is not
+// in the media of the post is looked for in its secure media and then in its
+// preview. A gallery has a media item for every video (or animated image) in
+// it.
+func (r *redditSource) Resolve(ctx context.Context, rawURL string, quality Quality) (items []*SourceMedia, err error) {
+	jsonData, err := getJSONData(ctx, strings.TrimRight(rawURL, "/")+".json")
+	if err != nil {
+		return
+	}
+
+	// Reddit serves a post as a list of listings, the post and then its
+	// comments, where only the first has the post itself
+	if listings, ok := jsonData.([]interface{}); ok && len(listings) > 0 {
+		jsonData = listings[0]
+	}
+
+	title, err := getTitleFromJSONData(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := lookupJSONObject(jsonData, JSONPathForPost, ErrJSONVideoURL)
+	if err != nil {
+		return nil, err
+	}
+	post = redditCrosspostParent(post)
+
+	videos := redditGalleryVideos(post)
+	if len(videos) == 0 {
+		if video, ok := redditPostVideo(post); ok {
+			videos = append(videos, video)
+		}
+	}
+
+	for _, video := range videos {
+		media := &SourceMedia{
+			Item:    len(items),
+			Quality: quality,
+			Source:  RedditSourceName,
+			Title:   title,
+			URL:     rawURL,
+		}
+		if err = r.resolveVideo(ctx, media, video); err != nil {
+			return nil, err
+		}
+		items = append(items, media)
+	}
+
+	if len(items) == 0 {
+		return nil, ErrJSONVideoURL
+	}
+
+	return
+}
+
+// manifest returns the representations listed in the MPEG-DASH manifest or,
+// if that can not be used, the HLS playlist for a Reddit video. It returns nil
+// if neither can be used.
+func (r *redditSource) manifest(ctx context.Context, video redditVideo) (manifest *Manifest) {
+	var err error
+	if video.DASHURL != "" {
+		if manifest, err = fetchManifest(ctx, video.DASHURL, ParseDASHManifest); err == nil {
+			return
+		}
+	}
+
+	if video.HLSURL != "" {
+		if manifest, err = fetchManifest(ctx, video.HLSURL, ParseHLSPlaylist); err == nil {
+			return
+		}
+	}
+
+	return nil
+}
+
+// resolveVideo sets the video URL and audio URL for the quality of the media
+// from the manifest for the Reddit video, falling back to the video Reddit
+// picked
+func (r *redditSource) resolveVideo(ctx context.Context, media *SourceMedia, video redditVideo) (err error) {
+	if media.Manifest = r.manifest(ctx, video); media.Manifest != nil {
+		representation, audio, err := media.Manifest.Select(media.Quality)
+		if err != nil {
+			return err
+		}
+
+		media.Height = representation.Height
+		media.VideoURL = representation.URL
+		media.Width = representation.Width
+		if audio != nil {
+			media.AudioURL = audio.URL
+		}
+
+		return nil
+	}
+
+	if video.FallbackURL == "" {
+		return ErrJSONVideoURL
+	}
+	media.Height = video.Height
+	media.VideoURL = video.FallbackURL
+	media.Width = video.Width
+
+	// Animated images are served as a single file which never has audio
+	if video.Animated {
+		return
+	}
+	media.AudioURL, err = getAudioURLFromVideoURL(media.VideoURL)
+
+	return
+}
+
+// redditVideo is where a video in a Reddit post (or in a gallery of one) can
+// be downloaded from
+type redditVideo struct {
+	// Animated is set for an animated image which is a single video file
+	// without any audio
+	Animated bool
+
+	DASHURL     string
+	FallbackURL string
+	HLSURL      string
+	Height      int
+	Width       int
+}
+
+// redditCrosspostParent returns the post a post was crossposted from, or the
+// one that was crossposted from in turn, which is where the media is. A post
+// which is not a crosspost is returned as it is.
+func redditCrosspostParent(post map[string]interface{}) map[string]interface{} {
+	for depth := 0; depth < redditMaxCrosspostDepth; depth++ {
+		parents, _ := post["crosspost_parent_list"].([]interface{})
+		if len(parents) == 0 {
+			break
+		}
+
+		parent, ok := parents[0].(map[string]interface{})
+		if !ok {
+			break
+		}
+		post = parent
+	}
+
+	return post
+}
+
+// redditGalleryVideos returns the videos and animated images in a gallery post
+// in the order they are shown skipping any still images
+func redditGalleryVideos(post map[string]interface{}) (videos []redditVideo) {
+	galleryData, _ := post["gallery_data"].(map[string]interface{})
+	galleryItems, _ := galleryData["items"].([]interface{})
+	mediaMetadata, _ := post["media_metadata"].(map[string]interface{})
+
+	for _, galleryItem := range galleryItems {
+		item, _ := galleryItem.(map[string]interface{})
+		metadata, _ := mediaMetadata[jsonString(item, "media_id")].(map[string]interface{})
+		if metadata == nil || jsonString(metadata, "status") != "valid" {
+			continue
+		}
+
+		switch jsonString(metadata, "e") {
+		case "AnimatedImage":
+			source, _ := metadata["s"].(map[string]interface{})
+			if jsonString(source, "mp4") == "" {
+				continue
+			}
+			videos = append(videos, redditVideo{
+				Animated:    true,
+				FallbackURL: jsonString(source, "mp4"),
+				Height:      jsonInt(source, "y"),
+				Width:       jsonInt(source, "x"),
+			})
+		case "RedditVideo":
+			videos = append(videos, redditVideo{
+				DASHURL: jsonString(metadata, "dashUrl"),
+				HLSURL:  jsonString(metadata, "hlsUrl"),
+				Height:  jsonInt(metadata, "y"),
+				Width:   jsonInt(metadata, "x"),
+			})
+		}
+	}
+
+	return
+}
+
+// redditPostVideo returns the video of a post from the first of the
+// JSONPathsForRedditVideo it has one at
+func redditPostVideo(post map[string]interface{}) (video redditVideo, ok bool) {
+	for _, path := range JSONPathsForRedditVideo {
+		object, err := lookupJSONObject(post, path, ErrJSONVideoURL)
+		if err != nil {
+			continue
+		}
+
+		video = redditVideo{
+			DASHURL:     jsonString(object, "dash_url"),
+			FallbackURL: jsonString(object, "fallback_url"),
+			HLSURL:      jsonString(object, "hls_url"),
+			Height:      jsonInt(object, "height"),
+			Width:       jsonInt(object, "width"),
+		}
+		if video.DASHURL != "" || video.FallbackURL != "" || video.HLSURL != "" {
+			return video, true
+		}
+	}
+
+	return video, false
+}
+
+// fetchManifest will download a manifest and parse it
+func fetchManifest(ctx context.Context, manifestURL string, parse func(data []byte, manifestURL string) (*Manifest, error)) (manifest *Manifest, err error) {
+	httpResponse, err := getContent(ctx, manifestURL)
+	if err != nil {
+		return
+	}
+	defer httpResponse.Body.Close()
+
+	data, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return
+	}
+
+	return parse(data, manifestURL)
+}
+
+// getAudioURLFromVideoURL returns the URL to the audio which Reddit serves
+// next to the DASH video
+func getAudioURLFromVideoURL(videoURL string) (audioURL string, err error) {
+	if !strings.Contains(videoURL, "DASH_") {
+		return "", ErrNotDASH
+	}
+
+	return strings.Split(videoURL, "DASH_")[0] + "audio", nil
+}
+
+// getTitleFromJSONData will hunt down the title for a Reddit post from a
+// JSON path
+func getTitleFromJSONData(jsonData interface{}) (title string, err error) {
+	return lookupJSONString(jsonData, JSONPathForTitle, ErrJSONTitle)
+}
+
+// jsonInt returns the number for the key of a JSON object or 0 if there is
+// not one
+func jsonInt(object map[string]interface{}, key string) int {
+	number, _ := object[key].(float64)
+
+	return int(number)
+}
+
+// jsonString returns the string for the key of a JSON object or an empty
+// string if there is not one. Reddit escapes "&" in URLs unless asked for raw
+// JSON so any HTML entities are unescaped.
+func jsonString(object map[string]interface{}, key string) string {
+	value, _ := object[key].(string)
+
+	return html.UnescapeString(value)
+}
+
+// lookupJSON will return the single value found at the JSON path returning
+// errNoMatch unless there is exactly one
+func lookupJSON(jsonData interface{}, path string, errNoMatch error) (value interface{}, err error) {
+	pattern, _ := jsonpath.Compile(path)
+	value, err = pattern.Lookup(jsonData)
+	if err != nil {
+		return nil, errNoMatch
+	}
+
+	if matches, ok := value.([]interface{}); ok {
+		if len(matches) != 1 {
+			return nil, errNoMatch
+		}
+		value = matches[0]
+	}
+
+	return
+}
+
+// lookupJSONObject will return the object found at the JSON path returning
+// errNoMatch unless there is exactly one
+func lookupJSONObject(jsonData interface{}, path string, errNoMatch error) (object map[string]interface{}, err error) {
+	value, err := lookupJSON(jsonData, path, errNoMatch)
+	if err != nil {
+		return
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errNoMatch
+	}
+
+	return
+}
+
+// lookupJSONString will return the string found at the JSON path returning
+// errNoMatch unless there is exactly one
+func lookupJSONString(jsonData interface{}, path string, errNoMatch error) (value string, err error) {
+	match, err := lookupJSON(jsonData, path, errNoMatch)
+	if err != nil {
+		return
+	}
+
+	value, ok := match.(string)
+	if !ok {
+		return value, errNoMatch
+	}
+
+	return
+}
@@ -1,11 +1,11 @@
 package domain
 
 import (
+	"context"
+	"fmt"
 	"net/url"
 	"os"
-	"strings"
 
-	"github.com/peter-jozsa/jsonpath"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/johnwyles/vrddt-droplets/pkg/errors"
@@ -13,49 +13,6 @@ import (
 
 // TODO: Do we add AudioURL, Title, and VideoURL, and VrddtVideo to Validate()?
 
-// TODO: Incorporate errors into pkg/errors
-
-const (
-	// JSONPathForTitle is the JSON path to find the title for a Reddit post
-	JSONPathForTitle = `$.data.children[0].data.title`
-
-	// JSONPathForVideoURL is the JSON path to find the video URL for a Reddit post
-	JSONPathForVideoURL = `$.data.children[0].data.media.reddit_video.fallback_url`
-)
-
-var (
-	// ErrJSONTitle is the error returned when the JSON does not parse in order to find the title
-	ErrJSONTitle = errors.New("JSON data does not have exactly one match for the Title: " + JSONPathForTitle)
-
-	// ErrJSONVideoURL is the error returned when the JSON does not parse in order to find the video URL
-	ErrJSONVideoURL = errors.New("JSON data does not have exactly one match for the video URL: " + JSONPathForVideoURL)
-
-	// ErrNotDASH is the error returned when the video URL found when
-	// attempting to set the audio URL is not a URL containing "DASH_"
-	ErrNotDASH = errors.New("The Reddit video URL does not seem to contain a DASH video")
-
-	// KnownRedditDomains are all of the known Reddit domains prefixed with a "." so
-	// that we do not process any requests for domains which contain a known
-	// Reddit domain name at the end of them (e.g. "foo-reddit.com")
-	KnownRedditDomains = []string{
-		".redd.it",
-		".reddit.com",
-		".redditstatic.com",
-	}
-
-	// RedditDomain will be what to prepend to arbitrary URIs that
-	// come in by a request that we will attempt to locate a valid Reddit URL
-	RedditDomain = "www.reddit.com"
-
-	// TemporaryAudioFilePrefix is the file prefix for the file that will hold
-	// the contents of the audio downloaded
-	TemporaryAudioFilePrefix = "vrddt-input-reddit-audio*.mp4"
-
-	// TemporaryVideoFilePrefix is the file prefix for the file that will hold
-	// the contents of the video downloaded
-	TemporaryVideoFilePrefix = "vrddt-input-reddit-video*.mp4"
-)
-
 // RedditAudio is nothing more than a simpl struct for a file which we may or
 // may not consider any attributes of important in the future, we use this
 // since we are merging both Audio and Video for this project but who knows
@@ -70,15 +27,40 @@ type RedditVideo struct {
 	// AudioURL is the URL to the audio for the reddit video.
 	AudioURL string `json:"audio_url,omitempty" bson:"audio_url,omitempty"`
 
+	// Clip is the range of time of the video the vrddt video was (or is to
+	// be) made from or empty for all of it. It is stored even when it is
+	// empty so that the whole video can be looked up by it.
+	Clip Clip `json:"clip,omitempty" bson:"clip"`
+
 	RedditAudio *RedditAudio `json:"-" bson:"-"`
 
 	FilePath string `json:"-" bson:"-"`
 
 	FileHandle *os.File `json:"-" bson:"-"`
 
+	// Format is the format the vrddt video was (or is to be) made in. The same
+	// URL is stored once for every format it was requested in.
+	Format Format `json:"format,omitempty" bson:"format,omitempty"`
+
+	// Item is the position of the video among the media items of the post
+	// (e.g. in a gallery) starting from 0. Every item is stored as its own
+	// Reddit video.
+	Item int `json:"item,omitempty" bson:"item"`
+
+	// JobID is the ID of the job which requested the Reddit video be
+	// processed. It is only carried on the queue and never stored.
+	JobID bson.ObjectId `json:"job_id,omitempty" bson:"-"`
+
 	// Meta holds the generic information about the vrddt video.
 	Meta `json:",inline,omitempty" bson:",inline,omitempty"`
 
+	// Quality is the quality the video and audio were (or are to be) picked
+	// for. The same URL is stored once for every quality it was requested in.
+	Quality Quality `json:"quality,omitempty" bson:"quality,omitempty"`
+
+	// Source is the name of the source which resolved the URL.
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+
 	// URL should contain a valid URL for the reddit link for the reddit video.
 	URL string `json:"url,omitempty" bson:"url,omitempty"`
 
@@ -134,50 +116,71 @@ func (r *RedditVideo) DownloadAudio() (err error) {
 	return
 }
 
-// SetAudioURL returns the URL to the audio for a given Reddit URL
-func (r *RedditVideo) SetAudioURL() (err error) {
-	if strings.Contains(r.VideoURL, "DASH_") {
-		r.AudioURL = strings.Split(r.VideoURL, "DASH_")[0] + "audio"
-	} else {
-		err = ErrNotDASH
+// SetFinalURL will set the URL as the final URL according to the source
+// which supports the URL
+func (r *RedditVideo) SetFinalURL(ctx context.Context) (err error) {
+	source, err := SourceFor(r.URL)
+	if err != nil {
+		return
 	}
 
-	return
-}
-
-// SetFinalURL will set the URL as the final URL after less than or equal to
-// util.RedirectMax http redirects for the supplied URL
-func (r *RedditVideo) SetFinalURL() (err error) {
-	r.URL, err = GetFinalURL(r.URL)
+	finalURL, err := source.FinalURL(ctx, r.URL)
+	if err != nil {
+		return
+	}
+	r.Source = source.Name()
+	r.URL = finalURL
 
 	return
 }
 
-// SetMetadata sets the title, video URL and audio URL for a given Reddit video from
-// a Reddit URL
-func (r *RedditVideo) SetMetadata() (err error) {
-	jsonURL := r.getJSONURL()
-
-	jsonData, err := GetJSONData(jsonURL)
+// SetMetadata sets the title, video URL and audio URL of the quality for the
+// item of the video, or of the best quality if none was set, from the source
+// which supports the URL
+func (r *RedditVideo) SetMetadata(ctx context.Context) (err error) {
+	source, err := SourceFor(r.URL)
 	if err != nil {
 		return
 	}
 
-	r.Title, err = getTitleFromJSONData(jsonData)
+	quality, err := ParseQuality(string(r.Quality))
 	if err != nil {
 		return
 	}
 
-	r.VideoURL, err = getVideoURLFromJSONData(jsonData)
+	items, err := source.Resolve(ctx, r.URL, quality)
 	if err != nil {
 		return
 	}
-
-	err = r.SetAudioURL()
+	if r.Item < 0 || r.Item >= len(items) {
+		return errors.ResourceNotFound("item", fmt.Sprintf("%d of %d at %s", r.Item, len(items), r.URL))
+	}
+	r.SetMedia(items[r.Item])
 
 	return
 }
 
+// SetMedia sets the title, video URL and audio URL for the video from the
+// media a source resolved its URL to
+func (r *RedditVideo) SetMedia(media *SourceMedia) {
+	r.AudioURL = media.AudioURL
+	r.Item = media.Item
+	r.Quality = media.Quality
+	r.Source = media.Source
+	r.Title = media.Title
+	r.VideoURL = media.VideoURL
+}
+
+// VideoRequest returns the request for the URL of the Reddit video to be made
+// in to vrddt videos in its quality, format and clip for the job which
+// requested it
+func (r RedditVideo) VideoRequest() *VideoRequest {
+	videoRequest := NewVideoRequest(r.URL, r.Quality, r.Format, r.Clip)
+	videoRequest.JobID = r.JobID
+
+	return videoRequest
+}
+
 // Validate performs basic validation of user information.
 func (r RedditVideo) Validate() error {
 	// _, err := url.ParseRequestURI(redditVideo.AudioURL)
@@ -198,6 +201,22 @@ func (r RedditVideo) Validate() error {
 		return errors.InvalidValue("URL", err.Error())
 	}
 
+	if r.Quality != "" {
+		if _, err = ParseQuality(string(r.Quality)); err != nil {
+			return err
+		}
+	}
+
+	if r.Format != "" {
+		if _, err = ParseFormat(string(r.Format)); err != nil {
+			return err
+		}
+	}
+
+	if _, _, err = r.Clip.Range(); err != nil {
+		return err
+	}
+
 	// _, err = url.ParseRequestURI(redditVideo.VideoURL)
 	// if err != nil {
 	// 	return errors.InvalidValue("VideoURL", err.Error())
@@ -209,95 +228,3 @@ func (r RedditVideo) Validate() error {
 
 	return nil
 }
-
-// getJSONURL will return the JSON URL for a Reddit URL
-func (r *RedditVideo) getJSONURL() (redditURL string) {
-	redditURL = strings.TrimRight(r.URL, "/") + ".json"
-
-	return
-}
-
-// setTitle returns the Title of the given Reddit URL
-func (r *RedditVideo) setTitle() (err error) {
-	jsonURL := r.getJSONURL()
-	jsonData, err := GetJSONData(jsonURL)
-	if err != nil {
-		return
-	}
-
-	r.Title, err = getTitleFromJSONData(jsonData)
-
-	return
-}
-
-// setVideoURL returns the URL to the video for a given Reddit URL
-func (r *RedditVideo) setVideoURL() (err error) {
-	jsonURL := r.getJSONURL()
-	jsonData, err := GetJSONData(jsonURL)
-	if err != nil {
-		return
-	}
-
-	r.VideoURL, err = getVideoURLFromJSONData(jsonData)
-
-	return
-}
-
-// getTitleFromJSONData will hunt down the title for a Reddit post from a
-// JSON path
-func getTitleFromJSONData(jsonData interface{}) (title string, err error) {
-	pattern, _ := jsonpath.Compile(JSONPathForTitle)
-	patternMatches, err := pattern.Lookup(jsonData)
-	if err != nil {
-		return
-	}
-
-	matches := patternMatches.([]interface{})
-	if len(matches) != 1 {
-		return title, ErrJSONTitle
-	}
-
-	title = matches[0].(string)
-
-	return
-}
-
-// getVideoURLFromJSONData will hunt down the video URL for a Reddit post from
-// a JSON path
-func getVideoURLFromJSONData(jsonData interface{}) (videoURL string, err error) {
-	pattern, _ := jsonpath.Compile(JSONPathForVideoURL)
-	patternMatches, err := pattern.Lookup(jsonData)
-	if err != nil {
-		return
-	}
-
-	matches := patternMatches.([]interface{})
-	if len(matches) != 1 {
-		return videoURL, ErrJSONVideoURL
-	}
-
-	videoURL = matches[0].(string)
-
-	return
-}
-
-// isRedditURL will validate that whatever has been thrown at us is actually a
-// Reddit URL and saves us time and trouble
-func isRedditURL(originalURL string) (valid bool) {
-	valid = false
-	u, err := url.Parse(originalURL)
-	if err != nil {
-		return
-	}
-
-	host := strings.ToLower(u.Host)
-	for _, validDomain := range KnownRedditDomains {
-		if strings.HasSuffix(host, validDomain) {
-			return true
-		} else if host == strings.TrimPrefix(validDomain, ".") {
-			return true
-		}
-	}
-
-	return
-}
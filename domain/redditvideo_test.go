@@ -45,6 +45,40 @@ func TestRedditVideo_Validate(suite *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			redditVideo: domain.RedditVideo{
+				Meta:    validMeta,
+				Quality: "720p",
+				URL:     validURL,
+			},
+			expectErr: false,
+		},
+		{
+			redditVideo: domain.RedditVideo{
+				Meta:    validMeta,
+				Quality: "hd",
+				URL:     validURL,
+			},
+			expectErr: true,
+			errType:   errors.TypeInvalidValue,
+		},
+		{
+			redditVideo: domain.RedditVideo{
+				Format: domain.FormatGIF,
+				Meta:   validMeta,
+				URL:    validURL,
+			},
+			expectErr: false,
+		},
+		{
+			redditVideo: domain.RedditVideo{
+				Format: "avi",
+				Meta:   validMeta,
+				URL:    validURL,
+			},
+			expectErr: true,
+			errType:   errors.TypeInvalidValue,
+		},
 	}
 
 	for id, cs := range cases {
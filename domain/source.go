@@ -0,0 +1,168 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// Source is a provider of media (e.g. Reddit) which knows which URLs belong
+// to it, how to find the streams for the media behind one of those URLs and
+// how to download them
+type Source interface {
+	// Name is the unique name the source is registered under
+	Name() string
+
+	// Match reports whether the URL is one the source can resolve
+	Match(rawURL string) bool
+
+	// FinalURL returns the canonical URL for the media after following any
+	// redirects
+	FinalURL(ctx context.Context, rawURL string) (finalURL string, err error)
+
+	// Resolve finds the media items at the (final) URL, of which there are
+	// several for posts such as galleries, along with the title and the
+	// video stream and audio stream for the quality of each
+	Resolve(ctx context.Context, rawURL string, quality Quality) (items []*SourceMedia, err error)
+
+	// Download saves the streams of the resolved media to temporary files
+	Download(ctx context.Context, media *SourceMedia) (files *SourceFiles, err error)
+}
+
+// RenditionSource is the rendition of media whose height is not known, which
+// is the only rendition such media is available in
+const RenditionSource = "source"
+
+// SourceMedia is the metadata a source resolved a URL to
+type SourceMedia struct {
+	// AudioURL is the URL to the audio stream which is empty if the media
+	// does not have a separate one
+	AudioURL string `json:"audio_url,omitempty"`
+
+	// Height is the height of the video stream in pixels if it is known
+	Height int `json:"height,omitempty"`
+
+	// Item is the position of the media among the media items at the URL
+	// (e.g. in a gallery) starting from 0
+	Item int `json:"item"`
+
+	// Manifest lists all of the video representations and audio tracks the
+	// streams were selected from if the source knows about them
+	Manifest *Manifest `json:"manifest,omitempty"`
+
+	// Quality is the quality the streams were selected for
+	Quality Quality `json:"quality,omitempty"`
+
+	// Source is the name of the source which resolved the media
+	Source string `json:"source,omitempty"`
+
+	// Title is the title of the media
+	Title string `json:"title,omitempty"`
+
+	// URL is the final URL the media was resolved from
+	URL string `json:"url,omitempty"`
+
+	// VideoURL is the URL to the video stream
+	VideoURL string `json:"video_url,omitempty"`
+
+	// Width is the width of the video stream in pixels if it is known
+	Width int `json:"width,omitempty"`
+}
+
+// Rendition returns the name of the rendition the video stream was selected
+// from, which is its height (e.g. "720p") or RenditionSource if the height is
+// not known
+func (m *SourceMedia) Rendition() string {
+	if m.Height <= 0 {
+		return RenditionSource
+	}
+
+	return fmt.Sprintf("%dp", m.Height)
+}
+
+// SourceFiles are the temporary files a source downloaded the streams of the
+// media to
+type SourceFiles struct {
+	// AudioPath is the path to the audio which is empty if there was no audio
+	AudioPath string
+
+	// VideoPath is the path to the video
+	VideoPath string
+}
+
+// Remove will delete the downloaded files
+func (f *SourceFiles) Remove() {
+	if f.AudioPath != "" {
+		os.Remove(f.AudioPath)
+	}
+	if f.VideoPath != "" {
+		os.Remove(f.VideoPath)
+	}
+}
+
+var (
+	// sources are the registered sources keyed by their name
+	sources = map[string]Source{}
+
+	// sourcesMutex guards sources
+	sourcesMutex sync.RWMutex
+)
+
+func init() {
+	RegisterSource(NewRedditSource())
+}
+
+// RegisterSource makes a source available to SourceFor(). It panics if a
+// source with the same name is registered twice or the source is nil.
+func RegisterSource(source Source) {
+	sourcesMutex.Lock()
+	defer sourcesMutex.Unlock()
+
+	if source == nil {
+		panic("domain: RegisterSource source is nil")
+	}
+	if _, ok := sources[source.Name()]; ok {
+		panic("domain: RegisterSource called twice for source " + source.Name())
+	}
+
+	sources[source.Name()] = source
+}
+
+// SourceFor returns the source which can resolve the URL. Sources are asked
+// in the order of their names and the first one to match is used.
+func SourceFor(rawURL string) (source Source, err error) {
+	sourcesMutex.RLock()
+	defer sourcesMutex.RUnlock()
+
+	for _, name := range sortedSourceNames() {
+		if sources[name].Match(rawURL) {
+			return sources[name], nil
+		}
+	}
+
+	return nil, errors.InvalidValue("url", fmt.Sprintf("No source supports the URL '%s' (supported sources: %s)", rawURL, strings.Join(sortedSourceNames(), ", ")))
+}
+
+// Sources returns the sorted names of the sources which have been registered
+func Sources() (names []string) {
+	sourcesMutex.RLock()
+	defer sourcesMutex.RUnlock()
+
+	return sortedSourceNames()
+}
+
+// sortedSourceNames returns the sorted names of the registered sources and
+// must be called with sourcesMutex held
+func sortedSourceNames() (names []string) {
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
@@ -0,0 +1,389 @@
+package domain_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/httpfixture"
+)
+
+func TestSourceFor(suite *testing.T) {
+	suite.Parallel()
+
+	cases := []struct {
+		url       string
+		expectErr bool
+		source    string
+	}{
+		{url: "https://www.reddit.com/r/MadeMeSmile/comments/apt8tb/need_more_people_like_him/", source: domain.RedditSourceName},
+		{url: "https://v.redd.it/nrkkvdp9uyg21", source: domain.RedditSourceName},
+		{url: "https://reddit.com/r/videos", source: domain.RedditSourceName},
+		{url: "https://foo-reddit.com/r/videos", expectErr: true},
+		{url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", expectErr: true},
+		{url: "foo.html", expectErr: true},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			source, err := domain.SourceFor(cs.url)
+			if cs.expectErr {
+				if errors.Type(err) != errors.TypeInvalidValue {
+					t.Fatalf("expecting error of type '%s', got: %v", errors.TypeInvalidValue, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if source.Name() != cs.source {
+				t.Errorf("expecting source '%s', got '%s'", cs.source, source.Name())
+			}
+		})
+	}
+}
+
+func TestRegisterSource(t *testing.T) {
+	domain.RegisterSource(&fakeSource{name: "test-register"})
+
+	source, err := domain.SourceFor("https://vrddt.test/video")
+	if err != nil {
+		t.Fatalf("expecting the registered source to be found: %s", err)
+	}
+	if source.Name() != "test-register" {
+		t.Errorf("expecting source 'test-register', got '%s'", source.Name())
+	}
+
+	found := false
+	for _, name := range domain.Sources() {
+		found = found || name == "test-register"
+	}
+	if !found {
+		t.Errorf("expecting 'test-register' in the sources, got: %v", domain.Sources())
+	}
+
+	for id, source := range []domain.Source{nil, &fakeSource{name: domain.RedditSourceName}} {
+		t.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expecting RegisterSource to panic")
+				}
+			}()
+			domain.RegisterSource(source)
+		})
+	}
+}
+
+func TestRedditSource_Resolve(suite *testing.T) {
+	suite.Parallel()
+
+	video := domain.SourceMedia{
+		AudioURL: "https://v.redd.it/abc/audio",
+		Source:   domain.RedditSourceName,
+		Title:    "Vortex coin bank",
+		VideoURL: "https://v.redd.it/abc/DASH_720?source=fallback",
+	}
+
+	cases := []struct {
+		body     string
+		err      error
+		expected []domain.SourceMedia
+	}{
+		{
+			body:     `{"data": {"children": [{"data": {"title": "Vortex coin bank", "media": {"reddit_video": {"fallback_url": "https://v.redd.it/abc/DASH_720?source=fallback"}}}}]}}`,
+			expected: []domain.SourceMedia{video},
+		},
+		{
+			body:     `[{"kind": "Listing", "data": {"children": [{"data": {"title": "Vortex coin bank", "media": {"reddit_video": {"fallback_url": "https://v.redd.it/abc/DASH_720?source=fallback"}}}}]}}, {"kind": "Listing", "data": {"children": [{"data": {"body": "Nice"}}]}}]`,
+			expected: []domain.SourceMedia{video},
+		},
+		{
+			body:     `{"data": {"children": [{"data": {"title": "Vortex coin bank", "media": null, "secure_media": {"reddit_video": {"fallback_url": "https://v.redd.it/abc/DASH_720?source=fallback"}}}}]}}`,
+			expected: []domain.SourceMedia{video},
+		},
+		{
+			body:     `{"data": {"children": [{"data": {"title": "Vortex coin bank", "media": null, "crosspost_parent_list": [{"title": "Original", "crosspost_parent_list": [{"title": "Original original", "media": {"reddit_video": {"fallback_url": "https://v.redd.it/abc/DASH_720?source=fallback"}}}]}]}}]}}`,
+			expected: []domain.SourceMedia{video},
+		},
+		{
+			body: `{"data": {"children": [{"data": {"title": "Vortex coin bank", "media": null, "preview": {"reddit_video_preview": {"fallback_url": "https://v.redd.it/abc/DASH_720?source=fallback&amp;a=1", "height": 720, "width": 1280, "is_gif": true}}}}]}}`,
+			expected: []domain.SourceMedia{
+				{AudioURL: video.AudioURL, Height: 720, Source: video.Source, Title: video.Title, VideoURL: "https://v.redd.it/abc/DASH_720?source=fallback&a=1", Width: 1280},
+			},
+		},
+		{
+			body: `{"data": {"children": [{"data": {"title": "Vortex coin bank", "is_gallery": true, "gallery_data": {"items": [{"media_id": "gif"}, {"media_id": "image"}, {"media_id": "failed"}, {"media_id": "missing"}, {"media_id": "video"}]}, "media_metadata": {
+				"gif": {"status": "valid", "e": "AnimatedImage", "m": "image/gif", "s": {"x": 320, "y": 240, "gif": "https://i.redd.it/gif.gif", "mp4": "https://preview.redd.it/gif.gif?format=mp4&amp;s=abc"}},
+				"image": {"status": "valid", "e": "Image", "m": "image/jpg", "s": {"x": 640, "y": 480, "u": "https://preview.redd.it/image.jpg"}},
+				"failed": {"status": "failed"},
+				"video": {"status": "valid", "e": "RedditVideo", "x": 1280, "y": 720, "dashUrl": "https://v.redd.it/link/abc/asset/video/DASHPlaylist.mpd"}
+			}}}]}}`,
+			expected: []domain.SourceMedia{
+				{Height: 240, Source: video.Source, Title: video.Title, VideoURL: "https://preview.redd.it/gif.gif?format=mp4&s=abc", Width: 320},
+				{Height: 480, Item: 1, Source: video.Source, Title: video.Title, VideoURL: "/link/abc/asset/video/DASH_480.mp4", Width: 854},
+			},
+		},
+		{
+			body: `{"data": {"children": [{"data": {"title": "Not a video", "media": {"reddit_video": {"fallback_url": "https://i.redd.it/abc.gif"}}}}]}}`,
+			err:  domain.ErrNotDASH,
+		},
+		{
+			body: `{"data": {"children": [{"data": {"media": {"reddit_video": {"fallback_url": "https://v.redd.it/abc/DASH_720"}}}}]}}`,
+			err:  domain.ErrJSONTitle,
+		},
+		{
+			body: `{"data": {"children": [{"data": {"title": "Not a video", "media": {}}}]}}`,
+			err:  domain.ErrJSONVideoURL,
+		},
+		{
+			body: `{"data": {"children": [{"data": {"title": "Only images", "is_gallery": true, "gallery_data": {"items": [{"media_id": "image"}]}, "media_metadata": {"image": {"status": "valid", "e": "Image", "s": {"u": "https://preview.redd.it/image.jpg"}}}}}]}}`,
+			err:  domain.ErrJSONVideoURL,
+		},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/r/videos/comments/abc/title.json":
+					fmt.Fprint(wr, strings.Replace(cs.body, "https://v.redd.it/link", server.URL+"/link", -1))
+				case "/link/abc/asset/video/DASHPlaylist.mpd":
+					// The manifest for a video in a gallery does not list any
+					// audio
+					fmt.Fprint(wr, dashManifest[:strings.Index(dashManifest, `<AdaptationSet contentType="audio"`)]+"</Period></MPD>")
+				default:
+					http.NotFound(wr, req)
+				}
+			}))
+			defer server.Close()
+
+			url := server.URL + "/r/videos/comments/abc/title/"
+			items, err := domain.NewRedditSource().Resolve(context.Background(), url, "480p")
+			if err != cs.err {
+				t.Fatalf("expecting error '%s', got '%s'", cs.err, err)
+			}
+			if cs.err != nil {
+				return
+			}
+
+			if len(items) != len(cs.expected) {
+				t.Fatalf("expecting %d media items, got %d", len(cs.expected), len(items))
+			}
+			for i, media := range items {
+				expected := cs.expected[i]
+				expected.Quality = "480p"
+				expected.URL = url
+				if strings.HasPrefix(expected.VideoURL, "/") {
+					expected.VideoURL = server.URL + expected.VideoURL
+				}
+
+				// Only the renditions which were picked are compared
+				media.Manifest = nil
+				if *media != expected {
+					t.Errorf("expecting media item %d %#v, got %#v", i, expected, *media)
+				}
+			}
+		})
+	}
+}
+
+func TestRedditSource_ResolveManifest(suite *testing.T) {
+	suite.Parallel()
+
+	cases := []struct {
+		dash      bool
+		hls       bool
+		quality   domain.Quality
+		audioURL  string
+		height    int
+		rendition string
+		videoURL  string
+	}{
+		{dash: true, hls: true, quality: domain.QualityBest, audioURL: "/abc/DASH_audio.mp4", height: 720, rendition: "720p", videoURL: "/abc/DASH_720.mp4"},
+		{dash: true, hls: true, quality: "480p", audioURL: "/abc/DASH_audio.mp4", height: 480, rendition: "480p", videoURL: "/abc/DASH_480.mp4"},
+		{dash: true, quality: domain.QualityWorst, audioURL: "/abc/DASH_AUDIO_64.mp4", height: 270, rendition: "270p", videoURL: "/abc/DASH_240.mp4"},
+		{hls: true, quality: domain.QualityWorst, audioURL: "/abc/HLS_AUDIO_160_K.m3u8", height: 480, rendition: "480p", videoURL: "/abc/HLS_480.m3u8"},
+		{quality: domain.QualityWorst, audioURL: "/abc/audio", rendition: domain.RenditionSource, videoURL: "/abc/DASH_1080.mp4"},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+				switch {
+				case req.URL.Path == "/r/videos/comments/abc/title.json":
+					fmt.Fprintf(wr, `[{"data": {"children": [{"data": {"title": "Vortex coin bank", "media": {"reddit_video": {"dash_url": "%[1]s/abc/DASHPlaylist.mpd", "fallback_url": "%[1]s/abc/DASH_1080.mp4", "hls_url": "%[1]s/abc/HLSPlaylist.m3u8"}}}}]}}]`, server.URL)
+				case req.URL.Path == "/abc/DASHPlaylist.mpd" && cs.dash:
+					fmt.Fprint(wr, strings.Replace(dashManifest, "https://audio.v.redd.it", server.URL, 1))
+				case req.URL.Path == "/abc/HLSPlaylist.m3u8" && cs.hls:
+					fmt.Fprint(wr, hlsPlaylist)
+				default:
+					http.NotFound(wr, req)
+				}
+			}))
+			defer server.Close()
+
+			items, err := domain.NewRedditSource().Resolve(context.Background(), server.URL+"/r/videos/comments/abc/title", cs.quality)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(items) != 1 {
+				t.Fatalf("expecting 1 media item, got %d", len(items))
+			}
+			media := items[0]
+
+			if media.AudioURL != server.URL+cs.audioURL {
+				t.Errorf("expecting audio URL '%s', got '%s'", server.URL+cs.audioURL, media.AudioURL)
+			}
+			if media.VideoURL != server.URL+cs.videoURL {
+				t.Errorf("expecting video URL '%s', got '%s'", server.URL+cs.videoURL, media.VideoURL)
+			}
+			if media.Height != cs.height {
+				t.Errorf("expecting height %d, got %d", cs.height, media.Height)
+			}
+			if media.Rendition() != cs.rendition {
+				t.Errorf("expecting rendition '%s', got '%s'", cs.rendition, media.Rendition())
+			}
+			if (media.Manifest != nil) != (cs.dash || cs.hls) {
+				t.Errorf("expecting a manifest only if there was one to fetch, got: %#v", media.Manifest)
+			}
+		})
+	}
+}
+
+func TestRedditSource_Download(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/abc/DASH_720":
+			fmt.Fprint(wr, "video")
+		case "/abc/HLS_AUDIO_160_K.m3u8":
+			fmt.Fprint(wr, "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4.0,\nHLS_AUDIO_0.m4s\n#EXTINF:4.0,\nHLS_AUDIO_1.m4s\n#EXT-X-ENDLIST\n")
+		case "/abc/init.mp4", "/abc/HLS_AUDIO_0.m4s", "/abc/HLS_AUDIO_1.m4s":
+			fmt.Fprint(wr, req.URL.Path[len("/abc/"):]+";")
+		default:
+			http.NotFound(wr, req)
+		}
+	}))
+	defer server.Close()
+
+	files, err := domain.NewRedditSource().Download(context.Background(), &domain.SourceMedia{
+		AudioURL: server.URL + "/abc/audio",
+		VideoURL: server.URL + "/abc/DASH_720",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer files.Remove()
+
+	// The post not having any audio is not an error
+	if files.AudioPath != "" {
+		t.Errorf("expecting no audio, got: %s", files.AudioPath)
+	}
+
+	video, err := ioutil.ReadFile(files.VideoPath)
+	if err != nil {
+		t.Fatalf("unable to read the downloaded video: %s", err)
+	}
+	if string(video) != "video" {
+		t.Errorf("expecting the video to be downloaded, got: %s", video)
+	}
+
+	// The segments of an HLS playlist are joined
+	files, err = domain.NewRedditSource().Download(context.Background(), &domain.SourceMedia{
+		AudioURL: server.URL + "/abc/HLS_AUDIO_160_K.m3u8",
+		VideoURL: server.URL + "/abc/DASH_720",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer files.Remove()
+
+	audio, err := ioutil.ReadFile(files.AudioPath)
+	if err != nil {
+		t.Fatalf("unable to read the downloaded audio: %s", err)
+	}
+	if string(audio) != "init.mp4;HLS_AUDIO_0.m4s;HLS_AUDIO_1.m4s;" {
+		t.Errorf("expecting the audio segments to be joined, got: %s", audio)
+	}
+}
+
+func TestRedditSource_Fixtures(t *testing.T) {
+	// The fixtures are replayed unless VRDDT_RECORD_FIXTURES=record in which
+	// case they are recorded from Reddit
+	ctx := domain.WithHTTPClient(context.Background(), &http.Client{
+		Transport: httpfixture.NewTransport(
+			filepath.Join("testdata", "fixtures"),
+			httpfixture.ModeFromEnv("VRDDT_RECORD_FIXTURES"),
+			nil,
+		),
+	})
+	source := domain.NewRedditSource()
+
+	finalURL, err := source.FinalURL(ctx, "https://v.redd.it/2x8ncgqftw021")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if finalURL != "https://www.reddit.com/r/mindblowing/comments/9z4buv/vortex_coin_bank/" {
+		t.Errorf("expecting the short link to redirect to the post, got: %s", finalURL)
+	}
+
+	items, err := source.Resolve(ctx, finalURL, "480p")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expecting 1 media item, got %d", len(items))
+	}
+	if items[0].Title != "Vortex coin bank" || items[0].Rendition() != "480p" {
+		t.Errorf("expecting the 480p rendition of 'Vortex coin bank', got the %s rendition of '%s'", items[0].Rendition(), items[0].Title)
+	}
+
+	files, err := source.Download(ctx, items[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer files.Remove()
+
+	for path, expected := range map[string]string{files.VideoPath: "video 480p", files.AudioPath: "audio"} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("unable to read the download: %s", err)
+		}
+		if string(data) != expected {
+			t.Errorf("expecting '%s' to be downloaded, got: %s", expected, data)
+		}
+	}
+}
+
+// fakeSource matches URLs on the vrddt.test host and never resolves any of
+// them
+type fakeSource struct {
+	name string
+}
+
+func (f *fakeSource) Download(ctx context.Context, media *domain.SourceMedia) (*domain.SourceFiles, error) {
+	return nil, errors.NotImplemented("download", f.name)
+}
+
+func (f *fakeSource) FinalURL(ctx context.Context, rawURL string) (string, error) {
+	return rawURL, nil
+}
+
+func (f *fakeSource) Match(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "https://vrddt.test/")
+}
+
+func (f *fakeSource) Name() string { return f.name }
+
+func (f *fakeSource) Resolve(ctx context.Context, rawURL string, quality domain.Quality) ([]*domain.SourceMedia, error) {
+	return nil, errors.NotImplemented("resolve", f.name)
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,7 +13,14 @@ import (
 	"strings"
 )
 
+// httpClientKey is the key of the HTTP client in a context
+type httpClientKey struct{}
+
 var (
+	// HTTPClient is the HTTP client used to make every request unless a
+	// context carries a different one (see WithHTTPClient())
+	HTTPClient = &http.Client{}
+
 	// HTTPHeaders are the default headers we will set before making each
 	// HTTP request
 	HTTPHeaders = map[string]string{
@@ -29,9 +37,63 @@ var (
 	TemporaryDirectoryPrefix = "vrddt-download"
 )
 
+// WithHTTPClient returns a copy of the context which makes the requests done
+// with it use the HTTP client, e.g. one with a transport which replays
+// recorded responses or talks to a fake server
+func WithHTTPClient(ctx context.Context, httpClient *http.Client) context.Context {
+	return context.WithValue(ctx, httpClientKey{}, httpClient)
+}
+
 // DownloadToTemporaryFile is a helper function to download a given URL to a temporary
 // file with a specified prefix
 func DownloadToTemporaryFile(originalURL string, filePrefix string) (outputFile *os.File, err error) {
+	return downloadToTemporaryFile(context.Background(), originalURL, filePrefix)
+}
+
+// GetFinalURL will get the final URL after redirects for a supplied URL
+func GetFinalURL(originalURL string) (finalURL string, err error) {
+	return getFinalURL(context.Background(), originalURL)
+}
+
+// GetJSONData will return the JSON structured data from a URL
+func GetJSONData(url string) (jsonData interface{}, err error) {
+	return getJSONData(context.Background(), url)
+}
+
+// GetJSONDataFromRawData will return a JSON representation of the raw data
+// that is passed in
+func GetJSONDataFromRawData(data []byte) (jsonData interface{}, err error) {
+	if !json.Valid(data) {
+		if len(data) > 100 {
+			data = data[:100]
+		}
+		err = errors.New("Invalid JSON: " + string(data))
+		return
+	}
+
+	json.Unmarshal(data, &jsonData)
+
+	return
+}
+
+// GetRawDataFromURL returns the raw data for a given URL
+func GetRawDataFromURL(originalURL string) (data []byte, err error) {
+	return getRawDataFromURL(context.Background(), originalURL)
+}
+
+// contextHTTPClient returns the HTTP client the context carries or HTTPClient
+// if it does not carry one
+func contextHTTPClient(ctx context.Context) *http.Client {
+	if httpClient, ok := ctx.Value(httpClientKey{}).(*http.Client); ok && httpClient != nil {
+		return httpClient
+	}
+
+	return HTTPClient
+}
+
+// downloadToTemporaryFile will download a given URL to a temporary file with
+// a specified prefix until the context is cancelled
+func downloadToTemporaryFile(ctx context.Context, originalURL string, filePrefix string) (outputFile *os.File, err error) {
 	// Attempt to create a tenporary directory
 	temporaryDirectory, err := ioutil.TempDir(os.TempDir(), TemporaryDirectoryPrefix)
 	if err != nil {
@@ -39,15 +101,11 @@ func DownloadToTemporaryFile(originalURL string, filePrefix string) (outputFile
 	}
 
 	// Get the content
-	httpResponse, err := http.Get(originalURL)
+	httpResponse, err := getContent(ctx, originalURL)
 	if err != nil {
 		return
 	}
 	defer httpResponse.Body.Close()
-	if httpResponse.StatusCode != 200 {
-		err = errors.New("HTTP response for the URL to download is not a 200 response code")
-		return
-	}
 
 	// Attempt to create a temporary file with a specified prefix
 	outputFile, err = ioutil.TempFile(temporaryDirectory, filePrefix)
@@ -61,18 +119,92 @@ func DownloadToTemporaryFile(originalURL string, filePrefix string) (outputFile
 	return
 }
 
-// GetFinalURL will get the final URL after redirects for a supplied URL
-func GetFinalURL(originalURL string) (finalURL string, err error) {
+// downloadHLSToTemporaryFile will download the segments of an HLS media
+// playlist one after the other to a temporary file with a specified prefix
+// until the context is cancelled
+func downloadHLSToTemporaryFile(ctx context.Context, playlistURL string, filePrefix string) (outputFile *os.File, err error) {
+	data, err := getRawDataFromURL(ctx, playlistURL)
+	if err != nil {
+		return
+	}
+
+	segments, err := parseHLSSegments(data, playlistURL)
+	if err != nil {
+		return
+	}
+
+	temporaryDirectory, err := ioutil.TempDir(os.TempDir(), TemporaryDirectoryPrefix)
+	if err != nil {
+		return
+	}
+
+	outputFile, err = ioutil.TempFile(temporaryDirectory, filePrefix)
+	if err != nil {
+		return
+	}
+	defer outputFile.Close()
+
+	for _, segment := range segments {
+		var httpResponse *http.Response
+		httpResponse, err = getContent(ctx, segment)
+		if err != nil {
+			return
+		}
+
+		_, err = io.Copy(outputFile, httpResponse.Body)
+		httpResponse.Body.Close()
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// downloadStreamToTemporaryFile will download a stream to a temporary file
+// with a specified prefix whether the stream is a single file or an HLS
+// media playlist
+func downloadStreamToTemporaryFile(ctx context.Context, streamURL string, filePrefix string) (outputFile *os.File, err error) {
+	if hlsPlaylistURL(streamURL) {
+		return downloadHLSToTemporaryFile(ctx, streamURL, filePrefix)
+	}
+
+	return downloadToTemporaryFile(ctx, streamURL, filePrefix)
+}
+
+// getContent will make a GET request for the URL until the context is
+// cancelled returning an error unless the response is a 200
+func getContent(ctx context.Context, originalURL string) (httpResponse *http.Response, err error) {
+	httpRequest, err := http.NewRequest(http.MethodGet, originalURL, nil)
+	if err != nil {
+		return
+	}
+
+	httpResponse, err = contextHTTPClient(ctx).Do(httpRequest.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	if httpResponse.StatusCode != 200 {
+		httpResponse.Body.Close()
+		return nil, errors.New("HTTP response for the URL to download is not a 200 response code")
+	}
+
+	return
+}
+
+// getFinalURL will get the final URL after redirects for a supplied URL
+// until the context is cancelled
+func getFinalURL(ctx context.Context, originalURL string) (finalURL string, err error) {
 	// Check this is a valid URL
 	_, err = url.Parse(originalURL)
 	if err != nil {
 		return
 	}
 
-	httpClient := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	// The redirects are followed here one at a time
+	httpClient := *contextHTTPClient(ctx)
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
 	}
 
 	nextURL := originalURL
@@ -96,10 +228,11 @@ func GetFinalURL(originalURL string) (finalURL string, err error) {
 		}
 
 		var httpResponse *http.Response
-		httpResponse, err = httpClient.Do(httpRequest)
+		httpResponse, err = httpClient.Do(httpRequest.WithContext(ctx))
 		if err != nil {
 			return
 		}
+		httpResponse.Body.Close()
 
 		if httpResponse.StatusCode == 200 {
 			url := httpResponse.Request.URL
@@ -117,9 +250,10 @@ func GetFinalURL(originalURL string) (finalURL string, err error) {
 	return
 }
 
-// GetJSONData will return the JSON structured data from a URL
-func GetJSONData(url string) (jsonData interface{}, err error) {
-	rawData, err := GetRawDataFromURL(url)
+// getJSONData will return the JSON structured data from a URL until the
+// context is cancelled
+func getJSONData(ctx context.Context, url string) (jsonData interface{}, err error) {
+	rawData, err := getRawDataFromURL(ctx, url)
 	if err != nil {
 		return
 	}
@@ -129,23 +263,9 @@ func GetJSONData(url string) (jsonData interface{}, err error) {
 	return
 }
 
-// GetJSONDataFromRawData will return a JSON representation of the raw data
-// that is passed in
-func GetJSONDataFromRawData(data []byte) (jsonData interface{}, err error) {
-	if !json.Valid(data) {
-		err = errors.New("Invalid JSON: " + string(data[:100]))
-		return
-	}
-
-	json.Unmarshal(data, &jsonData)
-
-	return
-}
-
-// GetRawDataFromURL returns the raw data for a given URL
-func GetRawDataFromURL(originalURL string) (data []byte, err error) {
-	var httpClient http.Client
-
+// getRawDataFromURL returns the raw data for a given URL until the context is
+// cancelled
+func getRawDataFromURL(ctx context.Context, originalURL string) (data []byte, err error) {
 	httpRequest, err := http.NewRequest(http.MethodGet, originalURL, nil)
 	if err != nil {
 		return
@@ -156,10 +276,11 @@ func GetRawDataFromURL(originalURL string) (data []byte, err error) {
 		httpRequest.Header.Add(key, value)
 	}
 
-	httpResponse, err := httpClient.Do(httpRequest)
+	httpResponse, err := contextHTTPClient(ctx).Do(httpRequest.WithContext(ctx))
 	if err != nil {
 		return
 	}
+	defer httpResponse.Body.Close()
 
 	data, err = ioutil.ReadAll(httpResponse.Body)
 
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"net/url"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// VideoRequest represents a request for the video at a URL of any registered
+// source to be made in to vrddt videos, which is what is queued for a worker.
+type VideoRequest struct {
+	// Clip is the range of time of the video to make the vrddt videos from or
+	// empty for all of it.
+	Clip Clip `json:"clip,omitempty"`
+
+	// Format is the format to make the vrddt videos in.
+	Format Format `json:"format,omitempty"`
+
+	// JobID is the ID of the job which requested the video, if there was one.
+	JobID bson.ObjectId `json:"job_id,omitempty"`
+
+	// Quality is the quality to pick the video and audio for.
+	Quality Quality `json:"quality,omitempty"`
+
+	// URL is the URL of the video at its source.
+	URL string `json:"url,omitempty"`
+}
+
+// NewVideoRequest will return a new request for the video at the URL in the
+// quality, format and clip.
+func NewVideoRequest(url string, quality Quality, format Format, clip Clip) *VideoRequest {
+	return &VideoRequest{
+		Clip:    clip,
+		Format:  format,
+		Quality: quality,
+		URL:     url,
+	}
+}
+
+// SetFinalURL will set the URL as the final URL according to the source
+// which supports the URL
+func (v *VideoRequest) SetFinalURL(ctx context.Context) (err error) {
+	source, err := SourceFor(v.URL)
+	if err != nil {
+		return
+	}
+
+	finalURL, err := source.FinalURL(ctx, v.URL)
+	if err != nil {
+		return
+	}
+	v.URL = finalURL
+
+	return
+}
+
+// Validate performs validation of the video request.
+func (v VideoRequest) Validate() error {
+	if v.URL == "" {
+		return errors.MissingField("URL")
+	}
+
+	if _, err := url.ParseRequestURI(v.URL); err != nil {
+		return errors.InvalidValue("URL", err.Error())
+	}
+
+	if v.Quality != "" {
+		if _, err := ParseQuality(string(v.Quality)); err != nil {
+			return err
+		}
+	}
+
+	if v.Format != "" {
+		if _, err := ParseFormat(string(v.Format)); err != nil {
+			return err
+		}
+	}
+
+	if _, _, err := v.Clip.Range(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package domain_test
+
+import (
+	"fmt"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+func TestVideoRequest_Validate(suite *testing.T) {
+	suite.Parallel()
+
+	validURL := "https://www.reddit.com/r/MadeMeSmile/comments/apt8tb/need_more_people_like_him/"
+
+	cases := []struct {
+		errType      string
+		videoRequest *domain.VideoRequest
+	}{
+		{errType: errors.TypeMissingField, videoRequest: &domain.VideoRequest{}},
+		{errType: errors.TypeInvalidValue, videoRequest: domain.NewVideoRequest("foo.html", "", "", "")},
+		{videoRequest: domain.NewVideoRequest(validURL, "", "", "")},
+		{videoRequest: domain.NewVideoRequest(validURL, "720p", domain.FormatGIF, "5-15")},
+		{errType: errors.TypeInvalidValue, videoRequest: domain.NewVideoRequest(validURL, "hd", "", "")},
+		{errType: errors.TypeInvalidValue, videoRequest: domain.NewVideoRequest(validURL, "", "avi", "")},
+		{errType: errors.TypeInvalidValue, videoRequest: domain.NewVideoRequest(validURL, "", "", "15-5")},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("#%d", id), func(t *testing.T) {
+			err := cs.videoRequest.Validate()
+			if errors.Type(err) != cs.errType && !(cs.errType == "" && err == nil) {
+				t.Errorf("expecting error type '%s', got: %v", cs.errType, err)
+			}
+		})
+	}
+}
+
+func TestRedditVideo_VideoRequest(t *testing.T) {
+	redditVideo := domain.NewRedditVideo()
+	redditVideo.Clip = "5-15"
+	redditVideo.Format = domain.FormatWebM
+	redditVideo.JobID = bson.NewObjectId()
+	redditVideo.Quality = "480p"
+	redditVideo.URL = "https://v.redd.it/2x8ncgqftw021"
+
+	expected := &domain.VideoRequest{
+		Clip:    redditVideo.Clip,
+		Format:  redditVideo.Format,
+		JobID:   redditVideo.JobID,
+		Quality: redditVideo.Quality,
+		URL:     redditVideo.URL,
+	}
+	if videoRequest := redditVideo.VideoRequest(); *videoRequest != *expected {
+		t.Errorf("expecting %#v, got %#v", expected, videoRequest)
+	}
+}
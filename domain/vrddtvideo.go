@@ -12,11 +12,64 @@ type VrddtVideo struct {
 	// Meta holds the generic information about the vrddt video.
 	Meta `json:",inline" bson:",inline"`
 
+	// AudioCodec is the codec of the audio of the vrddt video (e.g. "aac")
+	// or empty if it does not have any audio or was not probed.
+	AudioCodec string `json:"audio_codec,omitempty" bson:"audio_codec,omitempty"`
+
+	// Clip is the range of time of the source media the vrddt video was made
+	// from or empty if it is all of it. It is stored even when it is empty
+	// so that the whole video can be looked up by it.
+	Clip Clip `json:"clip,omitempty" bson:"clip"`
+
+	// ContentType is the media type of the vrddt video (e.g. "video/mp4").
+	ContentType string `json:"content_type,omitempty" bson:"content_type,omitempty"`
+
+	// Duration is the number of seconds the vrddt video plays for or zero if
+	// it was not probed.
+	Duration float64 `json:"duration,omitempty" bson:"duration,omitempty"`
+
+	// Format is the format the vrddt video is in, or FormatMP4 if it is not
+	// set.
+	Format Format `json:"format,omitempty" bson:"format,omitempty"`
+
+	// HasAudio is whether the vrddt video has any audio or nil if it was not
+	// probed, so that a vrddt video which is not known to have audio is not
+	// mistaken for one without any.
+	HasAudio *bool `json:"has_audio,omitempty" bson:"has_audio,omitempty"`
+
+	// Height is the height of the video of the vrddt video in pixels or zero
+	// if it is only audio or was not probed.
+	Height int `json:"height,omitempty" bson:"height,omitempty"`
+
 	// MD5 is the md5 hash of the contents of the vrddt video.
 	MD5 []byte `json:"md5,omitempty" bson:"md5,omitempty"`
 
+	// Rendition is the rendition of the source media the vrddt video was
+	// made from (e.g. "720p"). A vrddt video is unique by its MD5, its
+	// rendition, its clip and its format.
+	Rendition string `json:"rendition,omitempty" bson:"rendition,omitempty"`
+
+	// SizeBytes is the size of the vrddt video in bytes.
+	SizeBytes int64 `json:"size_bytes,omitempty" bson:"size_bytes,omitempty"`
+
+	// SpriteURL represents a publicly accessible path to a sprite sheet of
+	// frames from across the vrddt video, if one was made.
+	SpriteURL string `json:"sprite_url,omitempty" bson:"sprite_url,omitempty"`
+
+	// ThumbnailURL represents a publicly accessible path to the poster frame
+	// of the vrddt video, if one was taken.
+	ThumbnailURL string `json:"thumbnail_url,omitempty" bson:"thumbnail_url,omitempty"`
+
 	// URL represents a publicly accessibly path to the asset.
 	URL string `json:"url,omitempty" bson:"url,omitempty"`
+
+	// VideoCodec is the codec of the video of the vrddt video (e.g. "h264")
+	// or empty if it is only audio or was not probed.
+	VideoCodec string `json:"video_codec,omitempty" bson:"video_codec,omitempty"`
+
+	// Width is the width of the video of the vrddt video in pixels or zero if
+	// it is only audio or was not probed.
+	Width int `json:"width,omitempty" bson:"width,omitempty"`
 }
 
 // NewVrddtVideo will return a new vrddt video.
@@ -1,7 +1,9 @@
 package domain_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"gopkg.in/mgo.v2/bson"
@@ -85,3 +87,36 @@ func TestVrddtVideo_Validate(suite *testing.T) {
 		})
 	}
 }
+
+func TestVrddtVideo_HasAudioJSON(suite *testing.T) {
+	suite.Parallel()
+
+	hasAudio := true
+	noAudio := false
+
+	cases := []struct {
+		hasAudio *bool
+		json     string
+	}{
+		// A vrddt video which was not probed is not said to have no audio
+		{hasAudio: nil, json: ""},
+		{hasAudio: &noAudio, json: `"has_audio":false`},
+		{hasAudio: &hasAudio, json: `"has_audio":true`},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("#%d", id), func(t *testing.T) {
+			data, err := json.Marshal(domain.VrddtVideo{HasAudio: cs.hasAudio})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if cs.json == "" && strings.Contains(string(data), "has_audio") {
+				t.Errorf("expecting no has_audio, got %s", data)
+			}
+			if cs.json != "" && !strings.Contains(string(data), cs.json) {
+				t.Errorf("expecting %s, got %s", cs.json, data)
+			}
+		})
+	}
+}
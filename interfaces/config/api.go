@@ -5,5 +5,10 @@ type APIConfig struct {
 	Address         string
 	CertFile        string
 	GracefulTimeout int
-	KeyFile         string
+
+	// HTTPAddress is an optional address to serve plain HTTP on alongside
+	// the HTTPS Address
+	HTTPAddress string
+
+	KeyFile string
 }
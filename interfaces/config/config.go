@@ -7,6 +7,7 @@ type Config struct {
 	Converter ConverterConfig
 	Storage   StorageConfig
 	Log       LogConfig
+	PubSub    PubSubConfig
 	Queue     QueueConfig
 	Store     StoreConfig
 	Web       WebConfig
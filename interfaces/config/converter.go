@@ -1,11 +1,15 @@
 package config
 
-// ConverterType is the type of converter
-type ConverterType int
+// ConverterType is the name of a type of converter
+type ConverterType string
 
 const (
 	// ConverterFFmpeg is the type reserved for a FFmpeg converter
-	ConverterFFmpeg ConverterType = iota
+	ConverterFFmpeg ConverterType = "ffmpeg"
+
+	// ConverterMP4 is the type reserved for the pure Go MP4 muxer which falls
+	// back to FFmpeg
+	ConverterMP4 ConverterType = "mp4"
 )
 
 // ConverterConfig holds all the different implmentations for video conversion
@@ -14,7 +18,7 @@ type ConverterConfig struct {
 	Type   ConverterType
 }
 
-// String will return the string representation of the iota
+// String will return the name of the type
 func (c ConverterType) String() string {
-	return [...]string{"ffmpeg"}[c]
+	return string(c)
 }
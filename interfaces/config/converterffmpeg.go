@@ -3,4 +3,8 @@ package config
 // ConverterFFmpegConfig stores the configuration for the FFmpeg program
 type ConverterFFmpegConfig struct {
 	Path string
+
+	// ProbePath is the path of FFprobe, which is looked for next to FFmpeg
+	// and then in the path if it is not given
+	ProbePath string
 }
@@ -0,0 +1,25 @@
+package config
+
+// PubSubType is the name of a type of publish / subscribe service
+type PubSubType string
+
+const (
+	// PubSubConfigMemory is the type reserved for a Memory pub/sub type
+	PubSubConfigMemory PubSubType = "memory"
+
+	// PubSubConfigRabbitMQ is the type reserved for a RabbitMQ pub/sub type
+	PubSubConfigRabbitMQ PubSubType = "rabbitmq"
+)
+
+// PubSubConfig holds all the different implentations for a publish /
+// subscribe service
+type PubSubConfig struct {
+	Memory   PubSubMemoryConfig
+	RabbitMQ PubSubRabbitMQConfig
+	Type     PubSubType
+}
+
+// String will return the name of the type
+func (p PubSubType) String() string {
+	return string(p)
+}
@@ -0,0 +1,8 @@
+package config
+
+// PubSubMemoryConfig has the configuration for the in-memory pub/sub
+type PubSubMemoryConfig struct {
+	// BufferSize is the number of events held for each subscriber before
+	// events are dropped for it
+	BufferSize int
+}
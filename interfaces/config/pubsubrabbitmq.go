@@ -0,0 +1,9 @@
+package config
+
+// PubSubRabbitMQConfig stores the configuration for the RabbitMQ pub/sub
+type PubSubRabbitMQConfig struct {
+	// ExchangeName is the fanout exchange every event is published to
+	ExchangeName string
+
+	URI string
+}
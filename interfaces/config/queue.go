@@ -1,14 +1,14 @@
 package config
 
-// QueueType is the type of queue
-type QueueType int
+// QueueType is the name of a type of queue
+type QueueType string
 
 const (
 	// QueueConfigMemory is the type reserved for a Memory queue type
-	QueueConfigMemory QueueType = iota
+	QueueConfigMemory QueueType = "memory"
 
 	// QueueConfigRabbitMQ is the type reserved for a RabbitMQ queue type
-	QueueConfigRabbitMQ QueueType = iota
+	QueueConfigRabbitMQ QueueType = "rabbitmq"
 )
 
 // QueueConfig holds all the different implentations for a queue service
@@ -18,7 +18,7 @@ type QueueConfig struct {
 	Type     QueueType
 }
 
-// String will return the string representation of the iota
+// String will return the name of the type
 func (q QueueType) String() string {
-	return [...]string{"memory", "rabbitmq"}[q]
+	return string(q)
 }
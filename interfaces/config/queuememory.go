@@ -3,4 +3,8 @@ package config
 // QueueMemoryConfig has the configuration for the in-memory queue
 type QueueMemoryConfig struct {
 	MaxSize int
+
+	// VisibilityTimeout is the number of seconds a popped message may go
+	// without being acknowledged before it is delivered again
+	VisibilityTimeout int
 }
@@ -3,7 +3,23 @@ package config
 // QueueRabbitMQConfig stores the configuration for the RabbitMQ queue
 type QueueRabbitMQConfig struct {
 	BindingKeyName string
-	ExchangeName   string
-	QueueName      string
-	URI            string
+
+	// DeadLetterQueueName is the queue messages are moved to once they can no
+	// longer be processed (defaults to QueueName with a ".dead-letter" suffix)
+	DeadLetterQueueName string
+
+	ExchangeName string
+
+	// Prefetch is the number of unacknowledged messages a consumer may hold
+	// at once (defaults to 1)
+	Prefetch int
+
+	QueueName string
+
+	// RetryQueueName is the prefix of the queues messages wait in before
+	// they are delivered again, one for each delay suffixed with its number
+	// of milliseconds (defaults to QueueName with a ".retry" suffix)
+	RetryQueueName string
+
+	URI string
 }
@@ -1,27 +1,28 @@
 package config
 
-// StorageType is the type of storage
-type StorageType int
+// StorageType is the name of a type of storage
+type StorageType string
 
 const (
 	// StorageConfigGCS is the type reserved for GCS storage
-	StorageConfigGCS StorageType = iota
+	StorageConfigGCS StorageType = "gcs"
 
 	// StorageConfigS3 is the type reserved for S3 storage
-	StorageConfigS3 StorageType = iota
+	StorageConfigS3 StorageType = "s3"
 
 	// StorageConfigLocal is the type reserved for local storage
-	StorageConfigLocal StorageType = iota
+	StorageConfigLocal StorageType = "local"
 )
 
 // StorageConfig holds all the different implementations for cloud storage
 type StorageConfig struct {
 	GCS   StorageGCSConfig
 	Local StorageLocalConfig
+	S3    StorageS3Config
 	Type  StorageType
 }
 
-// String will return the string representation of the iota
+// String will return the name of the type
 func (s StorageType) String() string {
-	return [...]string{"gcs", "s3", "local"}[s]
+	return string(s)
 }
@@ -2,5 +2,9 @@ package config
 
 // StorageLocalConfig stores the configuraiton for Local storage
 type StorageLocalConfig struct {
-	Path string
+	// BaseURL is the URL prefix that GetLocation will return for files (e.g.
+	// "http://localhost:8000/media") and if it is empty a "file://" URL is
+	// returned instead
+	BaseURL string
+	Path    string
 }
@@ -2,5 +2,34 @@ package config
 
 // StorageS3Config stores the configuraiton for S3 storage
 type StorageS3Config struct {
-	Bucket string
+	AccessKeyID string
+	Bucket      string
+
+	// Endpoint is the URL of the S3 compatible service (e.g.
+	// "http://localhost:9000" for MinIO) and if it is empty the AWS endpoint
+	// for the region is used
+	Endpoint string
+
+	// PartSize is the size in megabytes of each part of a multipart upload.
+	// Files larger than this are uploaded in parts (defaults to 16 and
+	// must be at least 5)
+	PartSize int
+
+	// PathStyle addresses the bucket in the path of the URL rather than in
+	// the host name which most S3 compatible services require
+	PathStyle bool
+
+	// PresignExpiry is the number of seconds a URL returned for a private
+	// file is valid for (defaults to 7 days which is also the maximum)
+	PresignExpiry int
+
+	// Public uploads files readable by anyone and returns plain URLs for
+	// them instead of presigned URLs
+	Public bool
+
+	Region          string
+	SecretAccessKey string
+
+	// SessionToken is only needed for temporary credentials
+	SessionToken string
 }
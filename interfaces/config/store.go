@@ -1,14 +1,14 @@
 package config
 
-// StoreType is the type of store
-type StoreType int
+// StoreType is the name of a type of store
+type StoreType string
 
 const (
 	// StoreConfigeMemory is the type reserved for a memory store
-	StoreConfigeMemory StoreType = iota
+	StoreConfigeMemory StoreType = "memory"
 
 	// StoreConfigMongo is the type reserved for a Mongo store
-	StoreConfigMongo StoreType = iota
+	StoreConfigMongo StoreType = "mongo"
 )
 
 // StoreConfig holds all the different implementations for a persistence store service
@@ -18,7 +18,7 @@ type StoreConfig struct {
 	Type   StoreType
 }
 
-// String will return the string representation of the iota
+// String will return the name of the type
 func (s StoreType) String() string {
-	return [...]string{"memory", "mongo"}[s]
+	return string(s)
 }
@@ -2,6 +2,7 @@ package config
 
 // StoreMongoConfig stores the configuration for the Mongo persistence store
 type StoreMongoConfig struct {
+	JobsCollectionName         string
 	RedditVideosCollectionName string
 	Timeout                    int
 	URI                        string
@@ -5,8 +5,13 @@ type WebConfig struct {
 	Address         string
 	CertFile        string
 	GracefulTimeout int
-	KeyFile         string
-	StaticDir       string
-	TemplateDir     string
-	VrddtAPIURI     string
+
+	// HTTPAddress is an optional address to serve plain HTTP on alongside
+	// the HTTPS Address
+	HTTPAddress string
+
+	KeyFile     string
+	StaticDir   string
+	TemplateDir string
+	VrddtAPIURI string
 }
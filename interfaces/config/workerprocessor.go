@@ -3,6 +3,42 @@ package config
 // WorkerProcessorConfig holds all the configuration for the worker that performs
 // video conversion
 type WorkerProcessorConfig struct {
+	// Concurrency is the number of pieces of work processed at once
+	Concurrency int
+
+	// GraceTimeout is the number of seconds work which has already started
+	// is given to finish once the worker is asked to shut down
+	GraceTimeout int
+
+	// MaxAttempts is the number of times a piece of work is attempted before
+	// it is moved to the dead-letter queue
+	MaxAttempts int
+
 	MaxErrors int
-	Sleep     int
+
+	// RetryBackoff is the number of milliseconds to wait before retrying work
+	// for the first time which doubles for every attempt after that
+	RetryBackoff int
+
+	// RetryMaxBackoff is the most number of milliseconds to wait before
+	// retrying work
+	RetryMaxBackoff int
+
+	// RetryableErrors is a comma separated list of the pkg/errors types which
+	// are worth retrying (e.g. "ConnectionFailure,ConnectionTimeout")
+	RetryableErrors string
+
+	Sleep int
+
+	// SpriteFrames is the number of frames in the sprite sheet made of every
+	// vrddt video or zero for no sprite sheets
+	SpriteFrames int
+
+	// ThumbnailFormat is the format of the thumbnails and sprite sheets
+	// (jpeg or webp)
+	ThumbnailFormat string
+
+	// ThumbnailOffset is the number of milliseconds in to every vrddt video
+	// its thumbnail is taken from
+	ThumbnailOffset int
 }
@@ -2,12 +2,180 @@ package converter
 
 import (
 	"context"
+	"fmt"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 )
 
 // TODO: Implement URLs?
 
+const (
+	// CodecCopy is the codec which copies a stream as it is instead of
+	// encoding it again
+	CodecCopy = "copy"
+)
+
+// ClipVideoCodec is the codec a video which would be copied is encoded with
+// instead when it is clipped somewhere other than a key frame
+var ClipVideoCodec = "libx264"
+
 // Converter is the generic interface for a audio and video converter
 type Converter interface {
-	Convert(ctx context.Context, inputVideoPath string, inputAudioPath string, outputVideoPath string) (err error)
+	Convert(ctx context.Context, inputVideoPath string, inputAudioPath string, outputVideoPath string, options *ConvertOptions) (err error)
 	Init(ctx context.Context) (err error)
 }
+
+// ConvertOptions are the options for a conversion. The zero value of a field
+// means the value from DefaultConvertOptions() for the container and codecs
+// and no limit for the maximum duration and size.
+type ConvertOptions struct {
+	// AudioBitrate is the bitrate the audio is encoded at (e.g. "128k") or
+	// empty for the default of the audio codec
+	AudioBitrate string
+
+	// AudioCodec is the codec the audio is encoded with or CodecCopy
+	AudioCodec string
+
+	// Container is the format of the output (e.g. "mp4")
+	Container string
+
+	// DropAudio leaves the audio out of the output (e.g. for a GIF)
+	DropAudio bool
+
+	// DropVideo leaves the video out of the output (e.g. for an MP3)
+	DropVideo bool
+
+	// FastStart moves the index of an MP4 to the front so that it can be
+	// played before it has finished downloading
+	FastStart bool
+
+	// MaxDuration is the duration after which the output is cut off, which
+	// with Start is the end of a clip
+	MaxDuration time.Duration
+
+	// MaxSize is the size in bytes after which the output is cut off
+	MaxSize int64
+
+	// Progress is called with the progress of the conversion as it is made
+	Progress func(progress Progress)
+
+	// Start is where in the inputs the output starts. The inputs are seeked
+	// to the key frame at or before it, and a video which is copied is
+	// encoded again with ClipVideoCodec when there is not a key frame there
+	// so that the output starts exactly at it.
+	Start time.Duration
+
+	// VideoCodec is the codec the video is encoded with or CodecCopy
+	VideoCodec string
+
+	// VideoCRF is the constant rate factor the video is encoded at, where
+	// lower is better, or zero for the default of the video codec
+	VideoCRF int
+
+	// VideoFilter is the FFmpeg filter graph the video is passed through or
+	// empty for none
+	VideoFilter string
+}
+
+// Progress is how far along a conversion is
+type Progress struct {
+	// Done is set for the last progress of a conversion
+	Done bool
+
+	// Duration is the duration of the output once converted or zero if it is
+	// not known
+	Duration time.Duration
+
+	// OutTime is the duration of the output converted so far
+	OutTime time.Duration
+
+	// Percent is the percentage (0 to 100) of the conversion which is done or
+	// zero if the duration is not known
+	Percent float64
+
+	// Size is the size in bytes of the output converted so far
+	Size int64
+
+	// Speed is how many times faster than realtime the conversion is running
+	Speed float64
+}
+
+// DefaultConvertOptions returns the options which copy the video and encode
+// the audio as AAC in to an MP4 which can be played while it is downloaded
+func DefaultConvertOptions() *ConvertOptions {
+	return &ConvertOptions{
+		AudioCodec: "aac",
+		Container:  "mp4",
+		FastStart:  true,
+		VideoCodec: CodecCopy,
+	}
+}
+
+// FormatOptions returns the options which convert a video in to one of the
+// formats of the domain (e.g. "gif")
+func FormatOptions(format string) (options *ConvertOptions, err error) {
+	switch format {
+	case "", "mp4":
+		options = DefaultConvertOptions()
+	case "webm":
+		options = &ConvertOptions{
+			AudioBitrate: "128k",
+			AudioCodec:   "libopus",
+			Container:    "webm",
+			VideoCodec:   "libvpx-vp9",
+			VideoCRF:     33,
+		}
+	case "gif":
+		// A palette made from the video itself keeps the colours of a GIF
+		// from banding
+		options = &ConvertOptions{
+			Container:   "gif",
+			DropAudio:   true,
+			VideoCodec:  "gif",
+			VideoFilter: "fps=15,scale=480:-1:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+		}
+	case "mp3":
+		options = &ConvertOptions{
+			AudioBitrate: "192k",
+			AudioCodec:   "libmp3lame",
+			Container:    "mp3",
+			DropVideo:    true,
+		}
+	case "m4a":
+		// Reddit audio is already AAC so it is only copied in to its own
+		// container
+		options = &ConvertOptions{
+			AudioCodec: CodecCopy,
+			Container:  "ipod",
+			DropVideo:  true,
+			FastStart:  true,
+		}
+	default:
+		err = errors.InvalidValue("format", fmt.Sprintf("No conversion to the format '%s'", format))
+	}
+
+	return
+}
+
+// withDefaults returns a copy of the options with the empty container and
+// codecs set to their defaults
+func (o *ConvertOptions) withDefaults() *ConvertOptions {
+	defaults := DefaultConvertOptions()
+	if o == nil {
+		return defaults
+	}
+
+	options := *o
+	if options.AudioCodec == "" {
+		options.AudioCodec = defaults.AudioCodec
+	}
+	if options.Container == "" {
+		options.Container = defaults.Container
+	}
+	if options.VideoCodec == "" {
+		options.VideoCodec = defaults.VideoCodec
+	}
+
+	return &options
+}
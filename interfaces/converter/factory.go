@@ -0,0 +1,74 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+// Factory builds a converter from its section of the configuration
+type Factory func(cfg *config.ConverterConfig, loggerHandle logger.Logger) (converter Converter, err error)
+
+var (
+	// factories are the converters which can be built by New() keyed by their
+	// type
+	factories = map[config.ConverterType]Factory{}
+
+	// factoriesMutex guards factories
+	factoriesMutex sync.RWMutex
+)
+
+func init() {
+	Register(config.ConverterFFmpeg, func(cfg *config.ConverterConfig, loggerHandle logger.Logger) (Converter, error) {
+		return FFmpeg(&cfg.FFmpeg, loggerHandle)
+	})
+	Register(config.ConverterMP4, MP4)
+}
+
+// New builds the converter named by the type in the configuration
+func New(cfg *config.ConverterConfig, loggerHandle logger.Logger) (converter Converter, err error) {
+	factoriesMutex.RLock()
+	factory, ok := factories[cfg.Type]
+	factoriesMutex.RUnlock()
+
+	if !ok {
+		return nil, errors.InvalidValue("Converter.Type", fmt.Sprintf("Unknown converter type '%s' (must be one of: %s)", cfg.Type, strings.Join(Types(), ", ")))
+	}
+
+	return factory(cfg, loggerHandle)
+}
+
+// Register makes a converter available to New() by its type. It panics if
+// the type is registered twice or the factory is nil.
+func Register(converterType config.ConverterType, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if factory == nil {
+		panic("converter: Register factory is nil")
+	}
+	if _, ok := factories[converterType]; ok {
+		panic("converter: Register called twice for type " + converterType.String())
+	}
+
+	factories[converterType] = factory
+}
+
+// Types returns the sorted types of the converters which have been
+// registered
+func Types() (types []string) {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	for converterType := range factories {
+		types = append(types, converterType.String())
+	}
+	sort.Strings(types)
+
+	return
+}
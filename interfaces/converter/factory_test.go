@@ -0,0 +1,46 @@
+package converter_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestNew(suite *testing.T) {
+	cases := []struct {
+		converterType config.ConverterType
+		expectedType  string
+		path          string
+	}{
+		{converterType: config.ConverterFFmpeg, path: "sh"},
+		{converterType: config.ConverterFFmpeg, expectedType: errors.TypeUnknown, path: "vrddt-missing-ffmpeg"},
+		// The muxer does not need FFmpeg
+		{converterType: config.ConverterMP4, path: "vrddt-missing-ffmpeg"},
+		{converterType: "handbrake", expectedType: errors.TypeInvalidValue, path: "sh"},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			c, err := converter.New(
+				&config.ConverterConfig{
+					FFmpeg: config.ConverterFFmpegConfig{Path: cs.path},
+					Type:   cs.converterType,
+				},
+				logger.New(ioutil.Discard, "error", "text"),
+			)
+			if actualType := errors.Type(err); err != nil && actualType != cs.expectedType {
+				t.Fatalf("expecting error type '%s', got '%s'", cs.expectedType, actualType)
+			} else if err == nil && cs.expectedType != "" {
+				t.Fatalf("expecting error type '%s', got none", cs.expectedType)
+			}
+			if err == nil && c == nil {
+				t.Errorf("expecting a converter, got nil")
+			}
+		})
+	}
+}
@@ -1,19 +1,36 @@
 package converter
 
 import (
+	"bufio"
 	"context"
-	"os"
+	"io"
+	"math"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"github.com/johnwyles/vrddt-droplets/pkg/logger"
 )
 
+var (
+	// FastStartContainers are the containers which can have their index moved
+	// to the front
+	FastStartContainers = []string{"ipod", "mov", "mp4"}
+
+	// StderrTailLines is how many of the last lines FFmpeg wrote to stderr are
+	// kept for the error when it fails
+	StderrTailLines = 10
+)
+
 // ffmpeg holds the information relating to the FFmpeg executable
 type ffmpeg struct {
-	Path string
-	log  logger.Logger
+	Path      string
+	ProbePath string
+	log       logger.Logger
 }
 
 // FFmpeg sets up an FFmpeg converter
@@ -25,69 +42,331 @@ func FFmpeg(cfg *config.ConverterFFmpegConfig, loggerHandle logger.Logger) (conv
 		return
 	}
 
+	probePath, err := getProbePath(cfg.ProbePath, ffmpegPath)
+	if err != nil {
+		loggerHandle.Warnf("FFprobe could not be found so media will not be probed: %s", err)
+		probePath = ""
+		err = nil
+	}
+
 	converter = &ffmpeg{
-		Path: ffmpegPath,
-		log:  loggerHandle,
+		Path:      ffmpegPath,
+		ProbePath: probePath,
+		log:       loggerHandle,
 	}
 
 	return
 }
 
-// ConvertFiles is the method to convert the files
-func (f *ffmpeg) Convert(ctx context.Context, inputVideoPath string, inputAudioPath string, outputVideoPath string) (err error) {
-	ffmpegArguments := []string{
+// Convert runs FFmpeg to convert the video, and the audio if there is any, in
+// to the output with the options, reporting its progress to the progress
+// callback of the options. FFmpeg is killed if the context is cancelled.
+func (f *ffmpeg) Convert(ctx context.Context, inputVideoPath string, inputAudioPath string, outputVideoPath string, options *ConvertOptions) (err error) {
+	options = options.withDefaults()
+	if options.Start > 0 && options.VideoCodec == CodecCopy && !options.DropVideo && !startsOnKeyframe(inputVideoPath, options.Start) {
+		f.log.Debugf("Encoding the video with %s as the clip does not start on a key frame", ClipVideoCodec)
+		options.VideoCodec = ClipVideoCodec
+	}
+	ffmpegArguments := ffmpegArguments(inputVideoPath, inputAudioPath, outputVideoPath, options)
+
+	duration := func(inputDuration time.Duration) time.Duration {
+		return outputDuration(inputDuration, options.Start, options.MaxDuration)
+	}
+
+	return f.run(ctx, ffmpegArguments, duration, options.Progress)
+}
+
+// Init is the initialization routine
+func (f *ffmpeg) Init(ctx context.Context) (err error) {
+	return
+}
+
+// Sprite runs FFmpeg to make a sprite sheet of frames spread evenly over the
+// video
+func (f *ffmpeg) Sprite(ctx context.Context, inputVideoPath string, outputImagePath string, options *SpriteOptions) (err error) {
+	arguments, err := spriteArguments(inputVideoPath, outputImagePath, options)
+	if err != nil {
+		return
+	}
+
+	return f.run(ctx, arguments, noDuration, nil)
+}
+
+// Thumbnail runs FFmpeg to take a single frame of the video as its poster
+func (f *ffmpeg) Thumbnail(ctx context.Context, inputVideoPath string, outputImagePath string, options *ThumbnailOptions) (err error) {
+	arguments, err := thumbnailArguments(inputVideoPath, outputImagePath, options)
+	if err != nil {
+		return
+	}
+
+	return f.run(ctx, arguments, noDuration, nil)
+}
+
+// run runs FFmpeg with the arguments reporting its progress, for the duration
+// of the output worked out from the duration of the input, to the callback if
+// there is one. FFmpeg is killed if the context is cancelled.
+func (f *ffmpeg) run(ctx context.Context, arguments []string, duration func(inputDuration time.Duration) time.Duration, report func(progress Progress)) (err error) {
+	ffmpegCommand := exec.CommandContext(ctx, f.Path, arguments...)
+	args := strings.Join(ffmpegCommand.Args, " ")
+	f.log.Debugf("Running command: %s", args)
+
+	stdout, err := ffmpegCommand.StdoutPipe()
+	if err != nil {
+		return
+	}
+	stderr, err := ffmpegCommand.StderrPipe()
+	if err != nil {
+		return
+	}
+	if err = ffmpegCommand.Start(); err != nil {
+		return
+	}
+
+	// FFmpeg writes its progress to stdout and everything else to stderr, the
+	// duration of the input from which is needed for the percentage done
+	tail := &stderrTail{}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		tail.read(stderr)
+	}()
+	go func() {
+		defer wg.Done()
+		readProgress(stdout, func() time.Duration { return duration(tail.duration()) }, report)
+	}()
+	wg.Wait()
+
+	if err = ffmpegCommand.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return errors.Cancelled("convert", ctx.Err().Error())
+		}
+
+		f.log.Errorf("Error encountered while running command: %s", args)
+		return errors.CommandFailed(args, err, tail.String())
+	}
+
+	return
+}
+
+// ffmpegArguments returns the arguments for FFmpeg to convert the video, and
+// the audio if there is any, in to the output with the options
+func ffmpegArguments(inputVideoPath string, inputAudioPath string, outputVideoPath string, options *ConvertOptions) (arguments []string) {
+	arguments = []string{
 		"-y",
-		"-i", inputVideoPath,
-		// ffmpeg audio arguments will go here
-		"-c:v", "copy",
+		"-nostdin",
+		"-nostats",
+		"-progress", "pipe:1",
+	}
+
+	// Seeking the inputs before they are opened is fast as it skips straight
+	// to the key frame at or before the start
+	var seek []string
+	if options.Start > 0 {
+		seek = []string{"-ss", formatSeconds(options.Start)}
+	}
+	arguments = append(append(arguments, seek...), "-i", inputVideoPath)
+	withAudio := inputAudioPath != "" && !options.DropAudio
+	if withAudio {
+		arguments = append(append(arguments, seek...), "-i", inputAudioPath)
+	}
+
+	if options.DropVideo {
+		arguments = append(arguments, "-vn")
+	} else {
+		if options.VideoFilter != "" {
+			arguments = append(arguments, "-vf", options.VideoFilter)
+		}
+		arguments = append(arguments, "-c:v", options.VideoCodec)
+		if options.VideoCRF > 0 {
+			arguments = append(arguments, "-crf", strconv.Itoa(options.VideoCRF))
+			if strings.HasPrefix(options.VideoCodec, "libvpx") {
+				// VP8 and VP9 only keep to the quality when the bitrate is
+				// not also limited
+				arguments = append(arguments, "-b:v", "0")
+			}
+		}
+	}
+
+	switch {
+	case options.DropAudio:
+		arguments = append(arguments, "-an")
+	case withAudio, options.DropVideo:
+		// Without the video only the audio of the video input is kept
+		arguments = append(arguments, "-c:a", options.AudioCodec)
+		if options.AudioBitrate != "" {
+			arguments = append(arguments, "-b:a", options.AudioBitrate)
+		}
+	}
+
+	if options.Container == "gif" {
+		arguments = append(arguments, "-loop", "0")
+	}
+	if options.MaxDuration > 0 {
+		arguments = append(arguments, "-t", formatSeconds(options.MaxDuration))
+	}
+	if options.MaxSize > 0 {
+		arguments = append(arguments, "-fs", strconv.FormatInt(options.MaxSize, 10))
+	}
+	if options.FastStart && contains(FastStartContainers, options.Container) {
+		arguments = append(arguments, "-movflags", "+faststart")
+	}
+
+	return append(arguments,
 		"-strict", "experimental",
-		"-f", "mp4",
+		"-f", options.Container,
 		outputVideoPath,
+	)
+}
+
+// formatSeconds returns a duration as a number of seconds for FFmpeg
+func formatSeconds(duration time.Duration) string {
+	return strconv.FormatFloat(duration.Seconds(), 'f', -1, 64)
+}
+
+// noDuration is the duration of the output of FFmpeg when its progress is
+// not reported
+func noDuration(inputDuration time.Duration) time.Duration {
+	return 0
+}
+
+// outputDuration returns the duration of the output for the duration of the
+// input which starts at the start and is cut off at the maximum duration if
+// there is one
+func outputDuration(duration time.Duration, start time.Duration, maxDuration time.Duration) time.Duration {
+	if duration > start {
+		duration -= start
+	} else {
+		duration = 0
 	}
 
-	if inputAudioPath != "" {
-		ffmpegArguments = arrayInject(
-			ffmpegArguments,
-			[]string{
-				"-i", inputAudioPath,
-				"-c:a", "aac",
-			},
-			3,
-		)
+	if maxDuration > 0 && (duration == 0 || maxDuration < duration) {
+		return maxDuration
 	}
 
-	ffmpegCommand := exec.Command(
-		f.Path,
-		ffmpegArguments...,
-	)
+	return duration
+}
+
+// parseFFmpegDuration parses a duration written by FFmpeg (e.g.
+// "00:01:02.50")
+func parseFFmpegDuration(value string) (duration time.Duration, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 {
+		return
+	}
 
-	output, err := ffmpegCommand.CombinedOutput()
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
 	if err != nil {
-		args := strings.Join(ffmpegCommand.Args, " ")
-		os.Stderr.WriteString(string(output))
-		f.log.Errorf("Error encountered while running command: %s", args)
 		return
 	}
 
-	return
+	duration = time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second))
+
+	return duration, true
 }
 
-// Init is the initialization routine
-func (f *ffmpeg) Init(ctx context.Context) (err error) {
-	return
+// readProgress reads the key=value blocks FFmpeg writes for "-progress",
+// each of which ends with a "progress" key, and reports each block to the
+// callback until the reader is closed
+func readProgress(reader io.Reader, duration func() time.Duration, report func(progress Progress)) {
+	var progress Progress
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				progress.OutTime = time.Duration(us) * time.Microsecond
+			}
+		case "speed":
+			if speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				progress.Speed = speed
+			}
+		case "total_size":
+			if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+				progress.Size = size
+			}
+		case "progress":
+			progress.Done = value == "end"
+			progress.Duration = duration()
+			progress.Percent = 0
+			if progress.Duration > 0 {
+				progress.Percent = math.Min(100, 100*float64(progress.OutTime)/float64(progress.Duration))
+			}
+			if progress.Done {
+				progress.Percent = 100
+			}
+
+			if report != nil {
+				report(progress)
+			}
+		}
+	}
+}
+
+// stderrTail keeps the last lines FFmpeg writes to stderr along with the
+// duration of the first input
+type stderrTail struct {
+	inputDuration time.Duration
+	lines         []string
+	mutex         sync.Mutex
+}
+
+// String returns the lines kept
+func (s *stderrTail) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return strings.Join(s.lines, "\n")
+}
+
+// duration returns the duration of the first input or zero if FFmpeg has not
+// written it yet
+func (s *stderrTail) duration() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inputDuration
 }
 
-// arrayInject is a helper function written by Alirus on StackOverflow in my
-// inquiry to find a way to inject one array into another _elegantly_:
-// https://stackoverflow.com/a/53647212/776896
-// Proof on Go Playground: https://play.golang.org/p/x4ljcOU71Z6
-func arrayInject(haystack, pile []string, at int) (result []string) {
-	result = make([]string, len(haystack[:at]))
-	copy(result, haystack[:at])
-	result = append(result, pile...)
-	result = append(result, haystack[at:]...)
+// read keeps the lines from the reader until it is closed
+func (s *stderrTail) read(reader io.Reader) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		s.mutex.Lock()
+		if s.inputDuration == 0 && strings.HasPrefix(line, "Duration:") {
+			value := strings.SplitN(strings.TrimPrefix(line, "Duration:"), ",", 2)[0]
+			if duration, ok := parseFFmpegDuration(value); ok {
+				s.inputDuration = duration
+			}
+		}
 
-	return result
+		s.lines = append(s.lines, line)
+		if len(s.lines) > StderrTailLines {
+			s.lines = s.lines[len(s.lines)-StderrTailLines:]
+		}
+		s.mutex.Unlock()
+	}
 }
 
 // getExecutablePath will return the path (relative or full) to Ffmpeg
@@ -0,0 +1,193 @@
+package converter_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestFFmpeg_Convert(suite *testing.T) {
+	// The fake FFmpeg writes its arguments to the output (the last argument)
+	// and, like FFmpeg, the duration of the input to stderr before it starts
+	// writing its progress to stdout
+	progress := `echo "  Duration: 00:00:10.00, start: 0.000000, bitrate: 1000 kb/s" >&2
+sleep 0.1
+for last; do :; done
+echo "$@" > "$last"
+printf 'out_time_us=2500000\ntotal_size=100\nspeed=2.5x\nprogress=continue\n'
+printf 'out_time_us=5000000\ntotal_size=200\nspeed=2.5x\nprogress=continue\n'
+printf 'out_time_us=10000000\ntotal_size=400\nspeed=2.5x\nprogress=end\n'
+`
+
+	cases := []struct {
+		audio     string
+		arguments string
+		errType   string
+		format    string
+		options   *converter.ConvertOptions
+		percents  []float64
+		script    string
+		stderr    string
+		video     string
+	}{
+		{
+			audio:     "audio.mp4",
+			arguments: "-y -nostdin -nostats -progress pipe:1 -i video.mp4 -i audio.mp4 -c:v copy -c:a aac -movflags +faststart -strict experimental -f mp4",
+			percents:  []float64{25, 50, 100},
+			script:    progress,
+		},
+		{
+			arguments: "-y -nostdin -nostats -progress pipe:1 -i video.mp4 -c:v libx264 -t 5 -fs 1024 -strict experimental -f webm",
+			options:   &converter.ConvertOptions{Container: "webm", MaxDuration: 5 * time.Second, MaxSize: 1024, VideoCodec: "libx264"},
+			percents:  []float64{50, 100, 100},
+			script:    progress,
+		},
+		{
+			audio:     "audio.mp4",
+			arguments: "-y -nostdin -nostats -progress pipe:1 -i video.mp4 -i audio.mp4 -c:v copy -c:a libopus -b:a 96k -strict experimental -f mp4",
+			options:   &converter.ConvertOptions{AudioBitrate: "96k", AudioCodec: "libopus"},
+			percents:  []float64{25, 50, 100},
+			script:    progress,
+		},
+		{
+			audio:     "audio.mp4",
+			arguments: "-y -nostdin -nostats -progress pipe:1 -i video.mp4 -i audio.mp4 -c:v libvpx-vp9 -crf 33 -b:v 0 -c:a libopus -b:a 128k -strict experimental -f webm",
+			format:    "webm",
+			percents:  []float64{25, 50, 100},
+			script:    progress,
+		},
+		{
+			audio:     "audio.mp4",
+			arguments: "-y -nostdin -nostats -progress pipe:1 -i video.mp4 -vf fps=15,scale=480:-1:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse -c:v gif -an -loop 0 -strict experimental -f gif",
+			format:    "gif",
+			percents:  []float64{25, 50, 100},
+			script:    progress,
+		},
+		{
+			audio:     "audio.mp4",
+			arguments: "-y -nostdin -nostats -progress pipe:1 -i video.mp4 -i audio.mp4 -vn -c:a libmp3lame -b:a 192k -strict experimental -f mp3",
+			format:    "mp3",
+			percents:  []float64{25, 50, 100},
+			script:    progress,
+		},
+		{
+			arguments: "-y -nostdin -nostats -progress pipe:1 -i video.mp4 -vn -c:a copy -movflags +faststart -strict experimental -f ipod",
+			format:    "m4a",
+			percents:  []float64{25, 50, 100},
+			script:    progress,
+		},
+		// A clip is seeked to quickly and encoded again unless it starts on
+		// a key frame
+		{
+			audio:     "audio.mp4",
+			arguments: "-y -nostdin -nostats -progress pipe:1 -ss 2.5 -i video.mp4 -ss 2.5 -i audio.mp4 -c:v libx264 -c:a aac -t 5 -strict experimental -f mp4",
+			options:   &converter.ConvertOptions{MaxDuration: 5 * time.Second, Start: 2500 * time.Millisecond},
+			percents:  []float64{50, 100, 100},
+			script:    progress,
+		},
+		{
+			audio:     "audio.mp4",
+			arguments: "-y -nostdin -nostats -progress pipe:1 -ss 0.5 -i " + videoFixture + " -ss 0.5 -i audio.mp4 -c:v copy -c:a aac -strict experimental -f mp4",
+			options:   &converter.ConvertOptions{Start: 500 * time.Millisecond},
+			percents:  []float64{26.31578947368421, 52.63157894736842, 100},
+			script:    progress,
+			video:     videoFixture,
+		},
+		{
+			errType: errors.TypeCommandFailed,
+			script:  "for i in 1 2 3 4 5 6 7 8 9 10 11 12; do echo \"line $i\" >&2; done\necho 'video.mp4: Invalid data found when processing input' >&2\nexit 1\n",
+			stderr:  "line 4\nline 5\nline 6\nline 7\nline 8\nline 9\nline 10\nline 11\nline 12\nvideo.mp4: Invalid data found when processing input",
+		},
+		{
+			errType: errors.TypeCancelled,
+			script:  "exec sleep 10\n",
+		},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "vrddt-converter-test")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			c := newFakeFFmpeg(t, dir, cs.script)
+
+			var percents []float64
+			options := cs.options
+			if options == nil {
+				if options, err = converter.FormatOptions(cs.format); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			options.Progress = func(progress converter.Progress) {
+				percents = append(percents, progress.Percent)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			video := cs.video
+			if video == "" {
+				video = "video.mp4"
+			}
+
+			output := filepath.Join(dir, "output")
+			err = c.Convert(ctx, video, cs.audio, output, options)
+			if errors.Type(err) != cs.errType && !(cs.errType == "" && err == nil) {
+				t.Fatalf("expecting error type '%s', got: %v", cs.errType, err)
+			}
+			if cs.errType != "" {
+				if cs.stderr != "" && err.(*errors.Error).Context["stderr"] != cs.stderr {
+					t.Errorf("expecting the stderr tail '%s', got: %v", cs.stderr, err.(*errors.Error).Context["stderr"])
+				}
+				return
+			}
+
+			arguments, err := ioutil.ReadFile(output)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if expected := cs.arguments + " " + output; strings.TrimSpace(string(arguments)) != expected {
+				t.Errorf("expecting arguments '%s', got '%s'", expected, strings.TrimSpace(string(arguments)))
+			}
+			if !reflect.DeepEqual(percents, cs.percents) {
+				t.Errorf("expecting progress %v, got %v", cs.percents, percents)
+			}
+		})
+	}
+}
+
+// newFakeFFmpeg returns an FFmpeg converter for a shell script standing in
+// for FFmpeg
+func newFakeFFmpeg(t *testing.T, dir string, script string) converter.Converter {
+	c, err := converter.FFmpeg(&config.ConverterFFmpegConfig{Path: writeFakeFFmpeg(t, dir, script)}, logger.New(ioutil.Discard, "error", "text"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return c
+}
+
+// writeFakeFFmpeg writes a shell script standing in for FFmpeg to the
+// directory returning its path
+func writeFakeFFmpeg(t *testing.T, dir string, script string) string {
+	path := filepath.Join(dir, "ffmpeg")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return path
+}
@@ -0,0 +1,288 @@
+package converter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+	"github.com/johnwyles/vrddt-droplets/pkg/mp4"
+)
+
+var (
+	// MuxableAudioCodecs are the codecs of the audio tracks which can be muxed
+	// without FFmpeg
+	MuxableAudioCodecs = []string{"mp4a"}
+
+	// MuxableVideoCodecs are the codecs of the video tracks which can be muxed
+	// without FFmpeg
+	MuxableVideoCodecs = []string{"avc1", "avc3"}
+)
+
+// muxer holds the information relating to the pure Go MP4 muxer
+type muxer struct {
+	fallback Converter
+	log      logger.Logger
+}
+
+// MP4 sets up a converter which muxes H.264 video and AAC audio in to an MP4
+// without any external program, falling back to FFmpeg when the options need
+// the media to be encoded again or the inputs can not be muxed. A clip is
+// muxed when it starts on a key frame. Only muxing is possible if FFmpeg can
+// not be found.
+func MP4(cfg *config.ConverterConfig, loggerHandle logger.Logger) (converter Converter, err error) {
+	loggerHandle.Debugf("MP4(cfg): %#v", cfg)
+
+	m := &muxer{
+		log: loggerHandle,
+	}
+
+	if m.fallback, err = FFmpeg(&cfg.FFmpeg, loggerHandle); err != nil {
+		loggerHandle.Warnf("FFmpeg could not be found so videos will only be muxed: %s", err)
+		m.fallback = nil
+		err = nil
+	}
+
+	converter = m
+
+	return
+}
+
+// Convert muxes the video and the audio, if there is any, in to the output
+// or converts them with FFmpeg if they can not be muxed with the options
+func (m *muxer) Convert(ctx context.Context, inputVideoPath string, inputAudioPath string, outputVideoPath string, options *ConvertOptions) (err error) {
+	options = options.withDefaults()
+
+	reason := muxable(options)
+	if reason == "" {
+		err = m.mux(ctx, inputVideoPath, inputAudioPath, outputVideoPath, options)
+		switch errors.Type(err) {
+		case errors.TypeInvalidValue, errors.TypeNotImplemented:
+			reason = err.Error()
+		default:
+			return
+		}
+	}
+
+	if m.fallback == nil {
+		return errors.NotImplemented("convert", fmt.Sprintf("FFmpeg is needed to convert the video: %s", reason))
+	}
+	m.log.Debugf("Converting with FFmpeg as the video can not be muxed: %s", reason)
+
+	return m.fallback.Convert(ctx, inputVideoPath, inputAudioPath, outputVideoPath, options)
+}
+
+// Init is the initialization routine
+func (m *muxer) Init(ctx context.Context) (err error) {
+	return
+}
+
+// Sprite makes a sprite sheet of the video with FFmpeg as frames can not be
+// taken from a video without decoding it
+func (m *muxer) Sprite(ctx context.Context, inputVideoPath string, outputImagePath string, options *SpriteOptions) (err error) {
+	thumbnailer, ok := m.fallback.(Thumbnailer)
+	if !ok {
+		return errors.NotImplemented("sprite", "FFmpeg is needed to take frames from the video")
+	}
+
+	return thumbnailer.Sprite(ctx, inputVideoPath, outputImagePath, options)
+}
+
+// Thumbnail takes a thumbnail of the video with FFmpeg as frames can not be
+// taken from a video without decoding it
+func (m *muxer) Thumbnail(ctx context.Context, inputVideoPath string, outputImagePath string, options *ThumbnailOptions) (err error) {
+	thumbnailer, ok := m.fallback.(Thumbnailer)
+	if !ok {
+		return errors.NotImplemented("thumbnail", "FFmpeg is needed to take frames from the video")
+	}
+
+	return thumbnailer.Thumbnail(ctx, inputVideoPath, outputImagePath, options)
+}
+
+// mux writes the first video track of the video, and the first audio track of
+// the audio or else of the video, in to the output
+func (m *muxer) mux(ctx context.Context, inputVideoPath string, inputAudioPath string, outputVideoPath string, options *ConvertOptions) (err error) {
+	videoFile, videoTracks, err := readTracks(inputVideoPath)
+	if err != nil {
+		return
+	}
+	defer videoFile.Close()
+
+	video := findTrack(videoTracks, mp4.HandlerVideo)
+	if video == nil {
+		return errors.NotImplemented("mux", "the video does not have a video track")
+	}
+	if !contains(MuxableVideoCodecs, video.Codec) {
+		return errors.NotImplemented("mux", fmt.Sprintf("video in '%s'", video.Codec))
+	}
+	if video, err = clipTrack(video, options); err != nil {
+		return
+	}
+	tracks := []*mp4.Track{video}
+
+	audio := findTrack(videoTracks, mp4.HandlerSound)
+	if inputAudioPath != "" {
+		audioFile, audioTracks, err := readTracks(inputAudioPath)
+		if err != nil {
+			return err
+		}
+		defer audioFile.Close()
+
+		if audio = findTrack(audioTracks, mp4.HandlerSound); audio == nil {
+			return errors.NotImplemented("mux", "the audio does not have an audio track")
+		}
+	}
+	if audio != nil {
+		if !contains(MuxableAudioCodecs, audio.Codec) {
+			return errors.NotImplemented("mux", fmt.Sprintf("audio in '%s'", audio.Codec))
+		}
+		if audio, err = clipTrack(audio, options); err != nil {
+			return
+		}
+		tracks = append(tracks, audio)
+	}
+
+	outputFile, err := os.Create(outputVideoPath)
+	if err != nil {
+		return
+	}
+	defer outputFile.Close()
+
+	output := bufio.NewWriter(outputFile)
+	if err = mp4.Write(ctx, output, tracks); err != nil {
+		return
+	}
+	if err = output.Flush(); err != nil {
+		return
+	}
+
+	if options.Progress != nil {
+		duration := time.Duration(video.Duration()) * time.Second / time.Duration(video.Timescale)
+		size, _ := outputFile.Seek(0, io.SeekCurrent)
+		options.Progress(Progress{
+			Done:     true,
+			Duration: duration,
+			OutTime:  duration,
+			Percent:  100,
+			Size:     size,
+		})
+	}
+
+	return outputFile.Close()
+}
+
+// clipTrack returns the track with only the samples from the start of the
+// options for their maximum duration. A video track has to have a key frame
+// at the start as nothing before it is kept.
+func clipTrack(track *mp4.Track, options *ConvertOptions) (*mp4.Track, error) {
+	if options.Start <= 0 && options.MaxDuration <= 0 {
+		return track, nil
+	}
+
+	first := track.SampleAt(timescaleTime(options.Start, track.Timescale))
+	last := len(track.Samples)
+	if options.MaxDuration > 0 {
+		last = track.SampleAt(timescaleTime(options.Start+options.MaxDuration, track.Timescale))
+	}
+	if first >= last {
+		return nil, errors.InvalidValue("start", fmt.Sprintf("The clip from %s is not in the %s track", options.Start, track.Handler))
+	}
+	if options.Start > 0 && track.Handler == mp4.HandlerVideo && !track.Samples[first].Sync {
+		return nil, errors.NotImplemented("mux", fmt.Sprintf("a clip from %s which is not a key frame", options.Start))
+	}
+
+	return track.Slice(first, last), nil
+}
+
+// contains returns whether the value is one of the values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findTrack returns the first track with the handler or nil if there is not
+// one
+func findTrack(tracks []*mp4.Track, handler string) *mp4.Track {
+	for _, track := range tracks {
+		if track.Handler == handler {
+			return track
+		}
+	}
+
+	return nil
+}
+
+// muxable returns why the options need FFmpeg or an empty string if the
+// media can be muxed with them
+func muxable(options *ConvertOptions) string {
+	switch {
+	case options.Container != "mp4":
+		return fmt.Sprintf("the container is '%s'", options.Container)
+	case options.VideoCodec != CodecCopy:
+		return fmt.Sprintf("the video is encoded with '%s'", options.VideoCodec)
+	case options.AudioCodec != CodecCopy && options.AudioCodec != "aac":
+		return fmt.Sprintf("the audio is encoded with '%s'", options.AudioCodec)
+	case options.AudioBitrate != "":
+		return fmt.Sprintf("the audio is encoded at %s", options.AudioBitrate)
+	case options.DropAudio, options.DropVideo:
+		return "a stream is left out"
+	case options.VideoFilter != "":
+		return "the video is filtered"
+	case options.MaxSize > 0:
+		return "the video is cut off"
+	}
+
+	return ""
+}
+
+// startsOnKeyframe returns whether the first video track of the MP4 at the
+// path has a key frame at the start so that it can be clipped there without
+// being encoded again
+func startsOnKeyframe(path string, start time.Duration) bool {
+	file, tracks, err := readTracks(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	video := findTrack(tracks, mp4.HandlerVideo)
+	if video == nil {
+		return false
+	}
+
+	sample := video.SampleAt(timescaleTime(start, video.Timescale))
+	return sample < len(video.Samples) && video.Samples[sample].Sync
+}
+
+// timescaleTime returns a time in a timescale
+func timescaleTime(value time.Duration, timescale uint32) uint64 {
+	return uint64(value * time.Duration(timescale) / time.Second)
+}
+
+// readTracks opens the MP4 at the path and reads its tracks
+func readTracks(path string) (file *os.File, tracks []*mp4.Track, err error) {
+	if file, err = os.Open(path); err != nil {
+		return
+	}
+
+	info, err := file.Stat()
+	if err == nil {
+		tracks, err = mp4.Read(file, info.Size())
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return
+}
@@ -0,0 +1,227 @@
+package converter_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+	"github.com/johnwyles/vrddt-droplets/pkg/mp4"
+)
+
+// updateFFmpegReferenceFlag is the flag which writes the output of FFmpeg for
+// the fixtures when the tests are run where FFmpeg is installed
+const updateFFmpegReferenceFlag = "update-ffmpeg-reference"
+
+// The fixtures are fragmented MP4s like the MPEG-DASH streams Reddit serves,
+// and the reference is what FFmpeg muxed them in to so that the muxer can be
+// compared with FFmpeg without it
+var (
+	audioFixture    = filepath.Join("..", "..", "data", "test", "reddit_dash_audio.mp4")
+	ffmpegReference = filepath.Join("..", "..", "data", "test", "reddit_dash_ffmpeg.mp4")
+	videoFixture    = filepath.Join("..", "..", "data", "test", "reddit_dash_video.mp4")
+
+	updateFFmpegReference = flag.Bool(updateFFmpegReferenceFlag, false, "write the output of FFmpeg for the fixtures to "+ffmpegReference)
+)
+
+func TestMP4_Convert(suite *testing.T) {
+	cases := []struct {
+		audio    string
+		errType  string
+		fallback bool
+		ffmpeg   bool
+		options  *converter.ConvertOptions
+		samples  int
+		tracks   int
+		video    string
+	}{
+		{audio: audioFixture, ffmpeg: true, tracks: 2, video: videoFixture},
+		{ffmpeg: true, tracks: 1, video: videoFixture},
+		{audio: audioFixture, options: &converter.ConvertOptions{AudioCodec: converter.CodecCopy}, tracks: 2, video: videoFixture},
+		// Anything which needs encoding, or which is not an MP4, is converted
+		// by FFmpeg
+		{audio: audioFixture, fallback: true, ffmpeg: true, options: &converter.ConvertOptions{Container: "webm"}, video: videoFixture},
+		{audio: audioFixture, fallback: true, ffmpeg: true, options: &converter.ConvertOptions{VideoCodec: "libx264"}, video: videoFixture},
+		{audio: audioFixture, fallback: true, ffmpeg: true, options: &converter.ConvertOptions{AudioBitrate: "96k"}, video: videoFixture},
+		{audio: videoFixture, fallback: true, ffmpeg: true, video: videoFixture},
+		{audio: audioFixture, fallback: true, ffmpeg: true, video: "ffmpeg"},
+		{audio: audioFixture, errType: errors.TypeNotImplemented, options: &converter.ConvertOptions{Container: "webm"}, video: videoFixture},
+		// A clip is muxed when it starts on a key frame, the second of which
+		// is the 16th frame at 0.5s, otherwise FFmpeg encodes it
+		{audio: audioFixture, options: &converter.ConvertOptions{MaxDuration: 250 * time.Millisecond, Start: 500 * time.Millisecond}, samples: 7, tracks: 2, video: videoFixture},
+		{audio: audioFixture, options: &converter.ConvertOptions{MaxDuration: 500 * time.Millisecond}, samples: 15, tracks: 2, video: videoFixture},
+		{audio: audioFixture, fallback: true, ffmpeg: true, options: &converter.ConvertOptions{Start: 250 * time.Millisecond}, video: videoFixture},
+		{audio: audioFixture, errType: errors.TypeNotImplemented, options: &converter.ConvertOptions{Start: 250 * time.Millisecond}, video: videoFixture},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "vrddt-converter-test")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			// The fake FFmpeg only writes what it was run with
+			cfg := &config.ConverterConfig{FFmpeg: config.ConverterFFmpegConfig{Path: filepath.Join(dir, "missing")}}
+			if cs.ffmpeg {
+				cfg.FFmpeg.Path = writeFakeFFmpeg(t, dir, "for last; do :; done\necho ffmpeg \"$@\" > \"$last\"\n")
+			}
+			video := cs.video
+			if video == "ffmpeg" {
+				video = cfg.FFmpeg.Path
+			}
+
+			c, err := converter.MP4(cfg, logger.New(ioutil.Discard, "error", "text"))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			output := filepath.Join(dir, "output.mp4")
+			err = c.Convert(context.Background(), video, cs.audio, output, cs.options)
+			if errors.Type(err) != cs.errType && !(cs.errType == "" && err == nil) {
+				t.Fatalf("expecting error type '%s', got: %v", cs.errType, err)
+			}
+			if cs.errType != "" {
+				return
+			}
+
+			data, err := ioutil.ReadFile(output)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if fallback := strings.HasPrefix(string(data), "ffmpeg "); fallback != cs.fallback {
+				t.Fatalf("expecting FFmpeg to be used to be %t, got %t", cs.fallback, fallback)
+			}
+			if cs.fallback {
+				return
+			}
+
+			tracks, err := mp4.Read(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("unexpected error reading the output: %s", err)
+			}
+			if len(tracks) != cs.tracks {
+				t.Errorf("expecting %d tracks, got %d", cs.tracks, len(tracks))
+			}
+			if cs.samples > 0 && len(tracks[0].Samples) != cs.samples {
+				t.Errorf("expecting %d video samples, got %d", cs.samples, len(tracks[0].Samples))
+			}
+		})
+	}
+}
+
+func TestMP4_MatchesFFmpeg(t *testing.T) {
+	reference, err := ioutil.ReadFile(ffmpegReference)
+	if os.IsNotExist(err) {
+		t.Skipf("The output of FFmpeg is needed to compare the muxer with, run with -%s where FFmpeg is installed to make it", updateFFmpegReferenceFlag)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	compareWithFFmpeg(t, reference, muxFixtures(t, nil))
+}
+
+// TestMP4_MatchesLiveFFmpeg also compares the muxer with the FFmpeg which is
+// installed, if there is one, updating the output of FFmpeg kept with the
+// fixtures when it is asked to
+func TestMP4_MatchesLiveFFmpeg(t *testing.T) {
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("FFmpeg is needed to compare the muxer with")
+	}
+
+	ffmpeg, err := converter.FFmpeg(&config.ConverterFFmpegConfig{Path: ffmpegPath}, logger.New(ioutil.Discard, "error", "text"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	reference := muxFixtures(t, ffmpeg)
+	if *updateFFmpegReference {
+		if err = ioutil.WriteFile(ffmpegReference, reference, 0644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	compareWithFFmpeg(t, reference, muxFixtures(t, nil))
+}
+
+// compareWithFFmpeg fails the test unless the samples muxed are the same as
+// those FFmpeg muxed. Both copy the samples so the samples in the outputs
+// have to be the same.
+func compareWithFFmpeg(t *testing.T, reference []byte, data []byte) {
+	expectedTracks, err := mp4.Read(bytes.NewReader(reference), int64(len(reference)))
+	if err != nil {
+		t.Fatalf("unexpected error reading the output of FFmpeg: %s", err)
+	}
+	actualTracks, err := mp4.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("unexpected error reading the output of the muxer: %s", err)
+	}
+
+	if len(actualTracks) != len(expectedTracks) {
+		t.Fatalf("expecting %d tracks like FFmpeg, got %d", len(expectedTracks), len(actualTracks))
+	}
+	for i, expected := range expectedTracks {
+		actual := actualTracks[i]
+		if actual.Codec != expected.Codec || len(actual.Samples) != len(expected.Samples) {
+			t.Fatalf("expecting track %d to have %d samples of '%s' like FFmpeg, got %d of '%s'", i, len(expected.Samples), expected.Codec, len(actual.Samples), actual.Codec)
+		}
+		// The timing of the samples and the edit list have to match as well
+		if actual.Timescale != expected.Timescale || actual.MediaTime != expected.MediaTime {
+			t.Errorf("expecting track %d to be in a timescale of %d starting at %d like FFmpeg, got %d starting at %d", i, expected.Timescale, expected.MediaTime, actual.Timescale, actual.MediaTime)
+		}
+
+		for j, e := range expected.Samples {
+			a := actual.Samples[j]
+			if a.CompositionOffset != e.CompositionOffset || a.DecodeTime != e.DecodeTime || a.Duration != e.Duration || a.Size != e.Size || a.Sync != e.Sync {
+				t.Fatalf("expecting sample %d of track %d to be %+v like FFmpeg, got %+v", j, i, e, a)
+			}
+			if !bytes.Equal(data[a.Offset:a.Offset+int64(a.Size)], reference[e.Offset:e.Offset+int64(e.Size)]) {
+				t.Fatalf("expecting the data of sample %d of track %d to be the same as FFmpeg", j, i)
+			}
+		}
+	}
+}
+
+// muxFixtures returns the fixtures muxed in to an MP4 by the converter, or by
+// the muxer without FFmpeg if there is no converter
+func muxFixtures(t *testing.T, c converter.Converter) []byte {
+	dir, err := ioutil.TempDir("", "vrddt-converter-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if c == nil {
+		cfg := &config.ConverterConfig{FFmpeg: config.ConverterFFmpegConfig{Path: filepath.Join(dir, "missing")}}
+		if c, err = converter.MP4(cfg, logger.New(ioutil.Discard, "error", "text")); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	output := filepath.Join(dir, "output.mp4")
+	options := &converter.ConvertOptions{AudioCodec: converter.CodecCopy, FastStart: true}
+	if err = c.Convert(context.Background(), videoFixture, audioFixture, output, options); err != nil {
+		t.Fatalf("unexpected error converting: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return data
+}
@@ -0,0 +1,213 @@
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/mp4"
+)
+
+var (
+	// CodecNames are the names FFprobe gives to the codecs of the sample
+	// entries of MP4 tracks so that media is described the same way no matter
+	// how it was probed
+	CodecNames = map[string]string{
+		"Opus": "opus",
+		"avc1": "h264",
+		"avc3": "h264",
+		"hev1": "hevc",
+		"hvc1": "hevc",
+		"mp4a": "aac",
+		"vp09": "vp9",
+	}
+)
+
+// Prober is implemented by the converters which can also find out what is in
+// media once it is converted
+type Prober interface {
+	Probe(ctx context.Context, inputPath string) (media *MediaInfo, err error)
+}
+
+// MediaInfo is what was found out about media by probing it
+type MediaInfo struct {
+	// AudioCodec is the codec of the first audio stream (e.g. "aac") or empty
+	// if there is no audio
+	AudioCodec string
+
+	// Duration is how long the media plays for
+	Duration time.Duration
+
+	// Height is the height of the first video stream in pixels
+	Height int
+
+	// VideoCodec is the codec of the first video stream (e.g. "h264") or
+	// empty if there is no video
+	VideoCodec string
+
+	// Width is the width of the first video stream in pixels
+	Width int
+}
+
+// HasAudio returns whether the media has any audio
+func (m *MediaInfo) HasAudio() bool {
+	return m.AudioCodec != ""
+}
+
+// ffprobeOutput is the part of the JSON written by FFprobe which describes the
+// media
+type ffprobeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+	Streams []struct {
+		CodecName   string `json:"codec_name"`
+		CodecType   string `json:"codec_type"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+		Height int `json:"height"`
+		Width  int `json:"width"`
+	} `json:"streams"`
+}
+
+// Probe runs FFprobe to find out what is in the media
+func (f *ffmpeg) Probe(ctx context.Context, inputPath string) (media *MediaInfo, err error) {
+	if f.ProbePath == "" {
+		return nil, errors.NotImplemented("probe", "FFprobe is needed to probe the media")
+	}
+
+	ffprobeCommand := exec.CommandContext(ctx, f.ProbePath, ffprobeArguments(inputPath)...)
+	args := strings.Join(ffprobeCommand.Args, " ")
+	f.log.Debugf("Running command: %s", args)
+
+	stdout, err := ffprobeCommand.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Cancelled("probe", ctx.Err().Error())
+		}
+
+		stderr := ""
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		return nil, errors.CommandFailed(args, err, stderr)
+	}
+
+	return parseFFprobe(stdout)
+}
+
+// Probe reads what is in an MP4 without any external program, falling back
+// to FFprobe for any other media
+func (m *muxer) Probe(ctx context.Context, inputPath string) (media *MediaInfo, err error) {
+	file, tracks, err := readTracks(inputPath)
+	if err == nil {
+		defer file.Close()
+		return tracksInfo(tracks), nil
+	}
+
+	prober, ok := m.fallback.(Prober)
+	if !ok {
+		return nil, errors.NotImplemented("probe", fmt.Sprintf("FFprobe is needed to probe media which is not an MP4: %s", err))
+	}
+
+	return prober.Probe(ctx, inputPath)
+}
+
+// ffprobeArguments returns the arguments for FFprobe to describe the media as
+// JSON
+func ffprobeArguments(inputPath string) []string {
+	return []string{
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		inputPath,
+	}
+}
+
+// getProbePath returns the path of FFprobe, which is looked for next to FFmpeg
+// and then in the path if it is not configured
+func getProbePath(executable string, ffmpegPath string) (probePath string, err error) {
+	if executable != "" {
+		return getExecutablePath(executable)
+	}
+
+	if probePath, err = getExecutablePath(filepath.Join(filepath.Dir(ffmpegPath), "ffprobe")); err == nil {
+		return
+	}
+
+	return getExecutablePath("ffprobe")
+}
+
+// parseFFprobe returns what the JSON written by FFprobe says is in the media
+func parseFFprobe(data []byte) (media *MediaInfo, err error) {
+	output := &ffprobeOutput{}
+	if err = json.Unmarshal(data, output); err != nil {
+		return nil, errors.InvalidValue("ffprobe", fmt.Sprintf("The output of FFprobe is not JSON: %s", err))
+	}
+
+	media = &MediaInfo{}
+	if output.Format.Duration != "" {
+		seconds, err := strconv.ParseFloat(output.Format.Duration, 64)
+		if err != nil {
+			return nil, errors.InvalidValue("duration", fmt.Sprintf("The duration '%s' is not a number of seconds", output.Format.Duration))
+		}
+		media.Duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	for _, stream := range output.Streams {
+		switch {
+		case stream.CodecType == "audio" && media.AudioCodec == "":
+			media.AudioCodec = stream.CodecName
+		// Cover art is a video stream of a single picture which is left out
+		case stream.CodecType == "video" && media.VideoCodec == "" && stream.Disposition.AttachedPic == 0:
+			media.VideoCodec = stream.CodecName
+			media.Height = stream.Height
+			media.Width = stream.Width
+		}
+	}
+
+	return
+}
+
+// tracksInfo returns what is in the tracks of an MP4
+func tracksInfo(tracks []*mp4.Track) (media *MediaInfo) {
+	media = &MediaInfo{}
+	for _, track := range tracks {
+		if track.Timescale > 0 {
+			duration := time.Duration(track.Duration()) * time.Second / time.Duration(track.Timescale)
+			if duration > media.Duration {
+				media.Duration = duration
+			}
+		}
+	}
+
+	if video := findTrack(tracks, mp4.HandlerVideo); video != nil {
+		media.VideoCodec = codecName(video.Codec)
+		// The dimensions of a track are in 16.16 fixed point
+		media.Height = int(video.Height >> 16)
+		media.Width = int(video.Width >> 16)
+	}
+	if audio := findTrack(tracks, mp4.HandlerSound); audio != nil {
+		media.AudioCodec = codecName(audio.Codec)
+	}
+
+	return
+}
+
+// codecName returns the name FFprobe gives to the codec of an MP4 sample
+// entry
+func codecName(codec string) string {
+	if name, ok := CodecNames[codec]; ok {
+		return name
+	}
+
+	return strings.TrimSpace(codec)
+}
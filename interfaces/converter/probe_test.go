@@ -0,0 +1,129 @@
+package converter_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestFFmpeg_Probe(suite *testing.T) {
+	cases := []struct {
+		errType string
+		media   *converter.MediaInfo
+		script  string
+	}{
+		{
+			media:  &converter.MediaInfo{AudioCodec: "opus", Duration: 12500 * time.Millisecond, Height: 720, VideoCodec: "vp9", Width: 1280},
+			script: `echo '{"streams": [{"codec_name": "vp9", "codec_type": "video", "width": 1280, "height": 720}, {"codec_name": "opus", "codec_type": "audio"}], "format": {"duration": "12.500000"}}'`,
+		},
+		// Cover art is not the video of the media
+		{
+			media:  &converter.MediaInfo{AudioCodec: "mp3", Duration: 3 * time.Second},
+			script: `echo '{"streams": [{"codec_name": "mp3", "codec_type": "audio"}, {"codec_name": "mjpeg", "codec_type": "video", "width": 500, "height": 500, "disposition": {"attached_pic": 1}}], "format": {"duration": "3.0"}}'`,
+		},
+		{
+			errType: errors.TypeInvalidValue,
+			script:  "echo 'not json'",
+		},
+		{
+			errType: errors.TypeCommandFailed,
+			script:  "echo 'video.mp4: Invalid data found when processing input' >&2\nexit 1",
+		},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "vrddt-converter-test")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			// FFprobe is found next to FFmpeg
+			writeFakeFFprobe(t, dir, cs.script)
+			c := newFakeFFmpeg(t, dir, "").(converter.Prober)
+
+			media, err := c.Probe(context.Background(), "video.mp4")
+			if errors.Type(err) != cs.errType && !(cs.errType == "" && err == nil) {
+				t.Fatalf("expecting error type '%s', got: %v", cs.errType, err)
+			}
+			if cs.errType != "" {
+				return
+			}
+
+			if !reflect.DeepEqual(media, cs.media) {
+				t.Errorf("expecting media %#v, got %#v", cs.media, media)
+			}
+		})
+	}
+}
+
+func TestMP4_Probe(suite *testing.T) {
+	cases := []struct {
+		errType string
+		ffprobe bool
+		input   string
+		media   *converter.MediaInfo
+	}{
+		{input: videoFixture, media: &converter.MediaInfo{Duration: time.Second, Height: 64, VideoCodec: "h264", Width: 64}},
+		// The last AAC frame runs slightly past a second
+		{input: audioFixture, media: &converter.MediaInfo{AudioCodec: "aac", Duration: 1002666666}},
+		// Anything other than an MP4 needs FFprobe
+		{errType: errors.TypeNotImplemented, input: filepath.Join("..", "..", "data", "test", "reddit_videos.json")},
+		{ffprobe: true, input: filepath.Join("..", "..", "data", "test", "reddit_videos.json"), media: &converter.MediaInfo{Duration: 2 * time.Second, Height: 480, VideoCodec: "gif", Width: 640}},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "vrddt-converter-test")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			cfg := &config.ConverterConfig{FFmpeg: config.ConverterFFmpegConfig{Path: filepath.Join(dir, "missing")}}
+			if cs.ffprobe {
+				writeFakeFFprobe(t, dir, `echo '{"streams": [{"codec_name": "gif", "codec_type": "video", "width": 640, "height": 480}], "format": {"duration": "2"}}'`)
+				cfg.FFmpeg.Path = writeFakeFFmpeg(t, dir, "")
+			}
+
+			c, err := converter.MP4(cfg, logger.New(ioutil.Discard, "error", "text"))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			media, err := c.(converter.Prober).Probe(context.Background(), cs.input)
+			if errors.Type(err) != cs.errType && !(cs.errType == "" && err == nil) {
+				t.Fatalf("expecting error type '%s', got: %v", cs.errType, err)
+			}
+			if cs.errType != "" {
+				return
+			}
+
+			if !reflect.DeepEqual(media, cs.media) {
+				t.Errorf("expecting media %#v, got %#v", cs.media, media)
+			}
+		})
+	}
+}
+
+// writeFakeFFprobe writes a shell script standing in for FFprobe to the
+// directory returning its path
+func writeFakeFFprobe(t *testing.T, dir string, script string) string {
+	path := filepath.Join(dir, "ffprobe")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return path
+}
@@ -0,0 +1,173 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+const (
+	// ImageJPEG is the format of a JPEG image
+	ImageJPEG = "jpeg"
+
+	// ImageWebP is the format of a WebP image
+	ImageWebP = "webp"
+)
+
+var (
+	// DefaultSpriteWidth is the width every frame of a sprite sheet is scaled
+	// to when no width is given
+	DefaultSpriteWidth = 160
+)
+
+// Thumbnailer is implemented by the converters which can also take images
+// from a video to show before it is played
+type Thumbnailer interface {
+	Sprite(ctx context.Context, inputVideoPath string, outputImagePath string, options *SpriteOptions) (err error)
+	Thumbnail(ctx context.Context, inputVideoPath string, outputImagePath string, options *ThumbnailOptions) (err error)
+}
+
+// SpriteOptions are the options for a sprite sheet, which is a grid of frames
+// spread evenly over a video in a single image
+type SpriteOptions struct {
+	// Columns is the number of frames in each row of the grid or zero for a
+	// grid which is as close to a square as possible
+	Columns int
+
+	// Duration is the duration of the video the frames are spread over or
+	// zero, if it is not known, for a frame every second
+	Duration time.Duration
+
+	// Format is the format of the image, ImageJPEG unless it is given
+	Format string
+
+	// Frames is the number of frames in the grid
+	Frames int
+
+	// Width is the width every frame is scaled to, keeping its aspect ratio,
+	// or zero for DefaultSpriteWidth
+	Width int
+}
+
+// ThumbnailOptions are the options for a thumbnail, which is a single frame
+// of a video to show as its poster
+type ThumbnailOptions struct {
+	// Format is the format of the image, ImageJPEG unless it is given
+	Format string
+
+	// Offset is how far in to the video the frame is taken from
+	Offset time.Duration
+
+	// Width is the width the frame is scaled to, keeping its aspect ratio,
+	// or zero to keep the width of the video
+	Width int
+}
+
+// ImageExtension returns the file name extension for an image in the format
+func ImageExtension(format string) string {
+	if format == ImageWebP {
+		return ".webp"
+	}
+
+	return ".jpg"
+}
+
+// Grid returns the number of columns and rows of frames in the sprite sheet
+func (o *SpriteOptions) Grid() (columns int, rows int) {
+	columns = o.Columns
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(o.Frames))))
+	}
+	if columns > o.Frames {
+		columns = o.Frames
+	}
+	if columns <= 0 {
+		return 0, 0
+	}
+
+	return columns, (o.Frames + columns - 1) / columns
+}
+
+// imageArguments returns the arguments for FFmpeg to write an image in the
+// format
+func imageArguments(format string) ([]string, error) {
+	switch format {
+	case "", ImageJPEG:
+		return []string{"-c:v", "mjpeg", "-q:v", "3", "-f", "image2"}, nil
+	case ImageWebP:
+		return []string{"-c:v", "libwebp", "-quality", "80", "-f", "webp"}, nil
+	}
+
+	return nil, errors.InvalidValue("format", fmt.Sprintf("Unknown image format '%s' (must be one of: %s, %s)", format, ImageJPEG, ImageWebP))
+}
+
+// spriteArguments returns the arguments for FFmpeg to make a sprite sheet of
+// the video with the options
+func spriteArguments(inputVideoPath string, outputImagePath string, options *SpriteOptions) (arguments []string, err error) {
+	if options == nil || options.Frames <= 0 {
+		return nil, errors.InvalidValue("frames", "A sprite sheet needs at least one frame")
+	}
+
+	image, err := imageArguments(options.Format)
+	if err != nil {
+		return
+	}
+
+	width := options.Width
+	if width <= 0 {
+		width = DefaultSpriteWidth
+	}
+
+	fps := "1"
+	if options.Duration > 0 {
+		fps = fmt.Sprintf("%d/%s", options.Frames, formatSeconds(options.Duration))
+	}
+
+	columns, rows := options.Grid()
+	arguments = []string{
+		"-y",
+		"-nostdin",
+		"-nostats",
+		"-i", inputVideoPath,
+		"-an",
+		"-vf", fmt.Sprintf("fps=%s,scale=%d:-2,tile=%dx%d", fps, width, columns, rows),
+		"-frames:v", "1",
+	}
+
+	return append(append(arguments, image...), outputImagePath), nil
+}
+
+// thumbnailArguments returns the arguments for FFmpeg to take a thumbnail of
+// the video with the options
+func thumbnailArguments(inputVideoPath string, outputImagePath string, options *ThumbnailOptions) (arguments []string, err error) {
+	if options == nil {
+		options = &ThumbnailOptions{}
+	}
+
+	image, err := imageArguments(options.Format)
+	if err != nil {
+		return
+	}
+
+	arguments = []string{
+		"-y",
+		"-nostdin",
+		"-nostats",
+	}
+	if options.Offset > 0 {
+		arguments = append(arguments, "-ss", formatSeconds(options.Offset))
+	}
+	arguments = append(arguments,
+		"-i", inputVideoPath,
+		"-an",
+		"-frames:v", "1",
+	)
+	if options.Width > 0 {
+		arguments = append(arguments, "-vf", fmt.Sprintf("scale=%d:-2", options.Width))
+	}
+
+	return append(append(arguments, image...), outputImagePath), nil
+}
@@ -0,0 +1,115 @@
+package converter_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestFFmpeg_Thumbnail(suite *testing.T) {
+	cases := []struct {
+		arguments string
+		errType   string
+		sprite    *converter.SpriteOptions
+		thumbnail *converter.ThumbnailOptions
+	}{
+		{
+			arguments: "-y -nostdin -nostats -ss 1.5 -i video.mp4 -an -frames:v 1 -c:v mjpeg -q:v 3 -f image2",
+			thumbnail: &converter.ThumbnailOptions{Offset: 1500 * time.Millisecond},
+		},
+		{
+			arguments: "-y -nostdin -nostats -i video.mp4 -an -frames:v 1 -vf scale=320:-2 -c:v libwebp -quality 80 -f webp",
+			thumbnail: &converter.ThumbnailOptions{Format: converter.ImageWebP, Width: 320},
+		},
+		{
+			errType:   errors.TypeInvalidValue,
+			thumbnail: &converter.ThumbnailOptions{Format: "png"},
+		},
+		{
+			arguments: "-y -nostdin -nostats -i video.mp4 -an -vf fps=10/5,scale=160:-2,tile=4x3 -frames:v 1 -c:v mjpeg -q:v 3 -f image2",
+			sprite:    &converter.SpriteOptions{Duration: 5 * time.Second, Frames: 10},
+		},
+		{
+			arguments: "-y -nostdin -nostats -i video.mp4 -an -vf fps=1,scale=90:-2,tile=5x1 -frames:v 1 -c:v libwebp -quality 80 -f webp",
+			sprite:    &converter.SpriteOptions{Columns: 8, Format: converter.ImageWebP, Frames: 5, Width: 90},
+		},
+		{
+			errType: errors.TypeInvalidValue,
+			sprite:  &converter.SpriteOptions{},
+		},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "vrddt-converter-test")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			c := newFakeFFmpeg(t, dir, "for last; do :; done\necho \"$@\" > \"$last\"\n").(converter.Thumbnailer)
+
+			output := filepath.Join(dir, "output")
+			if cs.sprite != nil {
+				err = c.Sprite(context.Background(), "video.mp4", output, cs.sprite)
+			} else {
+				err = c.Thumbnail(context.Background(), "video.mp4", output, cs.thumbnail)
+			}
+			if errors.Type(err) != cs.errType && !(cs.errType == "" && err == nil) {
+				t.Fatalf("expecting error type '%s', got: %v", cs.errType, err)
+			}
+			if cs.errType != "" {
+				return
+			}
+
+			arguments, err := ioutil.ReadFile(output)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if expected := cs.arguments + " " + output; strings.TrimSpace(string(arguments)) != expected {
+				t.Errorf("expecting arguments '%s', got '%s'", expected, strings.TrimSpace(string(arguments)))
+			}
+		})
+	}
+}
+
+func TestMP4_Thumbnail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vrddt-converter-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	loggerHandle := logger.New(ioutil.Discard, "error", "text")
+	output := filepath.Join(dir, "output.jpg")
+
+	// Frames can only be taken from a video with FFmpeg
+	c, err := converter.MP4(&config.ConverterConfig{FFmpeg: config.ConverterFFmpegConfig{Path: filepath.Join(dir, "missing")}}, loggerHandle)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = c.(converter.Thumbnailer).Thumbnail(context.Background(), videoFixture, output, nil); errors.Type(err) != errors.TypeNotImplemented {
+		t.Errorf("expecting error type '%s', got: %v", errors.TypeNotImplemented, err)
+	}
+
+	cfg := &config.ConverterConfig{FFmpeg: config.ConverterFFmpegConfig{Path: writeFakeFFmpeg(t, dir, "for last; do :; done\necho ffmpeg \"$@\" > \"$last\"\n")}}
+	if c, err = converter.MP4(cfg, loggerHandle); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = c.(converter.Thumbnailer).Sprite(context.Background(), videoFixture, output, &converter.SpriteOptions{Frames: 4}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if data, _ := ioutil.ReadFile(output); !strings.HasPrefix(string(data), "ffmpeg ") {
+		t.Errorf("expecting FFmpeg to make the sprite sheet, got '%s'", data)
+	}
+}
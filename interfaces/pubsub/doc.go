@@ -0,0 +1,4 @@
+// Package pubsub contains any component in the entire project which publishes
+// events to, or subscribes to events from, every interested party (e.g.
+// different publish / subscribe implementations).
+package pubsub
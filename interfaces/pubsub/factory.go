@@ -0,0 +1,75 @@
+package pubsub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+// Factory builds a pub/sub from its section of the configuration
+type Factory func(cfg *config.PubSubConfig, loggerHandle logger.Logger) (pubsub PubSub, err error)
+
+var (
+	// factories are the pub/subs which can be built by New() keyed by their
+	// type
+	factories = map[config.PubSubType]Factory{}
+
+	// factoriesMutex guards factories
+	factoriesMutex sync.RWMutex
+)
+
+func init() {
+	Register(config.PubSubConfigMemory, func(cfg *config.PubSubConfig, loggerHandle logger.Logger) (PubSub, error) {
+		return Memory(&cfg.Memory, loggerHandle)
+	})
+	Register(config.PubSubConfigRabbitMQ, func(cfg *config.PubSubConfig, loggerHandle logger.Logger) (PubSub, error) {
+		return RabbitMQ(&cfg.RabbitMQ, loggerHandle)
+	})
+}
+
+// New builds the pub/sub named by the type in the configuration
+func New(cfg *config.PubSubConfig, loggerHandle logger.Logger) (pubsub PubSub, err error) {
+	factoriesMutex.RLock()
+	factory, ok := factories[cfg.Type]
+	factoriesMutex.RUnlock()
+
+	if !ok {
+		return nil, errors.InvalidValue("PubSub.Type", fmt.Sprintf("Unknown pub/sub type '%s' (must be one of: %s)", cfg.Type, strings.Join(Types(), ", ")))
+	}
+
+	return factory(cfg, loggerHandle)
+}
+
+// Register makes a pub/sub available to New() by its type. It panics if the
+// type is registered twice or the factory is nil.
+func Register(pubSubType config.PubSubType, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if factory == nil {
+		panic("pubsub: Register factory is nil")
+	}
+	if _, ok := factories[pubSubType]; ok {
+		panic("pubsub: Register called twice for type " + pubSubType.String())
+	}
+
+	factories[pubSubType] = factory
+}
+
+// Types returns the sorted types of the pub/subs which have been registered
+func Types() (types []string) {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	for pubSubType := range factories {
+		types = append(types, pubSubType.String())
+	}
+	sort.Strings(types)
+
+	return
+}
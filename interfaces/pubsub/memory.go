@@ -0,0 +1,143 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+const (
+	// DefaultMemoryBufferSize is the number of events held for each
+	// subscriber when it is not configured
+	DefaultMemoryBufferSize = 100
+)
+
+// memory is a pub/sub which is only useful when the publishers and
+// subscribers live in the same process
+type memory struct {
+	bufferSize  int
+	closed      bool
+	log         logger.Logger
+	mutex       sync.RWMutex
+	nextID      uint64
+	subscribers map[uint64]*memorySubscription
+}
+
+// memorySubscription is a subscriber to the memory pub/sub
+type memorySubscription struct {
+	events chan *domain.Event
+	id     uint64
+	pubsub *memory
+}
+
+// Memory is the contructor for a new memory based pub/sub
+func Memory(cfg *config.PubSubMemoryConfig, loggerHandle logger.Logger) (pubsub PubSub, err error) {
+	loggerHandle.Debugf("Memory(cfg): %#v", cfg)
+
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultMemoryBufferSize
+	}
+
+	pubsub = &memory{
+		bufferSize: bufferSize,
+		log:        loggerHandle,
+	}
+
+	return
+}
+
+// Cleanup will close every subscription
+func (m *memory) Cleanup(ctx context.Context) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.subscribers == nil || m.closed {
+		return errors.ConnectionFailure("memory", "PubSub has not been initialized or is already closed")
+	}
+
+	m.closed = true
+	for id, subscription := range m.subscribers {
+		close(subscription.events)
+		delete(m.subscribers, id)
+	}
+
+	return
+}
+
+// Init will get the pub/sub ready for subscribers
+func (m *memory) Init(ctx context.Context) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.closed = false
+	m.subscribers = map[uint64]*memorySubscription{}
+
+	return
+}
+
+// Publish will hand a copy of the event to every subscriber without blocking
+// dropping it for any subscriber which has fallen too far behind
+func (m *memory) Publish(ctx context.Context, event *domain.Event) (err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.subscribers == nil || m.closed {
+		return errors.ConnectionClosed("memory", "PubSub has not been initialized or is closed")
+	}
+
+	for id, subscription := range m.subscribers {
+		copied := *event
+		select {
+		case subscription.events <- &copied:
+		default:
+			m.log.Warnf("Subscriber (%d) is full, dropping %s event for: %s", id, event.Stage, event.RedditURL)
+		}
+	}
+
+	return
+}
+
+// Subscribe will start receiving every event published from now on
+func (m *memory) Subscribe(ctx context.Context) (subscription Subscription, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.subscribers == nil || m.closed {
+		return nil, errors.ConnectionClosed("memory", "PubSub has not been initialized or is closed")
+	}
+
+	m.nextID++
+	memorySubscription := &memorySubscription{
+		events: make(chan *domain.Event, m.bufferSize),
+		id:     m.nextID,
+		pubsub: m,
+	}
+	m.subscribers[memorySubscription.id] = memorySubscription
+
+	return memorySubscription, nil
+}
+
+// Close will stop receiving events
+func (s *memorySubscription) Close(ctx context.Context) (err error) {
+	s.pubsub.mutex.Lock()
+	defer s.pubsub.mutex.Unlock()
+
+	if _, ok := s.pubsub.subscribers[s.id]; !ok {
+		return errors.ConnectionClosed("memory", "Subscription is already closed")
+	}
+
+	delete(s.pubsub.subscribers, s.id)
+	close(s.events)
+
+	return
+}
+
+// Events returns the channel the events are received on
+func (s *memorySubscription) Events() (events <-chan *domain.Event) {
+	return s.events
+}
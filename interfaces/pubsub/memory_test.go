@@ -0,0 +1,110 @@
+package pubsub_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/pubsub"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+const redditURL = "https://www.reddit.com/r/mindblowing/comments/9z4buv/vortex_coin_bank/"
+
+func TestMemory_PublishToEverySubscriber(t *testing.T) {
+	ctx := context.Background()
+	ps := newMemory(t, 10)
+
+	first, err := ps.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	second, err := ps.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = ps.Publish(ctx, domain.NewEvent(redditURL, domain.EventStageVideoDownloaded)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, subscription := range []pubsub.Subscription{first, second} {
+		select {
+		case event := <-subscription.Events():
+			if event.Stage != domain.EventStageVideoDownloaded || event.RedditURL != redditURL {
+				t.Errorf("expecting the published event, got %#v", event)
+			}
+		default:
+			t.Errorf("expecting every subscriber to receive the event")
+		}
+	}
+
+	// A closed subscription no longer receives events
+	if err = first.Close(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = first.Close(ctx); errors.Type(err) != errors.TypeConnectionClosed {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeConnectionClosed, errors.Type(err))
+	}
+	if err = ps.Publish(ctx, domain.NewEvent(redditURL, domain.EventStageDone)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := <-first.Events(); ok {
+		t.Errorf("expecting the events of a closed subscription to be closed")
+	}
+	if event := <-second.Events(); event.Stage != domain.EventStageDone {
+		t.Errorf("expecting stage '%s', got '%s'", domain.EventStageDone, event.Stage)
+	}
+}
+
+func TestMemory_SlowSubscriber(t *testing.T) {
+	ctx := context.Background()
+	ps := newMemory(t, 1)
+
+	subscription, err := ps.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Publishing never blocks on a subscriber which is not keeping up
+	for _, stage := range []domain.EventStage{domain.EventStageMetadataFetched, domain.EventStageVideoDownloaded} {
+		if err = ps.Publish(ctx, domain.NewEvent(redditURL, stage)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if event := <-subscription.Events(); event.Stage != domain.EventStageMetadataFetched {
+		t.Errorf("expecting stage '%s', got '%s'", domain.EventStageMetadataFetched, event.Stage)
+	}
+
+	if err = ps.Cleanup(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := <-subscription.Events(); ok {
+		t.Errorf("expecting the dropped event to never be received")
+	}
+	if err = ps.Publish(ctx, domain.NewEvent(redditURL, domain.EventStageDone)); errors.Type(err) != errors.TypeConnectionClosed {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeConnectionClosed, errors.Type(err))
+	}
+}
+
+func newMemory(t *testing.T, bufferSize int) pubsub.PubSub {
+	ps, err := pubsub.Memory(
+		&config.PubSubMemoryConfig{
+			BufferSize: bufferSize,
+		},
+		logger.New(ioutil.Discard, "error", "text"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = ps.Init(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return ps
+}
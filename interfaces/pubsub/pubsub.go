@@ -0,0 +1,24 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+)
+
+// PubSub is the generic interface for a publish / subscribe service where,
+// unlike a queue, every subscriber receives every event published while it
+// is subscribed
+type PubSub interface {
+	Cleanup(ctx context.Context) (err error)
+	Init(ctx context.Context) (err error)
+	Publish(ctx context.Context, event *domain.Event) (err error)
+	Subscribe(ctx context.Context) (subscription Subscription, err error)
+}
+
+// Subscription receives the events published after it was made until it is
+// closed at which point the channel of events is closed
+type Subscription interface {
+	Close(ctx context.Context) (err error)
+	Events() (events <-chan *domain.Event)
+}
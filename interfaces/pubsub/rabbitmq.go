@@ -0,0 +1,225 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/streadway/amqp"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+// rabbitmqConnection contains all the information about a RabbitMQ connection
+// publishing to a fanout exchange
+type rabbitmqConnection struct {
+	channel      *amqp.Channel
+	connection   *amqp.Connection
+	exchangeName string
+	log          logger.Logger
+	mutex        sync.Mutex
+	uri          string
+}
+
+// rabbitmqSubscription is a subscriber with its own channel and exclusive
+// queue bound to the fanout exchange
+type rabbitmqSubscription struct {
+	channel   *amqp.Channel
+	closeOnce sync.Once
+	done      chan struct{}
+	events    chan *domain.Event
+}
+
+// RabbitMQ initializes a RabbitMQ AMQP pub/sub
+func RabbitMQ(cfg *config.PubSubRabbitMQConfig, loggerHandle logger.Logger) (pubsub PubSub, err error) {
+	loggerHandle.Debugf("RabbitMQ(cfg): %#v", cfg)
+
+	pubsub = &rabbitmqConnection{
+		exchangeName: cfg.ExchangeName,
+		log:          loggerHandle,
+		uri:          cfg.URI,
+	}
+
+	return
+}
+
+// Cleanup will close the channel and connection which also closes every
+// subscription
+func (r *rabbitmqConnection) Cleanup(ctx context.Context) (err error) {
+	if r.connection == nil || r.channel == nil {
+		return errors.ConnectionFailure("rabbitmq", "Channel and connection have not be initialized")
+	}
+
+	if err = r.channel.Close(); err != nil {
+		r.log.Errorf("Error closing channel: %s", err)
+		return r.connection.Close()
+	}
+	r.log.Infof("Channel closed")
+
+	if err = r.connection.Close(); err != nil {
+		return errors.ConnectionFailure("rabbitmq", "Unable to close connection")
+	}
+	r.log.Infof("Connection closed")
+
+	return
+}
+
+// Init will connect and declare the fanout exchange
+func (r *rabbitmqConnection) Init(ctx context.Context) (err error) {
+	r.connection, err = amqp.Dial(r.uri)
+	if err != nil {
+		return
+	}
+	r.log.Infof("Opened connection")
+
+	r.channel, err = r.connection.Channel()
+	if err != nil {
+		r.log.Errorf("Unable to open channel; %s", err)
+		r.connection.Close()
+		return
+	}
+	r.log.Infof("Opened channel")
+
+	if err = r.channel.ExchangeDeclare(
+		r.exchangeName, // name of the exchange
+		"fanout",       // type
+		true,           // durable
+		false,          // delete when complete
+		false,          // internal
+		false,          // noWait
+		nil,            // arguments
+	); err != nil {
+		r.log.Errorf("Error declaring exchange %s: %s", r.exchangeName, err)
+		return r.Cleanup(ctx)
+	}
+	r.log.Infof("Exchanged declared: %s", r.exchangeName)
+
+	return
+}
+
+// Publish will send the event to the fanout exchange. Events are not
+// persisted so they are lost if nothing is subscribed.
+func (r *rabbitmqConnection) Publish(ctx context.Context, event *domain.Event) (err error) {
+	if r.channel == nil {
+		return errors.ConnectionClosed("rabbitmq", "Channel has not been initialized")
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.InvalidValue("event", err.Error())
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.channel.Publish(
+		r.exchangeName, // exchange
+		"",             // routing key is ignored by a fanout exchange
+		false,          // mandatory
+		false,          // immediate
+		amqp.Publishing{
+			Body:         body,
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Transient,
+			Timestamp:    event.CreatedAt,
+		},
+	)
+}
+
+// Subscribe will bind a new exclusive queue to the fanout exchange which is
+// removed by RabbitMQ once the subscription is closed
+func (r *rabbitmqConnection) Subscribe(ctx context.Context) (subscription Subscription, err error) {
+	if r.connection == nil {
+		return nil, errors.ConnectionClosed("rabbitmq", "Connection has not been initialized")
+	}
+
+	channel, err := r.connection.Channel()
+	if err != nil {
+		return
+	}
+
+	queue, err := channel.QueueDeclare(
+		"",    // name is generated by RabbitMQ
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		channel.Close()
+		return
+	}
+
+	if err = channel.QueueBind(
+		queue.Name,     // name of the queue
+		"",             // bindingKey
+		r.exchangeName, // sourceExchange
+		false,          // noWait
+		nil,            // arguments
+	); err != nil {
+		channel.Close()
+		return
+	}
+
+	deliveries, err := channel.Consume(
+		queue.Name, // name
+		"",         // consumerTag
+		true,       // auto-ack
+		true,       // exclusive
+		false,      // noLocal
+		false,      // noWait
+		nil,        // arguments
+	)
+	if err != nil {
+		channel.Close()
+		return
+	}
+
+	rabbitmqSubscription := &rabbitmqSubscription{
+		channel: channel,
+		done:    make(chan struct{}),
+		events:  make(chan *domain.Event),
+	}
+	go rabbitmqSubscription.receive(deliveries, r.log)
+
+	return rabbitmqSubscription, nil
+}
+
+// Close will stop receiving events
+func (s *rabbitmqSubscription) Close(ctx context.Context) (err error) {
+	// A subscriber which has stopped reading must not leave receive() stuck
+	// handing it an event
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+
+	return s.channel.Close()
+}
+
+// Events returns the channel the events are received on
+func (s *rabbitmqSubscription) Events() (events <-chan *domain.Event) {
+	return s.events
+}
+
+// receive will decode deliveries in to events until the channel is closed
+func (s *rabbitmqSubscription) receive(deliveries <-chan amqp.Delivery, log logger.Logger) {
+	defer close(s.events)
+
+	for delivery := range deliveries {
+		event := &domain.Event{}
+		if err := json.Unmarshal(delivery.Body, event); err != nil {
+			log.Warnf("Ignoring event which could not be decoded: %s", err)
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+const (
+	// EnvelopeVersion is the version of the envelope schema which is pushed
+	// and the only one which can be decoded
+	EnvelopeVersion = 1
+
+	// KindRedditVideo is the kind of an envelope carrying a Reddit video to
+	// be processed by a worker. It is only decoded for the envelopes pushed
+	// before KindVideoRequest.
+	KindRedditVideo = "reddit_video"
+
+	// KindVideoRequest is the kind of an envelope carrying a request for the
+	// video at a URL of any source to be processed by a worker
+	KindVideoRequest = "video_request"
+)
+
+// Envelope is what is pushed on to a queue so that a consumer knows what the
+// payload is instead of having to guess from its contents
+type Envelope struct {
+	// Attempts is the number of times the payload was attempted before the
+	// envelope was pushed, e.g. in another queue. Attempts made while on this
+	// queue are counted by the queue itself.
+	Attempts int `json:"attempts"`
+
+	// EnqueuedAt is when the envelope was created
+	EnqueuedAt time.Time `json:"enqueued_at"`
+
+	// ID uniquely identifies the envelope
+	ID string `json:"id"`
+
+	// Kind is what the payload is
+	Kind string `json:"kind"`
+
+	// Payload is the JSON for the payload
+	Payload json.RawMessage `json:"payload"`
+
+	// Version is the version of the envelope schema
+	Version int `json:"version"`
+}
+
+// NewEnvelope will return an envelope of the kind for the payload
+func NewEnvelope(kind string, payload interface{}) (envelope *Envelope, err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	envelope = &Envelope{
+		EnqueuedAt: time.Now().UTC(),
+		ID:         id.String(),
+		Kind:       kind,
+		Payload:    data,
+		Version:    EnvelopeVersion,
+	}
+
+	return
+}
+
+// DecodeEnvelope will return the envelope in a message popped off of a queue
+// rejecting messages which are not an envelope of a version we know
+func DecodeEnvelope(msg interface{}) (envelope *Envelope, err error) {
+	data, ok := msg.([]byte)
+	if !ok {
+		return nil, errors.InvalidValue("envelope", fmt.Sprintf("Message is not of type []byte: %T", msg))
+	}
+
+	envelope = &Envelope{}
+	if err = json.Unmarshal(data, envelope); err != nil {
+		return nil, errors.InvalidValue("envelope", fmt.Sprintf("Message is not a JSON envelope: %s", err))
+	}
+
+	switch {
+	case envelope.Version != EnvelopeVersion:
+		return nil, errors.InvalidValue("envelope.version", fmt.Sprintf("Unknown envelope version %d (must be %d)", envelope.Version, EnvelopeVersion))
+	case envelope.Kind == "":
+		return nil, errors.MissingField("envelope.kind")
+	case len(envelope.Payload) == 0:
+		return nil, errors.MissingField("envelope.payload")
+	}
+
+	return
+}
+
+// Marshal will return the JSON for the envelope to push on to a queue
+func (e *Envelope) Marshal() (msg []byte, err error) {
+	return json.Marshal(e)
+}
+
+// Unmarshal will decode the payload of the envelope into v
+func (e *Envelope) Unmarshal(v interface{}) (err error) {
+	if err = json.Unmarshal(e.Payload, v); err != nil {
+		return errors.InvalidValue("envelope.payload", fmt.Sprintf("Payload is not a valid %s: %s", e.Kind, err))
+	}
+
+	return
+}
@@ -0,0 +1,73 @@
+package queue_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+func TestNewEnvelope(t *testing.T) {
+	envelope, err := queue.NewEnvelope(queue.KindRedditVideo, map[string]string{"url": "https://www.reddit.com/r/videos"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if envelope.ID == "" || envelope.EnqueuedAt.IsZero() || envelope.Version != queue.EnvelopeVersion {
+		t.Errorf("expecting an ID, enqueue time and version, got: %#v", envelope)
+	}
+
+	msg, err := envelope.Marshal()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	decoded, err := queue.DecodeEnvelope(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decoded.ID != envelope.ID || decoded.Kind != envelope.Kind || !decoded.EnqueuedAt.Equal(envelope.EnqueuedAt) {
+		t.Errorf("expecting %#v, got %#v", envelope, decoded)
+	}
+
+	payload := map[string]string{}
+	if err = decoded.Unmarshal(&payload); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if payload["url"] != "https://www.reddit.com/r/videos" {
+		t.Errorf("expecting the payload to survive the round trip, got: %#v", payload)
+	}
+}
+
+func TestDecodeEnvelope(suite *testing.T) {
+	suite.Parallel()
+
+	cases := []struct {
+		msg     interface{}
+		errType string
+	}{
+		{msg: "not bytes", errType: errors.TypeInvalidValue},
+		{msg: []byte("garbage"), errType: errors.TypeInvalidValue},
+		{msg: []byte(`{"url": "https://www.reddit.com/r/videos"}`), errType: errors.TypeInvalidValue},
+		{msg: []byte(`{"id": "1", "kind": "reddit_video", "payload": {}, "version": 2}`), errType: errors.TypeInvalidValue},
+		{msg: []byte(`{"id": "1", "payload": {}, "version": 1}`), errType: errors.TypeMissingField},
+		{msg: []byte(`{"id": "1", "kind": "reddit_video", "version": 1}`), errType: errors.TypeMissingField},
+		{msg: []byte(`{"attempts": 2, "id": "1", "kind": "reddit_video", "payload": {}, "version": 1}`)},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			_, err := queue.DecodeEnvelope(cs.msg)
+			if cs.errType == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if errors.Type(err) != cs.errType {
+				t.Errorf("expecting error type '%s', got: %v", cs.errType, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+// Factory builds a queue from its section of the configuration
+type Factory func(cfg *config.QueueConfig, loggerHandle logger.Logger) (queue Queue, err error)
+
+var (
+	// factories are the queues which can be built by New() keyed by their
+	// type
+	factories = map[config.QueueType]Factory{}
+
+	// factoriesMutex guards factories
+	factoriesMutex sync.RWMutex
+)
+
+func init() {
+	Register(config.QueueConfigMemory, func(cfg *config.QueueConfig, loggerHandle logger.Logger) (Queue, error) {
+		return Memory(&cfg.Memory, loggerHandle)
+	})
+	Register(config.QueueConfigRabbitMQ, func(cfg *config.QueueConfig, loggerHandle logger.Logger) (Queue, error) {
+		return RabbitMQ(&cfg.RabbitMQ, loggerHandle)
+	})
+}
+
+// New builds the queue named by the type in the configuration
+func New(cfg *config.QueueConfig, loggerHandle logger.Logger) (queue Queue, err error) {
+	factoriesMutex.RLock()
+	factory, ok := factories[cfg.Type]
+	factoriesMutex.RUnlock()
+
+	if !ok {
+		return nil, errors.InvalidValue("Queue.Type", fmt.Sprintf("Unknown queue type '%s' (must be one of: %s)", cfg.Type, strings.Join(Types(), ", ")))
+	}
+
+	return factory(cfg, loggerHandle)
+}
+
+// Register makes a queue available to New() by its type. It panics if the
+// type is registered twice or the factory is nil.
+func Register(queueType config.QueueType, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if factory == nil {
+		panic("queue: Register factory is nil")
+	}
+	if _, ok := factories[queueType]; ok {
+		panic("queue: Register called twice for type " + queueType.String())
+	}
+
+	factories[queueType] = factory
+}
+
+// Types returns the sorted types of the queues which have been registered
+func Types() (types []string) {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	for queueType := range factories {
+		types = append(types, queueType.String())
+	}
+	sort.Strings(types)
+
+	return
+}
@@ -0,0 +1,74 @@
+package queue_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestNew(suite *testing.T) {
+	cases := []struct {
+		expectedType string
+		queueType    config.QueueType
+	}{
+		{queueType: config.QueueConfigMemory},
+		{queueType: config.QueueConfigRabbitMQ},
+		{expectedType: errors.TypeInvalidValue, queueType: "kafka"},
+		{expectedType: errors.TypeInvalidValue, queueType: ""},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			q, err := queue.New(
+				&config.QueueConfig{
+					Memory: config.QueueMemoryConfig{MaxSize: 1},
+					Type:   cs.queueType,
+				},
+				logger.New(ioutil.Discard, "error", "text"),
+			)
+			if actualType := errors.Type(err); err != nil && actualType != cs.expectedType {
+				t.Fatalf("expecting error type '%s', got '%s'", cs.expectedType, actualType)
+			} else if err == nil && cs.expectedType != "" {
+				t.Fatalf("expecting error type '%s', got none", cs.expectedType)
+			}
+			if err == nil && q == nil {
+				t.Errorf("expecting a queue, got nil")
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	queueType := config.QueueType("test")
+	queue.Register(queueType, func(cfg *config.QueueConfig, loggerHandle logger.Logger) (queue.Queue, error) {
+		return queue.Memory(&cfg.Memory, loggerHandle)
+	})
+
+	q, err := queue.New(&config.QueueConfig{Type: queueType}, logger.New(ioutil.Discard, "error", "text"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = q.Init(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer q.Cleanup(context.Background())
+
+	if types := fmt.Sprint(queue.Types()); types != "[memory rabbitmq test]" {
+		t.Errorf("expecting types '[memory rabbitmq test]', got '%s'", types)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expecting registering a type twice to panic")
+		}
+	}()
+	queue.Register(queueType, func(cfg *config.QueueConfig, loggerHandle logger.Logger) (queue.Queue, error) {
+		return nil, nil
+	})
+}
@@ -2,73 +2,404 @@ package queue
 
 import (
 	"context"
-	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"github.com/johnwyles/vrddt-droplets/pkg/logger"
 )
 
+const (
+	// DefaultMemoryVisibilityTimeout is how long a popped message may go
+	// without being acknowledged before it is delivered again when one is
+	// not configured
+	DefaultMemoryVisibilityTimeout = 5 * time.Minute
+)
+
+// memory is a queue backed by a buffered channel which is only useful when
+// the producers and consumers live in the same process
 type memory struct {
-	maxSize        int
-	queue          chan interface{}
-	log            logger.Logger
-	connectionType ConnectionType
+	closed            bool
+	deadLetters       []*DeadLetter
+	done              chan struct{}
+	inFlight          map[uint64]*memoryMessage
+	log               logger.Logger
+	maxSize           int
+	mutex             sync.RWMutex
+	nextID            uint64
+	queue             chan *memoryMessage
+	visibilityTimeout time.Duration
+}
+
+// memoryMessage is the envelope for a message while it is in the queue
+type memoryMessage struct {
+	attempts int
+	body     interface{}
+	deadline time.Time
+	id       uint64
+}
+
+// memoryDelivery is the handle for a message popped off of the memory queue
+type memoryDelivery struct {
+	message *memoryMessage
+	queue   *memory
 }
 
 // Memory is the contructor for a new memory based queue
 func Memory(cfg *config.QueueMemoryConfig, loggerHandle logger.Logger) (queue Queue, err error) {
 	loggerHandle.Debugf("Memory(cfg): %#v", cfg)
 
+	visibilityTimeout := time.Duration(cfg.VisibilityTimeout) * time.Second
+	if visibilityTimeout <= 0 {
+		visibilityTimeout = DefaultMemoryVisibilityTimeout
+	}
+
 	queue = &memory{
-		log:     loggerHandle,
-		maxSize: cfg.MaxSize,
+		log:               loggerHandle,
+		maxSize:           cfg.MaxSize,
+		visibilityTimeout: visibilityTimeout,
 	}
 
 	return
 }
 
+// Cleanup will close the queue which will unblock any consumers waiting on
+// a message
 func (m *memory) Cleanup(ctx context.Context) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.queue == nil || m.closed {
+		return errors.ConnectionFailure("memory", "Queue has not been initialized or is already closed")
+	}
+
+	m.closed = true
+	close(m.done)
 	close(m.queue)
+
 	return
 }
 
+// DeadLetters returns up to limit of the messages which were moved to the
+// dead-letter queue, oldest first, or all of them if limit is not positive
+func (m *memory) DeadLetters(ctx context.Context, limit int) (deadLetters []*DeadLetter, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, deadLetter := range m.deadLetters {
+		if limit > 0 && len(deadLetters) >= limit {
+			break
+		}
+
+		copied := *deadLetter
+		deadLetters = append(deadLetters, &copied)
+	}
+
+	return
+}
+
+// GetDeadLetter returns the message on the dead-letter queue with the given ID
+func (m *memory) GetDeadLetter(ctx context.Context, id string) (deadLetter *DeadLetter, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, found := range m.deadLetters {
+		if found.ID == id {
+			copied := *found
+			return &copied, nil
+		}
+	}
+
+	return nil, errors.ResourceNotFound("DeadLetter", id)
+}
+
+// Init will create the underlying channel and start redelivering messages
+// which have not been acknowledged within the visibility timeout
 func (m *memory) Init(ctx context.Context) (err error) {
-	m.queue = make(chan interface{}, m.maxSize)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.closed = false
+	m.deadLetters = []*DeadLetter{}
+	m.done = make(chan struct{})
+	m.inFlight = map[uint64]*memoryMessage{}
+	m.queue = make(chan *memoryMessage, m.maxSize)
+
+	go m.redeliver(m.done)
+
 	return
 }
 
+// MakeClient is implemented but does nothing as the in-memory queue is shared
+// within a single process and is always able to both push and pop
 func (m *memory) MakeClient(ctx context.Context) (err error) {
-	m.connectionType = Client
 	return
 }
 
+// MakeConsumer is implemented but does nothing as the in-memory queue is
+// shared within a single process and is always able to both push and pop
 func (m *memory) MakeConsumer(ctx context.Context) (err error) {
-	m.connectionType = Consumer
 	return
 }
 
+// Push will put a message on to the queue without blocking and will return a
+// ResourceLimit error if the queue is full
 func (m *memory) Push(ctx context.Context, msg interface{}) (err error) {
-	if m.connectionType != Client {
-		return errors.Conflict("Connection type", m.connectionType.String())
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.queue == nil || m.closed {
+		return errors.ConnectionClosed("memory", "Queue has not been initialized or is closed")
+	}
+
+	m.nextID++
+	message := &memoryMessage{
+		body: msg,
+		id:   m.nextID,
 	}
 
 	select {
-	case m.queue <- msg:
+	case m.queue <- message:
 		return
 	default:
 		return errors.ResourceLimit("memory", m.maxSize)
 	}
 }
 
-func (m *memory) Pop(ctx context.Context) (msg interface{}, err error) {
-	if m.connectionType != Consumer {
-		return nil, errors.ConnectionFailure("memory", m.connectionType.String())
+// Pop will block until a message is available on the queue, the queue is
+// closed, or the context is done
+func (m *memory) Pop(ctx context.Context) (delivery Delivery, err error) {
+	m.mutex.RLock()
+	queue := m.queue
+	m.mutex.RUnlock()
+
+	if queue == nil {
+		return nil, errors.ConnectionClosed("memory", "Queue has not been initialized")
 	}
 
 	select {
-	case item := <-m.queue:
-		return item, nil
+	case <-ctx.Done():
+		return nil, errors.Cancelled("memory pop", ctx.Err().Error())
+	case message, ok := <-queue:
+		if !ok {
+			return nil, errors.ConnectionClosed("memory", "Queue was closed while waiting for a message")
+		}
+
+		m.mutex.Lock()
+		message.attempts++
+		message.deadline = time.Now().Add(m.visibilityTimeout)
+		m.inFlight[message.id] = message
+		m.mutex.Unlock()
+
+		return &memoryDelivery{message: message, queue: m}, nil
+	}
+}
+
+// ReplayDeadLetter will move the message with the given ID off of the
+// dead-letter queue and back on to the queue with its attempts reset
+func (m *memory) ReplayDeadLetter(ctx context.Context, id string) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.queue == nil || m.closed {
+		return errors.ConnectionClosed("memory", "Queue has not been initialized or is closed")
+	}
+
+	for i, deadLetter := range m.deadLetters {
+		if deadLetter.ID != id {
+			continue
+		}
+
+		m.nextID++
+		message := &memoryMessage{
+			body: deadLetter.Body,
+			id:   m.nextID,
+		}
+
+		select {
+		case m.queue <- message:
+			m.deadLetters = append(m.deadLetters[:i], m.deadLetters[i+1:]...)
+			return
+		default:
+			return errors.ResourceLimit("memory", m.maxSize)
+		}
+	}
+
+	return errors.ResourceNotFound("DeadLetter", id)
+}
+
+// deadLetter will move an in-flight message on to the dead-letter queue. The
+// dead letters are kept until they are replayed so none are dropped when
+// there are already the maximum number, the message is left in flight
+// instead for it to be settled some other way.
+func (m *memory) deadLetter(message *memoryMessage, reason string) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.inFlight[message.id]; !ok {
+		return errors.ResourceNotFound("delivery", fmt.Sprintf("%d", message.id))
+	}
+
+	if m.maxSize > 0 && len(m.deadLetters) >= m.maxSize {
+		return errors.ResourceLimit("memory", m.maxSize)
+	}
+	delete(m.inFlight, message.id)
+
+	m.deadLetters = append(m.deadLetters, &DeadLetter{
+		Attempts: message.attempts,
+		Body:     message.body,
+		DiedAt:   time.Now(),
+		ID:       fmt.Sprintf("%d", message.id),
+		Reason:   reason,
+	})
+
+	return
+}
+
+// redeliver will periodically put messages which have outlived the
+// visibility timeout back on to the queue until done is closed
+func (m *memory) redeliver(done chan struct{}) {
+	interval := m.visibilityTimeout / 10
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			m.mutex.Lock()
+			if m.closed {
+				m.mutex.Unlock()
+				return
+			}
+
+			for id, message := range m.inFlight {
+				if now.Before(message.deadline) {
+					continue
+				}
+
+				select {
+				case m.queue <- message:
+					delete(m.inFlight, id)
+					m.log.Debugf("Redelivering message (%d) after the visibility timeout", id)
+				default:
+					// The queue is full so try again on the next tick
+				}
+			}
+			m.mutex.Unlock()
+		}
+	}
+}
+
+// release removes a message from the in-flight messages optionally putting it
+// back on to the queue
+func (m *memory) release(message *memoryMessage, requeue bool) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.inFlight[message.id]; !ok {
+		return errors.ResourceNotFound("delivery", fmt.Sprintf("%d", message.id))
+	}
+	delete(m.inFlight, message.id)
+
+	if !requeue {
+		return
+	}
+
+	if m.closed {
+		return errors.ConnectionClosed("memory", "Queue was closed before the message could be requeued")
+	}
+
+	select {
+	case m.queue <- message:
+		return
 	default:
-		return nil, errors.ResourceLimit("memory", 0)
+		return errors.ResourceLimit("memory", m.maxSize)
 	}
 }
+
+// retry will take a message out of flight and put it back on to the queue
+// once the delay has passed unless the queue has been closed by then. If the
+// queue is full the message waits out the delay again rather than being lost.
+func (m *memory) retry(message *memoryMessage, delay time.Duration) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.inFlight[message.id]; !ok {
+		return errors.ResourceNotFound("delivery", fmt.Sprintf("%d", message.id))
+	}
+	delete(m.inFlight, message.id)
+
+	// A full queue is tried again no more often than messages are
+	// redelivered
+	wait := delay
+	if wait < 10*time.Millisecond {
+		wait = 10 * time.Millisecond
+	}
+
+	done := m.done
+	var requeue func()
+	requeue = func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		select {
+		case <-done:
+			m.log.Warnf("Queue was closed before message (%d) could be retried", message.id)
+			return
+		default:
+		}
+
+		select {
+		case m.queue <- message:
+			m.log.Debugf("Retrying message (%d) after %s", message.id, delay)
+		default:
+			m.log.Warnf("Queue is full, trying to retry message (%d) again in %s", message.id, wait)
+			time.AfterFunc(wait, requeue)
+		}
+	}
+	time.AfterFunc(delay, requeue)
+
+	return
+}
+
+// Ack will acknowledge the message so that it is never delivered again
+func (d *memoryDelivery) Ack(ctx context.Context) (err error) {
+	return d.queue.release(d.message, false)
+}
+
+// Attempts returns the number of times the message has been popped
+func (d *memoryDelivery) Attempts() (attempts int) {
+	d.queue.mutex.RLock()
+	defer d.queue.mutex.RUnlock()
+
+	return d.message.attempts
+}
+
+// Body returns the message that was pushed on to the queue
+func (d *memoryDelivery) Body() (msg interface{}) {
+	return d.message.body
+}
+
+// DeadLetter will move the message to the dead-letter queue
+func (d *memoryDelivery) DeadLetter(ctx context.Context, reason string) (err error) {
+	return d.queue.deadLetter(d.message, reason)
+}
+
+// Nack will reject the message putting it back on to the queue if requeue is
+// set and otherwise dropping it
+func (d *memoryDelivery) Nack(ctx context.Context, requeue bool) (err error) {
+	return d.queue.release(d.message, requeue)
+}
+
+// Retry will put the message back on to the queue after the delay
+func (d *memoryDelivery) Retry(ctx context.Context, delay time.Duration) (err error) {
+	return d.queue.retry(d.message, delay)
+}
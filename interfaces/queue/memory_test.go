@@ -0,0 +1,356 @@
+package queue_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestMemory_PopBlocksUntilPush(t *testing.T) {
+	ctx := context.Background()
+	producer, consumer := newMemoryPair(t)
+
+	popped := make(chan interface{})
+	go func() {
+		delivery, err := consumer.Pop(ctx)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+			popped <- nil
+			return
+		}
+		popped <- delivery.Body()
+	}()
+
+	select {
+	case <-popped:
+		t.Fatalf("Pop returned before a message was pushed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := producer.Push(ctx, []byte("vrddt")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	select {
+	case msg := <-popped:
+		if body, _ := msg.([]byte); string(body) != "vrddt" {
+			t.Errorf("expecting message 'vrddt', got '%s'", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Pop did not return after a message was pushed")
+	}
+}
+
+func TestMemory_PopCancelled(t *testing.T) {
+	_, consumer := newMemoryPair(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := consumer.Pop(ctx); errors.Type(err) != errors.TypeCancelled {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeCancelled, errors.Type(err))
+	}
+}
+
+func TestMemory_PopClosed(t *testing.T) {
+	ctx := context.Background()
+	_, consumer := newMemoryPair(t)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		consumer.Cleanup(ctx)
+	}()
+
+	if _, err := consumer.Pop(ctx); errors.Type(err) != errors.TypeConnectionClosed {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeConnectionClosed, errors.Type(err))
+	}
+}
+
+func TestMemory_AckNack(suite *testing.T) {
+	cases := []struct {
+		redelivered bool
+		settle      func(ctx context.Context, delivery queue.Delivery) error
+	}{
+		{
+			redelivered: false,
+			settle: func(ctx context.Context, delivery queue.Delivery) error {
+				return delivery.Ack(ctx)
+			},
+		},
+		{
+			redelivered: false,
+			settle: func(ctx context.Context, delivery queue.Delivery) error {
+				return delivery.Nack(ctx, false)
+			},
+		},
+		{
+			redelivered: true,
+			settle: func(ctx context.Context, delivery queue.Delivery) error {
+				return delivery.Nack(ctx, true)
+			},
+		},
+		{
+			// Never settling the delivery should have it come back after the
+			// visibility timeout
+			redelivered: true,
+			settle: func(ctx context.Context, delivery queue.Delivery) error {
+				return nil
+			},
+		},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			producer, consumer := newMemoryPair(t)
+			defer consumer.Cleanup(context.Background())
+
+			if err := producer.Push(context.Background(), []byte("vrddt")); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			delivery, err := consumer.Pop(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if err = cs.settle(context.Background(), delivery); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+			defer cancel()
+
+			redelivery, err := consumer.Pop(ctx)
+			if !cs.redelivered {
+				if errors.Type(err) != errors.TypeCancelled {
+					t.Errorf("expecting error type '%s', got '%s'", errors.TypeCancelled, errors.Type(err))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if body, _ := redelivery.Body().([]byte); string(body) != "vrddt" {
+				t.Errorf("expecting message 'vrddt', got '%s'", redelivery.Body())
+			}
+		})
+	}
+}
+
+func TestMemory_AckTwice(t *testing.T) {
+	ctx := context.Background()
+	producer, consumer := newMemoryPair(t)
+
+	if err := producer.Push(ctx, []byte("vrddt")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	delivery, err := consumer.Pop(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = delivery.Ack(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = delivery.Ack(ctx); errors.Type(err) != errors.TypeResourceNotFound {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceNotFound, errors.Type(err))
+	}
+}
+
+func TestMemory_DeadLetters(t *testing.T) {
+	ctx := context.Background()
+	producer, consumer := newMemoryPair(t)
+
+	for _, body := range []string{"first", "second"} {
+		if err := producer.Push(ctx, []byte(body)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		delivery, err := consumer.Pop(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err = delivery.DeadLetter(ctx, "broken "+body); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	deadLetters, err := consumer.DeadLetters(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Reason != "broken first" || deadLetters[0].Attempts != 1 {
+		t.Fatalf("expecting only the first dead letter, got %#v", deadLetters)
+	}
+
+	if _, err = consumer.GetDeadLetter(ctx, "unknown"); errors.Type(err) != errors.TypeResourceNotFound {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceNotFound, errors.Type(err))
+	}
+
+	if err = consumer.ReplayDeadLetter(ctx, deadLetters[0].ID); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	delivery, err := consumer.Pop(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if body, _ := delivery.Body().([]byte); string(body) != "first" {
+		t.Errorf("expecting message 'first', got '%s'", delivery.Body())
+	}
+	if delivery.Attempts() != 1 {
+		t.Errorf("expecting attempts to be reset to 1, got %d", delivery.Attempts())
+	}
+
+	if deadLetters, _ = consumer.DeadLetters(ctx, 0); len(deadLetters) != 1 {
+		t.Errorf("expecting 1 dead letter after replay, got %d", len(deadLetters))
+	}
+}
+
+func TestMemory_DeadLettersFull(t *testing.T) {
+	ctx := context.Background()
+	q, err := queue.Memory(&config.QueueMemoryConfig{MaxSize: 1}, logger.New(ioutil.Discard, "error", "text"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = q.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer q.Cleanup(ctx)
+
+	var deliveries []queue.Delivery
+	for _, body := range []string{"first", "second"} {
+		if err = q.Push(ctx, []byte(body)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		delivery, err := q.Pop(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = deliveries[0].DeadLetter(ctx, "broken first"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A full dead-letter queue keeps what it has and leaves the message to
+	// be settled some other way
+	if err = deliveries[1].DeadLetter(ctx, "broken second"); errors.Type(err) != errors.TypeResourceLimit {
+		t.Fatalf("expecting error type '%s', got '%s'", errors.TypeResourceLimit, errors.Type(err))
+	}
+	if err = deliveries[1].Nack(ctx, true); err != nil {
+		t.Fatalf("expecting the message to still be in flight, got error: %s", err)
+	}
+
+	deadLetters, err := q.DeadLetters(ctx, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Reason != "broken first" {
+		t.Errorf("expecting only the first dead letter, got %#v", deadLetters)
+	}
+}
+
+func TestMemory_Retry(t *testing.T) {
+	ctx := context.Background()
+	producer, consumer := newMemoryPair(t)
+
+	if err := producer.Push(ctx, []byte("vrddt")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	delivery, err := consumer.Pop(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	start := time.Now()
+	if err = delivery.Retry(ctx, 100*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if delivery, err = consumer.Pop(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expecting the retry to wait at least 100ms, waited %s", elapsed)
+	}
+	if delivery.Attempts() != 2 {
+		t.Errorf("expecting 2 attempts, got %d", delivery.Attempts())
+	}
+}
+
+func TestMemory_RetryFull(t *testing.T) {
+	ctx := context.Background()
+	q, err := queue.Memory(&config.QueueMemoryConfig{MaxSize: 1}, logger.New(ioutil.Discard, "error", "text"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = q.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer q.Cleanup(ctx)
+
+	if err = q.Push(ctx, []byte("first")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	delivery, err := q.Pop(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The queue is full when the retry is due so it has to wait its turn
+	if err = q.Push(ctx, []byte("second")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = delivery.Retry(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	popCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	for _, expected := range []string{"second", "first"} {
+		if delivery, err = q.Pop(popCtx); err != nil {
+			t.Fatalf("expecting '%s', got error: %s", expected, err)
+		}
+		if string(delivery.Body().([]byte)) != expected {
+			t.Errorf("expecting '%s', got '%s'", expected, delivery.Body())
+		}
+		if err = delivery.Ack(ctx); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+// newMemoryPair returns a client and a consumer sharing the same underlying
+// memory queue
+func newMemoryPair(t *testing.T) (producer queue.Queue, consumer queue.Queue) {
+	q, err := queue.Memory(
+		&config.QueueMemoryConfig{
+			MaxSize:           10,
+			VisibilityTimeout: 1,
+		},
+		logger.New(ioutil.Discard, "error", "text"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = q.Init(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return q, q
+}
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"time"
 )
 
 const (
@@ -15,14 +16,41 @@ const (
 // ConnectionType holds whether the connection is a Client or Consumer
 type ConnectionType int
 
+// DeadLetter is a message which was moved off of the queue because it could
+// not be processed
+type DeadLetter struct {
+	Attempts int
+	Body     interface{}
+	DiedAt   time.Time
+	ID       string
+	Reason   string
+}
+
+// Delivery is a message that has been popped off of a queue. The message
+// stays reserved for the consumer until it is acknowledged with Ack(),
+// rejected with Nack(), scheduled for another attempt with Retry(), or moved
+// to the dead-letter queue with DeadLetter() so that a consumer which dies
+// while working on it does not lose the message.
+type Delivery interface {
+	Ack(ctx context.Context) (err error)
+	Attempts() (attempts int)
+	Body() (msg interface{})
+	DeadLetter(ctx context.Context, reason string) (err error)
+	Nack(ctx context.Context, requeue bool) (err error)
+	Retry(ctx context.Context, delay time.Duration) (err error)
+}
+
 // Queue is the generic interface for a queue
 type Queue interface {
 	Cleanup(ctx context.Context) (err error)
+	DeadLetters(ctx context.Context, limit int) (deadLetters []*DeadLetter, err error)
+	GetDeadLetter(ctx context.Context, id string) (deadLetter *DeadLetter, err error)
 	Init(ctx context.Context) (err error)
 	MakeClient(ctx context.Context) (err error)
 	MakeConsumer(ctx context.Context) (err error)
 	Push(ctx context.Context, msg interface{}) (err error)
-	Pop(ctx context.Context) (msg interface{}, err error)
+	Pop(ctx context.Context) (delivery Delivery, err error)
+	ReplayDeadLetter(ctx context.Context, id string) (err error)
 }
 
 func (c ConnectionType) String() string {
@@ -3,16 +3,27 @@ package queue
 import (
 	"context"
 	"fmt"
-	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/streadway/amqp"
 
 	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"github.com/johnwyles/vrddt-droplets/pkg/logger"
 )
 
+const (
+	// RabbitMQHeaderAttempts is the message header holding the number of
+	// times a message has previously been attempted
+	RabbitMQHeaderAttempts = "x-vrddt-attempts"
+
+	// RabbitMQHeaderReason is the message header holding the reason a
+	// message was moved to the dead-letter queue
+	RabbitMQHeaderReason = "x-vrddt-reason"
+)
+
 // We tried and failed so many times...
 //
 // https://stackoverflow.com/questions/35583735/unmarshaling-into-an-interface-and-then-performing-type-assertion
@@ -22,30 +33,62 @@ import (
 
 // rabbitmqConnection contains all the information about a RabbitMQ connection
 type rabbitmqConnection struct {
-	bindingKeyName string
-	consumerID     string
-	channel        *amqp.Channel
-	connection     *amqp.Connection
-	connectionType ConnectionType
-	delivery       <-chan amqp.Delivery
-	exchangeName   string
-	log            logger.Logger
-	queue          amqp.Queue
-	queueName      string
-	uri            string
+	bindingKeyName      string
+	consumerID          string
+	consumerMutex       sync.Mutex
+	channel             *amqp.Channel
+	connection          *amqp.Connection
+	connectionType      ConnectionType
+	deadLetterQueueName string
+	delivery            <-chan amqp.Delivery
+	exchangeName        string
+	log                 logger.Logger
+	prefetch            int
+	queue               amqp.Queue
+	queueName           string
+	retryQueueName      string
+	retryQueues         map[time.Duration]string
+	retryQueuesMutex    sync.Mutex
+	uri                 string
+}
+
+// rabbitmqDelivery is the handle for a message popped off of RabbitMQ
+type rabbitmqDelivery struct {
+	connection *rabbitmqConnection
+	delivery   amqp.Delivery
+	log        logger.Logger
 }
 
 // RabbitMQ initializes a RabbitMQ AMQP connection
 func RabbitMQ(cfg *config.QueueRabbitMQConfig, loggerHandle logger.Logger) (queue Queue, err error) {
 	loggerHandle.Debugf("RabbitMQ(cfg): %#v", cfg)
 
+	deadLetterQueueName := cfg.DeadLetterQueueName
+	if deadLetterQueueName == "" {
+		deadLetterQueueName = cfg.QueueName + ".dead-letter"
+	}
+
+	retryQueueName := cfg.RetryQueueName
+	if retryQueueName == "" {
+		retryQueueName = cfg.QueueName + ".retry"
+	}
+
+	prefetch := cfg.Prefetch
+	if prefetch <= 0 {
+		prefetch = 1
+	}
+
 	queue = &rabbitmqConnection{
-		bindingKeyName: cfg.BindingKeyName,
-		connectionType: Client,
-		exchangeName:   cfg.ExchangeName,
-		log:            loggerHandle,
-		queueName:      cfg.QueueName,
-		uri:            cfg.URI,
+		bindingKeyName:      cfg.BindingKeyName,
+		connectionType:      Client,
+		deadLetterQueueName: deadLetterQueueName,
+		exchangeName:        cfg.ExchangeName,
+		log:                 loggerHandle,
+		prefetch:            prefetch,
+		queueName:           cfg.QueueName,
+		retryQueueName:      retryQueueName,
+		retryQueues:         map[time.Duration]string{},
+		uri:                 cfg.URI,
 	}
 
 	return
@@ -131,19 +174,40 @@ func (r *rabbitmqConnection) Init(ctx context.Context) (err error) {
 	}
 	r.log.Infof("Queue '%s' bound to exchange '%s' using binding key name '%s'", r.queueName, r.exchangeName, r.bindingKeyName)
 
+	_, err = r.channel.QueueDeclare(
+		r.deadLetterQueueName, // name
+		true,                  // durable
+		false,                 // delete when unused
+		false,                 // exclusive
+		false,                 // no-wait
+		nil,                   // arguments
+	)
+	if err != nil {
+		r.log.Errorf("Error declaring dead-letter queue %s: %s", r.deadLetterQueueName, err)
+		return r.Cleanup(ctx)
+	}
+	r.log.Infof("Dead-letter queue declared: %s", r.deadLetterQueueName)
+
 	return
 }
 
 // MakeClient is implemented but does nothing as there is no additional steps
 // required by RabbitMQ to make the connection a client vs a consumer
 func (r *rabbitmqConnection) MakeClient(ctx context.Context) (err error) {
+	r.consumerMutex.Lock()
+	defer r.consumerMutex.Unlock()
+
 	r.connectionType = Client
 	return
 }
 
 // MakeConsumer will setup whatever is necessary to pop messages and
-// will set the Delivery channel
+// will set the Delivery channel. It is safe to call from many goroutines
+// sharing the connection as only the first call sets up the consumer.
 func (r *rabbitmqConnection) MakeConsumer(ctx context.Context) (err error) {
+	r.consumerMutex.Lock()
+	defer r.consumerMutex.Unlock()
+
 	if r.consumerID != "" && r.connectionType == Consumer {
 		r.log.Debugf("Channel was already made a consumer: %s", r.consumerID)
 		return
@@ -156,7 +220,8 @@ func (r *rabbitmqConnection) MakeConsumer(ctx context.Context) (err error) {
 	}
 	r.consumerID = uuid.String()
 
-	if err = r.channel.Qos(1, 0, false); err != nil {
+	// Never hold more messages than there are consumers to work on them
+	if err = r.channel.Qos(r.prefetch, 0, false); err != nil {
 		return
 	}
 
@@ -179,50 +244,319 @@ func (r *rabbitmqConnection) MakeConsumer(ctx context.Context) (err error) {
 	return
 }
 
-// Pop will pull off a Reddit video struct from the queue
-func (r *rabbitmqConnection) Pop(ctx context.Context) (msg interface{}, err error) {
-	if r.connectionType != Consumer {
-		return nil, errors.InvalidValue("connectionType", fmt.Sprintf("Connection type must be '%s' but it is '%s' instead", Consumer, r.connectionType))
+// Pop will pull off a Reddit video struct from the queue blocking until a
+// message arrives, the delivery channel is closed, or the context is done.
+// The message is not acknowledged until Ack() is called on the delivery.
+func (r *rabbitmqConnection) Pop(ctx context.Context) (delivery Delivery, err error) {
+	r.consumerMutex.Lock()
+	connectionType := r.connectionType
+	r.consumerMutex.Unlock()
+
+	if connectionType != Consumer {
+		return nil, errors.InvalidValue("connectionType", fmt.Sprintf("Connection type must be '%s' but it is '%s' instead", Consumer, connectionType))
 	}
 
-	data := <-r.delivery
-	data.Ack(false)
-	msg = data.Body
-	r.log.Infof("Popped message: %#v", string(data.Body))
+	select {
+	case <-ctx.Done():
+		return nil, errors.Cancelled("rabbitmq pop", ctx.Err().Error())
+	case data, ok := <-r.delivery:
+		if !ok {
+			return nil, errors.ConnectionClosed("rabbitmq", "Delivery channel was closed while waiting for a message")
+		}
 
-	return
+		r.log.Infof("Popped message: %#v", string(data.Body))
+
+		return &rabbitmqDelivery{connection: r, delivery: data, log: r.log}, nil
+	}
 }
 
 // Push will put a Reddit video struct onto the queue
 func (r *rabbitmqConnection) Push(ctx context.Context, msg interface{}) (err error) {
-	if r.connectionType != Client {
-		return errors.InvalidValue("connectionType", fmt.Sprintf("Connection type must be '%s' but it is '%s' instead", Client, r.connectionType))
+	r.consumerMutex.Lock()
+	connectionType := r.connectionType
+	r.consumerMutex.Unlock()
+
+	if connectionType != Client {
+		return errors.InvalidValue("connectionType", fmt.Sprintf("Connection type must be '%s' but it is '%s' instead", Client, connectionType))
 	}
 
 	if _, ok := msg.([]byte); !ok {
 		return errors.InvalidValue("msg", fmt.Sprint("RabbitMQ Push(msg), msg must be of type []byte"))
 	}
 
+	messageID, err := uuid.NewRandom()
+	if err != nil {
+		return
+	}
+
 	byteMsg := msg.([]byte)
-	err = r.channel.Publish(
-		"",          // exchange
-		r.queueName, // routing key
-		false,       // mandatory
-		false,       // immediate
-		amqp.Publishing{
-			Body:         byteMsg,
-			ContentType:  "application/json",
-			DeliveryMode: amqp.Persistent,
-			Headers:      amqp.Table{},
-			Priority:     0,
-			Timestamp:    time.Now(),
-		},
+	if err = r.publish(r.queueName, amqp.Publishing{
+		Body:      byteMsg,
+		Headers:   amqp.Table{},
+		MessageId: messageID.String(),
+	}); err != nil {
+		return
+	}
+
+	r.log.Infof("Pushed message: %#v", string(byteMsg))
+
+	return
+}
+
+// DeadLetters returns up to limit of the messages on the dead-letter queue,
+// oldest first, or all of them if limit is not positive
+func (r *rabbitmqConnection) DeadLetters(ctx context.Context, limit int) (deadLetters []*DeadLetter, err error) {
+	err = r.browseDeadLetters(ctx, func(message amqp.Delivery) (stop bool, ack bool, err error) {
+		deadLetters = append(deadLetters, rabbitmqDeadLetter(message))
+		return limit > 0 && len(deadLetters) >= limit, false, nil
+	})
+
+	return
+}
+
+// GetDeadLetter returns the message on the dead-letter queue with the given
+// message ID
+func (r *rabbitmqConnection) GetDeadLetter(ctx context.Context, id string) (deadLetter *DeadLetter, err error) {
+	err = r.browseDeadLetters(ctx, func(message amqp.Delivery) (stop bool, ack bool, err error) {
+		if message.MessageId != id {
+			return false, false, nil
+		}
+
+		deadLetter = rabbitmqDeadLetter(message)
+		return true, false, nil
+	})
+	if err == nil && deadLetter == nil {
+		err = errors.ResourceNotFound("DeadLetter", id)
+	}
+
+	return
+}
+
+// ReplayDeadLetter will move the message with the given message ID off of the
+// dead-letter queue and back on to the work queue with its attempts reset
+func (r *rabbitmqConnection) ReplayDeadLetter(ctx context.Context, id string) (err error) {
+	found := false
+	err = r.browseDeadLetters(ctx, func(message amqp.Delivery) (stop bool, ack bool, err error) {
+		if message.MessageId != id {
+			return false, false, nil
+		}
+
+		found = true
+		if err = r.publish(r.queueName, amqp.Publishing{
+			Body:      message.Body,
+			Headers:   amqp.Table{},
+			MessageId: message.MessageId,
+		}); err != nil {
+			return true, false, err
+		}
+		r.log.Infof("Replayed dead-lettered message: %s", message.MessageId)
+
+		return true, true, nil
+	})
+	if err == nil && !found {
+		err = errors.ResourceNotFound("DeadLetter", id)
+	}
+
+	return
+}
+
+// browseDeadLetters will get each message on the dead-letter queue in turn
+// and hand it to visit until visit asks to stop or there are no more. Every
+// message visit does not ask to acknowledge is put back on to the
+// dead-letter queue once browsing is done.
+func (r *rabbitmqConnection) browseDeadLetters(ctx context.Context, visit func(message amqp.Delivery) (stop bool, ack bool, err error)) (err error) {
+	if r.channel == nil {
+		return errors.ConnectionFailure("rabbitmq", "Channel has not been initialized")
+	}
+
+	unacknowledged := []uint64{}
+	defer func() {
+		for _, deliveryTag := range unacknowledged {
+			if nackErr := r.channel.Nack(deliveryTag, false, true); nackErr != nil && err == nil {
+				err = nackErr
+			}
+		}
+	}()
+
+	for {
+		if ctx.Err() != nil {
+			return errors.Cancelled("rabbitmq browse", ctx.Err().Error())
+		}
+
+		message, ok, getErr := r.channel.Get(r.deadLetterQueueName, false)
+		if getErr != nil {
+			return getErr
+		}
+		if !ok {
+			return
+		}
+
+		stop, ack, visitErr := visit(message)
+		if ack {
+			if err = message.Ack(false); err != nil {
+				return
+			}
+		} else {
+			unacknowledged = append(unacknowledged, message.DeliveryTag)
+		}
+
+		if visitErr != nil || stop {
+			return visitErr
+		}
+	}
+}
+
+// retryQueue returns the name of the retry queue for the delay, declaring it
+// the first time it is needed. RabbitMQ only expires the message at the head
+// of a queue so every delay has its own queue where all of the messages wait
+// the same time, which the queue expires them after before dead-lettering
+// them straight back on to the work queue.
+func (r *rabbitmqConnection) retryQueue(delay time.Duration) (queueName string, err error) {
+	r.retryQueuesMutex.Lock()
+	defer r.retryQueuesMutex.Unlock()
+
+	if queueName, ok := r.retryQueues[delay]; ok {
+		return queueName, nil
+	}
+
+	ttl := int64(delay / time.Millisecond)
+	queueName = fmt.Sprintf("%s.%d", r.retryQueueName, ttl)
+	_, err = r.channel.QueueDeclare(
+		queueName, // name
+		true,      // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": r.queueName,
+			"x-message-ttl":             ttl,
+		}, // arguments
 	)
 	if err != nil {
+		r.log.Errorf("Error declaring retry queue %s: %s", queueName, err)
+		return "", err
+	}
+	r.log.Infof("Retry queue declared: %s", queueName)
+
+	r.retryQueues[delay] = queueName
+
+	return
+}
+
+// publish will put a persistent message on to the named queue through the
+// default exchange
+func (r *rabbitmqConnection) publish(queueName string, publishing amqp.Publishing) (err error) {
+	publishing.ContentType = "application/json"
+	publishing.DeliveryMode = amqp.Persistent
+	publishing.Timestamp = time.Now()
+
+	return r.channel.Publish(
+		"",        // exchange
+		queueName, // routing key
+		false,     // mandatory
+		false,     // immediate
+		publishing,
+	)
+}
+
+// rabbitmqAttempts returns the number of previous attempts recorded in the
+// headers of a message
+func rabbitmqAttempts(headers amqp.Table) (attempts int) {
+	switch value := headers[RabbitMQHeaderAttempts].(type) {
+	case int:
+		return value
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	}
+
+	return 0
+}
+
+// rabbitmqDeadLetter converts a message from the dead-letter queue
+func rabbitmqDeadLetter(message amqp.Delivery) (deadLetter *DeadLetter) {
+	reason, _ := message.Headers[RabbitMQHeaderReason].(string)
+
+	return &DeadLetter{
+		Attempts: rabbitmqAttempts(message.Headers),
+		Body:     message.Body,
+		DiedAt:   message.Timestamp,
+		ID:       message.MessageId,
+		Reason:   reason,
+	}
+}
+
+// Ack will acknowledge the message so that RabbitMQ never delivers it again
+func (d *rabbitmqDelivery) Ack(ctx context.Context) (err error) {
+	if err = d.delivery.Ack(false); err != nil {
 		return
 	}
+	d.log.Debugf("Acknowledged message: %d", d.delivery.DeliveryTag)
 
-	r.log.Infof("Pushed message: %#v", string(byteMsg))
+	return
+}
+
+// Attempts returns the number of times the message has been delivered
+// including this one
+func (d *rabbitmqDelivery) Attempts() (attempts int) {
+	return rabbitmqAttempts(d.delivery.Headers) + 1
+}
+
+// Body returns the raw bytes of the message
+func (d *rabbitmqDelivery) Body() (msg interface{}) {
+	return d.delivery.Body
+}
+
+// DeadLetter will publish the message to the dead-letter queue and then
+// acknowledge it on the work queue
+func (d *rabbitmqDelivery) DeadLetter(ctx context.Context, reason string) (err error) {
+	if err = d.connection.publish(d.connection.deadLetterQueueName, amqp.Publishing{
+		Body: d.delivery.Body,
+		Headers: amqp.Table{
+			RabbitMQHeaderAttempts: int32(d.Attempts()),
+			RabbitMQHeaderReason:   reason,
+		},
+		MessageId: d.delivery.MessageId,
+	}); err != nil {
+		return
+	}
+	d.log.Debugf("Dead-lettered message (%s): %s", d.delivery.MessageId, reason)
+
+	return d.Ack(ctx)
+}
+
+// Nack will reject the message which RabbitMQ will deliver again if requeue
+// is set
+func (d *rabbitmqDelivery) Nack(ctx context.Context, requeue bool) (err error) {
+	if err = d.delivery.Nack(false, requeue); err != nil {
+		return
+	}
+	d.log.Debugf("Rejected message (requeue: %t): %d", requeue, d.delivery.DeliveryTag)
 
 	return
 }
+
+// Retry will publish the message to the retry queue for the delay where it
+// waits out the delay before RabbitMQ puts it back on to the work queue and
+// then acknowledge it on the work queue
+func (d *rabbitmqDelivery) Retry(ctx context.Context, delay time.Duration) (err error) {
+	retryQueueName, err := d.connection.retryQueue(delay)
+	if err != nil {
+		return
+	}
+
+	if err = d.connection.publish(retryQueueName, amqp.Publishing{
+		Body: d.delivery.Body,
+		Headers: amqp.Table{
+			RabbitMQHeaderAttempts: int32(d.Attempts()),
+		},
+		MessageId: d.delivery.MessageId,
+	}); err != nil {
+		return
+	}
+	d.log.Debugf("Retrying message (%s) in %s", d.delivery.MessageId, delay)
+
+	return d.Ack(ctx)
+}
@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+// jobsController holds all of the internal implementations of our usecases
+type jobsController struct {
+	cons jobConstructor
+	log  logger.Logger
+	ret  jobRetriever
+}
+
+// jobRequest is the body of a request to create a job
+type jobRequest struct {
+	Duration string `json:"duration"`
+	End      string `json:"end"`
+	Format   string `json:"format"`
+	Quality  string `json:"quality"`
+	Start    string `json:"start"`
+	URL      string `json:"url"`
+}
+
+// jobResponse is a job along with the resulting vrddt video once the job is
+// done and all of the resulting vrddt videos if the Reddit post had several
+// media items
+type jobResponse struct {
+	*domain.Job
+
+	VrddtVideo  *domain.VrddtVideo   `json:"vrddt_video,omitempty"`
+	VrddtVideos []*domain.VrddtVideo `json:"vrddt_videos,omitempty"`
+}
+
+// AddJobsAPI will register the various routes and their methods
+func AddJobsAPI(loggerHandle logger.Logger, router *mux.Router, cons jobConstructor, ret jobRetriever) {
+	jc := &jobsController{
+		log: loggerHandle,
+
+		cons: cons,
+		ret:  ret,
+	}
+
+	jrouter := router.PathPrefix("/jobs").Subrouter()
+
+	jrouter.HandleFunc("", jc.create).Methods(http.MethodPost)
+	jrouter.HandleFunc("/", jc.create).Methods(http.MethodPost)
+	jrouter.HandleFunc("/{id:[0-9a-fA-F]{24}}", jc.getByID).Methods(http.MethodGet)
+}
+
+// create will queue a job for the Reddit URL in the body of the request and
+// respond with where the progress of it can be found. The quality, format and
+// clip may be given in the body or as the query parameters of the same names.
+func (jc *jobsController) create(wr http.ResponseWriter, req *http.Request) {
+	jobReq := jobRequest{}
+	if err := readRequest(req, &jobReq); err != nil {
+		respondErr(wr, err)
+		return
+	}
+
+	if jobReq.URL == "" {
+		respondErr(wr, errors.MissingField("url"))
+		return
+	}
+
+	if jobReq.Quality == "" {
+		jobReq.Quality = req.URL.Query().Get("quality")
+	}
+	quality, err := domain.ParseQuality(jobReq.Quality)
+	if err != nil {
+		respondErr(wr, err)
+		return
+	}
+
+	if jobReq.Format == "" {
+		jobReq.Format = req.URL.Query().Get("format")
+	}
+	format, err := domain.ParseFormat(jobReq.Format)
+	if err != nil {
+		respondErr(wr, err)
+		return
+	}
+
+	if jobReq.Start == "" && jobReq.End == "" && jobReq.Duration == "" {
+		query := req.URL.Query()
+		jobReq.Duration = query.Get("duration")
+		jobReq.End = query.Get("end")
+		jobReq.Start = query.Get("start")
+	}
+	clip, err := domain.ParseClip(jobReq.Start, jobReq.End, jobReq.Duration)
+	if err != nil {
+		respondErr(wr, err)
+		return
+	}
+
+	job, err := jc.cons.Create(req.Context(), jobReq.URL, quality, format, clip)
+	if err != nil {
+		jc.log.Errorf("Failed to create job for URL '%s': %s", jobReq.URL, err)
+		respondErr(wr, err)
+		return
+	}
+
+	jc.log.Infof("Job '%s' queued for Reddit URL in %s quality as %s: %s", job.ID.Hex(), job.Quality, job.Format, job.RedditURL)
+
+	respondAccepted(wr, job)
+}
+
+// getByID will get the job and the resulting vrddt video, if it is done, by
+// the ID of the job
+func (jc *jobsController) getByID(wr http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	if !bson.IsObjectIdHex(id) {
+		respondErr(wr, errors.InvalidValue("id", id))
+		return
+	}
+
+	job, vrddtVideos, err := jc.ret.GetByID(req.Context(), bson.ObjectIdHex(id))
+	if err != nil {
+		respondErr(wr, err)
+		return
+	}
+
+	response := jobResponse{Job: job}
+	if len(vrddtVideos) > 0 {
+		response.VrddtVideo = vrddtVideos[0]
+	}
+	if len(vrddtVideos) > 1 {
+		response.VrddtVideos = vrddtVideos
+	}
+
+	respond(wr, http.StatusOK, response)
+}
+
+// respondAccepted will respond with a job which was queued and where its
+// progress can be found
+func respondAccepted(wr http.ResponseWriter, job *domain.Job) {
+	wr.Header().Set("Location", "/jobs/"+job.ID.Hex())
+	respond(wr, http.StatusAccepted, jobResponse{Job: job})
+}
+
+type jobConstructor interface {
+	Create(ctx context.Context, redditURL string, quality domain.Quality, format domain.Format, clip domain.Clip) (job *domain.Job, err error)
+}
+
+type jobRetriever interface {
+	GetByID(ctx context.Context, id bson.ObjectId) (job *domain.Job, vrddtVideos []*domain.VrddtVideo, err error)
+}
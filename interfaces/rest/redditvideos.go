@@ -2,6 +2,7 @@ package rest
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -9,28 +10,37 @@ import (
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/pubsub"
 	"github.com/johnwyles/vrddt-droplets/interfaces/store"
 	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"github.com/johnwyles/vrddt-droplets/pkg/logger"
 )
 
+// eventsKeepAlive is how often a comment is sent on an otherwise idle event
+// stream so that proxies do not close it
+const eventsKeepAlive = 15 * time.Second
+
 // redditVideosController holds all of the internal implementations of our
 // usecases
 type redditVideosController struct {
 	cons redditConstructor
 	des  redditDestructor
+	jobs jobConstructor
 	log  logger.Logger
 	ret  redditRetriever
+	sub  eventSubscriber
 }
 
 // AddRedditVideosAPI will register the various routes and their methods
-func AddRedditVideosAPI(loggerHandle logger.Logger, router *mux.Router, cons redditConstructor, des redditDestructor, ret redditRetriever) {
+func AddRedditVideosAPI(loggerHandle logger.Logger, router *mux.Router, cons redditConstructor, des redditDestructor, ret redditRetriever, sub eventSubscriber, jobs jobConstructor) {
 	rvc := &redditVideosController{
 		log: loggerHandle,
 
 		cons: cons,
 		des:  des,
+		jobs: jobs,
 		ret:  ret,
+		sub:  sub,
 	}
 
 	// TODO: Implement search / ALL
@@ -43,6 +53,13 @@ func AddRedditVideosAPI(loggerHandle logger.Logger, router *mux.Router, cons red
 	// rvrouter.HandleFunc("/queue", rvc.enqueue).Methods(http.MethodPost)
 	// rvrouter.HandleFunc("/queue", rvc.dequeue).Methods(http.MethodGet)
 
+	// Streams the progress of processing a Reddit URL as Server-Sent Events
+	rvrouter.HandleFunc("/events", rvc.events).Queries("url", "{url}").Methods(http.MethodGet)
+
+	// Lists the renditions of the media behind a URL and which of them would
+	// be picked for the quality
+	rvrouter.HandleFunc("/media", rvc.getMedia).Queries("url", "{url}").Methods(http.MethodGet)
+
 	// These will handle paths that match an ID for a Reddit video
 	rvrouter.HandleFunc("/{id:[0-9a-fA-F]+}", rvc.getByID).Methods(http.MethodGet)
 	rvrouter.HandleFunc("/{id:[0-9a-fA-F]+}/vrddt_video", rvc.getVrddtVideoByID).Methods(http.MethodGet)
@@ -121,6 +138,125 @@ func (rvc *redditVideosController) delete(wr http.ResponseWriter, req *http.Requ
 	return
 }
 
+// events will stream the progress of processing a Reddit URL as Server-Sent
+// Events until the resulting vrddt video is known or processing has failed.
+// The Reddit URL is queued if it has not been processed before and the
+// request is held open only to stream what the worker publishes.
+func (rvc *redditVideosController) events(wr http.ResponseWriter, req *http.Request) {
+	flusher, ok := wr.(http.Flusher)
+	if !ok {
+		respondErr(wr, errors.NotImplemented("events", "Streaming is not supported by the connection"))
+		return
+	}
+
+	url := mux.Vars(req)["url"]
+	finalURL, err := sourceFinalURL(req.Context(), url)
+	if err != nil {
+		respondErr(wr, errors.InvalidValue("url", url))
+		return
+	}
+
+	quality, err := requestQuality(req)
+	if err != nil {
+		respondErr(wr, err)
+		return
+	}
+
+	format, err := requestFormat(req)
+	if err != nil {
+		respondErr(wr, err)
+		return
+	}
+
+	clip, err := requestClip(req)
+	if err != nil {
+		respondErr(wr, err)
+		return
+	}
+
+	// Subscribe before looking for the Reddit video so that it can not be
+	// finished in between without us hearing about it
+	subscription, err := rvc.sub.Subscribe(req.Context())
+	if err != nil {
+		rvc.log.Errorf("Failed to subscribe to events: %s", err)
+		respondErr(wr, err)
+		return
+	}
+	defer subscription.Close(context.Background())
+
+	var finished *domain.Event
+	redditVideo, err := rvc.ret.GetByURL(req.Context(), finalURL, quality, format, clip)
+	switch {
+	case err == nil:
+		vrddtVideo, err := rvc.ret.GetVrddtVideoByID(req.Context(), redditVideo.VrddtVideoID)
+		if err != nil {
+			respondErr(wr, err)
+			return
+		}
+
+		finished = domain.NewEvent(finalURL, domain.EventStageDone)
+		finished.Clip = clip
+		finished.Format = format
+		finished.Quality = quality
+		finished.VrddtVideo = vrddtVideo
+	case errors.Type(err) == errors.TypeResourceNotFound:
+		redditVideo = domain.NewRedditVideo()
+		redditVideo.Clip = clip
+		redditVideo.Format = format
+		redditVideo.Quality = quality
+		redditVideo.URL = finalURL
+		if err = rvc.cons.Push(req.Context(), redditVideo); err != nil {
+			rvc.log.Errorf("Failed to push Reddit video to queue: %s", err)
+			respondErr(wr, err)
+			return
+		}
+		rvc.log.Infof("Unique Reddit video URL queued in %s quality as %s with URL of: %s", quality, format, finalURL)
+	default:
+		respondErr(wr, err)
+		return
+	}
+
+	wr.Header().Set("Cache-Control", "no-cache")
+	wr.Header().Set("Connection", "keep-alive")
+	wr.Header().Set("Content-Type", "text/event-stream")
+	wr.WriteHeader(http.StatusOK)
+
+	if finished != nil {
+		respondEvent(wr, flusher, finished)
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(wr, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-subscription.Events():
+			if !ok {
+				rvc.log.Warnf("Event subscription closed before Reddit URL was processed: %s", finalURL)
+				return
+			}
+			if event.RedditURL != finalURL || event.Quality != quality || event.Format != format || event.Clip != clip {
+				continue
+			}
+
+			if err = respondEvent(wr, flusher, event); err != nil {
+				rvc.log.Warnf("Failed to write event: %s", err)
+				return
+			}
+			if event.Finished() {
+				return
+			}
+		}
+	}
+}
+
 // getByID will get the Reddit video by ID
 func (rvc *redditVideosController) getByID(wr http.ResponseWriter, req *http.Request) {
 	if id, ok := mux.Vars(req)["id"]; ok {
@@ -141,17 +277,37 @@ func (rvc *redditVideosController) getByID(wr http.ResponseWriter, req *http.Req
 	return
 }
 
-// getByRedditURL will get the vrddt video by a query parameter for
-// the URL from Reddit
+// getByRedditURL will get the Reddit video by a query parameter for the URL
+// from Reddit in the quality, format and clip of the query parameters, which
+// are the best quality and MP4 of all of the video unless they are given. If
+// it has not been processed yet a job is queued for it and responded with.
 func (rvc *redditVideosController) getByRedditURL(wr http.ResponseWriter, req *http.Request) {
 	if url, ok := mux.Vars(req)["url"]; ok {
-		finalURL, err := domain.GetFinalURL(url)
+		finalURL, err := sourceFinalURL(req.Context(), url)
+		if err != nil {
+			respondErr(wr, err)
+			return
+		}
+
+		quality, err := requestQuality(req)
+		if err != nil {
+			respondErr(wr, err)
+			return
+		}
+
+		format, err := requestFormat(req)
+		if err != nil {
+			respondErr(wr, err)
+			return
+		}
+
+		clip, err := requestClip(req)
 		if err != nil {
 			respondErr(wr, err)
 			return
 		}
 
-		redditVideo, err := rvc.ret.GetByURL(req.Context(), url)
+		redditVideo, err := rvc.ret.GetByURL(req.Context(), url, quality, format, clip)
 		if err != nil {
 			switch errors.Type(err) {
 			case errors.TypeUnknown:
@@ -168,71 +324,41 @@ func (rvc *redditVideosController) getByRedditURL(wr http.ResponseWriter, req *h
 			return
 		}
 
-		redditVideo = domain.NewRedditVideo()
-		redditVideo.URL = finalURL
-
-		if err = rvc.cons.Push(context.TODO(), redditVideo); err != nil {
-			rvc.log.Errorf("Failed to push Reddit video to queue: %s", err)
+		// The Reddit URL has not been processed so a job is queued for it
+		// rather than holding the request open until it is done
+		job, err := rvc.jobs.Create(req.Context(), finalURL, quality, format, clip)
+		if err != nil {
+			rvc.log.Errorf("Failed to queue a job for Reddit URL '%s': %s", finalURL, err)
+			respondErr(wr, err)
+			return
 		}
 
-		rvc.log.Infof("Unique Reddit video URL queued with URL of: %s", redditVideo.URL)
-
-		var pollTime int
-		pollTime = 500
-		if pollTime > 5000 {
-			pollTime = 5000
-		}
-		if pollTime < 10 {
-			pollTime = 10
-		}
+		rvc.log.Infof("Job '%s' queued for unique Reddit URL: %s", job.ID.Hex(), job.RedditURL)
+		respondAccepted(wr, job)
+		return
+	}
 
-		timeoutTime := 60
-		if timeoutTime > 600 {
-			pollTime = 600
-		}
-		if timeoutTime < 1 {
-			timeoutTime = 1
-		}
+	respondErr(wr, errors.MissingField("url"))
 
-		// Wait a pre-determined amount of time for the worker to fetch, convert,
-		// store in the database, and store in storage the video
-		timeout := time.After(
-			time.Duration(
-				time.Duration(timeoutTime) * time.Second,
-			),
-		)
-		tick := time.Tick(time.Duration(pollTime) * time.Millisecond)
-		for {
-			select {
-			case <-timeout:
-				respondErr(wr, errors.ConnectionTimeout("database", timeoutTime))
-				rvc.log.Errorf("Operation timed out at after '%d' seconds.", timeoutTime)
-				return
-			case <-tick:
-				// If the Reddit URL is not found in the database yet keep checking
-				redditVideo, err = rvc.ret.GetByURL(context.TODO(), redditVideo.URL)
-				if err != nil {
-					switch errors.Type(err) {
-					default:
-					case errors.TypeUnknown:
-						rvc.log.Errorf("Something went wrong: %s", err)
-					case errors.TypeResourceNotFound:
-						continue
-					}
-				}
-
-				rvc.log.Infof("Unique URL created new video: %#v", redditVideo)
-
-				respond(wr, http.StatusOK, redditVideo)
+	return
+}
 
-				return
-			}
-		}
+// getMedia will resolve the media items behind the URL in the query
+// parameters for the quality, which is the best quality unless one is given
+func (rvc *redditVideosController) getMedia(wr http.ResponseWriter, req *http.Request) {
+	quality, err := requestQuality(req)
+	if err != nil {
+		respondErr(wr, err)
+		return
 	}
 
-	respondErr(wr, errors.MissingField("url"))
+	items, err := rvc.ret.GetMedia(req.Context(), mux.Vars(req)["url"], quality)
+	if err != nil {
+		respondErr(wr, err)
+		return
+	}
 
-	return
+	respond(wr, http.StatusOK, items)
 }
 
 // getVrddtVideoByID will get a vrddt video by the Reddit video ID
@@ -290,10 +416,15 @@ type redditDestructor interface {
 	Pop(ctx context.Context) (redditVideo *domain.RedditVideo, err error)
 }
 
+type eventSubscriber interface {
+	Subscribe(ctx context.Context) (subscription pubsub.Subscription, err error)
+}
+
 // TODO: Search
 type redditRetriever interface {
 	GetByID(ctx context.Context, id bson.ObjectId) (redditVideo *domain.RedditVideo, err error)
-	GetByURL(ctx context.Context, url string) (redditVideo *domain.RedditVideo, err error)
+	GetByURL(ctx context.Context, url string, quality domain.Quality, format domain.Format, clip domain.Clip) (redditVideo *domain.RedditVideo, err error)
+	GetMedia(ctx context.Context, url string, quality domain.Quality) (items []*domain.SourceMedia, err error)
 	GetVrddtVideoByID(ctx context.Context, id bson.ObjectId) (rredditVideov *domain.VrddtVideo, err error)
 	Search(ctx context.Context, selector store.Selector, limit int) (redditVideos []*domain.RedditVideo, err error)
 }
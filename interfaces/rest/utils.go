@@ -1,13 +1,48 @@
 package rest
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 
+	"github.com/johnwyles/vrddt-droplets/domain"
 	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"github.com/johnwyles/vrddt-droplets/pkg/render"
 )
 
+// sourceFinalURL returns the final URL for a URL according to the source which
+// supports it so that any URL a source supports is accepted
+func sourceFinalURL(ctx context.Context, rawURL string) (string, error) {
+	source, err := domain.SourceFor(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	return source.FinalURL(ctx, rawURL)
+}
+
+// requestClip returns the clip in the "start" and either the "end" or the
+// "duration" query parameters of the request, which is all of the video when
+// none of them are given
+func requestClip(req *http.Request) (domain.Clip, error) {
+	query := req.URL.Query()
+
+	return domain.ParseClip(query.Get("start"), query.Get("end"), query.Get("duration"))
+}
+
+// requestFormat returns the format in the "format" query parameter of the
+// request, which is MP4 when it is not given
+func requestFormat(req *http.Request) (domain.Format, error) {
+	return domain.ParseFormat(req.URL.Query().Get("format"))
+}
+
+// requestQuality returns the quality in the "quality" query parameter of the
+// request, which is the best quality when it is not given
+func requestQuality(req *http.Request) (domain.Quality, error) {
+	return domain.ParseQuality(req.URL.Query().Get("quality"))
+}
+
 func respond(wr http.ResponseWriter, status int, v interface{}) {
 	if err := render.JSON(wr, status, v); err != nil {
 		if loggable, ok := wr.(errorLogger); ok {
@@ -24,6 +59,21 @@ func respondErr(wr http.ResponseWriter, err error) {
 	respond(wr, http.StatusInternalServerError, err)
 }
 
+// respondEvent writes the event as a Server-Sent Event named after its stage
+func respondEvent(wr http.ResponseWriter, flusher http.Flusher, event *domain.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(wr, "event: %s\ndata: %s\n\n", event.Stage, data); err != nil {
+		return err
+	}
+	flusher.Flush()
+
+	return nil
+}
+
 func readRequest(req *http.Request, v interface{}) error {
 	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
 		return errors.Validation("Failed to read request body")
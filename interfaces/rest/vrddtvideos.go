@@ -3,7 +3,6 @@ package rest
 import (
 	"context"
 	"net/http"
-	"time"
 
 	"github.com/gorilla/mux"
 	"gopkg.in/mgo.v2/bson"
@@ -21,18 +20,20 @@ type vrddtVideosController struct {
 	des  vrddtDestructor
 	ret  vrddtRetriever
 
-	rcons redditConstructor
-	rret  redditRetriever
+	jobs jobConstructor
+	rret redditRetriever
 }
 
 // AddVrddtVideosAPI will register the various routes and their methods
-func AddVrddtVideosAPI(loggerHandle logger.Logger, router *mux.Router, cons vrddtConstructor, des vrddtDestructor, ret vrddtRetriever, rcons redditConstructor, rret redditRetriever) {
+func AddVrddtVideosAPI(loggerHandle logger.Logger, router *mux.Router, cons vrddtConstructor, des vrddtDestructor, ret vrddtRetriever, rret redditRetriever, jobs jobConstructor) {
 	vvc := &vrddtVideosController{
 		Logger: loggerHandle,
 
 		cons: cons,
 		des:  des,
 		ret:  ret,
+
+		jobs: jobs,
 		rret: rret,
 	}
 
@@ -114,16 +115,37 @@ func (vvc *vrddtVideosController) getByMD5(wr http.ResponseWriter, req *http.Req
 }
 
 // getByRedditURL will get the vrddt video by a query parameter for
-// the URL from Reddit
+// the URL from Reddit in the quality, format and clip of the query
+// parameters, which are the best quality and MP4 of all of the video unless
+// they are given. If it has not been processed yet a job is queued for it
+// and responded with.
 func (vvc *vrddtVideosController) getByRedditURL(wr http.ResponseWriter, req *http.Request) {
 	if url, ok := mux.Vars(req)["url"]; ok {
-		finalURL, err := domain.GetFinalURL(url)
+		finalURL, err := sourceFinalURL(req.Context(), url)
+		if err != nil {
+			respondErr(wr, err)
+			return
+		}
+
+		quality, err := requestQuality(req)
 		if err != nil {
 			respondErr(wr, err)
 			return
 		}
 
-		redditVideo, err := vvc.rret.GetByURL(req.Context(), url)
+		format, err := requestFormat(req)
+		if err != nil {
+			respondErr(wr, err)
+			return
+		}
+
+		clip, err := requestClip(req)
+		if err != nil {
+			respondErr(wr, err)
+			return
+		}
+
+		redditVideo, err := vvc.rret.GetByURL(req.Context(), url, quality, format, clip)
 		if err != nil {
 			switch errors.Type(err) {
 			case errors.TypeUnknown:
@@ -140,14 +162,16 @@ func (vvc *vrddtVideosController) getByRedditURL(wr http.ResponseWriter, req *ht
 				return
 			}
 
-			vrddtVideo, errVrddt := vvc.ret.GetByID(context.TODO(), redditVideo.VrddtVideoID)
-			if err != nil {
+			vrddtVideo, errVrddt := vvc.ret.GetByID(req.Context(), redditVideo.VrddtVideoID)
+			if errVrddt != nil {
 				switch errors.Type(errVrddt) {
 				case errors.TypeResourceNotFound:
 					vvc.Errorf("Reddit Video found (ID: %s) but vrddt Video (ID: %s) was not", redditVideo.ID.Hex(), redditVideo.VrddtVideoID.Hex())
 				default:
 					vvc.Errorf("Something went wrong: %s", errVrddt)
 				}
+				respondErr(wr, errVrddt)
+				return
 			}
 
 			vvc.Infof("Reddit video already in the database with ID '%s' and a vrddt video of: %#v", redditVideo.ID, vrddtVideo)
@@ -155,77 +179,18 @@ func (vvc *vrddtVideosController) getByRedditURL(wr http.ResponseWriter, req *ht
 			return
 		}
 
-		redditVideo = domain.NewRedditVideo()
-		redditVideo.URL = finalURL
-
-		if err = vvc.rcons.Push(context.TODO(), redditVideo); err != nil {
-			vvc.Errorf("Failed to push Reddit video to queue: %s", err)
-		}
-
-		vvc.Infof("Unique Reddit video URL queued with URL of: %s", redditVideo.URL)
-
-		var pollTime int
-		pollTime = 500
-		if pollTime > 5000 {
-			pollTime = 5000
-		}
-		if pollTime < 10 {
-			pollTime = 10
-		}
-
-		timeoutTime := 60
-		if timeoutTime > 600 {
-			pollTime = 600
-		}
-		if timeoutTime < 1 {
-			timeoutTime = 1
+		// The Reddit URL has not been processed so a job is queued for it
+		// rather than holding the request open until it is done
+		job, err := vvc.jobs.Create(req.Context(), finalURL, quality, format, clip)
+		if err != nil {
+			vvc.Errorf("Failed to queue a job for Reddit URL '%s': %s", finalURL, err)
+			respondErr(wr, err)
+			return
 		}
 
-		// Wait a pre-determined amount of time for the worker to fetch, convert,
-		// store in the database, and store in storage the video
-		timeout := time.After(
-			time.Duration(
-				time.Duration(timeoutTime) * time.Second,
-			),
-		)
-		tick := time.Tick(time.Duration(pollTime) * time.Millisecond)
-		for {
-			select {
-			case <-timeout:
-				respondErr(wr, errors.ConnectionTimeout("database", timeoutTime))
-				vvc.Errorf("Operation timed out at after '%d' seconds.", timeoutTime)
-				return
-			case <-tick:
-				// If the Reddit URL is not found in the database yet keep checking
-				temporaryRedditVideo, err := vvc.rret.GetByURL(context.TODO(), redditVideo.URL)
-				if err != nil {
-					switch errors.Type(err) {
-					default:
-					case errors.TypeUnknown:
-						vvc.Errorf("Something went wrong: %s", err)
-					case errors.TypeResourceNotFound:
-						continue
-					}
-				}
-				vvc.Debugf("Reddit video now exists in db with a vrddt video ID: reddit video: %#v | vrddt video ID: %s", temporaryRedditVideo, temporaryRedditVideo.VrddtVideoID.Hex())
-
-				vrddtVideo, errVrddt := vvc.ret.GetByID(context.TODO(), temporaryRedditVideo.VrddtVideoID)
-				if errVrddt != nil {
-					switch errors.Type(errVrddt) {
-					case errors.TypeResourceNotFound:
-						vvc.Errorf("Reddit video found (ID: %s) but associated vrddt video (ID: %s) was not", temporaryRedditVideo.ID.Hex(), temporaryRedditVideo.VrddtVideoID.Hex())
-					default:
-						vvc.Errorf("Something went wrong: %s", errVrddt)
-					}
-				}
-
-				vvc.Infof("Unique URL created new vrddt video: %#v", vrddtVideo)
-
-				respond(wr, http.StatusOK, vrddtVideo)
-
-				return
-			}
-		}
+		vvc.Infof("Job '%s' queued for unique Reddit URL: %s", job.ID.Hex(), job.RedditURL)
+		respondAccepted(wr, job)
+		return
 	}
 
 	respondErr(wr, errors.MissingField("url"))
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+// Factory builds a storage from its section of the configuration
+type Factory func(cfg *config.StorageConfig, loggerHandle logger.Logger) (stg Storage, err error)
+
+var (
+	// factories are the storages which can be built by New() keyed by their
+	// type
+	factories = map[config.StorageType]Factory{}
+
+	// factoriesMutex guards factories
+	factoriesMutex sync.RWMutex
+)
+
+func init() {
+	Register(config.StorageConfigGCS, func(cfg *config.StorageConfig, loggerHandle logger.Logger) (Storage, error) {
+		return GCS(&cfg.GCS, loggerHandle)
+	})
+	Register(config.StorageConfigLocal, func(cfg *config.StorageConfig, loggerHandle logger.Logger) (Storage, error) {
+		return Local(&cfg.Local, loggerHandle)
+	})
+	Register(config.StorageConfigS3, func(cfg *config.StorageConfig, loggerHandle logger.Logger) (Storage, error) {
+		return S3(&cfg.S3, loggerHandle)
+	})
+}
+
+// New builds the storage named by the type in the configuration
+func New(cfg *config.StorageConfig, loggerHandle logger.Logger) (stg Storage, err error) {
+	factoriesMutex.RLock()
+	factory, ok := factories[cfg.Type]
+	factoriesMutex.RUnlock()
+
+	if !ok {
+		return nil, errors.InvalidValue("Storage.Type", fmt.Sprintf("Unknown storage type '%s' (must be one of: %s)", cfg.Type, strings.Join(Types(), ", ")))
+	}
+
+	return factory(cfg, loggerHandle)
+}
+
+// Register makes a storage available to New() by its type. It panics if the
+// type is registered twice or the factory is nil.
+func Register(storageType config.StorageType, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if factory == nil {
+		panic("storage: Register factory is nil")
+	}
+	if _, ok := factories[storageType]; ok {
+		panic("storage: Register called twice for type " + storageType.String())
+	}
+
+	factories[storageType] = factory
+}
+
+// Types returns the sorted types of the storages which have been registered
+func Types() (types []string) {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	for storageType := range factories {
+		types = append(types, storageType.String())
+	}
+	sort.Strings(types)
+
+	return
+}
@@ -0,0 +1,44 @@
+package storage_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/storage"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestNew(suite *testing.T) {
+	cases := []struct {
+		expectedType string
+		storageType  config.StorageType
+	}{
+		{storageType: config.StorageConfigLocal},
+		{storageType: config.StorageConfigS3},
+		{expectedType: errors.TypeInvalidValue, storageType: "ftp"},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			stg, err := storage.New(
+				&config.StorageConfig{
+					Local: config.StorageLocalConfig{Path: "/tmp/vrddt"},
+					S3:    config.StorageS3Config{Bucket: "vrddt"},
+					Type:  cs.storageType,
+				},
+				logger.New(ioutil.Discard, "error", "text"),
+			)
+			if actualType := errors.Type(err); err != nil && actualType != cs.expectedType {
+				t.Fatalf("expecting error type '%s', got '%s'", cs.expectedType, actualType)
+			} else if err == nil && cs.expectedType != "" {
+				t.Fatalf("expecting error type '%s', got none", cs.expectedType)
+			}
+			if err == nil && stg == nil {
+				t.Errorf("expecting a storage, got nil")
+			}
+		})
+	}
+}
@@ -2,26 +2,52 @@ package storage
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"github.com/johnwyles/vrddt-droplets/pkg/logger"
 )
 
-// TODO: Finish this
+const (
+	// localTemporaryFilePrefix is the prefix for the files that are being
+	// written to before they are atomically renamed into place
+	localTemporaryFilePrefix = ".vrddt-local-storage-"
+)
+
+// LocalAttributes are the attributes returned for a file in local storage
+type LocalAttributes struct {
+	ModTime time.Time `json:"mod_time"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+}
 
-// gcs contains all the information about a GCS client
+// local contains all the information about a local filesystem storage
 type local struct {
-	log  logger.Logger
-	path string
+	baseURL string
+	log     logger.Logger
+	path    string
 }
 
 // Local initiates a new local storage connection
 func Local(cfg *config.StorageLocalConfig, loggerHandle logger.Logger) (stg Storage, err error) {
 	loggerHandle.Debugf("Local(cfg): %#v", cfg)
 
+	if cfg.Path == "" {
+		return nil, errors.MissingField("Path")
+	}
+
 	stg = &local{
-		log:  loggerHandle,
-		path: cfg.Path,
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		log:     loggerHandle,
+		path:    cfg.Path,
 	}
 
 	return
@@ -29,6 +55,22 @@ func Local(cfg *config.StorageLocalConfig, loggerHandle logger.Logger) (stg Stor
 
 // Attributes returns attributes about a file
 func (l *local) Attributes(ctx context.Context, remotePath string) (attributes interface{}, err error) {
+	fullPath, err := l.resolve(remotePath)
+	if err != nil {
+		return
+	}
+
+	fileInfo, err := l.stat(remotePath, fullPath)
+	if err != nil {
+		return
+	}
+
+	attributes = &LocalAttributes{
+		ModTime: fileInfo.ModTime(),
+		Name:    remotePath,
+		Size:    fileInfo.Size(),
+	}
+
 	return
 }
 
@@ -39,30 +81,196 @@ func (l *local) Cleanup(ctx context.Context) (err error) {
 
 // Delete will remove a file
 func (l *local) Delete(ctx context.Context, remotePath string) (err error) {
-	return
+	fullPath, err := l.resolve(remotePath)
+	if err != nil {
+		return
+	}
+
+	if _, err = l.stat(remotePath, fullPath); err != nil {
+		return
+	}
+
+	return os.Remove(fullPath)
+}
+
+// Download will download a remote path to the provided local path
+func (l *local) Download(ctx context.Context, remotePath string, localPath string) (err error) {
+	fullPath, err := l.resolve(remotePath)
+	if err != nil {
+		return
+	}
+
+	if _, err = l.stat(remotePath, fullPath); err != nil {
+		return
+	}
+
+	return atomicCopy(fullPath, localPath)
 }
 
 // GetLocation returns the URL to a file
-func (l *local) GetLocation(ctx context.Context, remotePath string) (url string, err error) {
+func (l *local) GetLocation(ctx context.Context, remotePath string) (location string, err error) {
+	fullPath, err := l.resolve(remotePath)
+	if err != nil {
+		return
+	}
+
+	if _, err = l.stat(remotePath, fullPath); err != nil {
+		return
+	}
+
+	if l.baseURL != "" {
+		relativePath, _ := filepath.Rel(l.path, fullPath)
+		location = l.baseURL + "/" + (&url.URL{Path: filepath.ToSlash(relativePath)}).EscapedPath()
+		return
+	}
+
+	location = (&url.URL{Scheme: "file", Path: filepath.ToSlash(fullPath)}).String()
+
 	return
 }
 
 // Init establishes the session
 func (l *local) Init(ctx context.Context) (err error) {
+	if l.path, err = filepath.Abs(l.path); err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(l.path, 0755); err != nil {
+		return errors.ConnectionFailure("local", err.Error())
+	}
+
+	l.log.Debugf("Local storage rooted at: %s", l.path)
+
 	return
 }
 
 // List returns all files at a given path
 func (l *local) List(ctx context.Context, remotePath string) (files []interface{}, err error) {
-	return
-}
+	fullPath, err := l.resolve(remotePath)
+	if err != nil {
+		return
+	}
+
+	err = filepath.Walk(fullPath, func(walkPath string, fileInfo os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			if os.IsNotExist(walkErr) {
+				return nil
+			}
+			return walkErr
+		}
+
+		if fileInfo.IsDir() || strings.HasPrefix(fileInfo.Name(), localTemporaryFilePrefix) {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(l.path, walkPath)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, filepath.ToSlash(relativePath))
+
+		return nil
+	})
 
-// Download will download a remote path to the provided local path
-func (l *local) Download(ctx context.Context, remotePath string, localPath string) (err error) {
 	return
 }
 
 // Upload will upload a local path to the provided remote path
 func (l *local) Upload(ctx context.Context, localPath string, remotePath string) (err error) {
+	fullPath, err := l.resolve(remotePath)
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return
+	}
+
+	return atomicCopy(localPath, fullPath)
+}
+
+// resolve will join the remote path on to the root of the storage and make
+// sure that the result does not escape the root (e.g. "../../etc/passwd")
+func (l *local) resolve(remotePath string) (fullPath string, err error) {
+	cleanPath := path.Clean("/" + filepath.ToSlash(remotePath))
+	for _, element := range strings.Split(filepath.ToSlash(remotePath), "/") {
+		if element == ".." {
+			return "", errors.InvalidValue("remotePath", "Path must not contain '..': "+remotePath)
+		}
+	}
+
+	fullPath = filepath.Join(l.path, filepath.FromSlash(cleanPath))
+
+	relativePath, err := filepath.Rel(l.path, fullPath)
+	if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return "", errors.InvalidValue("remotePath", "Path escapes the storage root: "+remotePath)
+	}
+
+	return
+}
+
+// stat will return the file information for a file turning a missing file
+// into a ResourceNotFound error
+func (l *local) stat(remotePath string, fullPath string) (fileInfo os.FileInfo, err error) {
+	fileInfo, err = os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.ResourceNotFound("file", remotePath)
+		}
+		return
+	}
+
+	if fileInfo.IsDir() {
+		return nil, errors.InvalidValue("remotePath", "Path is a directory: "+remotePath)
+	}
+
 	return
 }
+
+// atomicCopy copies the source file to a temporary file next to the
+// destination and then renames it in to place so that readers never see a
+// partially written file
+func atomicCopy(sourcePath string, destinationPath string) (err error) {
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return
+	}
+	defer sourceFile.Close()
+
+	return atomicWrite(sourceFile, destinationPath)
+}
+
+// atomicWrite writes everything from the reader to a temporary file next to
+// the destination and then renames it in to place so that readers never see
+// a partially written file
+func atomicWrite(source io.Reader, destinationPath string) (err error) {
+	temporaryFile, err := ioutil.TempFile(filepath.Dir(destinationPath), localTemporaryFilePrefix)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			temporaryFile.Close()
+			os.Remove(temporaryFile.Name())
+		}
+	}()
+
+	if _, err = io.Copy(temporaryFile, source); err != nil {
+		return
+	}
+
+	if err = temporaryFile.Sync(); err != nil {
+		return
+	}
+
+	if err = temporaryFile.Close(); err != nil {
+		return
+	}
+
+	if err = os.Chmod(temporaryFile.Name(), 0644); err != nil {
+		return
+	}
+
+	return os.Rename(temporaryFile.Name(), destinationPath)
+}
@@ -0,0 +1,145 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/storage"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestLocal_RoundTrip(t *testing.T) {
+	root, err := ioutil.TempDir("", "vrddt-local-storage-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	source := filepath.Join(root, "source.mp4")
+	if err = ioutil.WriteFile(source, []byte("vrddt"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx := context.Background()
+	stg := newLocal(t, filepath.Join(root, "storage"), "")
+
+	if err = stg.Upload(ctx, source, "videos/abc.mp4"); err != nil {
+		t.Fatalf("unexpected error uploading: %s", err)
+	}
+
+	attributes, err := stg.Attributes(ctx, "videos/abc.mp4")
+	if err != nil {
+		t.Fatalf("unexpected error getting attributes: %s", err)
+	}
+	if size := attributes.(*storage.LocalAttributes).Size; size != 5 {
+		t.Errorf("expecting size of 5, got %d", size)
+	}
+
+	location, err := stg.GetLocation(ctx, "videos/abc.mp4")
+	if err != nil {
+		t.Fatalf("unexpected error getting location: %s", err)
+	}
+	if !strings.HasPrefix(location, "file://") || !strings.HasSuffix(location, "/storage/videos/abc.mp4") {
+		t.Errorf("unexpected location: %s", location)
+	}
+
+	files, err := stg.List(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected error listing: %s", err)
+	}
+	if len(files) != 1 || files[0].(string) != "videos/abc.mp4" {
+		t.Errorf("unexpected files: %#v", files)
+	}
+
+	destination := filepath.Join(root, "destination.mp4")
+	if err = stg.Download(ctx, "videos/abc.mp4", destination); err != nil {
+		t.Fatalf("unexpected error downloading: %s", err)
+	}
+	if data, _ := ioutil.ReadFile(destination); string(data) != "vrddt" {
+		t.Errorf("expecting downloaded content 'vrddt', got '%s'", data)
+	}
+
+	if err = stg.Delete(ctx, "videos/abc.mp4"); err != nil {
+		t.Fatalf("unexpected error deleting: %s", err)
+	}
+
+	if _, err = stg.GetLocation(ctx, "videos/abc.mp4"); errors.Type(err) != errors.TypeResourceNotFound {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceNotFound, errors.Type(err))
+	}
+}
+
+func TestLocal_GetLocationWithBaseURL(t *testing.T) {
+	root, err := ioutil.TempDir("", "vrddt-local-storage-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	if err = ioutil.WriteFile(filepath.Join(root, "a b.mp4"), []byte("vrddt"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	stg := newLocal(t, root, "http://localhost:8000/media/")
+
+	location, err := stg.GetLocation(context.Background(), "a b.mp4")
+	if err != nil {
+		t.Fatalf("unexpected error getting location: %s", err)
+	}
+
+	if expected := "http://localhost:8000/media/a%20b.mp4"; location != expected {
+		t.Errorf("expecting location '%s', got '%s'", expected, location)
+	}
+}
+
+func TestLocal_RejectsEscapingPaths(suite *testing.T) {
+	suite.Parallel()
+
+	root, err := ioutil.TempDir("", "vrddt-local-storage-test")
+	if err != nil {
+		suite.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	stg := newLocal(suite, root, "")
+
+	cases := []string{
+		"../escape.mp4",
+		"videos/../../escape.mp4",
+		"..",
+	}
+
+	for id, remotePath := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			_, err := stg.GetLocation(context.Background(), remotePath)
+			if actualType := errors.Type(err); actualType != errors.TypeInvalidValue {
+				t.Errorf("expecting error type '%s', got '%s'", errors.TypeInvalidValue, actualType)
+			}
+		})
+	}
+}
+
+func newLocal(t *testing.T, path string, baseURL string) storage.Storage {
+	stg, err := storage.Local(
+		&config.StorageLocalConfig{
+			BaseURL: baseURL,
+			Path:    path,
+		},
+		logger.New(ioutil.Discard, "error", "text"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = stg.Init(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return stg
+}
@@ -0,0 +1,656 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+const (
+	// DefaultS3PartSize is the size in megabytes of each part of a multipart
+	// upload when it is not configured
+	DefaultS3PartSize = 16
+
+	// DefaultS3PresignExpiry is how long a presigned URL is valid for when it
+	// is not configured which is also the longest S3 allows
+	DefaultS3PresignExpiry = 7 * 24 * time.Hour
+
+	// DefaultS3Region is the region used when one is not configured
+	DefaultS3Region = "us-east-1"
+
+	// MinimumS3PartSize is the smallest size in megabytes S3 allows for every
+	// part of a multipart upload but the last
+	MinimumS3PartSize = 5
+
+	// s3Algorithm is the signing algorithm for AWS Signature Version 4
+	s3Algorithm = "AWS4-HMAC-SHA256"
+
+	// s3TimeFormat is the format of the time used when signing requests
+	s3TimeFormat = "20060102T150405Z"
+
+	// s3UnsignedPayload is used in place of the hash of a request body which
+	// is streamed rather than read in to memory to be hashed
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3Attributes are the attributes returned for a file in S3 storage
+type S3Attributes struct {
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+}
+
+// s3 contains all the information about an S3 compatible storage which is
+// spoken to over its REST API and signed with AWS Signature Version 4
+type s3 struct {
+	accessKeyID     string
+	bucket          string
+	client          *http.Client
+	endpoint        *url.URL
+	log             logger.Logger
+	partSize        int64
+	pathStyle       bool
+	presignExpiry   time.Duration
+	public          bool
+	region          string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// s3CompleteMultipartUpload is the body of the request to finish a multipart
+// upload
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []s3Part `xml:"Part"`
+}
+
+// s3Error is the body of a response for a request which failed
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3InitiateMultipartUploadResult is the body of the response to starting a
+// multipart upload
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+// s3ListBucketResult is the body of the response to listing a bucket
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// s3Part is a part of a multipart upload which has been uploaded
+type s3Part struct {
+	ETag       string `xml:"ETag"`
+	PartNumber int    `xml:"PartNumber"`
+}
+
+// S3 initiates a new S3 compatible storage connection
+func S3(cfg *config.StorageS3Config, loggerHandle logger.Logger) (stg Storage, err error) {
+	loggerHandle.Debugf("S3(cfg): %#v", cfg)
+
+	if cfg.Bucket == "" {
+		return nil, errors.MissingField("Bucket")
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = DefaultS3Region
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	endpointURL, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || endpointURL.Host == "" {
+		return nil, errors.InvalidValue("Endpoint", endpoint)
+	}
+
+	partSize := cfg.PartSize
+	if partSize <= 0 {
+		partSize = DefaultS3PartSize
+	}
+	if partSize < MinimumS3PartSize {
+		return nil, errors.InvalidValue("PartSize", fmt.Sprintf("Must be at least %d megabytes", MinimumS3PartSize))
+	}
+
+	presignExpiry := time.Duration(cfg.PresignExpiry) * time.Second
+	if presignExpiry <= 0 || presignExpiry > DefaultS3PresignExpiry {
+		presignExpiry = DefaultS3PresignExpiry
+	}
+
+	stg = &s3{
+		accessKeyID:     cfg.AccessKeyID,
+		bucket:          cfg.Bucket,
+		endpoint:        endpointURL,
+		log:             loggerHandle,
+		partSize:        int64(partSize) * 1024 * 1024,
+		pathStyle:       cfg.PathStyle,
+		presignExpiry:   presignExpiry,
+		public:          cfg.Public,
+		region:          region,
+		secretAccessKey: cfg.SecretAccessKey,
+		sessionToken:    cfg.SessionToken,
+	}
+
+	return
+}
+
+// Attributes returns attributes about a file
+func (s *s3) Attributes(ctx context.Context, remotePath string) (attributes interface{}, err error) {
+	resp, err := s.do(ctx, http.MethodHead, remotePath, nil, nil, nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+
+	lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	attributes = &S3Attributes{
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         strings.Trim(resp.Header.Get("ETag"), `"`),
+		LastModified: lastModified,
+		Name:         remotePath,
+		Size:         resp.ContentLength,
+	}
+
+	return
+}
+
+// Cleanup closes any idle connections
+func (s *s3) Cleanup(ctx context.Context) (err error) {
+	if s.client == nil {
+		return errors.ConnectionFailure("s3", "A client has not been set in order to be cleaned up")
+	}
+
+	s.client.CloseIdleConnections()
+
+	return
+}
+
+// Delete will remove a file
+func (s *s3) Delete(ctx context.Context, remotePath string) (err error) {
+	// S3 happily deletes files which do not exist so look first to behave
+	// like the other storages
+	if _, err = s.Attributes(ctx, remotePath); err != nil {
+		return
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, remotePath, nil, nil, nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+
+	return
+}
+
+// Download will download a remote path to the provided local path
+func (s *s3) Download(ctx context.Context, remotePath string, localPath string) (err error) {
+	resp, err := s.do(ctx, http.MethodGet, remotePath, nil, nil, nil)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	return atomicWrite(resp.Body, localPath)
+}
+
+// GetLocation returns the URL to a file which is presigned unless files are
+// uploaded for anyone to read
+func (s *s3) GetLocation(ctx context.Context, remotePath string) (location string, err error) {
+	if _, err = s.Attributes(ctx, remotePath); err != nil {
+		return
+	}
+
+	if s.public {
+		return s.objectURL(remotePath, nil).String(), nil
+	}
+
+	return s.presign(http.MethodGet, remotePath, time.Now()), nil
+}
+
+// Init establishes the session and makes sure the bucket can be reached
+func (s *s3) Init(ctx context.Context) (err error) {
+	s.client = &http.Client{}
+
+	resp, err := s.do(ctx, http.MethodHead, "", nil, nil, nil)
+	if err != nil {
+		if errors.Type(err) == errors.TypeResourceNotFound {
+			return errors.ResourceNotFound("bucket", s.bucket)
+		}
+		return
+	}
+	resp.Body.Close()
+
+	s.log.Debugf("S3 storage using bucket '%s' at: %s", s.bucket, s.endpoint)
+
+	return
+}
+
+// List returns all files starting with the given prefix
+func (s *s3) List(ctx context.Context, remotePath string) (files []interface{}, err error) {
+	continuationToken := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {remotePath},
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		result := &s3ListBucketResult{}
+		if err = s.doXML(ctx, http.MethodGet, "", query, nil, nil, result); err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			files = append(files, content.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// Upload will upload a local path to the provided remote path in parts if
+// it is larger than a single part
+func (s *s3) Upload(ctx context.Context, localPath string, remotePath string) (err error) {
+	if remotePath == "" {
+		return errors.MissingField("remotePath")
+	}
+
+	sourceFile, err := os.Open(localPath)
+	if err != nil {
+		return
+	}
+	defer sourceFile.Close()
+
+	fileInfo, err := sourceFile.Stat()
+	if err != nil {
+		return
+	}
+
+	header := s.uploadHeader(remotePath)
+	if fileInfo.Size() <= s.partSize {
+		resp, err := s.do(ctx, http.MethodPut, remotePath, nil, header, io.NewSectionReader(sourceFile, 0, fileInfo.Size()))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		return nil
+	}
+
+	return s.uploadMultipart(ctx, sourceFile, fileInfo.Size(), remotePath, header)
+}
+
+// do will sign and send a request for the bucket, if remotePath is empty,
+// or for a file in the bucket turning any unsuccessful response in to an
+// error. The body must be nil, a *bytes.Reader, or an *io.SectionReader so
+// that its length is known up front.
+func (s *s3) do(ctx context.Context, method string, remotePath string, query url.Values, header http.Header, body io.Reader) (resp *http.Response, err error) {
+	if s.client == nil {
+		return nil, errors.ConnectionClosed("s3", "Storage has not been initialized")
+	}
+
+	req, err := http.NewRequest(method, s.objectURL(remotePath, query).String(), nil)
+	if err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	payloadHash := s3UnsignedPayload
+	switch reader := body.(type) {
+	case nil:
+		payloadHash = hashHex(nil)
+	case *bytes.Reader:
+		data := make([]byte, reader.Len())
+		reader.Read(data)
+		payloadHash = hashHex(data)
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+	case *io.SectionReader:
+		req.Body = ioutil.NopCloser(reader)
+		req.ContentLength = reader.Size()
+	default:
+		return nil, errors.InvalidValue("body", fmt.Sprintf("Length of %T is unknown", body))
+	}
+	if req.ContentLength == 0 {
+		req.Body = http.NoBody
+	}
+
+	s.sign(req, payloadHash, time.Now())
+
+	resp, err = s.client.Do(req)
+	if err != nil {
+		return nil, errors.ConnectionFailure("s3", err.Error())
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, s.responseError(resp, remotePath)
+	}
+
+	return
+}
+
+// doXML will send a request with do() and decode the XML response in to v
+func (s *s3) doXML(ctx context.Context, method string, remotePath string, query url.Values, header http.Header, body io.Reader, v interface{}) (err error) {
+	resp, err := s.do(ctx, method, remotePath, query, header, body)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.ConnectionFailure("s3", err.Error())
+	}
+
+	// Some requests (e.g. completing a multipart upload) can fail after a
+	// successful status has already been sent
+	responseError := &s3Error{}
+	if xml.Unmarshal(data, responseError) == nil && responseError.Code != "" {
+		return errors.ConnectionFailure("s3", fmt.Sprintf("%s: %s", responseError.Code, responseError.Message))
+	}
+
+	if err = xml.Unmarshal(data, v); err != nil {
+		return errors.ResourceUnknown("s3 response", err.Error())
+	}
+
+	return
+}
+
+// objectURL returns the URL for the bucket, if remotePath is empty, or for a
+// file in the bucket
+func (s *s3) objectURL(remotePath string, query url.Values) (objectURL *url.URL) {
+	objectURL = &url.URL{
+		Host:   s.endpoint.Host,
+		Scheme: s.endpoint.Scheme,
+	}
+
+	objectPath := s.endpoint.Path
+	if s.pathStyle {
+		objectPath += "/" + s.bucket
+	} else {
+		objectURL.Host = s.bucket + "." + s.endpoint.Host
+	}
+	objectPath += "/" + strings.TrimLeft(remotePath, "/")
+
+	objectURL.Path = objectPath
+	objectURL.RawPath = s3Escape(objectPath, false)
+	objectURL.RawQuery = s3CanonicalQuery(query)
+
+	return
+}
+
+// presign returns a URL which anyone can use to make the request until it
+// expires
+func (s *s3) presign(method string, remotePath string, now time.Time) (location string) {
+	now = now.UTC()
+	query := url.Values{
+		"X-Amz-Algorithm":     {s3Algorithm},
+		"X-Amz-Credential":    {s.accessKeyID + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(s3TimeFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(s.presignExpiry / time.Second))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if s.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	objectURL := s.objectURL(remotePath, query)
+	header := http.Header{"Host": {objectURL.Host}}
+	signature := s.signature(method, objectURL, header, []string{"host"}, s3UnsignedPayload, now)
+
+	return objectURL.String() + "&X-Amz-Signature=" + signature
+}
+
+// responseError turns an unsuccessful response in to an error
+func (s *s3) responseError(resp *http.Response, remotePath string) (err error) {
+	responseError := &s3Error{}
+	if data, readErr := ioutil.ReadAll(resp.Body); readErr == nil {
+		xml.Unmarshal(data, responseError)
+	}
+	if responseError.Code == "" {
+		responseError.Code = resp.Status
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		if remotePath == "" {
+			return errors.ResourceNotFound("bucket", s.bucket)
+		}
+		return errors.ResourceNotFound("file", remotePath)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Unauthorized(fmt.Sprintf("%s: %s", responseError.Code, responseError.Message))
+	default:
+		return errors.ConnectionFailure("s3", fmt.Sprintf("%s: %s", responseError.Code, responseError.Message))
+	}
+}
+
+// scope returns the credential scope requests made at the time are signed
+// for
+func (s *s3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// sign will add the AWS Signature Version 4 authorization to the request
+func (s *s3) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	signedHeaders := []string{}
+	for key := range req.Header {
+		key = strings.ToLower(key)
+		if key == "host" || key == "content-type" || key == "content-md5" || strings.HasPrefix(key, "x-amz-") {
+			signedHeaders = append(signedHeaders, key)
+		}
+	}
+	sort.Strings(signedHeaders)
+
+	signature := s.signature(req.Method, req.URL, req.Header, signedHeaders, payloadHash, now)
+
+	// The Host header is sent by the client from the URL
+	req.Header.Del("Host")
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm,
+		s.accessKeyID,
+		s.scope(now),
+		strings.Join(signedHeaders, ";"),
+		signature,
+	))
+}
+
+// signature returns the AWS Signature Version 4 signature for a request
+func (s *s3) signature(method string, requestURL *url.URL, header http.Header, signedHeaders []string, payloadHash string, now time.Time) string {
+	canonicalHeaders := ""
+	for _, key := range signedHeaders {
+		canonicalHeaders += key + ":" + strings.TrimSpace(header.Get(key)) + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		requestURL.EscapedPath(),
+		requestURL.RawQuery,
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3TimeFormat),
+		s.scope(now),
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretAccessKey), now.Format("20060102"))
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+// uploadHeader returns the headers for uploading a file
+func (s *s3) uploadHeader(remotePath string) (header http.Header) {
+	contentType := mime.TypeByExtension(path.Ext(remotePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header = http.Header{"Content-Type": {contentType}}
+	if s.public {
+		header.Set("X-Amz-Acl", "public-read")
+	}
+
+	return
+}
+
+// uploadMultipart will upload a file in parts aborting the upload if any of
+// them fail so that the parts do not linger in the bucket
+func (s *s3) uploadMultipart(ctx context.Context, sourceFile *os.File, size int64, remotePath string, header http.Header) (err error) {
+	initiated := &s3InitiateMultipartUploadResult{}
+	if err = s.doXML(ctx, http.MethodPost, remotePath, url.Values{"uploads": {""}}, header, nil, initiated); err != nil {
+		return
+	}
+	s.log.Debugf("Started multipart upload (%s) of %d bytes to: %s", initiated.UploadID, size, remotePath)
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		abortResp, abortErr := s.do(context.Background(), http.MethodDelete, remotePath, url.Values{"uploadId": {initiated.UploadID}}, nil, nil)
+		if abortErr != nil {
+			s.log.Errorf("Unable to abort multipart upload (%s): %s", initiated.UploadID, abortErr)
+			return
+		}
+		abortResp.Body.Close()
+	}()
+
+	completed := &s3CompleteMultipartUpload{}
+	for offset, partNumber := int64(0), 1; offset < size; offset, partNumber = offset+s.partSize, partNumber+1 {
+		partSize := s.partSize
+		if offset+partSize > size {
+			partSize = size - offset
+		}
+
+		query := url.Values{
+			"partNumber": {strconv.Itoa(partNumber)},
+			"uploadId":   {initiated.UploadID},
+		}
+
+		resp, err := s.do(ctx, http.MethodPut, remotePath, query, nil, io.NewSectionReader(sourceFile, offset, partSize))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		completed.Parts = append(completed.Parts, s3Part{
+			ETag:       resp.Header.Get("ETag"),
+			PartNumber: partNumber,
+		})
+	}
+
+	body, err := xml.Marshal(completed)
+	if err != nil {
+		return
+	}
+
+	return s.doXML(ctx, http.MethodPost, remotePath, url.Values{"uploadId": {initiated.UploadID}}, nil, bytes.NewReader(body), &struct{}{})
+}
+
+// hashHex returns the hex encoded SHA256 hash of the data
+func hashHex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data with the key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery encodes the query the way AWS Signature Version 4 expects
+// it which is sorted by key with spaces encoded as "%20" rather than "+"
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent encodes everything but the characters AWS Signature
+// Version 4 leaves alone optionally leaving "/" alone too
+func s3Escape(value string, escapeSlash bool) string {
+	escaped := strings.Builder{}
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '.', b == '_', b == '~':
+			escaped.WriteByte(b)
+		case b == '/' && !escapeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
@@ -0,0 +1,398 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/storage"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestS3_RoundTrip(t *testing.T) {
+	fake := newFakeS3("vrddt")
+	defer fake.Close()
+
+	root, err := ioutil.TempDir("", "vrddt-s3-storage-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	source := filepath.Join(root, "source.mp4")
+	if err = ioutil.WriteFile(source, []byte("vrddt"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx := context.Background()
+	stg := newS3(t, fake, &config.StorageS3Config{Public: true})
+
+	if err = stg.Upload(ctx, source, "videos/a b.mp4"); err != nil {
+		t.Fatalf("unexpected error uploading: %s", err)
+	}
+	if contentType := fake.contentTypes["videos/a b.mp4"]; contentType != "video/mp4" {
+		t.Errorf("expecting content type 'video/mp4', got '%s'", contentType)
+	}
+
+	attributes, err := stg.Attributes(ctx, "videos/a b.mp4")
+	if err != nil {
+		t.Fatalf("unexpected error getting attributes: %s", err)
+	}
+	if size := attributes.(*storage.S3Attributes).Size; size != 5 {
+		t.Errorf("expecting size of 5, got %d", size)
+	}
+
+	location, err := stg.GetLocation(ctx, "videos/a b.mp4")
+	if err != nil {
+		t.Fatalf("unexpected error getting location: %s", err)
+	}
+	if expected := fake.URL + "/vrddt/videos/a%20b.mp4"; location != expected {
+		t.Errorf("expecting location '%s', got '%s'", expected, location)
+	}
+
+	destination := filepath.Join(root, "destination.mp4")
+	if err = stg.Download(ctx, "videos/a b.mp4", destination); err != nil {
+		t.Fatalf("unexpected error downloading: %s", err)
+	}
+	if data, _ := ioutil.ReadFile(destination); string(data) != "vrddt" {
+		t.Errorf("expecting downloaded content 'vrddt', got '%s'", data)
+	}
+
+	if err = stg.Delete(ctx, "videos/a b.mp4"); err != nil {
+		t.Fatalf("unexpected error deleting: %s", err)
+	}
+
+	if _, err = stg.GetLocation(ctx, "videos/a b.mp4"); errors.Type(err) != errors.TypeResourceNotFound {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceNotFound, errors.Type(err))
+	}
+	if err = stg.Delete(ctx, "videos/a b.mp4"); errors.Type(err) != errors.TypeResourceNotFound {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceNotFound, errors.Type(err))
+	}
+}
+
+func TestS3_MultipartUpload(t *testing.T) {
+	fake := newFakeS3("vrddt")
+	defer fake.Close()
+
+	root, err := ioutil.TempDir("", "vrddt-s3-storage-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	// Just over two parts so the last one is short
+	content := bytes.Repeat([]byte("0123456789"), (11*1024*1024)/10)
+	source := filepath.Join(root, "source.mp4")
+	if err = ioutil.WriteFile(source, content, 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	stg := newS3(t, fake, &config.StorageS3Config{PartSize: storage.MinimumS3PartSize})
+
+	if err = stg.Upload(context.Background(), source, "large.mp4"); err != nil {
+		t.Fatalf("unexpected error uploading: %s", err)
+	}
+
+	if fake.parts != 3 {
+		t.Errorf("expecting 3 parts, got %d", fake.parts)
+	}
+	if !bytes.Equal(fake.objects["large.mp4"], content) {
+		t.Errorf("expecting uploaded content to match, got %d bytes", len(fake.objects["large.mp4"]))
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("expecting no unfinished uploads, got %d", len(fake.uploads))
+	}
+}
+
+func TestS3_GetLocationPresigned(t *testing.T) {
+	fake := newFakeS3("vrddt")
+	defer fake.Close()
+	fake.objects["private.mp4"] = []byte("vrddt")
+
+	stg := newS3(t, fake, &config.StorageS3Config{PresignExpiry: 60})
+
+	location, err := stg.GetLocation(context.Background(), "private.mp4")
+	if err != nil {
+		t.Fatalf("unexpected error getting location: %s", err)
+	}
+	if !strings.Contains(location, "X-Amz-Expires=60") || !strings.Contains(location, "X-Amz-Signature=") {
+		t.Errorf("expecting a presigned location, got '%s'", location)
+	}
+
+	resp, err := http.Get(location)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if data, _ := ioutil.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(data) != "vrddt" {
+		t.Errorf("expecting presigned location to return 'vrddt', got %d '%s'", resp.StatusCode, data)
+	}
+
+	// Without the signature the file can not be read
+	resp, err = http.Get(strings.Split(location, "?")[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expecting status %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestS3_List(suite *testing.T) {
+	fake := newFakeS3("vrddt")
+	defer fake.Close()
+	for _, key := range []string{"audio/a.mp4", "videos/a.mp4", "videos/b.mp4", "videos/c.mp4", "videosx.mp4"} {
+		fake.objects[key] = []byte("vrddt")
+	}
+
+	stg := newS3(suite, fake, &config.StorageS3Config{})
+
+	cases := []struct {
+		expected []string
+		prefix   string
+	}{
+		{expected: []string{"audio/a.mp4", "videos/a.mp4", "videos/b.mp4", "videos/c.mp4", "videosx.mp4"}, prefix: ""},
+		{expected: []string{"videos/a.mp4", "videos/b.mp4", "videos/c.mp4"}, prefix: "videos/"},
+		{expected: []string{"audio/a.mp4"}, prefix: "audio"},
+		{expected: nil, prefix: "missing/"},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			files, err := stg.List(context.Background(), cs.prefix)
+			if err != nil {
+				t.Fatalf("unexpected error listing: %s", err)
+			}
+
+			actual := []string{}
+			for _, file := range files {
+				actual = append(actual, file.(string))
+			}
+			if fmt.Sprint(actual) != fmt.Sprint(append([]string{}, cs.expected...)) {
+				t.Errorf("expecting files %v, got %v", cs.expected, actual)
+			}
+		})
+	}
+}
+
+func TestS3_Init(suite *testing.T) {
+	fake := newFakeS3("vrddt")
+	defer fake.Close()
+
+	cases := []struct {
+		accessKeyID  string
+		bucket       string
+		expectedType string
+	}{
+		{accessKeyID: "vrddt", bucket: "vrddt"},
+		{accessKeyID: "vrddt", bucket: "missing", expectedType: errors.TypeResourceNotFound},
+		{accessKeyID: "unknown", bucket: "vrddt", expectedType: errors.TypeUnauthorized},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			stg, err := storage.S3(
+				&config.StorageS3Config{
+					AccessKeyID:     cs.accessKeyID,
+					Bucket:          cs.bucket,
+					Endpoint:        fake.URL,
+					PathStyle:       true,
+					SecretAccessKey: "secret",
+				},
+				logger.New(ioutil.Discard, "error", "text"),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			err = stg.Init(context.Background())
+			if actualType := errors.Type(err); err != nil && actualType != cs.expectedType {
+				t.Errorf("expecting error type '%s', got '%s'", cs.expectedType, actualType)
+			} else if err == nil && cs.expectedType != "" {
+				t.Errorf("expecting error type '%s', got none", cs.expectedType)
+			}
+		})
+	}
+}
+
+// fakeS3 is an in-memory stand-in for a path-style S3 compatible service
+// (e.g. MinIO) with a single bucket which only accepts signed requests
+type fakeS3 struct {
+	*httptest.Server
+
+	bucket       string
+	contentTypes map[string]string
+	mu           sync.Mutex
+	objects      map[string][]byte
+	parts        int
+	uploads      map[string]map[int][]byte
+}
+
+func newFakeS3(bucket string) (fake *fakeS3) {
+	fake = &fakeS3{
+		bucket:       bucket,
+		contentTypes: map[string]string{},
+		objects:      map[string][]byte{},
+		uploads:      map[string]map[int][]byte{},
+	}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+
+	return
+}
+
+func (fake *fakeS3) serveHTTP(wr http.ResponseWriter, req *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	query := req.URL.Query()
+	authorization := req.Header.Get("Authorization")
+	signed := strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=vrddt/") && req.Header.Get("X-Amz-Date") != ""
+	presigned := query.Get("X-Amz-Signature") != "" && strings.HasPrefix(query.Get("X-Amz-Credential"), "vrddt/")
+	if !signed && !presigned {
+		fake.respondError(wr, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	segments := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	if segments[0] != fake.bucket {
+		fake.respondError(wr, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := ""
+	if len(segments) == 2 {
+		key = segments[1]
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+
+	switch {
+	case key == "" && req.Method == http.MethodHead:
+	case key == "" && req.Method == http.MethodGet:
+		fake.list(wr, query)
+	case req.Method == http.MethodPost && query["uploads"] != nil:
+		uploadID := strconv.Itoa(len(fake.uploads) + 1)
+		fake.uploads[uploadID] = map[int][]byte{}
+		fake.contentTypes[key] = req.Header.Get("Content-Type")
+		fmt.Fprintf(wr, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case req.Method == http.MethodPut && query.Get("uploadId") != "":
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		fake.uploads[query.Get("uploadId")][partNumber] = body
+		fake.parts++
+		wr.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, partNumber))
+	case req.Method == http.MethodPost && query.Get("uploadId") != "":
+		completed := &struct {
+			Parts []struct {
+				ETag       string `xml:"ETag"`
+				PartNumber int    `xml:"PartNumber"`
+			} `xml:"Part"`
+		}{}
+		xml.Unmarshal(body, completed)
+
+		object := []byte{}
+		for _, part := range completed.Parts {
+			if part.ETag != fmt.Sprintf(`"etag-%d"`, part.PartNumber) {
+				fake.respondError(wr, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			object = append(object, fake.uploads[query.Get("uploadId")][part.PartNumber]...)
+		}
+		fake.objects[key] = object
+		delete(fake.uploads, query.Get("uploadId"))
+		fmt.Fprint(wr, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case req.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(fake.uploads, query.Get("uploadId"))
+		wr.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodPut:
+		fake.objects[key] = body
+		fake.contentTypes[key] = req.Header.Get("Content-Type")
+	case req.Method == http.MethodDelete:
+		delete(fake.objects, key)
+		wr.WriteHeader(http.StatusNoContent)
+	default:
+		object, ok := fake.objects[key]
+		if !ok {
+			fake.respondError(wr, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+
+		wr.Header().Set("Content-Length", strconv.Itoa(len(object)))
+		wr.Header().Set("ETag", `"etag"`)
+		if req.Method == http.MethodGet {
+			wr.Write(object)
+		}
+	}
+}
+
+// list returns the keys starting with the prefix two at a time
+func (fake *fakeS3) list(wr http.ResponseWriter, query map[string][]string) {
+	prefix := ""
+	if values := query["prefix"]; len(values) > 0 {
+		prefix = values[0]
+	}
+
+	keys := []string{}
+	for key := range fake.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if values := query["continuation-token"]; len(values) > 0 {
+		start, _ = strconv.Atoi(values[0])
+	}
+	end := start + 2
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	fmt.Fprint(wr, "<ListBucketResult>")
+	for _, key := range keys[start:end] {
+		fmt.Fprintf(wr, "<Contents><Key>%s</Key></Contents>", key)
+	}
+	if end < len(keys) {
+		fmt.Fprintf(wr, "<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>", end)
+	}
+	fmt.Fprint(wr, "</ListBucketResult>")
+}
+
+func (fake *fakeS3) respondError(wr http.ResponseWriter, status int, code string) {
+	wr.WriteHeader(status)
+	fmt.Fprintf(wr, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, http.StatusText(status))
+}
+
+func newS3(t *testing.T, fake *fakeS3, cfg *config.StorageS3Config) storage.Storage {
+	cfg.AccessKeyID = "vrddt"
+	cfg.Bucket = fake.bucket
+	cfg.Endpoint = fake.URL
+	cfg.PathStyle = true
+	cfg.SecretAccessKey = "secret"
+
+	stg, err := storage.S3(cfg, logger.New(ioutil.Discard, "error", "text"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = stg.Init(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return stg
+}
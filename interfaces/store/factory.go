@@ -0,0 +1,75 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+// Factory builds a store from its section of the configuration
+type Factory func(cfg *config.StoreConfig, loggerHandle logger.Logger) (store Store, err error)
+
+var (
+	// factories are the store which can be built by New() keyed by their
+	// type
+	factories = map[config.StoreType]Factory{}
+
+	// factoriesMutex guards factories
+	factoriesMutex sync.RWMutex
+)
+
+func init() {
+	Register(config.StoreConfigeMemory, func(cfg *config.StoreConfig, loggerHandle logger.Logger) (Store, error) {
+		return Memory(&cfg.Memory, loggerHandle)
+	})
+	Register(config.StoreConfigMongo, func(cfg *config.StoreConfig, loggerHandle logger.Logger) (Store, error) {
+		return Mongo(&cfg.Mongo, loggerHandle)
+	})
+}
+
+// New builds the store named by the type in the configuration
+func New(cfg *config.StoreConfig, loggerHandle logger.Logger) (store Store, err error) {
+	factoriesMutex.RLock()
+	factory, ok := factories[cfg.Type]
+	factoriesMutex.RUnlock()
+
+	if !ok {
+		return nil, errors.InvalidValue("Store.Type", fmt.Sprintf("Unknown store type '%s' (must be one of: %s)", cfg.Type, strings.Join(Types(), ", ")))
+	}
+
+	return factory(cfg, loggerHandle)
+}
+
+// Register makes a store available to New() by its type. It panics if the
+// type is registered twice or the factory is nil.
+func Register(storeType config.StoreType, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if factory == nil {
+		panic("store: Register factory is nil")
+	}
+	if _, ok := factories[storeType]; ok {
+		panic("store: Register called twice for type " + storeType.String())
+	}
+
+	factories[storeType] = factory
+}
+
+// Types returns the sorted types of the store which have been registered
+func Types() (types []string) {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	for storeType := range factories {
+		types = append(types, storeType.String())
+	}
+	sort.Strings(types)
+
+	return
+}
@@ -2,55 +2,99 @@ package store
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/johnwyles/vrddt-droplets/domain"
 	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"github.com/johnwyles/vrddt-droplets/pkg/logger"
 )
 
-// TODO: Finish this when you're are bored
+const (
+	// memoryJobsCollectionName is the name of the in-memory collection of
+	// jobs
+	memoryJobsCollectionName = "Job"
+
+	// memoryRedditVideosCollectionName is the name of the in-memory
+	// collection of Reddit videos
+	memoryRedditVideosCollectionName = "RedditVideo"
+
+	// memoryVrddtVideosCollectionName is the name of the in-memory
+	// collection of vrddt videos
+	memoryVrddtVideosCollectionName = "VrddtVideo"
+)
 
-// mongoSession contains all the information about a Mongo session
+// memoryStore contains all the information about an in-memory store
 type memoryStore struct {
+	jobs         *memoryCollection
 	log          logger.Logger
-	redditVideos []*domain.RedditVideo
-	vrddtVideos  []*domain.VrddtVideo
+	maxSize      int
+	mutex        sync.RWMutex
+	redditVideos *memoryCollection
+	vrddtVideos  *memoryCollection
+}
+
+// memoryCollection holds documents in their BSON form so that selectors are
+// evaluated against the same representation Mongo would evaluate them against
+// and callers never share memory with what is stored
+type memoryCollection struct {
+	documents  []bson.M
+	name       string
+	uniqueKeys [][]string
 }
 
 // Memory initiates a new Memory struct
 func Memory(cfg *config.StoreMemoryConfig, loggerHandle logger.Logger) (store Store, err error) {
 	loggerHandle.Debugf("Memory(cfg): %#v", cfg)
 
-	store = &memoryStore{
-		log:          loggerHandle,
-		redditVideos: []*domain.RedditVideo{},
-		vrddtVideos:  []*domain.VrddtVideo{},
+	m := &memoryStore{
+		log:     loggerHandle,
+		maxSize: cfg.MaxSize,
 	}
+	m.reset()
+
+	store = m
 
 	return
 }
 
 // Cleanup will end the session
 func (m *memoryStore) Cleanup(ctx context.Context) (err error) {
-	m = &memoryStore{
-		log:          m.log,
-		redditVideos: []*domain.RedditVideo{},
-		vrddtVideos:  []*domain.VrddtVideo{},
-	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.reset()
 
 	return
 }
 
+// CreateJob will add a job to the jobs
+func (m *memoryStore) CreateJob(ctx context.Context, job *domain.Job) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.insert(m.jobs, job)
+}
+
 // CreateRedditVideo will add a RedditVideo to the Reddit videos
 func (m *memoryStore) CreateRedditVideo(ctx context.Context, redditVideo *domain.RedditVideo) (err error) {
-	m.redditVideos = append(m.redditVideos, redditVideo)
-	return
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.insert(m.redditVideos, redditVideo)
 }
 
 // CreateVrddtVideo will add a vrddt video to the vrddt videos
 func (m *memoryStore) CreateVrddtVideo(ctx context.Context, vrddtVideo *domain.VrddtVideo) (err error) {
-	m.vrddtVideos = append(m.vrddtVideos, vrddtVideo)
-	return
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.insert(m.vrddtVideos, vrddtVideo)
 }
 
 // DeleteRedditVideo is an alias to the same function but plural becaause the
@@ -61,7 +105,10 @@ func (m *memoryStore) DeleteRedditVideo(ctx context.Context, selector Selector)
 
 // DeleteRedditVideos deletes Reddit video from the collection
 func (m *memoryStore) DeleteRedditVideos(ctx context.Context, selector Selector) (err error) {
-	return
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.remove(m.redditVideos, selector)
 }
 
 // DeleteVrddtVideo is an alias to the same function but plural becaause the
@@ -70,54 +117,121 @@ func (m *memoryStore) DeleteVrddtVideo(ctx context.Context, selector Selector) (
 	return m.DeleteVrddtVideos(ctx, selector)
 }
 
-// DeleteVrddtVideo deletes vrddtVideos from the collection
+// DeleteVrddtVideos deletes vrddtVideos from the collection
 func (m *memoryStore) DeleteVrddtVideos(ctx context.Context, selector Selector) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.remove(m.vrddtVideos, selector)
+}
+
+// GetJob will return a job from the store if the passed in selector is found
+func (m *memoryStore) GetJob(ctx context.Context, selector Selector) (job *domain.Job, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	documents, err := m.find(m.jobs, selector, 1)
+	if err != nil {
+		return
+	}
+
+	if len(documents) == 0 {
+		return nil, errors.ResourceNotFound("Job", fmt.Sprintf("%#v", selector))
+	}
+
+	job = &domain.Job{}
+	err = decodeDocument(documents[0], job)
+
 	return
 }
 
-// GetRedditVideo will return a RedditVideo from the database if the passed in
+// GetRedditVideo will return a RedditVideo from the store if the passed in
 // key / value pair are found
 func (m *memoryStore) GetRedditVideo(ctx context.Context, selector Selector) (redditVideo *domain.RedditVideo, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	documents, err := m.find(m.redditVideos, selector, 1)
+	if err != nil {
+		return
+	}
+
+	if len(documents) == 0 {
+		return nil, errors.ResourceNotFound("RedditVideo", fmt.Sprintf("%#v", selector))
+	}
+
+	redditVideo = &domain.RedditVideo{}
+	err = decodeDocument(documents[0], redditVideo)
+
 	return
 }
 
+// GetRedditVideos will return a collection of Reddit videos from the store
+// that match the selector with a limit (less than 1 means no limit)
 func (m *memoryStore) GetRedditVideos(ctx context.Context, selector Selector, limit int) (redditVideos []*domain.RedditVideo, err error) {
-	// selector := map[string]interface{}{
-	// 	"audio_url": redditVideo.AudioURL,
-	// 	"video_url": redditVideo.VideoURL,
-	// }
-
-	// type Video struct {
-	// 	AudioURL     string        `json:"audio_url" bson:"audio_url"`
-	// 	FilePath     string        `json:"-" bson:"-"`
-	// 	FileHandle   *os.File      `json:"-" bson:"-"`
-	// 	ID           bson.ObjectId `json:"id,omitempty" bson:"_id,omitempty"`
-	// 	URL          string        `json:"url" bson:"url"`
-	// 	Timestamp    time.Time     `json:"timestamp" bson:"timestamp"`
-	// 	Title        string        `json:"title" bson:"title"`
-	// 	VideoURL     string        `json:"video_url" bson:"video_url"`
-	// 	VrddtVideoID bson.ObjectId `json:"vrddt_video_id" bson:"vrddt_video_id"`
-	// }
-
-	// for i, rv := range m.redditVideos {
-	// 	var rvMatch *reddit.Video
-	// 	for k, v := range selector {
-	//
-	// 	}
-	// }
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	documents, err := m.find(m.redditVideos, selector, limit)
+	if err != nil {
+		return
+	}
+
+	redditVideos = []*domain.RedditVideo{}
+	for _, document := range documents {
+		redditVideo := &domain.RedditVideo{}
+		if err = decodeDocument(document, redditVideo); err != nil {
+			return nil, err
+		}
+
+		redditVideos = append(redditVideos, redditVideo)
+	}
 
 	return
 }
 
-// GetVrddtVideo will return a VrddtVideo from the database if the passed
+// GetVrddtVideo will return a VrddtVideo from the store if the passed
 // in selector is found
 func (m *memoryStore) GetVrddtVideo(ctx context.Context, selector Selector) (vrddtVideo *domain.VrddtVideo, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	documents, err := m.find(m.vrddtVideos, selector, 1)
+	if err != nil {
+		return
+	}
+
+	if len(documents) == 0 {
+		return nil, errors.ResourceNotFound("VrddtVideo", fmt.Sprintf("%#v", selector))
+	}
+
+	vrddtVideo = &domain.VrddtVideo{}
+	err = decodeDocument(documents[0], vrddtVideo)
+
 	return
 }
 
-// GetVrddtVideos will return a VrddtVideo from the database if the passed
-// in key / value pair are found
+// GetVrddtVideos will return the vrddt videos from the store that match the
+// selector with a limit (less than 1 means no limit)
 func (m *memoryStore) GetVrddtVideos(ctx context.Context, selector Selector, limit int) (vrddtVideos []*domain.VrddtVideo, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	documents, err := m.find(m.vrddtVideos, selector, limit)
+	if err != nil {
+		return
+	}
+
+	vrddtVideos = []*domain.VrddtVideo{}
+	for _, document := range documents {
+		vrddtVideo := &domain.VrddtVideo{}
+		if err = decodeDocument(document, vrddtVideo); err != nil {
+			return nil, err
+		}
+
+		vrddtVideos = append(vrddtVideos, vrddtVideo)
+	}
+
 	return
 }
 
@@ -125,3 +239,190 @@ func (m *memoryStore) GetVrddtVideos(ctx context.Context, selector Selector, lim
 func (m *memoryStore) Init(ctx context.Context) (err error) {
 	return
 }
+
+// UpdateJob will replace the job in the jobs with the same ID
+func (m *memoryStore) UpdateJob(ctx context.Context, job *domain.Job) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.replace(m.jobs, job.ID, job)
+}
+
+// find returns the documents in a collection matching the selector up to
+// the limit (less than 1 means no limit)
+func (m *memoryStore) find(collection *memoryCollection, selector Selector, limit int) (documents []bson.M, err error) {
+	normalizedSelector, err := normalizeSelector(selector)
+	if err != nil {
+		return
+	}
+
+	for _, document := range collection.documents {
+		if limit > 0 && len(documents) >= limit {
+			break
+		}
+
+		if matchDocument(document, normalizedSelector) {
+			documents = append(documents, document)
+		}
+	}
+
+	return
+}
+
+// insert adds a document to a collection enforcing the size limit and the
+// unique keys of the collection
+func (m *memoryStore) insert(collection *memoryCollection, item interface{}) (err error) {
+	if m.maxSize > 0 && len(collection.documents) >= m.maxSize {
+		return errors.ResourceLimit(collection.name, m.maxSize)
+	}
+
+	document, err := encodeDocument(item)
+	if err != nil {
+		return
+	}
+
+	for _, keys := range collection.uniqueKeys {
+		values := bson.M{}
+		for _, key := range keys {
+			if value, ok := document[key]; ok {
+				values[key] = value
+			}
+		}
+		if len(values) == 0 {
+			// Sparse unique keys do not conflict when they are absent
+			continue
+		}
+
+		for _, existingDocument := range collection.documents {
+			if matchUniqueKeys(existingDocument, keys, values) {
+				return errors.Conflict(collection.name, fmt.Sprintf("%s: %v", strings.Join(keys, ", "), values))
+			}
+		}
+	}
+
+	collection.documents = append(collection.documents, document)
+
+	return
+}
+
+// remove deletes all of the documents in a collection matching the selector
+func (m *memoryStore) remove(collection *memoryCollection, selector Selector) (err error) {
+	normalizedSelector, err := normalizeSelector(selector)
+	if err != nil {
+		return
+	}
+
+	documents := collection.documents[:0]
+	for _, document := range collection.documents {
+		if !matchDocument(document, normalizedSelector) {
+			documents = append(documents, document)
+		}
+	}
+	collection.documents = documents
+
+	return
+}
+
+// replace swaps the document in a collection with the given ID for the item
+func (m *memoryStore) replace(collection *memoryCollection, id bson.ObjectId, item interface{}) (err error) {
+	document, err := encodeDocument(item)
+	if err != nil {
+		return
+	}
+
+	for i, existingDocument := range collection.documents {
+		if existingID, ok := existingDocument["_id"]; ok && existingID == id {
+			collection.documents[i] = document
+			return
+		}
+	}
+
+	return errors.ResourceNotFound(collection.name, id.Hex())
+}
+
+// reset will empty all of the collections
+func (m *memoryStore) reset() {
+	m.jobs = &memoryCollection{
+		name:       memoryJobsCollectionName,
+		uniqueKeys: [][]string{{"_id"}},
+	}
+
+	m.redditVideos = &memoryCollection{
+		name:       memoryRedditVideosCollectionName,
+		uniqueKeys: [][]string{{"_id"}, {"url", "quality", "item", "format", "clip"}},
+	}
+
+	m.vrddtVideos = &memoryCollection{
+		name:       memoryVrddtVideosCollectionName,
+		uniqueKeys: [][]string{{"_id"}, {"md5", "rendition", "format", "clip"}},
+	}
+}
+
+// decodeDocument will decode a stored document into the given struct
+func decodeDocument(document bson.M, out interface{}) (err error) {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return
+	}
+
+	return bson.Unmarshal(data, out)
+}
+
+// encodeDocument will encode a struct in to its BSON document form
+func encodeDocument(in interface{}) (document bson.M, err error) {
+	data, err := bson.Marshal(in)
+	if err != nil {
+		return
+	}
+
+	document = bson.M{}
+	err = bson.Unmarshal(data, &document)
+
+	return
+}
+
+// matchDocument will check that every key in the selector equals the value
+// in the document where a nil value in the selector matches a missing key
+func matchDocument(document bson.M, selector bson.M) bool {
+	for key, value := range selector {
+		documentValue, ok := document[key]
+		if !ok {
+			if value == nil {
+				continue
+			}
+			return false
+		}
+
+		if !reflect.DeepEqual(documentValue, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchUniqueKeys will check that the document has the same values for all of
+// the keys of a (compound) unique key where an absent key only matches an
+// absent key
+func matchUniqueKeys(document bson.M, keys []string, values bson.M) bool {
+	for _, key := range keys {
+		documentValue, documentOK := document[key]
+		value, ok := values[key]
+		if documentOK != ok || !reflect.DeepEqual(documentValue, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalizeSelector will round trip the selector through BSON so the values
+// in it are of the same types as the values of stored documents
+func normalizeSelector(selector Selector) (normalizedSelector bson.M, err error) {
+	normalizedSelector, err = encodeDocument(map[string]interface{}(selector))
+	if err != nil {
+		return nil, errors.InvalidValue("selector", err.Error())
+	}
+
+	return
+}
@@ -0,0 +1,221 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/store"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestMemory_Jobs(t *testing.T) {
+	ctx := context.Background()
+	str := newMemory(t, 0)
+
+	job := domain.NewJob()
+	job.RedditURL = "https://www.reddit.com/r/mindblowing/comments/9z4buv/vortex_coin_bank/"
+	if err := str.CreateJob(ctx, job); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	job.Status = domain.JobStatusDone
+	job.VrddtVideoID = domain.NewVrddtVideo().ID
+	if err := str.UpdateJob(ctx, job); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	found, err := str.GetJob(ctx, store.Selector{"_id": job.ID})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if found.Status != domain.JobStatusDone || found.VrddtVideoID != job.VrddtVideoID {
+		t.Errorf("expecting the updated job, got %#v", found)
+	}
+
+	if err = str.UpdateJob(ctx, domain.NewJob()); errors.Type(err) != errors.TypeResourceNotFound {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceNotFound, errors.Type(err))
+	}
+}
+
+func TestMemory_Selectors(suite *testing.T) {
+	suite.Parallel()
+
+	ctx := context.Background()
+	str := newMemory(suite, 0)
+
+	vrddtVideo := domain.NewVrddtVideo()
+	vrddtVideo.MD5 = []byte("h5K3pevUsf64fkbEr1CPVQ==")
+	vrddtVideo.URL = "file:///tmp/vrddt/video.mp4"
+	if err := str.CreateVrddtVideo(ctx, vrddtVideo); err != nil {
+		suite.Fatalf("unexpected error: %s", err)
+	}
+
+	redditVideo := domain.NewRedditVideo()
+	redditVideo.AudioURL = "https://v.redd.it/jw25r2kdgpz11/audio"
+	redditVideo.URL = "https://www.reddit.com/r/mindblowing/comments/9z4buv/vortex_coin_bank/"
+	redditVideo.VideoURL = "https://v.redd.it/jw25r2kdgpz11/DASH_2_4_M"
+	redditVideo.VrddtVideoID = vrddtVideo.ID
+	if err := str.CreateRedditVideo(ctx, redditVideo); err != nil {
+		suite.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		selector store.Selector
+		found    bool
+	}{
+		{selector: store.Selector{"_id": redditVideo.ID}, found: true},
+		{selector: store.Selector{"url": redditVideo.URL}, found: true},
+		{selector: store.Selector{"url": redditVideo.URL + "foo"}, found: false},
+		{selector: store.Selector{"audio_url": redditVideo.AudioURL, "video_url": redditVideo.VideoURL}, found: true},
+		{selector: store.Selector{"audio_url": redditVideo.AudioURL, "video_url": "foo"}, found: false},
+		{selector: store.Selector{"vrddt_video_id": vrddtVideo.ID}, found: true},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			found, err := str.GetRedditVideo(ctx, cs.selector)
+			if !cs.found {
+				if actualType := errors.Type(err); actualType != errors.TypeResourceNotFound {
+					t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceNotFound, actualType)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if found.ID != redditVideo.ID {
+				t.Errorf("expecting ID '%s', got '%s'", redditVideo.ID.Hex(), found.ID.Hex())
+			}
+		})
+	}
+
+	found, err := str.GetVrddtVideo(ctx, store.Selector{"md5": vrddtVideo.MD5})
+	if err != nil {
+		suite.Fatalf("unexpected error: %s", err)
+	}
+	if found.URL != vrddtVideo.URL {
+		suite.Errorf("expecting URL '%s', got '%s'", vrddtVideo.URL, found.URL)
+	}
+}
+
+func TestMemory_UniqueAndLimits(t *testing.T) {
+	ctx := context.Background()
+	str := newMemory(t, 3)
+
+	for i := 0; i < 3; i++ {
+		vrddtVideo := domain.NewVrddtVideo()
+		vrddtVideo.MD5 = []byte(fmt.Sprintf("md5-%d", i))
+		if err := str.CreateVrddtVideo(ctx, vrddtVideo); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	vrddtVideos, err := str.GetVrddtVideos(ctx, store.Selector{}, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(vrddtVideos) != 2 {
+		t.Errorf("expecting 2 vrddt videos, got %d", len(vrddtVideos))
+	}
+
+	duplicate := domain.NewVrddtVideo()
+	duplicate.MD5 = []byte("md5-0")
+	if err = str.DeleteVrddtVideos(ctx, store.Selector{"md5": []byte("md5-2")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = str.CreateVrddtVideo(ctx, duplicate); errors.Type(err) != errors.TypeResourceConflict {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceConflict, errors.Type(err))
+	}
+
+	duplicate.MD5 = []byte("md5-3")
+	if err = str.CreateVrddtVideo(ctx, duplicate); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	overflow := domain.NewVrddtVideo()
+	overflow.MD5 = []byte("md5-4")
+	if err = str.CreateVrddtVideo(ctx, overflow); errors.Type(err) != errors.TypeResourceLimit {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceLimit, errors.Type(err))
+	}
+}
+
+func TestMemory_CompoundUniqueKeys(t *testing.T) {
+	ctx := context.Background()
+	str := newMemory(t, 0)
+
+	redditURL := "https://www.reddit.com/r/test/comments/abc/test/"
+	for _, quality := range []domain.Quality{domain.QualityBest, "720p"} {
+		redditVideo := domain.NewRedditVideo()
+		redditVideo.Quality = quality
+		redditVideo.URL = redditURL
+		if err := str.CreateRedditVideo(ctx, redditVideo); err != nil {
+			t.Fatalf("unexpected error for %s quality: %s", quality, err)
+		}
+	}
+
+	duplicateRedditVideo := domain.NewRedditVideo()
+	duplicateRedditVideo.Quality = "720p"
+	duplicateRedditVideo.URL = redditURL
+	if err := str.CreateRedditVideo(ctx, duplicateRedditVideo); errors.Type(err) != errors.TypeResourceConflict {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeResourceConflict, errors.Type(err))
+	}
+
+	gifRedditVideo := domain.NewRedditVideo()
+	gifRedditVideo.Format = domain.FormatGIF
+	gifRedditVideo.Quality = "720p"
+	gifRedditVideo.URL = redditURL
+	if err := str.CreateRedditVideo(ctx, gifRedditVideo); err != nil {
+		t.Fatalf("unexpected error for the %s format: %s", domain.FormatGIF, err)
+	}
+
+	found, err := str.GetRedditVideo(ctx, store.Selector{"quality": domain.Quality("720p"), "url": redditURL})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if found.Quality != "720p" {
+		t.Errorf("expecting quality '720p', got '%s'", found.Quality)
+	}
+
+	for _, rendition := range []string{"", "480p", "720p"} {
+		vrddtVideo := domain.NewVrddtVideo()
+		vrddtVideo.MD5 = []byte("md5")
+		vrddtVideo.Rendition = rendition
+		if err = str.CreateVrddtVideo(ctx, vrddtVideo); err != nil {
+			t.Fatalf("unexpected error for rendition '%s': %s", rendition, err)
+		}
+	}
+
+	for _, rendition := range []string{"", "720p"} {
+		duplicateVrddtVideo := domain.NewVrddtVideo()
+		duplicateVrddtVideo.MD5 = []byte("md5")
+		duplicateVrddtVideo.Rendition = rendition
+		if err = str.CreateVrddtVideo(ctx, duplicateVrddtVideo); errors.Type(err) != errors.TypeResourceConflict {
+			t.Errorf("expecting error type '%s' for rendition '%s', got '%s'", errors.TypeResourceConflict, rendition, errors.Type(err))
+		}
+	}
+}
+
+func newMemory(t *testing.T, maxSize int) store.Store {
+	str, err := store.Memory(
+		&config.StoreMemoryConfig{
+			MaxSize: maxSize,
+		},
+		logger.New(ioutil.Discard, "error", "text"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = str.Init(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return str
+}
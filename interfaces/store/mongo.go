@@ -15,9 +15,42 @@ import (
 
 // TODO: Add logging
 
+const (
+	// mongoNamespaceNotFound is the code of the error from Mongo when a
+	// collection does not exist
+	mongoNamespaceNotFound = 26
+)
+
+var (
+	// LegacyRedditVideoIndexes are the names of the unique indexes older
+	// versions put on the Reddit videos, by only their URL and then by fewer
+	// of the fields they are now unique by
+	LegacyRedditVideoIndexes = []string{
+		"reddit_url_1",
+		"url_1",
+		"url_1_quality_1",
+		"url_1_quality_1_item_1",
+		"url_1_quality_1_item_1_format_1",
+	}
+
+	// LegacyVrddtVideoIndexes are the names of the unique indexes older
+	// versions put on the vrddt videos, by only their MD5 and then by fewer of
+	// the fields they are now unique by
+	LegacyVrddtVideoIndexes = []string{
+		"md5_1",
+		"md5_1_rendition_1",
+		"md5_1_rendition_1_format_1",
+	}
+
+	// VrddtVideoSearchKeys are the fields probed from vrddt videos which are
+	// indexed so that the vrddt videos can be searched by them
+	VrddtVideoSearchKeys = []string{"audio_codec", "content_type", "duration", "has_audio", "height", "video_codec", "width"}
+)
+
 // mongoSession contains all the information about a Mongo session
 type mongoSession struct {
 	database                   string
+	jobsCollectionName         string
 	log                        logger.Logger
 	redditVideosCollectionName string
 	session                    *mgo.Session
@@ -31,6 +64,7 @@ func Mongo(cfg *config.StoreMongoConfig, loggerHandle logger.Logger) (store Stor
 	loggerHandle.Debugf("Mongo(cfg): %#v", cfg)
 
 	store = &mongoSession{
+		jobsCollectionName:         cfg.JobsCollectionName,
 		log:                        loggerHandle,
 		redditVideosCollectionName: cfg.RedditVideosCollectionName,
 		timeout:                    cfg.Timeout,
@@ -54,6 +88,16 @@ func (m *mongoSession) Cleanup(ctx context.Context) (err error) {
 	return
 }
 
+// CreateJob will add a job to the jobs collection
+func (m *mongoSession) CreateJob(ctx context.Context, job *domain.Job) (err error) {
+	jobsCollection, err := m.jobsCollection()
+	if err != nil {
+		return
+	}
+
+	return jobsCollection.Insert(job)
+}
+
 // CreateRedditVideo will add a RedditVideo to the Reddit videos collection
 func (m *mongoSession) CreateRedditVideo(ctx context.Context, redditVideo *domain.RedditVideo) (err error) {
 	redditVideosCollection, err := m.redditVideosCollection()
@@ -106,6 +150,25 @@ func (m *mongoSession) DeleteVrddtVideos(ctx context.Context, selector Selector)
 	return vrddtVideosCollection.Remove(selector)
 }
 
+// GetJob will return a job from the database if the passed in selector is
+// found
+func (m *mongoSession) GetJob(ctx context.Context, selector Selector) (job *domain.Job, err error) {
+	jobsCollection, err := m.jobsCollection()
+	if err != nil {
+		return
+	}
+
+	job = &domain.Job{}
+
+	err = jobsCollection.Find(selector).One(job)
+	// Turn error into a ResourceNotFound error type
+	if err == mgo.ErrNotFound {
+		return nil, errors.ResourceNotFound("Job", fmt.Sprintf("%#v", selector))
+	}
+
+	return
+}
+
 // GetRedditVideo will return a Reddit video from the database if the passed in
 // key / value pair are found
 func (m *mongoSession) GetRedditVideo(ctx context.Context, selector Selector) (redditVideo *domain.RedditVideo, err error) {
@@ -194,37 +257,140 @@ func (m *mongoSession) Init(ctx context.Context) (err error) {
 	m.session.SetMode(mgo.Monotonic, true)
 	m.session.SetSafe(&mgo.Safe{})
 
+	return m.ensureIndexes()
+}
+
+// UpdateJob will replace the job in the jobs collection with the same ID
+func (m *mongoSession) UpdateJob(ctx context.Context, job *domain.Job) (err error) {
+	jobsCollection, err := m.jobsCollection()
+	if err != nil {
+		return
+	}
+
+	err = jobsCollection.UpdateId(job.ID, job)
+	// Turn error into a ResourceNotFound error type
+	if err == mgo.ErrNotFound {
+		return errors.ResourceNotFound("Job", job.ID.Hex())
+	}
+
 	return
 }
 
-// redditVideosCollection returns the collection of Reddit videos previously processed
-func (m *mongoSession) redditVideosCollection() (redditVideosCollection *mgo.Collection, err error) {
-	redditVideosCollection = m.session.DB(m.database).C(m.redditVideosCollectionName)
+// dropLegacyIndexes will drop the unique indexes which older versions put on
+// the collection (e.g. the unique index of vrddt videos by only their MD5)
+// and which would otherwise stop what is now allowed from being stored. Only
+// the indexes named are dropped so that any other index is left alone.
+func (m *mongoSession) dropLegacyIndexes(collection *mgo.Collection, names []string) (err error) {
+	// A collection which does not exist yet has no indexes to drop
+	indexes, err := collection.Indexes()
+	if queryErr, ok := err.(*mgo.QueryError); ok && queryErr.Code == mongoNamespaceNotFound {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+
+	for _, index := range indexes {
+		for _, name := range names {
+			if index.Name != name {
+				continue
+			}
+
+			m.log.Infof("Dropping the older unique index '%s' of the '%s' collection", index.Name, collection.Name)
+			if err = collection.DropIndexName(index.Name); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// ensureIndexes will set up the indexes of the collections once, dropping
+// those left by older versions, where a Reddit video is unique by its URL,
+// its quality, which media item of the post it is and the format and clip it
+// was made in, and a vrddt video is unique by its MD5, its rendition, its
+// format and its clip and can be searched by what was probed from it
+func (m *mongoSession) ensureIndexes() (err error) {
+	redditVideosCollection, err := m.redditVideosCollection()
+	if err != nil {
+		return
+	}
+
+	if err = m.dropLegacyIndexes(redditVideosCollection, LegacyRedditVideoIndexes); err != nil {
+		return
+	}
+
 	err = redditVideosCollection.EnsureIndex(
 		mgo.Index{
-			Key:        []string{"reddit_url"},
+			Key:        []string{"url", "quality", "item", "format", "clip"},
 			Unique:     true,
 			DropDups:   true,
 			Background: true,
 			Sparse:     true,
 		},
 	)
+	if err != nil {
+		return
+	}
 
-	return
-}
+	vrddtVideosCollection, err := m.vrddtVideosCollection()
+	if err != nil {
+		return
+	}
+
+	if err = m.dropLegacyIndexes(vrddtVideosCollection, LegacyVrddtVideoIndexes); err != nil {
+		return
+	}
 
-// vrddtVideosCollection returns the collection of vrddt videos previously processed
-func (m *mongoSession) vrddtVideosCollection() (vrddtVideosCollection *mgo.Collection, err error) {
-	vrddtVideosCollection = m.session.DB(m.database).C(m.vrddtVideosCollectionName)
 	err = vrddtVideosCollection.EnsureIndex(
 		mgo.Index{
-			Key:        []string{"md5"},
+			Key:        []string{"md5", "rendition", "format", "clip"},
 			Unique:     true,
 			DropDups:   true,
 			Background: true,
 			Sparse:     true,
 		},
 	)
+	if err != nil {
+		return
+	}
+
+	for _, key := range VrddtVideoSearchKeys {
+		err = vrddtVideosCollection.EnsureIndex(
+			mgo.Index{
+				Key:        []string{key},
+				Background: true,
+				Sparse:     true,
+			},
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// jobsCollection returns the collection of jobs which have been requested
+func (m *mongoSession) jobsCollection() (jobsCollection *mgo.Collection, err error) {
+	jobsCollection = m.session.DB(m.database).C(m.jobsCollectionName)
+
+	return
+}
+
+// redditVideosCollection returns the collection of Reddit videos previously
+// processed
+func (m *mongoSession) redditVideosCollection() (redditVideosCollection *mgo.Collection, err error) {
+	redditVideosCollection = m.session.DB(m.database).C(m.redditVideosCollectionName)
+
+	return
+}
+
+// vrddtVideosCollection returns the collection of vrddt videos previously
+// processed
+func (m *mongoSession) vrddtVideosCollection() (vrddtVideosCollection *mgo.Collection, err error) {
+	vrddtVideosCollection = m.session.DB(m.database).C(m.vrddtVideosCollectionName)
 
 	return
 }
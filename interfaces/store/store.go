@@ -13,6 +13,10 @@ type Selector map[string]interface{}
 type Store interface {
 	Cleanup(ctx context.Context) (err error)
 
+	CreateJob(ctx context.Context, job *domain.Job) (err error)
+	GetJob(ctx context.Context, selector Selector) (job *domain.Job, err error)
+	UpdateJob(ctx context.Context, job *domain.Job) (err error)
+
 	CreateRedditVideo(ctx context.Context, redditVideo *domain.RedditVideo) (err error)
 	DeleteRedditVideo(ctx context.Context, selector Selector) (err error)
 	DeleteRedditVideos(ctx context.Context, selector Selector) (err error)
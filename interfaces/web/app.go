@@ -17,9 +17,11 @@ import (
 type URL struct {
 	logger.Logger
 
-	RedditURL   string
-	VrddtAPIURI string
-	VrddtURL    string
+	JobID        string
+	RedditURL    string
+	ThumbnailURL string
+	VrddtAPIURI  string
+	VrddtURL     string
 }
 
 type app struct {
@@ -65,6 +67,25 @@ func (app app) uriHandler(wr http.ResponseWriter, req *http.Request) {
 		}
 		defer resp.Body.Close()
 
+		// A Reddit URL which has not been processed yet is queued as a job
+		// which the page follows until the vrddt video is ready
+		if resp.StatusCode == http.StatusAccepted {
+			job := domain.NewJob()
+			if err = json.NewDecoder(resp.Body).Decode(&job); err != nil {
+				app.Fatalf("An error was encountered: %s", err)
+				return
+			}
+
+			app.Infof("Job '%s' queued for Reddit URL: %s", job.ID.Hex(), url)
+
+			app.render(wr, "index.tpl", URL{
+				JobID:       job.ID.Hex(),
+				RedditURL:   url,
+				VrddtAPIURI: app.vrddtAPIURI,
+			})
+			return
+		}
+
 		vrddtVideo := domain.NewVrddtVideo()
 		if err = json.NewDecoder(resp.Body).Decode(&vrddtVideo); err != nil {
 			app.Fatalf("An error was encountered: %s", err)
@@ -72,9 +93,10 @@ func (app app) uriHandler(wr http.ResponseWriter, req *http.Request) {
 		}
 
 		urls := URL{
-			RedditURL:   url,
-			VrddtURL:    vrddtVideo.URL,
-			VrddtAPIURI: app.vrddtAPIURI,
+			RedditURL:    url,
+			ThumbnailURL: vrddtVideo.ThumbnailURL,
+			VrddtURL:     vrddtVideo.URL,
+			VrddtAPIURI:  app.vrddtAPIURI,
 		}
 
 		app.Infof("vrddt video URL: %s", urls.VrddtURL)
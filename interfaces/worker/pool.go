@@ -0,0 +1,226 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+const (
+	// DefaultMaxErrors is the number of errors a pool tolerates before it
+	// stops asking for work when it is not configured
+	DefaultMaxErrors = 10
+
+	// DefaultSleep is the number of milliseconds a worker in a pool sleeps
+	// after an error when it is not configured
+	DefaultSleep = 500
+)
+
+// Pool runs a goroutine for each of its workers which keep getting work and
+// performing it until the pool is stopped or too many errors have happened
+type Pool struct {
+	errors       int
+	graceTimeout time.Duration
+	log          logger.Logger
+	maxErrors    int
+	mutex        sync.Mutex
+	sleep        time.Duration
+	stop         context.CancelFunc
+	successes    int
+	workers      []Worker
+}
+
+// NewPool will return a pool for the workers which have already been
+// initialized
+func NewPool(cfg *config.WorkerProcessorConfig, loggerHandle logger.Logger, workers []Worker) (pool *Pool) {
+	pool = &Pool{
+		graceTimeout: time.Duration(cfg.GraceTimeout) * time.Second,
+		log:          loggerHandle,
+		maxErrors:    cfg.MaxErrors,
+		sleep:        time.Duration(cfg.Sleep) * time.Millisecond,
+		workers:      workers,
+	}
+
+	if pool.maxErrors <= 0 {
+		pool.maxErrors = DefaultMaxErrors
+	}
+	if pool.sleep <= 0 {
+		pool.sleep = DefaultSleep * time.Millisecond
+	}
+
+	return
+}
+
+// Counts returns the number of pieces of work which succeeded and failed
+func (p *Pool) Counts() (successes int, failures int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.successes, p.errors
+}
+
+// Run blocks while the workers get work and perform it. Cancelling pool
+// stops the workers from asking for more work and work which has already
+// started is then given the grace timeout to finish. Cancelling jobs (or the
+// grace timeout passing) abandons the work which has already started and
+// puts it back on to the queue, after which Run still waits for the workers
+// to stop so that nothing they use is cleaned up from under them.
+func (p *Pool) Run(pool context.Context, jobs context.Context) {
+	pool, stopPool := context.WithCancel(pool)
+	defer stopPool()
+
+	jobs, stopJobs := context.WithCancel(jobs)
+	defer stopJobs()
+
+	p.mutex.Lock()
+	p.stop = stopPool
+	p.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for id, w := range p.workers {
+		wg.Add(1)
+		go func(id int, w Worker) {
+			defer wg.Done()
+			p.loop(pool, jobs, id, w)
+		}(id, w)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return
+	case <-pool.Done():
+	}
+
+	p.log.Infof("Waiting up to %s for work already started to finish", p.graceTimeout)
+
+	select {
+	case <-finished:
+		return
+	case <-time.After(p.graceTimeout):
+		p.log.Warnf("Grace timeout of %s passed before all work finished", p.graceTimeout)
+	case <-jobs.Done():
+		p.log.Warnf("Not waiting for work already started to finish")
+	}
+
+	stopJobs()
+	p.release()
+	<-finished
+}
+
+// failure records an error stopping the pool if there have been too many
+func (p *Pool) failure(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err == domain.ErrJSONTitle || err == domain.ErrJSONVideoURL || err == domain.ErrNotDASH {
+		p.log.Warnf("Warning while processing media: %s", err)
+		return
+	}
+
+	p.errors++
+	p.log.Warnf("Error (#%d of %d allowed) while processing media: %s", p.errors, p.maxErrors, err)
+
+	// We have exceeded the max-error count so stop asking for work
+	if p.errors >= p.maxErrors {
+		p.log.Errorf("Maximum errors (#%d) while processing videos", p.errors)
+		p.stop()
+	}
+}
+
+// job will perform and complete a single element of work failing it if it
+// could not be performed
+func (p *Pool) job(ctx context.Context, id int, w Worker) (err error) {
+	p.log.Infof("Worker (%d) performing work", id)
+
+	if err = w.DoWork(ctx); err != nil {
+		p.log.Errorf("Worker (%d) unable to perform work: %s", id, err)
+		if failErr := w.FailWork(ctx, err); failErr != nil {
+			p.log.Errorf("Worker (%d) unable to reject work: %s", id, failErr)
+		}
+		return
+	}
+
+	if err = w.CompleteWork(ctx); err != nil {
+		p.log.Errorf("Worker (%d) unable to complete work: %s", id, err)
+		return
+	}
+	p.log.Infof("Worker (%d) completed work", id)
+
+	return
+}
+
+// loop will keep getting work and performing it with a single worker until
+// the pool is stopped
+func (p *Pool) loop(pool context.Context, jobs context.Context, id int, w Worker) {
+	for pool.Err() == nil {
+		if err := w.GetWork(pool); err != nil {
+			if errors.Type(err) == errors.TypeConnectionClosed || errors.Type(err) == errors.TypeCancelled {
+				// The queue will never hand us more work so there is no
+				// reason to keep looping
+				p.log.Warnf("Worker (%d) stopped waiting for work: %s", id, err)
+				return
+			}
+
+			p.log.Errorf("Worker (%d) error getting element of work: %s", id, err)
+			p.failure(err)
+			p.pause(pool)
+			continue
+		}
+
+		// The job gets its own context which is not tied to the pool so that
+		// work which has already started is allowed to finish
+		job, finishJob := context.WithCancel(jobs)
+		err := p.job(job, id, w)
+		finishJob()
+
+		if err != nil {
+			p.failure(err)
+			p.pause(pool)
+			continue
+		}
+		p.success()
+	}
+}
+
+// pause will take a break after an error unless the pool is stopped first
+func (p *Pool) pause(pool context.Context) {
+	select {
+	case <-pool.Done():
+	case <-time.After(p.sleep):
+	}
+}
+
+// release will put any work the workers have not finished back on to the
+// queue
+func (p *Pool) release() {
+	// The jobs have been abandoned so the queue may be the only thing left
+	// which can be waited on
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for id, w := range p.workers {
+		if err := w.ReleaseWork(ctx); err != nil && errors.Type(err) != errors.TypeMissingField {
+			p.log.Errorf("Worker (%d) unable to release unfinished work: %s", id, err)
+		}
+	}
+}
+
+// success records work which was completed
+func (p *Pool) success() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.successes++
+	p.log.Infof("Success (#%d)", p.successes)
+}
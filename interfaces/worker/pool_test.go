@@ -0,0 +1,136 @@
+package worker_test
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/worker"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestPool_Run(t *testing.T) {
+	w := &fakeWorker{work: 3}
+	pool := worker.NewPool(&config.WorkerProcessorConfig{}, logger.New(ioutil.Discard, "error", "text"), []worker.Worker{w})
+
+	// The worker stops once it runs out of work
+	pool.Run(context.Background(), context.Background())
+
+	if successes, failures := pool.Counts(); successes != 3 || failures != 0 {
+		t.Errorf("expecting 3 successes and 0 errors, got %d and %d", successes, failures)
+	}
+}
+
+func TestPool_RunMaxErrors(t *testing.T) {
+	w := &fakeWorker{cause: errors.ConnectionFailure("reddit", "down"), work: 100}
+	pool := worker.NewPool(
+		&config.WorkerProcessorConfig{MaxErrors: 3, Sleep: 1},
+		logger.New(ioutil.Discard, "error", "text"),
+		[]worker.Worker{w},
+	)
+
+	done := make(chan struct{})
+	go func() {
+		pool.Run(context.Background(), context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expecting the pool to stop after too many errors")
+	}
+
+	if _, failures := pool.Counts(); failures != 3 {
+		t.Errorf("expecting 3 errors, got %d", failures)
+	}
+	if w.failed != 3 {
+		t.Errorf("expecting 3 pieces of work to be failed, got %d", w.failed)
+	}
+}
+
+func TestPool_RunReleasesUnfinishedWork(t *testing.T) {
+	w := &fakeWorker{block: true, started: make(chan struct{}), work: 1}
+	pool := worker.NewPool(&config.WorkerProcessorConfig{}, logger.New(ioutil.Discard, "error", "text"), []worker.Worker{w})
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Run(ctx, context.Background())
+		close(done)
+	}()
+
+	<-w.started
+	stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expecting the pool to stop once the grace timeout passed")
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.released != 1 {
+		t.Errorf("expecting unfinished work to be released, got %d releases", w.released)
+	}
+	// The pool waits for the worker to give up on the work before it stops
+	if w.failed != 1 {
+		t.Errorf("expecting the abandoned work to be failed by the worker before the pool stopped, got %d", w.failed)
+	}
+}
+
+// fakeWorker hands out a number of pieces of work which either succeed, fail
+// with the cause, or block until they are abandoned
+type fakeWorker struct {
+	block    bool
+	cause    error
+	failed   int
+	mutex    sync.Mutex
+	released int
+	started  chan struct{}
+	work     int
+}
+
+func (w *fakeWorker) CompleteWork(ctx context.Context) error { return nil }
+
+func (w *fakeWorker) DoWork(ctx context.Context) error {
+	if w.block {
+		close(w.started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return w.cause
+}
+
+func (w *fakeWorker) FailWork(ctx context.Context, cause error) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.failed++
+	return nil
+}
+
+func (w *fakeWorker) GetWork(ctx context.Context) error {
+	if w.work == 0 {
+		return errors.ConnectionClosed("queue", "No more work")
+	}
+	w.work--
+
+	return nil
+}
+
+func (w *fakeWorker) Init(ctx context.Context) error { return nil }
+
+func (w *fakeWorker) ReleaseWork(ctx context.Context) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.released++
+	return nil
+}
@@ -2,43 +2,130 @@ package worker
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/johnwyles/vrddt-droplets/domain"
 	"github.com/johnwyles/vrddt-droplets/interfaces/config"
 	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/interfaces/pubsub"
 	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
 	"github.com/johnwyles/vrddt-droplets/interfaces/storage"
 	"github.com/johnwyles/vrddt-droplets/interfaces/store"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"github.com/johnwyles/vrddt-droplets/pkg/logger"
 )
 
+const (
+	// DefaultMaxAttempts is the number of times work is attempted when it
+	// is not configured
+	DefaultMaxAttempts = 3
+
+	// DefaultRetryBackoff is the number of milliseconds to wait before the
+	// first retry when it is not configured
+	DefaultRetryBackoff = 1000
+
+	// DefaultRetryMaxBackoff is the most number of milliseconds to wait
+	// before a retry when it is not configured
+	DefaultRetryMaxBackoff = 60000
+)
+
+var (
+	// DefaultRetryableErrors are the error types which are retried when
+	// they are not configured. Unknown errors are included because failed
+	// downloads and conversions are not yet typed.
+	DefaultRetryableErrors = []string{
+		errors.TypeConnectionFailure,
+		errors.TypeConnectionTimeout,
+		errors.TypeUnknown,
+	}
+)
+
 // converter holds all of the information about the worker for converting
 // videos from a queue saving storage and any information to a persistence
 // store
 type processor struct {
-	converter converter.Converter
-	queue     queue.Queue
-	log       logger.Logger
-	store     store.Store
-	storage   storage.Storage
-	work      interface{}
+	converter       converter.Converter
+	delivery        queue.Delivery
+	envelope        *queue.Envelope
+	maxAttempts     int
+	mutex           sync.Mutex
+	pubsub          pubsub.PubSub
+	queue           queue.Queue
+	log             logger.Logger
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+	retryableErrors map[string]bool
+	spriteFrames    int
+	store           store.Store
+	storage         storage.Storage
+	thumbnailFormat string
+	thumbnailOffset time.Duration
+	work            interface{}
+	workErr         error
 }
 
-// Processor will take a converter, queue, storage system, and persistence
-// store to provide an initial struct
-func Processor(cfg *config.WorkerProcessorConfig, loggerHandle logger.Logger, c converter.Converter, q queue.Queue, str store.Store, stg storage.Storage) (worker Worker, err error) {
+// Processor will take a converter, pub/sub (which may be nil if nothing is
+// interested in the progress of the work), queue, storage system, and
+// persistence store to provide an initial struct
+func Processor(cfg *config.WorkerProcessorConfig, loggerHandle logger.Logger, c converter.Converter, ps pubsub.PubSub, q queue.Queue, str store.Store, stg storage.Storage) (worker Worker, err error) {
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	retryBackoff := cfg.RetryBackoff
+	if retryBackoff <= 0 {
+		retryBackoff = DefaultRetryBackoff
+	}
+
+	retryMaxBackoff := cfg.RetryMaxBackoff
+	if retryMaxBackoff <= 0 {
+		retryMaxBackoff = DefaultRetryMaxBackoff
+	}
+
+	retryableErrors := map[string]bool{}
+	for _, errorType := range strings.Split(cfg.RetryableErrors, ",") {
+		if errorType = strings.TrimSpace(errorType); errorType != "" {
+			retryableErrors[errorType] = true
+		}
+	}
+	if len(retryableErrors) == 0 {
+		for _, errorType := range DefaultRetryableErrors {
+			retryableErrors[errorType] = true
+		}
+	}
+
+	thumbnailFormat := cfg.ThumbnailFormat
+	switch thumbnailFormat {
+	case "":
+		thumbnailFormat = converter.ImageJPEG
+	case converter.ImageJPEG, converter.ImageWebP:
+	default:
+		return nil, errors.InvalidValue("ThumbnailFormat", fmt.Sprintf("Unknown thumbnail format '%s' (must be one of: %s, %s)", thumbnailFormat, converter.ImageJPEG, converter.ImageWebP))
+	}
+
 	worker = &processor{
-		converter: c,
-		queue:     q,
-		log:       loggerHandle,
-		storage:   stg,
-		store:     str,
-		work:      nil,
+		converter:       c,
+		maxAttempts:     maxAttempts,
+		pubsub:          ps,
+		queue:           q,
+		log:             loggerHandle,
+		retryBackoff:    time.Duration(retryBackoff) * time.Millisecond,
+		retryMaxBackoff: time.Duration(retryMaxBackoff) * time.Millisecond,
+		retryableErrors: retryableErrors,
+		spriteFrames:    cfg.SpriteFrames,
+		storage:         stg,
+		store:           str,
+		thumbnailFormat: thumbnailFormat,
+		thumbnailOffset: time.Duration(cfg.ThumbnailOffset) * time.Millisecond,
+		work:            nil,
 	}
 
 	loggerHandle.Debugf("Worker > Processor(cfg): %#v", worker)
@@ -46,53 +133,127 @@ func Processor(cfg *config.WorkerProcessorConfig, loggerHandle logger.Logger, c
 	return
 }
 
-// SaveWork will complete the work
+// CompleteWork will acknowledge the work so that it is removed from the queue
 func (p *processor) CompleteWork(ctx context.Context) (err error) {
+	delivery := p.takeDelivery()
+	p.envelope = nil
 	p.work = nil
-	return
+	if delivery == nil {
+		return errors.MissingField("delivery")
+	}
+
+	return delivery.Ack(ctx)
 }
 
 // DoWork will perform the work
 func (p *processor) DoWork(ctx context.Context) (err error) {
 	if p.work == nil {
+		if p.workErr != nil {
+			return p.workErr
+		}
 		return errors.MissingField("work")
 	}
 
-	// TODO: Implement other video types
-	switch p.work.(type) {
-	case *domain.RedditVideo:
-		p.log.Debugf("Performing work on reddit video: %#v", p.work)
-		return p.doWorkRedditVideo(ctx)
-	case *domain.VrddtVideo:
-		p.log.Debugf("Performing work on vrddt video: %#v", p.work)
-		return errors.NotImplemented("vrddt video", fmt.Sprintf("There is no work that can be performed on a vrddt video: %#v", p.work))
-	case *domain.YoutubeVideo:
-		p.log.Debugf("Performing work on youtube video: %#v", p.work)
-		return errors.NotImplemented("youtube video", fmt.Sprintf("Working on youtube videos has not been implemented yet: %#v", p.work))
+	// The source which supports the URL of the work knows how to resolve
+	// and download it so nothing here depends on where the video is from
+	switch work := p.work.(type) {
+	case *domain.VideoRequest:
+		p.log.Debugf("Performing work on video: %#v", p.work)
+		return p.doWorkSource(ctx, work.JobID, work.URL, work.Quality, work.Format, work.Clip)
 	default:
 		p.log.Debugf("Performing work on unknown type: %#v", p.work)
 		return errors.ResourceUnknown("unknown", fmt.Sprintf("%#v", p.work))
 	}
 }
 
+// FailWork will schedule the work to be retried after a backoff if the cause
+// of the failure is retryable and the work has attempts left, otherwise the
+// work is moved to the dead-letter queue. Work which was only interrupted
+// because it was cancelled (e.g. by a shutdown) is put back on to the queue
+// without counting it as a failed attempt, and work which can not be moved
+// to a full dead-letter queue is retried after a backoff instead.
+func (p *processor) FailWork(ctx context.Context, cause error) (err error) {
+	delivery := p.takeDelivery()
+	envelope := p.envelope
+	work := p.work
+	p.envelope = nil
+	p.work = nil
+	if delivery == nil {
+		return errors.MissingField("delivery")
+	}
+
+	var jobID bson.ObjectId
+	videoRequest, _ := work.(*domain.VideoRequest)
+	if videoRequest != nil {
+		jobID = videoRequest.JobID
+	}
+
+	// Attempts made before the envelope was pushed count as well
+	attempts := delivery.Attempts()
+	if envelope != nil {
+		attempts += envelope.Attempts
+	}
+
+	var reason string
+	switch {
+	case work == nil:
+		p.log.Warnf("Dead-lettering work which could not be decoded: %s", cause)
+		reason = fmt.Sprintf("undecodable: %s", cause)
+	case ctx.Err() != nil || errors.Type(cause) == errors.TypeCancelled:
+		p.log.Infof("Releasing cancelled work back on to the queue: %s", cause)
+		p.updateJob(ctx, jobID, domain.JobStatusQueued, nil, nil)
+		return delivery.Nack(ctx, true)
+	case !p.retryable(cause):
+		p.log.Warnf("Dead-lettering work after a permanent error: %s", cause)
+		reason = fmt.Sprintf("permanent: %s", cause)
+	case attempts >= p.maxAttempts:
+		p.log.Warnf("Dead-lettering work after %d attempts: %s", attempts, cause)
+		reason = fmt.Sprintf("exhausted %d attempts: %s", attempts, cause)
+	default:
+		delay := p.backoff(attempts)
+		p.log.Infof("Retrying work (attempt %d of %d) in %s: %s", attempts, p.maxAttempts, delay, cause)
+		p.updateJob(ctx, jobID, domain.JobStatusQueued, nil, nil)
+		return delivery.Retry(ctx, delay)
+	}
+
+	// The work is kept on the queue rather than lost when there is no room
+	// left for it in the dead-letter queue
+	if err = delivery.DeadLetter(ctx, reason); errors.Type(err) == errors.TypeResourceLimit {
+		delay := p.backoff(attempts)
+		p.log.Warnf("Dead-letter queue is full, retrying work in %s: %s", delay, err)
+		p.updateJob(ctx, jobID, domain.JobStatusQueued, nil, nil)
+		return delivery.Retry(ctx, delay)
+	}
+	if err != nil {
+		return
+	}
+
+	if work != nil {
+		p.reportFailed(ctx, jobID, videoRequest, cause)
+	}
+
+	return
+}
+
 // GetWork will return some work to perform
 func (p *processor) GetWork(ctx context.Context) (err error) {
 	// Make sure we are marking ourselves as a consumer of the queue
 	p.queue.MakeConsumer(ctx)
 
 	// Get an element of work from the queue
-	work, err := p.queue.Pop(ctx)
+	delivery, err := p.queue.Pop(ctx)
 	if err != nil {
 		return
 	}
+	p.mutex.Lock()
+	p.delivery = delivery
+	p.mutex.Unlock()
 
-	// See if work is in JSON first
-	if byteWork, ok := work.([]byte); ok {
-		p.unmarshalJSON(byteWork)
-	} else {
-		// TODO: throw an error here or deal with it in DoWork()?
-		p.log.Debugf("Work is not of type []byte (which we expect should be unmarshalled JSON): %#v", work)
-		p.work = &work
+	// Work which can not be decoded is still handed to DoWork() so that it
+	// fails and is moved off of the queue
+	p.envelope, p.work, p.workErr = p.decodeWork(delivery.Body())
+	if p.workErr != nil {
+		p.log.Warnf("Rejecting work popped off of queue: %s", p.workErr)
 	}
 
 	p.log.Debugf("Popped work off of queue: %#v", p.work)
@@ -104,8 +265,23 @@ func (p *processor) Init(ctx context.Context) (err error) {
 	return
 }
 
-// convertVideo will do the ffmpeg bits of converting the video
-func (p *processor) convertVideo(inputVideoFilePath string, inputAudioFilePath string) (temporaryOutputFile *os.File, err error) {
+// ReleaseWork will put work which has not been completed back on to the queue
+// without counting it as a failed attempt. It is safe to call while the work
+// is still being performed in another goroutine in which case completing or
+// failing the work afterwards returns an error.
+func (p *processor) ReleaseWork(ctx context.Context) (err error) {
+	delivery := p.takeDelivery()
+	if delivery == nil {
+		return errors.MissingField("delivery")
+	}
+	p.log.Infof("Releasing unfinished work back on to the queue")
+
+	return delivery.Nack(ctx, true)
+}
+
+// convertVideo will do the ffmpeg bits of converting the video with the
+// options
+func (p *processor) convertVideo(ctx context.Context, inputVideoFilePath string, inputAudioFilePath string, options *converter.ConvertOptions) (temporaryOutputFile *os.File, err error) {
 	// Setup our temporary output file
 	temporaryDirectory, err := ioutil.TempDir(
 		os.TempDir(),
@@ -123,47 +299,163 @@ func (p *processor) convertVideo(inputVideoFilePath string, inputAudioFilePath s
 	}
 
 	// Convert the downloaded files
-	// TODO: Context
-	ctx := context.TODO()
-	if err = p.converter.Convert(ctx, inputVideoFilePath, inputAudioFilePath, temporaryOutputFile.Name()); err != nil {
+	if err = p.converter.Convert(ctx, inputVideoFilePath, inputAudioFilePath, temporaryOutputFile.Name(), options); err != nil {
 		return
 	}
 
 	return
 }
 
-// unmarshalJSON will attempt to unmarshal a byte array into known structs
-// TODO: Convert this to a type-switch?
-func (p *processor) unmarshalJSON(byteWork []byte) (err error) {
-	redditVideo := domain.RedditVideo{}
-	if err := json.Unmarshal(byteWork, &redditVideo); err != nil {
-		p.log.Debugf("Work is not a valid Reddit video: %s", err)
-	} else {
-		p.work = &redditVideo
-		return nil
+// backoff returns how long to wait before the next attempt doubling the
+// configured backoff for every attempt already made
+func (p *processor) backoff(attempts int) (delay time.Duration) {
+	delay = p.retryBackoff
+	for i := 1; i < attempts && delay < p.retryMaxBackoff; i++ {
+		delay *= 2
 	}
 
-	vrddtVideo := domain.VrddtVideo{}
-	if err := json.Unmarshal(byteWork, &vrddtVideo); err != nil {
-		p.log.Debugf("Work is not a valid Vrddt video: %s", err)
-	} else {
-		p.work = &vrddtVideo
-		return nil
+	if delay > p.retryMaxBackoff {
+		delay = p.retryMaxBackoff
 	}
 
-	youtubeVideo := domain.YoutubeVideo{}
-	if err := json.Unmarshal(byteWork, &youtubeVideo); err != nil {
-		p.log.Debugf("Work is not a valid Youtube video: %s", err)
-	} else {
-		p.work = &youtubeVideo
-		return nil
+	return
+}
+
+// decodeWork will decode the envelope in a message popped off of the queue
+// and the work in it depending on what kind of work it is
+func (p *processor) decodeWork(msg interface{}) (envelope *queue.Envelope, work interface{}, err error) {
+	envelope, err = queue.DecodeEnvelope(msg)
+	if err != nil {
+		return
+	}
+
+	switch envelope.Kind {
+	case queue.KindVideoRequest:
+		videoRequest := &domain.VideoRequest{}
+		if err = envelope.Unmarshal(videoRequest); err != nil {
+			return
+		}
+		work = videoRequest
+	// Reddit videos which were queued before video requests are still
+	// worked on as the request for their video
+	case queue.KindRedditVideo:
+		redditVideo := &domain.RedditVideo{}
+		if err = envelope.Unmarshal(redditVideo); err != nil {
+			return
+		}
+		work = redditVideo.VideoRequest()
+	default:
+		err = errors.InvalidValue("envelope.kind", fmt.Sprintf("Unknown kind of work '%s' in envelope '%s'", envelope.Kind, envelope.ID))
+	}
+
+	return
+}
+
+// publish will let any subscribers know about progress made on the work. The
+// work is not affected by whether the event could be published so any failure
+// is only logged.
+func (p *processor) publish(ctx context.Context, jobID bson.ObjectId, event *domain.Event) {
+	if p.pubsub == nil {
+		return
+	}
+
+	event.JobID = jobID
+	if err := p.pubsub.Publish(ctx, event); err != nil {
+		p.log.Warnf("Unable to publish %s event for %s: %s", event.Stage, event.RedditURL, err)
+	}
+}
+
+// reportDone will record the job as done and let any subscribers know which
+// vrddt videos the media items of the Reddit video resulted in
+func (p *processor) reportDone(ctx context.Context, jobID bson.ObjectId, redditVideo *domain.RedditVideo, vrddtVideos []*domain.VrddtVideo) {
+	p.updateJob(ctx, jobID, domain.JobStatusDone, vrddtVideos, nil)
+
+	event := newEvent(redditVideo, domain.EventStageDone)
+	if len(vrddtVideos) > 0 {
+		event.VrddtVideo = vrddtVideos[0]
+	}
+	if len(vrddtVideos) > 1 {
+		event.VrddtVideos = vrddtVideos
+	}
+	p.publish(ctx, jobID, event)
+}
+
+// reportFailed will record the job as failed and let any subscribers know the
+// requested video will not be processed
+func (p *processor) reportFailed(ctx context.Context, jobID bson.ObjectId, videoRequest *domain.VideoRequest, cause error) {
+	p.updateJob(ctx, jobID, domain.JobStatusFailed, nil, cause)
+
+	if videoRequest == nil || videoRequest.URL == "" {
+		return
+	}
+
+	event := domain.NewEvent(videoRequest.URL, domain.EventStageFailed)
+	event.Clip = videoRequest.Clip
+	event.Error = cause.Error()
+	event.Format = videoRequest.Format
+	event.Quality = videoRequest.Quality
+	p.publish(ctx, jobID, event)
+}
+
+// retryable returns whether work which failed with the error is worth
+// attempting again
+func (p *processor) retryable(err error) bool {
+	// The Reddit post itself is the problem so it will never succeed
+	switch err {
+	case domain.ErrJSONTitle, domain.ErrJSONVideoURL, domain.ErrNotDASH:
+		return false
+	}
+
+	return p.retryableErrors[errors.Type(err)]
+}
+
+// takeDelivery returns the delivery for the current work, if there is any,
+// making sure that nothing else can settle it
+func (p *processor) takeDelivery() (delivery queue.Delivery) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delivery = p.delivery
+	p.delivery = nil
+
+	return
+}
+
+// updateJob will record the status of the job the work was requested by, if
+// it was requested by one, along with the vrddt videos or the error it ended
+// with. The work is not affected by whether the job could be updated so any
+// failure is only logged.
+func (p *processor) updateJob(ctx context.Context, jobID bson.ObjectId, status domain.JobStatus, vrddtVideos []*domain.VrddtVideo, cause error) {
+	if jobID == "" {
+		return
+	}
+
+	job, err := p.store.GetJob(ctx, store.Selector{"_id": jobID})
+	if err != nil {
+		p.log.Errorf("Unable to find job '%s' to mark it %s: %s", jobID.Hex(), status, err)
+		return
 	}
 
-	if err := json.Unmarshal(byteWork, &p.work); err != nil {
-		p.work = nil
-		p.log.Errorf("work is not JSON or cannot be unmarshalled correctly: %s", err)
-		return err
+	job.Error = ""
+	if cause != nil {
+		job.Error = cause.Error()
+	}
+	job.Status = status
+	job.UpdatedAt = time.Now()
+	job.VrddtVideoID = ""
+	job.VrddtVideoIDs = nil
+	if len(vrddtVideos) > 0 {
+		job.VrddtVideoID = vrddtVideos[0].ID
+	}
+	if len(vrddtVideos) > 1 {
+		for _, vrddtVideo := range vrddtVideos {
+			job.VrddtVideoIDs = append(job.VrddtVideoIDs, vrddtVideo.ID)
+		}
 	}
 
-	return errors.InvalidValue("work", fmt.Sprintf("Unrecognized work item: %#v", p.work))
+	if err = p.store.UpdateJob(ctx, job); err != nil {
+		p.log.Errorf("Unable to mark job '%s' %s: %s", jobID.Hex(), status, err)
+		return
+	}
+	p.log.Debugf("Job '%s' is now %s", jobID.Hex(), status)
 }
@@ -0,0 +1,318 @@
+package worker_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
+	"github.com/johnwyles/vrddt-droplets/interfaces/storage"
+	"github.com/johnwyles/vrddt-droplets/interfaces/store"
+	"github.com/johnwyles/vrddt-droplets/interfaces/worker"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestProcessor_ReleaseWork(t *testing.T) {
+	ctx := context.Background()
+	q, w := newProcessor(t, nil, nil, nil)
+	defer q.Cleanup(ctx)
+
+	if err := q.Push(ctx, newEnvelope(t, 0, queue.KindVideoRequest, videoRequest)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := w.GetWork(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := w.ReleaseWork(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The work finishing after it was released can no longer settle it
+	if err := w.CompleteWork(ctx); errors.Type(err) != errors.TypeMissingField {
+		t.Errorf("expecting error type '%s', got '%s'", errors.TypeMissingField, errors.Type(err))
+	}
+
+	popCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if _, err := q.Pop(popCtx); err != nil {
+		t.Fatalf("expecting released work back on the queue, got error: %s", err)
+	}
+}
+
+func TestProcessor_FailWork(suite *testing.T) {
+	requested := newEnvelope(suite, 0, queue.KindVideoRequest, videoRequest)
+
+	cases := []struct {
+		attempts   int
+		cause      error
+		deadLetter bool
+		work       []byte
+	}{
+		{attempts: 1, cause: errors.ConnectionTimeout("reddit", 60), deadLetter: false, work: requested},
+		{attempts: 2, cause: errors.ConnectionTimeout("reddit", 60), deadLetter: true, work: requested},
+		{attempts: 1, cause: errors.InvalidValue("url", "not a video"), deadLetter: true, work: requested},
+		{attempts: 1, cause: errors.MissingField("work"), deadLetter: true, work: []byte("garbage")},
+		{attempts: 1, cause: errors.ConnectionTimeout("reddit", 60), deadLetter: true, work: newEnvelope(suite, 1, queue.KindVideoRequest, videoRequest)},
+		// Work interrupted by a shutdown is put back rather than failed
+		{attempts: 1, cause: errors.Cancelled("convert", "context canceled"), deadLetter: false, work: requested},
+		// Reddit videos queued before video requests are still worked on
+		{attempts: 1, cause: errors.ConnectionTimeout("reddit", 60), deadLetter: false, work: newEnvelope(suite, 0, queue.KindRedditVideo, &domain.RedditVideo{URL: videoRequest.URL})},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			ctx := context.Background()
+			q, w := newProcessor(t, nil, nil, nil)
+			defer q.Cleanup(ctx)
+
+			if err := q.Push(ctx, cs.work); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			for attempt := 1; attempt <= cs.attempts; attempt++ {
+				if err := w.GetWork(ctx); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if err := w.FailWork(ctx, cs.cause); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			deadLetters, err := q.DeadLetters(ctx, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if cs.deadLetter != (len(deadLetters) == 1) {
+				t.Fatalf("expecting dead-lettered to be %t, got %d dead letters", cs.deadLetter, len(deadLetters))
+			}
+			if cs.deadLetter {
+				return
+			}
+
+			// Work which was not dead-lettered is retried after the backoff
+			popCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+
+			delivery, err := q.Pop(popCtx)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if delivery.Attempts() != cs.attempts+1 {
+				t.Errorf("expecting %d attempts, got %d", cs.attempts+1, delivery.Attempts())
+			}
+		})
+	}
+}
+
+func TestProcessor_FailWorkDeadLettersFull(t *testing.T) {
+	ctx := context.Background()
+	q, w := newProcessor(t, nil, nil, nil)
+	defer q.Cleanup(ctx)
+
+	// Fill the dead-letter queue
+	for i := 0; i < 10; i++ {
+		if err := q.Push(ctx, []byte("garbage")); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := w.GetWork(ctx); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := w.FailWork(ctx, errors.MissingField("work")); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if err := q.Push(ctx, newEnvelope(t, 0, queue.KindVideoRequest, videoRequest)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := w.GetWork(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := w.FailWork(ctx, errors.InvalidValue("url", "not a video")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The work is retried rather than lost when it can not be dead-lettered
+	popCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	delivery, err := q.Pop(popCtx)
+	if err != nil {
+		t.Fatalf("expecting the work to be retried, got error: %s", err)
+	}
+	if delivery.Attempts() != 2 {
+		t.Errorf("expecting 2 attempts, got %d", delivery.Attempts())
+	}
+
+	deadLetters, err := q.DeadLetters(ctx, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(deadLetters) != 10 {
+		t.Errorf("expecting the 10 dead letters to be kept, got %d", len(deadLetters))
+	}
+}
+
+func TestProcessor_GetWork(suite *testing.T) {
+	unknownVersion := newEnvelope(suite, 0, queue.KindVideoRequest, videoRequest)
+	unknownVersion = bytes.Replace(unknownVersion, []byte(`"version":1`), []byte(`"version":2`), 1)
+
+	cases := []struct {
+		errType string
+		work    []byte
+	}{
+		{errType: errors.TypeInvalidValue, work: []byte("garbage")},
+		{errType: errors.TypeInvalidValue, work: []byte(`{"url": "https://www.reddit.com/r/mindblowing/comments/9z4buv/vortex_coin_bank/"}`)},
+		{errType: errors.TypeInvalidValue, work: unknownVersion},
+		{errType: errors.TypeInvalidValue, work: newEnvelope(suite, 0, "youtube_video", videoRequest)},
+		{errType: errors.TypeMissingField, work: []byte(`{"id": "1", "kind": "reddit_video", "version": 1}`)},
+		{errType: errors.TypeMissingField, work: newEnvelope(suite, 0, queue.KindVideoRequest, domain.VideoRequest{})},
+		{errType: errors.TypeMissingField, work: newEnvelope(suite, 0, queue.KindRedditVideo, domain.RedditVideo{})},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			ctx := context.Background()
+			q, w := newProcessor(t, nil, nil, nil)
+			defer q.Cleanup(ctx)
+
+			if err := q.Push(ctx, cs.work); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := w.GetWork(ctx); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			// Work which is rejected fails without being attempted
+			err := w.DoWork(ctx)
+			if errors.Type(err) != cs.errType {
+				t.Fatalf("expecting error type '%s', got: %v", cs.errType, err)
+			}
+			if err = w.FailWork(ctx, err); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			deadLetters, err := q.DeadLetters(ctx, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(deadLetters) != 1 {
+				t.Errorf("expecting rejected work to be dead-lettered, got %d dead letters", len(deadLetters))
+			}
+		})
+	}
+}
+
+func TestProcessor_FailWorkJob(t *testing.T) {
+	ctx := context.Background()
+
+	str, err := store.Memory(&config.StoreMemoryConfig{}, logger.New(ioutil.Discard, "error", "text"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	q, w := newProcessor(t, nil, str, nil)
+	defer q.Cleanup(ctx)
+
+	job := domain.NewJob()
+	job.RedditURL = videoRequest.URL
+	if err = str.CreateJob(ctx, job); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	requested := domain.NewVideoRequest(job.RedditURL, "", "", "")
+	requested.JobID = job.ID
+	if err = q.Push(ctx, newEnvelope(t, 0, queue.KindVideoRequest, requested)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cause := errors.ConnectionTimeout("reddit", 60)
+	expected := []domain.JobStatus{domain.JobStatusQueued, domain.JobStatusFailed}
+	for attempt, status := range expected {
+		popCtx, cancel := context.WithTimeout(ctx, time.Second)
+		err = w.GetWork(popCtx)
+		cancel()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err = w.FailWork(ctx, cause); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		found, err := str.GetJob(ctx, store.Selector{"_id": job.ID})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if found.Status != status {
+			t.Errorf("expecting status '%s' after attempt %d, got '%s'", status, attempt+1, found.Status)
+		}
+		if (status == domain.JobStatusFailed) != (found.Error != "") {
+			t.Errorf("expecting an error only once failed, got '%s' when %s", found.Error, found.Status)
+		}
+	}
+}
+
+// videoRequest is a request for a Reddit video which is only ever failed so
+// is never looked up
+var videoRequest = &domain.VideoRequest{URL: "https://www.reddit.com/r/mindblowing/comments/9z4buv/vortex_coin_bank/"}
+
+// newEnvelope returns the message for an envelope of the kind for the payload
+// which had been attempted before it was pushed
+func newEnvelope(t *testing.T, attempts int, kind string, payload interface{}) []byte {
+	envelope, err := queue.NewEnvelope(kind, payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	envelope.Attempts = attempts
+
+	message, err := envelope.Marshal()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return message
+}
+
+// newProcessor returns a processor worker reading from a memory queue which
+// retries connection timeouts once
+func newProcessor(t *testing.T, c converter.Converter, str store.Store, stg storage.Storage) (q queue.Queue, w worker.Worker) {
+	loggerHandle := logger.New(ioutil.Discard, "error", "text")
+
+	q, err := queue.Memory(&config.QueueMemoryConfig{MaxSize: 10}, loggerHandle)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = q.Init(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	w, err = worker.Processor(
+		&config.WorkerProcessorConfig{
+			MaxAttempts:     2,
+			RetryBackoff:    10,
+			RetryableErrors: errors.TypeConnectionTimeout,
+			SpriteFrames:    4,
+			ThumbnailOffset: 1000,
+		},
+		loggerHandle,
+		c,
+		nil,
+		q,
+		str,
+		stg,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+)
+
+// probe will set what can be found out about the converted vrddt video at the
+// path on it. Its content type and size are always known but the rest needs a
+// converter which can probe media, and failing to probe it is only logged as
+// the vrddt video can be used without it.
+func (p *processor) probe(ctx context.Context, videoPath string, vrddtVideo *domain.VrddtVideo) {
+	vrddtVideo.ContentType = vrddtVideo.Format.ContentType()
+
+	if info, err := os.Stat(videoPath); err != nil {
+		p.log.Warnf("Unable to get the size of the vrddt video: %s", err)
+	} else {
+		vrddtVideo.SizeBytes = info.Size()
+	}
+
+	prober, ok := p.converter.(converter.Prober)
+	if !ok {
+		return
+	}
+
+	media, err := prober.Probe(ctx, videoPath)
+	if err != nil {
+		p.log.Warnf("Unable to probe the vrddt video: %s", err)
+		return
+	}
+
+	vrddtVideo.AudioCodec = media.AudioCodec
+	vrddtVideo.Duration = media.Duration.Round(time.Millisecond).Seconds()
+	hasAudio := media.HasAudio()
+	vrddtVideo.HasAudio = &hasAudio
+	vrddtVideo.Height = media.Height
+	vrddtVideo.VideoCodec = media.VideoCodec
+	vrddtVideo.Width = media.Width
+}
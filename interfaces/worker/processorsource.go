@@ -0,0 +1,413 @@
+package worker
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/interfaces/store"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// TODO: Turn const into configuration variables
+
+const (
+	// OutputFileExtension is the filename extension for the file we output
+	// when the vrddt video does not have a format
+	OutputFileExtension = ".mp4"
+
+	// TemporaryDirectoryPrefix is the prefix for the directory which will
+	// store the temporarily converted video before uploading
+	TemporaryDirectoryPrefix = "vrddt-worker-downloader"
+
+	// TemporaryFilePrefix is the prefix for the file name which will
+	// store the temporarily converted video before uploading
+	TemporaryFilePrefix = "vrddt-worker-downloader-video"
+)
+
+// TODO: Fix comments
+
+// checkIfRedditURLExists will look in the database to see if the item of the
+// Reddit URL already exists in the quality, format and clip or not.  If it
+// does exist it will return the existing Reddit video otherwise nil
+func (p *processor) checkIfRedditURLExists(ctx context.Context, redditVideo *domain.RedditVideo) (existing *domain.RedditVideo, err error) {
+	// Let's also see if the Reddit URL has been seen before
+	existing, err = p.store.GetRedditVideo(
+		ctx,
+		store.Selector{
+			"clip":    redditVideo.Clip,
+			"format":  redditVideo.Format,
+			"item":    redditVideo.Item,
+			"quality": redditVideo.Quality,
+			"url":     redditVideo.URL,
+		},
+	)
+	if err != nil {
+		switch errors.Type(err) {
+		case errors.TypeResourceNotFound:
+			// We do not care if a Reddit video was not found
+			err = nil
+		default:
+		}
+
+		return nil, err
+	}
+
+	return
+}
+
+// checkIfVrddtMD5Exists will look to see if the processed video from the
+// unique Reddit URL that was given matches a vrddt video of the same
+// rendition, clip and format we have already stored and if so make the
+// association
+func (p *processor) checkIfVrddtMD5Exists(ctx context.Context, outputMD5Sum []byte, rendition string, redditVideo *domain.RedditVideo) (exists bool, err error) {
+	// Check the hash of the file against what is in the DB and only
+	// add it to the DB if it is unique otherwise associate it with the
+	// existing vrddt video
+	temporaryVrddtVideo, err := p.store.GetVrddtVideo(
+		ctx,
+		store.Selector{
+			"clip":      redditVideo.Clip,
+			"format":    redditVideo.Format,
+			"md5":       outputMD5Sum,
+			"rendition": rendition,
+		},
+	)
+	if err != nil {
+		switch errors.Type(err) {
+		case errors.TypeResourceNotFound:
+			// We do not care if a vrddt video was not found
+			err = nil
+		default:
+			return
+		}
+	} else {
+		redditVideo.VrddtVideoID = temporaryVrddtVideo.ID
+		if err = p.store.CreateRedditVideo(ctx, redditVideo); err != nil {
+			return
+		}
+		exists = true
+	}
+
+	return
+}
+
+// convertOptions returns the options to convert the clip of the media of the
+// Reddit video in to its format with which publish the progress of the
+// conversion every time another whole percent of it is done
+func (p *processor) convertOptions(ctx context.Context, jobID bson.ObjectId, redditVideo *domain.RedditVideo) (options *converter.ConvertOptions, err error) {
+	if options, err = converter.FormatOptions(redditVideo.Format.String()); err != nil {
+		return
+	}
+	options.MaxDuration = redditVideo.Clip.Duration()
+	options.Start = redditVideo.Clip.Start()
+
+	published := 0.0
+	options.Progress = func(progress converter.Progress) {
+		// The conversion being done is published once the output is checked
+		percent := math.Floor(progress.Percent)
+		if percent <= published || percent >= 100 {
+			return
+		}
+		published = percent
+
+		converting := newEvent(redditVideo, domain.EventStageConverting)
+		converting.Progress = percent
+		p.publish(ctx, jobID, converting)
+	}
+
+	return
+}
+
+// doWorkSource will perform all of the steps for a video conversion for
+// the clip of every media item at a URL (e.g. in a gallery) in a quality and
+// format using the source which supports it, store a reference of each in the
+// store, and upload the results to storage
+func (p *processor) doWorkSource(ctx context.Context, jobID bson.ObjectId, url string, quality domain.Quality, format domain.Format, clip domain.Clip) (err error) {
+	if url == "" {
+		return errors.MissingField("url")
+	}
+
+	if quality, err = domain.ParseQuality(quality.String()); err != nil {
+		return
+	}
+
+	if format, err = domain.ParseFormat(format.String()); err != nil {
+		return
+	}
+
+	if _, _, err = clip.Range(); err != nil {
+		return
+	}
+
+	source, err := domain.SourceFor(url)
+	if err != nil {
+		return
+	}
+
+	redditVideo := domain.NewRedditVideo()
+	redditVideo.Clip = clip
+	redditVideo.Format = format
+	redditVideo.Quality = quality
+	redditVideo.Source = source.Name()
+
+	// We shouldn't need this if all the entries to the queue are done
+	if redditVideo.URL, err = source.FinalURL(ctx, url); err != nil {
+		return
+	}
+
+	// The media items are resolved before looking for what has already been
+	// stored as only the source knows how many items there are at the URL
+	items, err := source.Resolve(ctx, redditVideo.URL, quality)
+	if err != nil {
+		return
+	}
+	p.publish(ctx, jobID, newEvent(redditVideo, domain.EventStageMetadataFetched))
+
+	vrddtVideos := make([]*domain.VrddtVideo, 0, len(items))
+	for _, media := range items {
+		vrddtVideo, err := p.doWorkSourceItem(ctx, jobID, source, media, format, clip)
+		if err != nil {
+			return err
+		}
+		vrddtVideos = append(vrddtVideos, vrddtVideo)
+	}
+
+	p.log.Infof("Completed storing %d media item(s) for Reddit URL: %s", len(vrddtVideos), redditVideo.URL)
+	p.reportDone(ctx, jobID, redditVideo, vrddtVideos)
+
+	return
+}
+
+// doWorkSourceItem will download, convert the clip in to the format, store
+// and upload one media item a source resolved a URL to, returning the vrddt
+// video it resulted in or the one that had already been stored for it
+func (p *processor) doWorkSourceItem(ctx context.Context, jobID bson.ObjectId, source domain.Source, media *domain.SourceMedia, format domain.Format, clip domain.Clip) (vrddtVideo *domain.VrddtVideo, err error) {
+	redditVideo := domain.NewRedditVideo()
+	redditVideo.Clip = clip
+	redditVideo.Format = format
+	redditVideo.URL = media.URL
+	redditVideo.SetMedia(media)
+
+	existingRedditVideo, err := p.checkIfRedditURLExists(ctx, redditVideo)
+	if err != nil {
+		return
+	} else if existingRedditVideo != nil {
+		p.log.Infof("Reddit URL item %d already exists in the database in %s quality as %s: %s", redditVideo.Item, redditVideo.Quality, redditVideo.Format, redditVideo.URL)
+		return p.getVrddtVideo(ctx, existingRedditVideo.VrddtVideoID)
+	}
+	p.log.Debugf("Reddit URL item %d is unique and does not exist in the database in %s quality as %s: %s", redditVideo.Item, redditVideo.Quality, redditVideo.Format, redditVideo.URL)
+
+	// I am not sure that Reddit does this but it could save them some
+	// trouble (and wouldn't be needed here if so). However, if someone
+	// uploads the same video to multiple different subreddits and
+	// Reddit notices the content is the same and points all references
+	// back to the same URL this will catch those instances and save us
+	// some work. The same goes for a URL requested in another quality which
+	// picked the same streams, or a crosspost of a video we have seen, as
+	// long as it was made in the same format from the same clip.
+	temporaryRedditVideo, err := p.store.GetRedditVideo(
+		ctx,
+		store.Selector{
+			"audio_url": redditVideo.AudioURL,
+			"clip":      redditVideo.Clip,
+			"format":    redditVideo.Format,
+			"video_url": redditVideo.VideoURL,
+		},
+	)
+	if err != nil {
+		switch errors.Type(err) {
+		case errors.TypeResourceNotFound:
+			// This simply means a duplicate was not found in the database (i.e.
+			// we have a unique Reddit URL)
+			p.log.Debugf("Reddit audio and/or video URLs is unique: %s", redditVideo.URL)
+		default:
+			// Something unexpected happened
+			return
+		}
+	} else {
+		redditVideo.VrddtVideoID = temporaryRedditVideo.VrddtVideoID
+		if err = p.store.CreateRedditVideo(ctx, redditVideo); err != nil {
+			return
+		}
+
+		p.log.Infof("Reddit audio and video URLs already exist in the database: %s", redditVideo.URL)
+		return p.getVrddtVideo(ctx, redditVideo.VrddtVideoID)
+	}
+
+	options, err := p.convertOptions(ctx, jobID, redditVideo)
+	if err != nil {
+		return
+	}
+
+	// The duration of the vrddt video is kept to spread its sprite sheet
+	// over it
+	var duration time.Duration
+	publishProgress := options.Progress
+	options.Progress = func(progress converter.Progress) {
+		if progress.Duration > 0 {
+			duration = progress.Duration
+		}
+		publishProgress(progress)
+	}
+
+	p.updateJob(ctx, jobID, domain.JobStatusDownloading, nil, nil)
+
+	files, err := source.Download(ctx, media)
+	if err != nil {
+		return
+	}
+	defer files.Remove()
+
+	if format.AudioOnly() && files.AudioPath == "" {
+		return nil, errors.InvalidValue("format", fmt.Sprintf("The video does not have any audio to make %s from", format))
+	}
+
+	p.publish(ctx, jobID, newEvent(redditVideo, domain.EventStageVideoDownloaded))
+	if files.AudioPath != "" {
+		p.publish(ctx, jobID, newEvent(redditVideo, domain.EventStageAudioDownloaded))
+	}
+
+	p.log.Debugf("Downloaded %s video: %#v", source.Name(), redditVideo)
+
+	p.log.Infof("Converting media for Reddit URL: %s", redditVideo.URL)
+	p.updateJob(ctx, jobID, domain.JobStatusConverting, nil, nil)
+	p.publish(ctx, jobID, newEvent(redditVideo, domain.EventStageConverting))
+
+	temporaryOutputFileHandle, err := p.convertVideo(ctx, files.VideoPath, files.AudioPath, options)
+	if err != nil {
+		return
+	}
+
+	converted := newEvent(redditVideo, domain.EventStageConverting)
+	converted.Progress = 100
+	p.publish(ctx, jobID, converted)
+
+	defer temporaryOutputFileHandle.Close()
+	defer os.Remove(temporaryOutputFileHandle.Name())
+
+	// Get an MD5 hash of the converted file
+	outputMD5 := md5.New()
+	if _, err = io.Copy(outputMD5, temporaryOutputFileHandle); err != nil {
+		return
+	}
+	outputMD5Sum := outputMD5.Sum(nil)
+
+	md5Exists, err := p.checkIfVrddtMD5Exists(ctx, outputMD5Sum, media.Rendition(), redditVideo)
+	if err != nil {
+		return
+	} else if md5Exists {
+		p.log.Debugf("Vrddt MD5 already exists in the database")
+		return p.getVrddtVideo(ctx, redditVideo.VrddtVideoID)
+	}
+	p.log.Debugf("MD5 for the resulting vrddt video does not exist in the database")
+
+	// The vrddt video is unique so setup a new one and assign the hash
+	vrddtVideo = domain.NewVrddtVideo()
+	vrddtVideo.Clip = clip
+	vrddtVideo.Format = format
+	vrddtVideo.MD5 = outputMD5Sum
+	vrddtVideo.Rendition = media.Rendition()
+
+	p.probe(ctx, temporaryOutputFileHandle.Name(), vrddtVideo)
+	if vrddtVideo.Duration > 0 {
+		duration = time.Duration(vrddtVideo.Duration * float64(time.Second))
+	}
+
+	p.log.Debugf("Uploading media to storage for Reddit URL: %s", redditVideo.URL)
+	p.updateJob(ctx, jobID, domain.JobStatusUploading, nil, nil)
+
+	destinationFilename := storageFilename(vrddtVideo)
+	if err = p.storage.Upload(ctx, temporaryOutputFileHandle.Name(), destinationFilename); err != nil {
+		return nil, err
+	}
+	vrddtVideo.URL, err = p.storage.GetLocation(ctx, destinationFilename)
+	if err != nil {
+		p.storage.Delete(ctx, destinationFilename)
+		return nil, err
+	}
+
+	p.log.Debugf("Vrddt media uploaded to storage as URL: %s", vrddtVideo.URL)
+
+	uploadedFilenames := append([]string{destinationFilename}, p.uploadImages(ctx, temporaryOutputFileHandle.Name(), duration, vrddtVideo)...)
+	p.publish(ctx, jobID, newEvent(redditVideo, domain.EventStageUploaded))
+
+	// Save the vrddt video information to the database
+	err = p.store.CreateVrddtVideo(ctx, vrddtVideo)
+	if err != nil {
+		p.deleteUploads(ctx, uploadedFilenames)
+		return nil, err
+	}
+
+	// If we got this far then the Reddit URL is unique and either:
+	// A) A vrddt video was found that already has processed the Reddit
+	// audio and video before so create the association
+	// B) This link, video,audio, and the generated vrddt video are all
+	// unique so store all of these values
+	redditVideo.VrddtVideoID = vrddtVideo.ID
+	if err = p.store.CreateRedditVideo(ctx, redditVideo); err != nil {
+		p.store.DeleteVrddtVideo(
+			ctx,
+			store.Selector{
+				"_id": vrddtVideo.ID,
+			},
+		)
+		p.deleteUploads(ctx, uploadedFilenames)
+		return nil, err
+	}
+
+	p.log.Infof("Completed storing media [VrddtVideo URL: %s] for Reddit URL item %d: %s",
+		vrddtVideo.URL,
+		redditVideo.Item,
+		redditVideo.URL,
+	)
+
+	return
+}
+
+// getVrddtVideo will return the vrddt video we had already stored for a
+// Reddit video
+func (p *processor) getVrddtVideo(ctx context.Context, vrddtVideoID bson.ObjectId) (vrddtVideo *domain.VrddtVideo, err error) {
+	return p.store.GetVrddtVideo(
+		ctx,
+		store.Selector{
+			"_id": vrddtVideoID,
+		},
+	)
+}
+
+// newEvent will return a new event for the stage of processing the item of
+// the URL of the Reddit video in its quality, format and clip
+func newEvent(redditVideo *domain.RedditVideo, stage domain.EventStage) (event *domain.Event) {
+	event = domain.NewEvent(redditVideo.URL, stage)
+	event.Clip = redditVideo.Clip
+	event.Format = redditVideo.Format
+	event.Item = redditVideo.Item
+	event.Quality = redditVideo.Quality
+
+	return
+}
+
+// storageFilename returns the name the vrddt video is uploaded to storage as
+// which includes its rendition so that the renditions of the same video do
+// not overwrite one another and ends in the extension of its format
+func storageFilename(vrddtVideo *domain.VrddtVideo) string {
+	extension := OutputFileExtension
+	if vrddtVideo.Format != "" {
+		extension = vrddtVideo.Format.Extension()
+	}
+
+	if vrddtVideo.Rendition == "" {
+		return vrddtVideo.ID.Hex() + extension
+	}
+
+	return vrddtVideo.ID.Hex() + "-" + vrddtVideo.Rendition + extension
+}
@@ -0,0 +1,230 @@
+package worker_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/config"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
+	"github.com/johnwyles/vrddt-droplets/interfaces/storage"
+	"github.com/johnwyles/vrddt-droplets/interfaces/store"
+	"github.com/johnwyles/vrddt-droplets/pkg/fakereddit"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+func TestProcessor_DoWorkRedditVideo(suite *testing.T) {
+	root, err := ioutil.TempDir("", "vrddt-worker-test")
+	if err != nil {
+		suite.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	loggerHandle := logger.New(ioutil.Discard, "error", "text")
+	str, err := store.Memory(&config.StoreMemoryConfig{}, loggerHandle)
+	if err != nil {
+		suite.Fatalf("unexpected error: %s", err)
+	}
+	stg, err := storage.Local(&config.StorageLocalConfig{Path: root}, loggerHandle)
+	if err != nil {
+		suite.Fatalf("unexpected error: %s", err)
+	}
+
+	reddit := fakereddit.NewServer()
+	defer reddit.Close()
+
+	post := &fakereddit.Post{
+		Audio:     []byte("audio"),
+		ID:        "2x8ncgqftw021",
+		Subreddit: "mindblowing",
+		Title:     "Vortex coin bank",
+		Videos: map[int][]byte{
+			480: []byte("video 480p;"),
+			720: []byte("video 720p;"),
+		},
+	}
+	reddit.AddPost(post)
+
+	cases := []struct {
+		clip      domain.Clip
+		filename  string
+		format    domain.Format
+		output    string
+		quality   domain.Quality
+		rendition string
+		url       string
+	}{
+		{filename: "480p.mp4", output: "video 480p;audio", quality: "480p", rendition: "480p", url: post.ShortURL()},
+		{filename: "720p.mp4", output: "video 720p;audio", quality: "", rendition: "720p", url: post.URL()},
+		// Requesting the same quality again reuses the vrddt video
+		{filename: "480p.mp4", output: "video 480p;audio", quality: "480p", rendition: "480p", url: post.ShortURL()},
+		// Another format of the same rendition is a vrddt video of its own
+		// even though the stand-in converter makes the same output
+		{filename: "480p.gif", format: domain.FormatGIF, output: "video 480p;audio", quality: "480p", rendition: "480p", url: post.ShortURL()},
+		// As is a clip, and the same clip again reuses it
+		{clip: "1-2.5", filename: "480p.mp4", output: "video 480p;audio", quality: "480p", rendition: "480p", url: post.ShortURL()},
+		{clip: "1-2.5", filename: "480p.mp4", output: "video 480p;audio", quality: "480p", rendition: "480p", url: post.URL()},
+	}
+
+	vrddtVideoIDs := map[string]string{}
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			ctx := domain.WithHTTPClient(context.Background(), reddit.Client())
+			q, w := newProcessor(t, concatConverter{}, str, stg)
+			defer q.Cleanup(ctx)
+
+			job := domain.NewJob()
+			job.RedditURL = cs.url
+			if err := str.CreateJob(ctx, job); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			videoRequest := domain.NewVideoRequest(cs.url, cs.quality, cs.format, cs.clip)
+			videoRequest.JobID = job.ID
+			if err := q.Push(ctx, newEnvelope(t, 0, queue.KindVideoRequest, videoRequest)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if err := w.GetWork(ctx); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := w.DoWork(ctx); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := w.CompleteWork(ctx); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			job, err := str.GetJob(ctx, store.Selector{"_id": job.ID})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if job.Status != domain.JobStatusDone {
+				t.Fatalf("expecting status '%s', got '%s': %s", domain.JobStatusDone, job.Status, job.Error)
+			}
+
+			vrddtVideo, err := str.GetVrddtVideo(ctx, store.Selector{"_id": job.VrddtVideoID})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if vrddtVideo.Rendition != cs.rendition {
+				t.Errorf("expecting rendition '%s', got '%s'", cs.rendition, vrddtVideo.Rendition)
+			}
+			if vrddtVideo.Clip != cs.clip {
+				t.Errorf("expecting clip '%s', got '%s'", cs.clip, vrddtVideo.Clip)
+			}
+			key := cs.filename + " " + cs.clip.String()
+			if existing, ok := vrddtVideoIDs[key]; ok && existing != vrddtVideo.ID.Hex() {
+				t.Errorf("expecting the %s vrddt video %s to be reused, got %s", key, existing, vrddtVideo.ID.Hex())
+			}
+			vrddtVideoIDs[key] = vrddtVideo.ID.Hex()
+
+			output, err := ioutil.ReadFile(filepath.Join(root, vrddtVideo.ID.Hex()+"-"+cs.filename))
+			if err != nil {
+				t.Fatalf("expecting the vrddt video in storage, got error: %s", err)
+			}
+			if string(output) != cs.output {
+				t.Errorf("expecting output '%s', got '%s'", cs.output, output)
+			}
+
+			// What was probed from it is stored with it
+			hasAudio := true
+			probed := &domain.VrddtVideo{
+				AudioCodec:  vrddtVideo.AudioCodec,
+				ContentType: vrddtVideo.ContentType,
+				Duration:    vrddtVideo.Duration,
+				HasAudio:    vrddtVideo.HasAudio,
+				Height:      vrddtVideo.Height,
+				SizeBytes:   vrddtVideo.SizeBytes,
+				VideoCodec:  vrddtVideo.VideoCodec,
+				Width:       vrddtVideo.Width,
+			}
+			expected := &domain.VrddtVideo{
+				AudioCodec:  "aac",
+				ContentType: vrddtVideo.Format.ContentType(),
+				Duration:    1,
+				HasAudio:    &hasAudio,
+				Height:      480,
+				SizeBytes:   int64(len(cs.output)),
+				VideoCodec:  "h264",
+				Width:       854,
+			}
+			if !reflect.DeepEqual(probed, expected) {
+				t.Errorf("expecting the probed vrddt video %#v, got %#v", expected, probed)
+			}
+
+			// The thumbnail and sprite sheet are uploaded next to it, and the
+			// thumbnail is taken from the middle of a video as short as its
+			// offset
+			base := vrddtVideo.ID.Hex() + "-" + cs.rendition
+			images := []struct {
+				content  string
+				filename string
+				url      string
+			}{
+				{content: "thumbnail at 500ms", filename: base + "-thumbnail.jpg", url: vrddtVideo.ThumbnailURL},
+				{content: "sprite of 4 frames", filename: base + "-sprite.jpg", url: vrddtVideo.SpriteURL},
+			}
+			for _, image := range images {
+				if image.url == "" {
+					t.Errorf("expecting a URL for '%s'", image.filename)
+				}
+				content, err := ioutil.ReadFile(filepath.Join(root, image.filename))
+				if err != nil {
+					t.Fatalf("expecting '%s' in storage, got error: %s", image.filename, err)
+				}
+				if string(content) != image.content {
+					t.Errorf("expecting '%s' to be '%s', got '%s'", image.filename, image.content, content)
+				}
+			}
+		})
+	}
+
+	if len(vrddtVideoIDs) != 4 {
+		suite.Errorf("expecting a vrddt video for each of 4 renditions, formats and clips, got %d", len(vrddtVideoIDs))
+	}
+}
+
+// concatConverter "converts" a video by writing the video followed by the
+// audio to the output so tests do not need FFmpeg
+type concatConverter struct{}
+
+func (c concatConverter) Convert(ctx context.Context, inputVideoPath string, inputAudioPath string, outputVideoPath string, options *converter.ConvertOptions) (err error) {
+	output, err := ioutil.ReadFile(inputVideoPath)
+	if err != nil {
+		return
+	}
+
+	if inputAudioPath != "" {
+		audio, err := ioutil.ReadFile(inputAudioPath)
+		if err != nil {
+			return err
+		}
+		output = append(output, audio...)
+	}
+
+	return ioutil.WriteFile(outputVideoPath, output, 0644)
+}
+
+func (c concatConverter) Init(ctx context.Context) (err error) {
+	return
+}
+
+func (c concatConverter) Probe(ctx context.Context, inputPath string) (media *converter.MediaInfo, err error) {
+	return &converter.MediaInfo{AudioCodec: "aac", Duration: time.Second, Height: 480, VideoCodec: "h264", Width: 854}, nil
+}
+
+func (c concatConverter) Sprite(ctx context.Context, inputVideoPath string, outputImagePath string, options *converter.SpriteOptions) (err error) {
+	return ioutil.WriteFile(outputImagePath, []byte(fmt.Sprintf("sprite of %d frames", options.Frames)), 0644)
+}
+
+func (c concatConverter) Thumbnail(ctx context.Context, inputVideoPath string, outputImagePath string, options *converter.ThumbnailOptions) (err error) {
+	return ioutil.WriteFile(outputImagePath, []byte(fmt.Sprintf("thumbnail at %s", options.Offset)), 0644)
+}
@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/converter"
+)
+
+const (
+	// SpriteFileSuffix is appended to the name of the vrddt video in storage
+	// for the name of its sprite sheet
+	SpriteFileSuffix = "-sprite"
+
+	// ThumbnailFileSuffix is appended to the name of the vrddt video in
+	// storage for the name of its thumbnail
+	ThumbnailFileSuffix = "-thumbnail"
+)
+
+// deleteUploads will delete everything uploaded to storage for a vrddt video
+// which could not be stored
+func (p *processor) deleteUploads(ctx context.Context, filenames []string) {
+	for _, filename := range filenames {
+		if err := p.storage.Delete(ctx, filename); err != nil {
+			p.log.Warnf("Unable to delete '%s' from storage: %s", filename, err)
+		}
+	}
+}
+
+// uploadImages will take a thumbnail of the converted vrddt video, and a
+// sprite sheet of it if they are configured, and upload them to storage next
+// to it setting their URLs on the vrddt video. Nothing is taken from audio or
+// when the converter can not take frames from a video. The images are only
+// extras so failing to make one is logged rather than failing the work. The
+// names of the images uploaded are returned so that they can be deleted with
+// the vrddt video.
+func (p *processor) uploadImages(ctx context.Context, videoPath string, duration time.Duration, vrddtVideo *domain.VrddtVideo) (filenames []string) {
+	thumbnailer, ok := p.converter.(converter.Thumbnailer)
+	if !ok || vrddtVideo.Format.AudioOnly() {
+		return
+	}
+
+	temporaryDirectory, err := ioutil.TempDir(os.TempDir(), TemporaryDirectoryPrefix)
+	if err != nil {
+		p.log.Warnf("Unable to create a directory for the images of the vrddt video: %s", err)
+		return
+	}
+	defer os.RemoveAll(temporaryDirectory)
+
+	destinationFilename := storageFilename(vrddtVideo)
+	base := strings.TrimSuffix(destinationFilename, filepath.Ext(destinationFilename))
+	extension := converter.ImageExtension(p.thumbnailFormat)
+
+	// A thumbnail past the end of a short video is taken from its middle
+	offset := p.thumbnailOffset
+	if duration > 0 && offset >= duration {
+		offset = duration / 2
+	}
+
+	thumbnailPath := filepath.Join(temporaryDirectory, "thumbnail"+extension)
+	thumbnailOptions := &converter.ThumbnailOptions{
+		Format: p.thumbnailFormat,
+		Offset: offset,
+	}
+	if err = thumbnailer.Thumbnail(ctx, videoPath, thumbnailPath, thumbnailOptions); err != nil {
+		p.log.Warnf("Unable to take a thumbnail of the vrddt video: %s", err)
+	} else if vrddtVideo.ThumbnailURL, err = p.uploadImage(ctx, thumbnailPath, base+ThumbnailFileSuffix+extension); err != nil {
+		p.log.Warnf("Unable to upload the thumbnail of the vrddt video: %s", err)
+	} else {
+		filenames = append(filenames, base+ThumbnailFileSuffix+extension)
+	}
+
+	if p.spriteFrames <= 0 {
+		return
+	}
+
+	spritePath := filepath.Join(temporaryDirectory, "sprite"+extension)
+	spriteOptions := &converter.SpriteOptions{
+		Duration: duration,
+		Format:   p.thumbnailFormat,
+		Frames:   p.spriteFrames,
+	}
+	if err = thumbnailer.Sprite(ctx, videoPath, spritePath, spriteOptions); err != nil {
+		p.log.Warnf("Unable to make a sprite sheet of the vrddt video: %s", err)
+	} else if vrddtVideo.SpriteURL, err = p.uploadImage(ctx, spritePath, base+SpriteFileSuffix+extension); err != nil {
+		p.log.Warnf("Unable to upload the sprite sheet of the vrddt video: %s", err)
+	} else {
+		filenames = append(filenames, base+SpriteFileSuffix+extension)
+	}
+
+	return
+}
+
+// uploadImage will upload the image at the path to storage as the filename
+// returning where it can be found
+func (p *processor) uploadImage(ctx context.Context, imagePath string, filename string) (url string, err error) {
+	if err = p.storage.Upload(ctx, imagePath, filename); err != nil {
+		return
+	}
+
+	if url, err = p.storage.GetLocation(ctx, filename); err != nil {
+		p.storage.Delete(ctx, filename)
+	}
+
+	return
+}
@@ -8,6 +8,8 @@ import (
 type Worker interface {
 	CompleteWork(ctx context.Context) (err error)
 	DoWork(ctx context.Context) (err error)
+	FailWork(ctx context.Context, cause error) (err error)
 	GetWork(ctx context.Context) (err error)
 	Init(ctx context.Context) (err error)
+	ReleaseWork(ctx context.Context) (err error)
 }
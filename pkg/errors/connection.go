@@ -6,6 +6,7 @@ import (
 
 // Common resource related error codes.
 const (
+	TypeConnectionClosed  = "ConnectionClosed"
 	TypeConnectionFailure = "ConnectionFailure"
 	TypeConnectionTimeout = "ConnectionTimeout"
 )
@@ -37,3 +38,17 @@ func ConnectionTimeout(cType string, timeout int) error {
 		},
 	})
 }
+
+// ConnectionClosed returns an error that represents an attempt to use a
+// connection to a service which has already been closed
+func ConnectionClosed(service string, description string) error {
+	return WithStack(&Error{
+		Code:    http.StatusServiceUnavailable,
+		Type:    TypeConnectionClosed,
+		Message: "Connection has been closed",
+		Context: map[string]interface{}{
+			"service":     service,
+			"description": description,
+		},
+	})
+}
@@ -0,0 +1,38 @@
+package errors
+
+import "net/http"
+
+// Common operation related error codes.
+const (
+	TypeCancelled     = "Cancelled"
+	TypeCommandFailed = "CommandFailed"
+)
+
+// Cancelled returns an error that represents an operation which was abandoned
+// because its context was cancelled or its deadline was exceeded
+func Cancelled(operation string, reason string) error {
+	return WithStack(&Error{
+		Code:    http.StatusServiceUnavailable,
+		Type:    TypeCancelled,
+		Message: "Operation has been cancelled",
+		Context: map[string]interface{}{
+			"operation": operation,
+			"reason":    reason,
+		},
+	})
+}
+
+// CommandFailed returns an error that represents an external command which
+// exited unsuccessfully along with the tail of what it wrote to stderr
+func CommandFailed(command string, cause error, stderr string) error {
+	return WithStack(&Error{
+		Code:    http.StatusInternalServerError,
+		Type:    TypeCommandFailed,
+		Message: "Command failed: " + stderr,
+		Context: map[string]interface{}{
+			"command": command,
+			"stderr":  stderr,
+		},
+		original: cause,
+	})
+}
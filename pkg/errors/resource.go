@@ -6,6 +6,7 @@ import "net/http"
 const (
 	TypeNotImplemented   = "NotImplemented"
 	TypeResourceConflict = "ResourceConflict"
+	TypeResourceLimit    = "ResourceLimit"
 	TypeResourceNotFound = "ResourceNotFound"
 	TypeResourceUnknown  = "ResourceUnknown"
 )
@@ -42,7 +43,7 @@ func NotImplemented(request string, reason string) error {
 func ResourceLimit(rType string, limit interface{}) error {
 	return WithStack(&Error{
 		Code:    http.StatusInternalServerError,
-		Type:    TypeResourceNotFound,
+		Type:    TypeResourceLimit,
 		Message: "Resource limit has been exceeded",
 		Context: map[string]interface{}{
 			"type":  rType,
@@ -0,0 +1,5 @@
+// Package fakereddit provides a fake Reddit which serves the JSON for video
+// posts along with the short link redirects, MPEG-DASH manifests and streams
+// of their videos. Its client sends requests for any host to the fake so
+// that resolving and downloading Reddit videos can be tested offline.
+package fakereddit
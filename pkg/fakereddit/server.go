@@ -0,0 +1,278 @@
+package fakereddit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// PostHost is the host the fake serves posts on
+	PostHost = "www.reddit.com"
+
+	// VideoHost is the host the fake serves short links and videos on
+	VideoHost = "v.redd.it"
+)
+
+// Post is a video post served by the fake.
+type Post struct {
+	// Audio is the audio of the video which is not served if it is empty.
+	Audio []byte
+
+	// ID is the ID of the post which is also the ID of its video.
+	ID string
+
+	// Subreddit is the name of the subreddit the post was made to.
+	Subreddit string
+
+	// Title is the title of the post.
+	Title string
+
+	// Videos are the renditions of the video keyed by their height.
+	Videos map[int][]byte
+}
+
+// URL returns the URL of the post.
+func (p *Post) URL() string {
+	return fmt.Sprintf("https://%s/r/%s/comments/%s/post/", PostHost, p.Subreddit, p.ID)
+}
+
+// ShortURL returns the short link which redirects to the post.
+func (p *Post) ShortURL() string {
+	return fmt.Sprintf("https://%s/%s", VideoHost, p.ID)
+}
+
+// heights returns the heights of the renditions from the smallest to the
+// tallest
+func (p *Post) heights() (heights []int) {
+	for height := range p.Videos {
+		heights = append(heights, height)
+	}
+	sort.Ints(heights)
+
+	return
+}
+
+// Server is a fake Reddit.
+type Server struct {
+	mutex    sync.Mutex
+	posts    map[string]*Post
+	requests []string
+	server   *httptest.Server
+}
+
+// NewServer starts a fake Reddit without any posts.
+func NewServer() *Server {
+	s := &Server{
+		posts: map[string]*Post{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// AddPost makes the fake serve the post.
+func (s *Server) AddPost(post *Post) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.posts[post.ID] = post
+}
+
+// Client returns an HTTP client whose requests, whatever their host, are
+// answered by the fake.
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.server.URL)
+
+	return &http.Client{
+		Transport: &transport{
+			next:   s.server.Client().Transport,
+			target: target,
+		},
+	}
+}
+
+// Close shuts the fake down.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Requests returns the method, host and path of every request the fake has
+// answered in the order they were made (e.g. "GET v.redd.it/abc/DASH_720.mp4").
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// manifest returns the MPEG-DASH manifest for the video of the post
+func (s *Server) manifest(post *Post) string {
+	manifest := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static"><Period>` +
+		`<AdaptationSet contentType="video">`
+	for _, height := range post.heights() {
+		manifest += fmt.Sprintf(`<Representation id="%[1]d" mimeType="video/mp4" width="%[2]d" height="%[1]d" bandwidth="%[3]d"><BaseURL>DASH_%[1]d.mp4</BaseURL></Representation>`, height, height*16/9, height*3000)
+	}
+	manifest += `</AdaptationSet>`
+	if len(post.Audio) > 0 {
+		manifest += `<AdaptationSet contentType="audio"><Representation id="audio" mimeType="audio/mp4" bandwidth="128000"><BaseURL>DASH_audio.mp4</BaseURL></Representation></AdaptationSet>`
+	}
+
+	return manifest + `</Period></MPD>`
+}
+
+// postJSON returns the JSON Reddit serves for the post, a listing of the post
+// followed by a listing of its comments
+func (s *Server) postJSON(post *Post) ([]byte, error) {
+	heights := post.heights()
+	videoURL := fmt.Sprintf("https://%s/%s", VideoHost, post.ID)
+
+	redditVideo := map[string]interface{}{
+		"dash_url":     videoURL + "/DASHPlaylist.mpd",
+		"fallback_url": fmt.Sprintf("%s/DASH_%d.mp4?source=fallback", videoURL, heights[len(heights)-1]),
+		"height":       heights[len(heights)-1],
+		"is_gif":       false,
+	}
+
+	return json.Marshal([]interface{}{
+		map[string]interface{}{
+			"kind": "Listing",
+			"data": map[string]interface{}{
+				"children": []interface{}{
+					map[string]interface{}{
+						"kind": "t3",
+						"data": map[string]interface{}{
+							"id":        post.ID,
+							"is_video":  true,
+							"media":     map[string]interface{}{"reddit_video": redditVideo},
+							"subreddit": post.Subreddit,
+							"title":     post.Title,
+							"url":       videoURL,
+						},
+					},
+				},
+			},
+		},
+		map[string]interface{}{
+			"kind": "Listing",
+			"data": map[string]interface{}{
+				"children": []interface{}{},
+			},
+		},
+	})
+}
+
+// serveHTTP answers a request for a post, a short link or a video
+func (s *Server) serveHTTP(wr http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, req.Method+" "+req.Host+req.URL.Path)
+	s.mutex.Unlock()
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case req.Host == PostHost && len(parts) == 5 && parts[0] == "r" && parts[2] == "comments":
+		post := s.post(parts[3])
+		if post == nil || parts[1] != post.Subreddit {
+			http.NotFound(wr, req)
+			return
+		}
+
+		if !strings.HasSuffix(parts[4], ".json") {
+			wr.Header().Set("Content-Type", "text/html")
+			return
+		}
+
+		data, err := s.postJSON(post)
+		if err != nil {
+			http.Error(wr, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write(data)
+	case req.Host == VideoHost && len(parts) == 1:
+		post := s.post(parts[0])
+		if post == nil {
+			http.NotFound(wr, req)
+			return
+		}
+
+		wr.Header().Set("Location", post.URL())
+		wr.WriteHeader(http.StatusMovedPermanently)
+	case req.Host == VideoHost && len(parts) == 2:
+		post := s.post(parts[0])
+		if post == nil {
+			http.NotFound(wr, req)
+			return
+		}
+
+		s.serveVideo(wr, req, post, parts[1])
+	default:
+		http.NotFound(wr, req)
+	}
+}
+
+// serveVideo answers a request for the manifest or one of the streams of the
+// video of a post
+func (s *Server) serveVideo(wr http.ResponseWriter, req *http.Request, post *Post, name string) {
+	switch {
+	case name == "DASHPlaylist.mpd":
+		wr.Header().Set("Content-Type", "application/dash+xml")
+		fmt.Fprint(wr, s.manifest(post))
+	case name == "DASH_audio.mp4" && len(post.Audio) > 0:
+		wr.Header().Set("Content-Type", "video/mp4")
+		wr.Write(post.Audio)
+	case strings.HasPrefix(name, "DASH_") && strings.HasSuffix(name, ".mp4"):
+		height, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "DASH_"), ".mp4"))
+		if err != nil || post.Videos[height] == nil {
+			http.NotFound(wr, req)
+			return
+		}
+
+		wr.Header().Set("Content-Type", "video/mp4")
+		wr.Write(post.Videos[height])
+	default:
+		http.NotFound(wr, req)
+	}
+}
+
+// post returns the post with the ID or nil if there is not one
+func (s *Server) post(id string) *Post {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.posts[id]
+}
+
+// transport sends every request to the fake keeping the host the request was
+// for so the fake knows what was asked for
+type transport struct {
+	next   http.RoundTripper
+	target *url.URL
+}
+
+// RoundTrip sends the request to the fake
+func (t *transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	fakeURL := *req.URL
+	fakeURL.Host = t.target.Host
+	fakeURL.Scheme = t.target.Scheme
+
+	fakeReq := new(http.Request)
+	*fakeReq = *req
+	fakeReq.Host = req.URL.Host
+	fakeReq.URL = &fakeURL
+
+	resp, err = t.next.RoundTrip(fakeReq)
+	if err != nil {
+		return
+	}
+	resp.Request = req
+
+	return
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 )
 
@@ -14,13 +15,18 @@ import (
 // server is shutting down.
 type LogFunc func(msg string, args ...interface{})
 
+// ShutdownFunc is called once all of the listeners have stopped so that any
+// resources used by the handlers (e.g. queue and store connections) can be
+// closed before the process exits.
+type ShutdownFunc func(ctx context.Context) error
+
 // NewServer creates a wrapper around the given handler.
 func NewServer(handler http.Handler, timeout time.Duration, signals ...os.Signal) *Server {
 	gss := &Server{}
-	gss.server = &http.Server{
-		Handler: handler,
-	}
+	gss.handler = handler
 	gss.signals = signals
+	gss.stop = make(chan struct{})
+	gss.timeout = timeout
 	gss.Log = log.Printf
 	return gss
 }
@@ -31,70 +37,202 @@ type Server struct {
 	Addr string
 	Log  LogFunc
 
-	server  *http.Server
-	signals []os.Signal
-	timeout time.Duration
-	err     error
+	handler   http.Handler
+	hooks     []ShutdownFunc
+	listeners []*listener
+	signals   []os.Signal
+	stop      chan struct{}
+	stopOnce  sync.Once
+	timeout   time.Duration
+}
+
+// listener is a single address (or already bound listener) the server will
+// accept requests on
+type listener struct {
+	certFile string
+	keyFile  string
+	listener net.Listener
+	server   *http.Server
+	tls      bool
+}
+
+// Listen registers an additional address to serve plain HTTP on alongside
+// the main one (e.g. an admin port). The server's handler is used if handler
+// is nil.
+func (gss *Server) Listen(addr string, handler http.Handler) {
+	gss.listeners = append(gss.listeners, &listener{
+		server: gss.newHTTPServer(addr, handler),
+	})
+}
+
+// ListenTLS registers an additional address to serve HTTPS on alongside the
+// main one. The server's handler is used if handler is nil.
+func (gss *Server) ListenTLS(addr string, handler http.Handler, certFile, keyFile string) {
+	gss.listeners = append(gss.listeners, &listener{
+		certFile: certFile,
+		keyFile:  keyFile,
+		server:   gss.newHTTPServer(addr, handler),
+		tls:      true,
+	})
+}
+
+// OnShutdown registers a function to call after the listeners have stopped.
+// The functions are called in the order they were registered and share the
+// shutdown timeout.
+func (gss *Server) OnShutdown(fn ShutdownFunc) {
+	gss.hooks = append(gss.hooks, fn)
+}
+
+// Stop shuts the server down as if one of its signals had been received
+// (e.g. when something else running in the same process has stopped).
+func (gss *Server) Stop() {
+	gss.stopOnce.Do(func() {
+		close(gss.stop)
+	})
 }
 
 // Serve starts the http listener with the registered http.Handler and
 // then blocks until a interrupt signal is received.
 func (gss *Server) Serve(l net.Listener) error {
-	go func() {
-		if err := gss.server.Serve(l); err != nil {
-			gss.err = err
-		}
-	}()
-	return gss.waitForShutdown()
+	return gss.run(&listener{
+		listener: l,
+		server:   gss.newHTTPServer("", nil),
+	})
 }
 
 // ServeTLS starts the http listener with the registered http.Handler and
 // then blocks until a interrupt signal is received.
 func (gss *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
-	go func() {
-		if err := gss.server.ServeTLS(l, certFile, keyFile); err != nil {
-			gss.err = err
-		}
-	}()
-	return gss.waitForShutdown()
+	return gss.run(&listener{
+		certFile: certFile,
+		keyFile:  keyFile,
+		listener: l,
+		server:   gss.newHTTPServer("", nil),
+		tls:      true,
+	})
 }
 
 // ListenAndServe serves the requests on a listener bound to interface
 // specified by Addr
 func (gss *Server) ListenAndServe() error {
-	go func() {
-		gss.server.Addr = gss.Addr
-		if err := gss.server.ListenAndServe(); err != http.ErrServerClosed {
-			gss.err = err
-		}
-	}()
-	return gss.waitForShutdown()
+	return gss.run(&listener{
+		server: gss.newHTTPServer(gss.Addr, nil),
+	})
 }
 
 // ListenAndServeTLS serves the requests on a listener bound to interface
 // specified by Addr
 func (gss *Server) ListenAndServeTLS(certFile, keyFile string) error {
-	go func() {
-		gss.server.Addr = gss.Addr
-		if err := gss.server.ListenAndServeTLS(certFile, keyFile); err != http.ErrServerClosed {
-			gss.err = err
-		}
-	}()
-	return gss.waitForShutdown()
+	return gss.run(&listener{
+		certFile: certFile,
+		keyFile:  keyFile,
+		server:   gss.newHTTPServer(gss.Addr, nil),
+		tls:      true,
+	})
+}
+
+// newHTTPServer returns a server for the address falling back to the
+// server's handler
+func (gss *Server) newHTTPServer(addr string, handler http.Handler) *http.Server {
+	if handler == nil {
+		handler = gss.handler
+	}
+
+	return &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
 }
 
-func (gss *Server) waitForShutdown() error {
+// run starts the main listener along with any additional ones and blocks
+// until either a signal is received or one of them fails
+func (gss *Server) run(main *listener) error {
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, gss.signals...)
-	_ = <-sig
+	defer signal.Stop(sig)
+
+	listeners := append([]*listener{main}, gss.listeners...)
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l *listener) {
+			if err := l.serve(); err != nil && err != http.ErrServerClosed {
+				errs <- err
+			}
+		}(l)
+	}
+
+	var err error
+	select {
+	case <-sig:
+		gss.logf("received interrupt. shutting down..")
+	case <-gss.stop:
+		gss.logf("stopped. shutting down..")
+	case err = <-errs:
+		gss.logf("listener failed: %s. shutting down..", err)
+	}
+
+	if shutdownErr := gss.shutdown(listeners); err == nil {
+		err = shutdownErr
+	}
+
+	return err
+}
+
+// shutdown stops all of the listeners at once and then calls the shutdown
+// hooks returning the first error encountered
+func (gss *Server) shutdown(listeners []*listener) error {
+	ctx := context.Background()
+	if gss.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, gss.timeout)
+		defer cancel()
+	}
 
+	var (
+		firstErr error
+		mutex    sync.Mutex
+		wg       sync.WaitGroup
+	)
+	record := func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, l := range listeners {
+		wg.Add(1)
+		go func(l *listener) {
+			defer wg.Done()
+			record(l.server.Shutdown(ctx))
+		}(l)
+	}
+	wg.Wait()
+
+	for _, hook := range gss.hooks {
+		record(hook(ctx))
+	}
+
+	return firstErr
+}
+
+func (gss *Server) logf(msg string, args ...interface{}) {
 	if gss.Log != nil {
-		gss.Log("received interrupt. shutting down..")
+		gss.Log(msg, args...)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), gss.timeout)
-	defer cancel()
-	if err := gss.server.Shutdown(ctx); err != nil {
-		return err
+}
+
+// serve blocks serving requests until the listener is shutdown or fails
+func (l *listener) serve() error {
+	switch {
+	case l.listener != nil && l.tls:
+		return l.server.ServeTLS(l.listener, l.certFile, l.keyFile)
+	case l.listener != nil:
+		return l.server.Serve(l.listener)
+	case l.tls:
+		return l.server.ListenAndServeTLS(l.certFile, l.keyFile)
+	default:
+		return l.server.ListenAndServe()
 	}
-	return gss.err
 }
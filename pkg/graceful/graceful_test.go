@@ -0,0 +1,126 @@
+package graceful_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/graceful"
+)
+
+func TestServer_ListenError(t *testing.T) {
+	srv := graceful.NewServer(http.NotFoundHandler(), time.Second, syscall.SIGUSR1)
+	srv.Log = nil
+	srv.Addr = "127.0.0.1:-1"
+
+	hooked := false
+	srv.OnShutdown(func(ctx context.Context) error {
+		hooked = true
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expecting the listen error to be returned")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("server did not return after failing to listen")
+	}
+
+	if !hooked {
+		t.Errorf("expecting the shutdown hook to be called")
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	srv := graceful.NewServer(http.NotFoundHandler(), 5*time.Second, syscall.SIGUSR1)
+	srv.Log = nil
+	srv.Listen("127.0.0.1:0", nil)
+
+	var deadline time.Time
+	srv.OnShutdown(func(ctx context.Context) error {
+		deadline, _ = ctx.Deadline()
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(l)
+	}()
+
+	// Make sure the server is up before asking it to stop
+	resp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	if err = syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("server did not shutdown after the signal")
+	}
+
+	if remaining := time.Until(deadline); remaining <= 0 || remaining > 5*time.Second {
+		t.Errorf("expecting the shutdown timeout to be applied, %s remaining", remaining)
+	}
+}
+
+func TestServer_Stop(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	srv := graceful.NewServer(http.NotFoundHandler(), time.Second, syscall.SIGUSR1)
+	srv.Log = nil
+
+	hooked := false
+	srv.OnShutdown(func(ctx context.Context) error {
+		hooked = true
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(l)
+	}()
+
+	// Stopping more than once is harmless
+	srv.Stop()
+	srv.Stop()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("server did not shutdown after being stopped")
+	}
+
+	if !hooked {
+		t.Errorf("expecting the shutdown hook to be called")
+	}
+}
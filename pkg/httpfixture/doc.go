@@ -0,0 +1,4 @@
+// Package httpfixture provides an http.RoundTripper which records the
+// responses to requests in fixture files and replays them so that code which
+// talks to remote services (e.g. Reddit) can be tested without the network.
+package httpfixture
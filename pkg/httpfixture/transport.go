@@ -0,0 +1,211 @@
+package httpfixture
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// Mode is whether a transport replays or records fixtures.
+type Mode string
+
+const (
+	// ModeRecord makes every request with the next transport and records the
+	// response to a fixture, overwriting any fixture already recorded.
+	ModeRecord Mode = "record"
+
+	// ModeReplay answers every request with the fixture recorded for it and
+	// fails requests which do not have one.
+	ModeReplay Mode = "replay"
+
+	// maxFixtureNameLength is the length after which fixture names are
+	// shortened with a hash of the request
+	maxFixtureNameLength = 120
+)
+
+// ModeFromEnv returns ModeRecord if the environment variable is set to
+// "record" and ModeReplay otherwise.
+func ModeFromEnv(name string) Mode {
+	if Mode(os.Getenv(name)) == ModeRecord {
+		return ModeRecord
+	}
+
+	return ModeReplay
+}
+
+// Fixture is a recorded response to a request.
+type Fixture struct {
+	// BinaryBody is the body of the response if it is not UTF-8 text.
+	BinaryBody []byte `json:"binary_body,omitempty"`
+
+	// Body is the body of the response if it is UTF-8 text.
+	Body string `json:"body,omitempty"`
+
+	// Header holds the headers of the response.
+	Header http.Header `json:"header,omitempty"`
+
+	// Method is the method of the request.
+	Method string `json:"method"`
+
+	// StatusCode is the status code of the response.
+	StatusCode int `json:"status_code"`
+
+	// URL is the URL of the request.
+	URL string `json:"url"`
+}
+
+// Transport records responses to fixtures in a directory or replays them.
+type Transport struct {
+	dir   string
+	mode  Mode
+	mutex sync.Mutex
+	next  http.RoundTripper
+}
+
+// NewTransport returns a transport for the fixtures in the directory which
+// makes requests with the next transport when recording, or with
+// http.DefaultTransport if next is nil.
+func NewTransport(dir string, mode Mode, next http.RoundTripper) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &Transport{
+		dir:  dir,
+		mode: mode,
+		next: next,
+	}
+}
+
+// Path returns the path to the fixture for a request. Fixtures are named
+// after the method, host, path and query of the request so that they can be
+// found (and written) by hand.
+func (t *Transport) Path(req *http.Request) string {
+	name := req.Method + "_" + req.URL.Host + req.URL.Path
+	if req.URL.RawQuery != "" {
+		name += "_" + req.URL.RawQuery
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+
+	if len(name) > maxFixtureNameLength {
+		sum := sha1.Sum([]byte(req.Method + " " + req.URL.String()))
+		name = name[:maxFixtureNameLength] + "_" + hex.EncodeToString(sum[:8])
+	}
+
+	return filepath.Join(t.dir, name+".json")
+}
+
+// RoundTrip answers the request with its fixture or, when recording, makes
+// the request and records the response.
+func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if t.mode == ModeRecord {
+		return t.record(req)
+	}
+
+	return t.replay(req)
+}
+
+// record makes the request with the next transport and writes the response
+// to the fixture for the request
+func (t *Transport) record(req *http.Request) (resp *http.Response, err error) {
+	resp, err = t.next.RoundTrip(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := &Fixture{
+		Header:     resp.Header,
+		Method:     req.Method,
+		StatusCode: resp.StatusCode,
+		URL:        req.URL.String(),
+	}
+	if utf8.Valid(body) {
+		fixture.Body = string(body)
+	} else {
+		fixture.BinaryBody = body
+	}
+
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err = os.MkdirAll(t.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(t.Path(req), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+
+	return fixture.response(req), nil
+}
+
+// replay reads the fixture for the request
+func (t *Transport) replay(req *http.Request) (resp *http.Response, err error) {
+	data, err := ioutil.ReadFile(t.Path(req))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.ResourceNotFound("fixture", req.Method+" "+req.URL.String())
+		}
+		return nil, err
+	}
+
+	fixture := &Fixture{}
+	if err = json.Unmarshal(data, fixture); err != nil {
+		return nil, errors.InvalidValue("fixture", err.Error())
+	}
+
+	return fixture.response(req), nil
+}
+
+// response returns the response the fixture recorded for the request
+func (f *Fixture) response(req *http.Request) *http.Response {
+	body := f.BinaryBody
+	if f.Body != "" {
+		body = []byte(f.Body)
+	}
+
+	header := f.Header
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Header:        header,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Request:       req,
+		Status:        fmt.Sprintf("%d %s", f.StatusCode, http.StatusText(f.StatusCode)),
+		StatusCode:    f.StatusCode,
+	}
+}
@@ -0,0 +1,106 @@
+package httpfixture_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/httpfixture"
+)
+
+func TestTransport_RecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vrddt-httpfixture")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		requests++
+		switch req.URL.Path {
+		case "/text":
+			wr.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(wr, `{"title": "Vortex coin bank"}`)
+		case "/binary":
+			wr.Write([]byte{0x00, 0xff, 0xfe})
+		case "/redirect":
+			wr.Header().Set("Location", "/text")
+			wr.WriteHeader(http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	noRedirects := func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	recorder := &http.Client{CheckRedirect: noRedirects, Transport: httpfixture.NewTransport(dir, httpfixture.ModeRecord, nil)}
+	replayer := &http.Client{CheckRedirect: noRedirects, Transport: httpfixture.NewTransport(dir, httpfixture.ModeReplay, nil)}
+
+	cases := []struct {
+		path     string
+		body     string
+		header   string
+		location string
+		status   int
+	}{
+		{path: "/text?a=1", body: `{"title": "Vortex coin bank"}`, header: "application/json", status: http.StatusOK},
+		{path: "/binary", body: "\x00\xff\xfe", status: http.StatusOK},
+		{path: "/redirect", location: "/text", status: http.StatusMovedPermanently},
+	}
+
+	for id, cs := range cases {
+		t.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			for _, client := range []*http.Client{recorder, replayer} {
+				resp, err := client.Get(server.URL + cs.path)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				body, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+
+				if resp.StatusCode != cs.status {
+					t.Errorf("expecting status %d, got %d", cs.status, resp.StatusCode)
+				}
+				if string(body) != cs.body {
+					t.Errorf("expecting body %q, got %q", cs.body, body)
+				}
+				if cs.header != "" && resp.Header.Get("Content-Type") != cs.header {
+					t.Errorf("expecting Content-Type '%s', got '%s'", cs.header, resp.Header.Get("Content-Type"))
+				}
+				if resp.Header.Get("Location") != cs.location {
+					t.Errorf("expecting Location '%s', got '%s'", cs.location, resp.Header.Get("Location"))
+				}
+			}
+		})
+	}
+
+	if requests != len(cases) {
+		t.Errorf("expecting only the recorder to make the %d requests, got %d", len(cases), requests)
+	}
+
+	if _, err = replayer.Get(server.URL + "/never-recorded"); err == nil || !strings.Contains(err.Error(), "never-recorded") {
+		t.Errorf("expecting an error replaying a request without a fixture, got: %v", err)
+	}
+}
+
+func TestTransport_Path(t *testing.T) {
+	transport := httpfixture.NewTransport("testdata", httpfixture.ModeReplay, nil)
+
+	req, _ := http.NewRequest(http.MethodHead, "https://www.reddit.com/r/videos/comments/abc/title/?a=1&b=2", nil)
+	if path := transport.Path(req); path != "testdata/HEAD_www.reddit.com_r_videos_comments_abc_title__a_1_b_2.json" {
+		t.Errorf("unexpected fixture path: %s", path)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "https://v.redd.it/"+strings.Repeat("a", 200), nil)
+	if path := transport.Path(req); len(path) > len("testdata/")+150 {
+		t.Errorf("expecting a long fixture name to be shortened, got: %s", path)
+	}
+}
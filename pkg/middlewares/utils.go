@@ -34,3 +34,11 @@ func (wr *wrappedWriter) WriteHeader(statusCode int) {
 	wr.wroteStatus = statusCode
 	wr.ResponseWriter.WriteHeader(statusCode)
 }
+
+// Flush sends any buffered data to the client so that handlers streaming a
+// response still can when they are wrapped
+func (wr *wrappedWriter) Flush() {
+	if flusher, ok := wr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
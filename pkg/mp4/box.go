@@ -0,0 +1,209 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+// box is a box found in a file, or in the payload of another box
+type box struct {
+	// Data is the payload of the box, it is only read for boxes nested in
+	// others
+	Data []byte
+
+	// HeaderSize is the size of the header of the box
+	HeaderSize int64
+
+	// Offset is where the box starts
+	Offset int64
+
+	// Size is the size of the box including its header
+	Size int64
+
+	// Type is the four character type of the box
+	Type string
+}
+
+// parseBoxes returns the boxes in the payload of a box
+func parseBoxes(data []byte) (boxes []box, err error) {
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < 8 {
+			return nil, errors.InvalidValue("mp4", "truncated box header")
+		}
+
+		b := box{
+			HeaderSize: 8,
+			Offset:     int64(offset),
+			Size:       int64(binary.BigEndian.Uint32(data[offset:])),
+			Type:       string(data[offset+4 : offset+8]),
+		}
+		switch b.Size {
+		case 0:
+			b.Size = int64(len(data) - offset)
+		case 1:
+			if len(data)-offset < 16 {
+				return nil, errors.InvalidValue("mp4", "truncated box header")
+			}
+			b.HeaderSize = 16
+			b.Size = int64(binary.BigEndian.Uint64(data[offset+8:]))
+		}
+		if b.Size < b.HeaderSize || b.Size > int64(len(data)-offset) {
+			return nil, errors.InvalidValue("mp4", fmt.Sprintf("box '%s' has an invalid size of %d", b.Type, b.Size))
+		}
+
+		b.Data = data[offset+int(b.HeaderSize) : offset+int(b.Size)]
+		boxes = append(boxes, b)
+		offset += int(b.Size)
+	}
+
+	return
+}
+
+// readBox returns the header of the box at the offset of a file of a size
+func readBox(r io.ReaderAt, offset int64, size int64) (b box, err error) {
+	header := make([]byte, 16)
+	if _, err = r.ReadAt(header[:8], offset); err != nil {
+		return b, errors.InvalidValue("mp4", fmt.Sprintf("unable to read box header at %d: %s", offset, err))
+	}
+
+	b = box{
+		HeaderSize: 8,
+		Offset:     offset,
+		Size:       int64(binary.BigEndian.Uint32(header)),
+		Type:       string(header[4:8]),
+	}
+	switch b.Size {
+	case 0:
+		b.Size = size - offset
+	case 1:
+		if _, err = r.ReadAt(header[8:], offset+8); err != nil {
+			return b, errors.InvalidValue("mp4", fmt.Sprintf("unable to read box header at %d: %s", offset, err))
+		}
+		b.HeaderSize = 16
+		b.Size = int64(binary.BigEndian.Uint64(header[8:]))
+	}
+	if b.Size < b.HeaderSize || b.Size > size-offset {
+		return b, errors.InvalidValue("mp4", fmt.Sprintf("box '%s' has an invalid size of %d", b.Type, b.Size))
+	}
+
+	return
+}
+
+// readPayload reads the payload of a box in a file
+func readPayload(r io.ReaderAt, b box) (data []byte, err error) {
+	data = make([]byte, b.Size-b.HeaderSize)
+	if _, err = r.ReadAt(data, b.Offset+b.HeaderSize); err != nil {
+		return nil, errors.InvalidValue("mp4", fmt.Sprintf("unable to read box '%s': %s", b.Type, err))
+	}
+
+	return
+}
+
+// findBox returns the payload of the first box of the type in the boxes
+func findBox(boxes []box, boxType string) (data []byte, ok bool) {
+	for _, b := range boxes {
+		if b.Type == boxType {
+			return b.Data, true
+		}
+	}
+
+	return nil, false
+}
+
+// reader reads the fields of a box payload, remembering if it ran out of
+// data so that the fields can be read without checking each one
+type reader struct {
+	data      []byte
+	offset    int
+	truncated bool
+}
+
+// newFullBoxReader returns a reader for the payload of a full box along with
+// its version and flags
+func newFullBoxReader(data []byte) (r *reader, version uint8, flags uint32) {
+	r = &reader{data: data}
+	versionAndFlags := r.u32()
+
+	return r, uint8(versionAndFlags >> 24), versionAndFlags & 0xffffff
+}
+
+// bytes returns the next n bytes
+func (r *reader) bytes(n int) []byte {
+	if n < 0 || len(r.data)-r.offset < n {
+		r.truncated = true
+		r.offset = len(r.data)
+		return make([]byte, n)
+	}
+	r.offset += n
+
+	return r.data[r.offset-n : r.offset]
+}
+
+// err returns an error for the box if it was truncated
+func (r *reader) err(boxType string) error {
+	if r.truncated {
+		return errors.InvalidValue("mp4", fmt.Sprintf("box '%s' is truncated", boxType))
+	}
+
+	return nil
+}
+
+func (r *reader) skip(n int)  { r.bytes(n) }
+func (r *reader) u16() uint16 { return binary.BigEndian.Uint16(r.bytes(2)) }
+func (r *reader) u32() uint32 { return binary.BigEndian.Uint32(r.bytes(4)) }
+func (r *reader) u64() uint64 { return binary.BigEndian.Uint64(r.bytes(8)) }
+
+// versioned reads a field which is 64 bits in version 1 of a box and 32 bits
+// otherwise
+func (r *reader) versioned(version uint8) uint64 {
+	if version == 1 {
+		return r.u64()
+	}
+
+	return uint64(r.u32())
+}
+
+// writer builds the payload of a box
+type writer struct {
+	data []byte
+}
+
+// newBox returns the box of the type with the payloads
+func newBox(boxType string, payloads ...[]byte) []byte {
+	size := 8
+	for _, payload := range payloads {
+		size += len(payload)
+	}
+
+	data := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(data, uint32(size))
+	copy(data[4:], boxType)
+	for _, payload := range payloads {
+		data = append(data, payload...)
+	}
+
+	return data
+}
+
+// newFullBoxWriter returns a writer for the payload of a full box of the version
+// with the flags
+func newFullBoxWriter(version uint8, flags uint32) *writer {
+	w := &writer{}
+	w.u32(uint32(version)<<24 | flags&0xffffff)
+
+	return w
+}
+
+func (w *writer) bytes(data []byte) { w.data = append(w.data, data...) }
+func (w *writer) u16(value uint16)  { w.data = append(w.data, byte(value>>8), byte(value)) }
+func (w *writer) u32(value uint32) {
+	w.data = append(w.data, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+func (w *writer) u64(value uint64) {
+	w.u32(uint32(value >> 32))
+	w.u32(uint32(value))
+}
+func (w *writer) zeros(n int) { w.data = append(w.data, make([]byte, n)...) }
@@ -0,0 +1,5 @@
+// Package mp4 reads the tracks of MP4 files, fragmented (e.g. the MPEG-DASH
+// streams Reddit serves) or not, and writes tracks in to a single MP4 with
+// the movie ahead of the media data so it can be played while downloading.
+// Samples are copied as they are, nothing is decoded or encoded.
+package mp4
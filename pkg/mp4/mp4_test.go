@@ -0,0 +1,243 @@
+package mp4_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+	"github.com/johnwyles/vrddt-droplets/pkg/mp4"
+)
+
+// The fixtures are fragmented MP4s like the MPEG-DASH streams Reddit serves:
+// 30 frames of H.264 at 30fps, with B-frames, and 47 frames of AAC at 48kHz,
+// each in two fragments
+var (
+	audioFixture = filepath.Join("..", "..", "data", "test", "reddit_dash_audio.mp4")
+	videoFixture = filepath.Join("..", "..", "data", "test", "reddit_dash_video.mp4")
+)
+
+func TestRead(suite *testing.T) {
+	cases := []struct {
+		codec       string
+		duration    uint64
+		handler     string
+		path        string
+		samples     int
+		syncSamples int
+		timescale   uint32
+	}{
+		{codec: "avc1", duration: 30 * 512, handler: mp4.HandlerVideo, path: videoFixture, samples: 30, syncSamples: 2, timescale: 15360},
+		{codec: "mp4a", duration: 47 * 1024, handler: mp4.HandlerSound, path: audioFixture, samples: 47, syncSamples: 47, timescale: 48000},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			data, tracks := readFixture(t, cs.path)
+			if len(tracks) != 1 {
+				t.Fatalf("expecting 1 track, got %d", len(tracks))
+			}
+
+			track := tracks[0]
+			if track.Codec != cs.codec || track.Handler != cs.handler || track.Timescale != cs.timescale {
+				t.Errorf("expecting a '%s' track of '%s' in a timescale of %d, got a '%s' track of '%s' in %d", cs.handler, cs.codec, cs.timescale, track.Handler, track.Codec, track.Timescale)
+			}
+			if len(track.Samples) != cs.samples || track.Duration() != cs.duration {
+				t.Errorf("expecting %d samples lasting %d, got %d lasting %d", cs.samples, cs.duration, len(track.Samples), track.Duration())
+			}
+
+			syncSamples := 0
+			for i, sample := range track.Samples {
+				if sample.Sync {
+					syncSamples++
+				}
+				if int64(len(data)) < sample.Offset+int64(sample.Size) {
+					t.Fatalf("expecting sample %d to be in the file, got offset %d", i, sample.Offset)
+				}
+			}
+			if syncSamples != cs.syncSamples {
+				t.Errorf("expecting %d sync samples, got %d", cs.syncSamples, syncSamples)
+			}
+		})
+	}
+
+	if _, err := mp4.Read(bytes.NewReader([]byte("not an mp4")), 10); errors.Type(err) != errors.TypeInvalidValue {
+		suite.Errorf("expecting error type '%s', got: %v", errors.TypeInvalidValue, err)
+	}
+}
+
+func TestRead_SampleToChunk(suite *testing.T) {
+	_, tracks := readFixture(suite, videoFixture)
+	output := &bytes.Buffer{}
+	if err := mp4.Write(context.Background(), output, tracks); err != nil {
+		suite.Fatalf("unexpected error: %s", err)
+	}
+
+	// The 30 samples of the video are written in a single chunk
+	cases := []struct {
+		entries [][2]uint32
+		errType string
+	}{
+		{entries: [][2]uint32{{1, 30}}},
+		{entries: [][2]uint32{{0, 30}}, errType: errors.TypeInvalidValue},
+		{entries: [][2]uint32{{2, 30}}, errType: errors.TypeInvalidValue},
+		{entries: [][2]uint32{{1, 15}, {3, 15}}, errType: errors.TypeInvalidValue},
+		{entries: [][2]uint32{{1, 15}, {0, 15}}, errType: errors.TypeInvalidValue},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			stsc := make([]byte, 8, 8+12*len(cs.entries))
+			binary.BigEndian.PutUint32(stsc[4:], uint32(len(cs.entries)))
+			for _, entry := range cs.entries {
+				stsc = append(stsc, make([]byte, 12)...)
+				binary.BigEndian.PutUint32(stsc[len(stsc)-12:], entry[0])
+				binary.BigEndian.PutUint32(stsc[len(stsc)-8:], entry[1])
+				binary.BigEndian.PutUint32(stsc[len(stsc)-4:], 1)
+			}
+			data := replaceBox(output.Bytes(), "stsc", stsc)
+
+			_, err := mp4.Read(bytes.NewReader(data), int64(len(data)))
+			if errors.Type(err) != cs.errType && !(cs.errType == "" && err == nil) {
+				t.Errorf("expecting error type '%s', got: %v", cs.errType, err)
+			}
+		})
+	}
+}
+
+func TestTrack_SampleAt(suite *testing.T) {
+	_, tracks := readFixture(suite, videoFixture)
+	video := tracks[0]
+
+	cases := []struct {
+		sample int
+		sync   bool
+		time   uint64
+	}{
+		{sample: 0, sync: true, time: 0},
+		{sample: 0, sync: true, time: 511},
+		{sample: 1, sync: false, time: 512},
+		{sample: 15, sync: true, time: 15 * 512},
+		{sample: 29, sync: false, time: 30*512 - 1},
+		{sample: 30, time: 30 * 512},
+	}
+
+	for id, cs := range cases {
+		suite.Run(fmt.Sprintf("Case#%d", id), func(t *testing.T) {
+			sample := video.SampleAt(cs.time)
+			if sample != cs.sample {
+				t.Fatalf("expecting sample %d at %d, got %d", cs.sample, cs.time, sample)
+			}
+			if sample < len(video.Samples) && video.Samples[sample].Sync != cs.sync {
+				t.Errorf("expecting sample %d to be a sync sample: %t", sample, cs.sync)
+			}
+		})
+	}
+
+	sliced := video.Slice(15, 30)
+	if len(sliced.Samples) != 15 || sliced.Duration() != 15*512 || !sliced.Samples[0].Sync {
+		suite.Errorf("expecting the last 15 samples starting with a sync sample, got %d lasting %d", len(sliced.Samples), sliced.Duration())
+	}
+	if len(video.Samples) != 30 {
+		suite.Errorf("expecting the track to be left with 30 samples, got %d", len(video.Samples))
+	}
+}
+
+func TestWrite(t *testing.T) {
+	videoData, videoTracks := readFixture(t, videoFixture)
+	audioData, audioTracks := readFixture(t, audioFixture)
+	tracks := []*mp4.Track{videoTracks[0], audioTracks[0]}
+
+	output := &bytes.Buffer{}
+	if err := mp4.Write(context.Background(), output, tracks); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The movie is ahead of the media data so it can be played while it is
+	// downloaded
+	var boxes []string
+	for offset := 0; offset+8 <= output.Len(); {
+		size := int(binary.BigEndian.Uint32(output.Bytes()[offset:]))
+		boxes = append(boxes, string(output.Bytes()[offset+4:offset+8]))
+		if size < 8 {
+			t.Fatalf("unexpected box size %d at %d", size, offset)
+		}
+		offset += size
+	}
+	if fmt.Sprint(boxes) != "[ftyp moov mdat]" {
+		t.Errorf("expecting boxes [ftyp moov mdat], got %v", boxes)
+	}
+
+	muxed, err := mp4.Read(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("unexpected error reading the output: %s", err)
+	}
+	if len(muxed) != 2 {
+		t.Fatalf("expecting 2 tracks, got %d", len(muxed))
+	}
+
+	for i, source := range [][]byte{videoData, audioData} {
+		expected, actual := tracks[i], muxed[i]
+		if actual.Codec != expected.Codec || actual.Handler != expected.Handler || actual.Timescale != expected.Timescale {
+			t.Errorf("expecting track %d to be a '%s' track of '%s', got a '%s' track of '%s'", i, expected.Handler, expected.Codec, actual.Handler, actual.Codec)
+		}
+		if !bytes.Equal(actual.SampleDescriptions, expected.SampleDescriptions) {
+			t.Errorf("expecting the sample descriptions of track %d to be copied", i)
+		}
+		if len(actual.Samples) != len(expected.Samples) {
+			t.Fatalf("expecting %d samples in track %d, got %d", len(expected.Samples), i, len(actual.Samples))
+		}
+
+		for j := range expected.Samples {
+			e, a := expected.Samples[j], actual.Samples[j]
+			if a.CompositionOffset != e.CompositionOffset || a.DecodeTime != e.DecodeTime || a.Duration != e.Duration || a.Size != e.Size || a.Sync != e.Sync {
+				t.Fatalf("expecting sample %d of track %d to be %+v, got %+v", j, i, e, a)
+			}
+
+			expectedData := source[e.Offset : e.Offset+int64(e.Size)]
+			actualData := output.Bytes()[a.Offset : a.Offset+int64(a.Size)]
+			if !bytes.Equal(actualData, expectedData) {
+				t.Fatalf("expecting the data of sample %d of track %d to be copied", j, i)
+			}
+		}
+	}
+}
+
+// replaceBox returns the MP4 of a single track with the payload of the first
+// box of the type replaced, growing every box it is in to fit
+func replaceBox(data []byte, boxType string, payload []byte) []byte {
+	at := bytes.Index(data, []byte(boxType)) - 4
+	size := int(binary.BigEndian.Uint32(data[at:]))
+
+	box := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(box, uint32(8+len(payload)))
+	copy(box[4:], boxType)
+	box = append(box, payload...)
+
+	output := append(append(append([]byte{}, data[:at]...), box...), data[at+size:]...)
+	for _, container := range []string{"moov", "trak", "mdia", "minf", "stbl"} {
+		start := bytes.Index(output[:at], []byte(container)) - 4
+		binary.BigEndian.PutUint32(output[start:], binary.BigEndian.Uint32(output[start:])+uint32(len(box)-size))
+	}
+
+	return output
+}
+
+// readFixture returns the contents of a fixture and the tracks read from it
+func readFixture(t *testing.T, path string) (data []byte, tracks []*mp4.Track) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tracks, err = mp4.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return
+}
@@ -0,0 +1,654 @@
+package mp4
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+const (
+	// HandlerSound is the handler of an audio track
+	HandlerSound = "soun"
+
+	// HandlerVideo is the handler of a video track
+	HandlerVideo = "vide"
+
+	// sampleIsNonSync is the bit of the flags of a sample in a fragment which
+	// is set when the sample is not a sync sample (i.e. a key frame)
+	sampleIsNonSync = 0x10000
+)
+
+// Sample is a sample of a track and where its data is in the file the track
+// was read from
+type Sample struct {
+	// CompositionOffset is the offset from the decode time of the sample to
+	// when it is presented
+	CompositionOffset int32
+
+	// DecodeTime is when the sample is decoded in the timescale of its track
+	DecodeTime uint64
+
+	// Duration is the duration of the sample in the timescale of its track
+	Duration uint32
+
+	// Offset is where the data of the sample is in the file
+	Offset int64
+
+	// Size is the size of the data of the sample
+	Size uint32
+
+	// Sync is set for a sync sample (i.e. a key frame)
+	Sync bool
+}
+
+// Track is a track read from an MP4
+type Track struct {
+	// Codec is the type of the sample entry of the track (e.g. "avc1" for
+	// H.264 or "mp4a" for AAC)
+	Codec string
+
+	// Handler is the type of the track (e.g. HandlerVideo or HandlerSound)
+	Handler string
+
+	// Height is the height of a video track in 16.16 fixed point
+	Height uint32
+
+	// ID is the ID of the track in the file it was read from
+	ID uint32
+
+	// Language is the packed ISO-639-2 language code of the track
+	Language uint16
+
+	// MediaTime is the time in the media of the track that presentation
+	// starts at, as set by an edit list (e.g. to skip the priming samples of
+	// AAC), or zero if there is not one
+	MediaTime int64
+
+	// SampleDescriptions is the payload of the sample description box of the
+	// track which is copied as it is
+	SampleDescriptions []byte
+
+	// Samples are the samples of the track in decode order
+	Samples []Sample
+
+	// Timescale is the number of units of time in a second for the track
+	Timescale uint32
+
+	// Width is the width of a video track in 16.16 fixed point
+	Width uint32
+
+	// source is the file the track was read from
+	source io.ReaderAt
+}
+
+// Duration returns the duration of the track in its timescale
+func (t *Track) Duration() (duration uint64) {
+	for _, sample := range t.Samples {
+		duration += uint64(sample.Duration)
+	}
+
+	return
+}
+
+// SampleAt returns the index of the sample being decoded at a time from the
+// start of the track, in its timescale, or the number of samples if the time
+// is at or after the end of the track
+func (t *Track) SampleAt(time uint64) int {
+	if len(t.Samples) == 0 {
+		return 0
+	}
+
+	start := t.Samples[0].DecodeTime
+	return sort.Search(len(t.Samples), func(i int) bool {
+		sample := t.Samples[i]
+		return sample.DecodeTime-start+uint64(sample.Duration) > time
+	})
+}
+
+// Slice returns a copy of the track with only its samples from the first up
+// to but not including the last
+func (t *Track) Slice(first int, last int) *Track {
+	sliced := *t
+	sliced.Samples = t.Samples[first:last]
+
+	return &sliced
+}
+
+// trackDefaults are the defaults for the samples in the fragments of a
+// track
+type trackDefaults struct {
+	duration uint32
+	flags    uint32
+	size     uint32
+}
+
+// Read reads the tracks from an MP4, of a size, whether it is fragmented or
+// not
+func Read(r io.ReaderAt, size int64) (tracks []*Track, err error) {
+	var defaults map[uint32]trackDefaults
+	byID := map[uint32]*Track{}
+
+	for offset := int64(0); offset < size; {
+		b, err := readBox(r, offset, size)
+		if err != nil {
+			return nil, err
+		}
+
+		switch b.Type {
+		case "moov":
+			data, err := readPayload(r, b)
+			if err != nil {
+				return nil, err
+			}
+			if tracks, defaults, err = parseMovie(data); err != nil {
+				return nil, err
+			}
+			for _, track := range tracks {
+				track.source = r
+				byID[track.ID] = track
+			}
+		case "moof":
+			if tracks == nil {
+				return nil, errors.InvalidValue("mp4", "movie fragment found before the movie")
+			}
+
+			data, err := readPayload(r, b)
+			if err != nil {
+				return nil, err
+			}
+			if err = parseFragment(data, b.Offset, byID, defaults); err != nil {
+				return nil, err
+			}
+		}
+
+		offset += b.Size
+	}
+
+	if tracks == nil {
+		return nil, errors.InvalidValue("mp4", "no movie was found")
+	}
+
+	return
+}
+
+// parseEditList returns the media time of the first edit which is not empty
+func parseEditList(data []byte) (mediaTime int64, err error) {
+	r, version, _ := newFullBoxReader(data)
+	entries := r.u32()
+	for i := uint32(0); i < entries && !r.truncated; i++ {
+		r.versioned(version)
+		if version == 1 {
+			mediaTime = int64(r.u64())
+		} else {
+			mediaTime = int64(int32(r.u32()))
+		}
+		r.skip(4)
+
+		if mediaTime >= 0 {
+			return mediaTime, r.err("elst")
+		}
+	}
+
+	return 0, r.err("elst")
+}
+
+// parseFragment adds the samples in a movie fragment, which starts at the
+// offset in the file, to the tracks
+func parseFragment(data []byte, offset int64, tracks map[uint32]*Track, defaults map[uint32]trackDefaults) (err error) {
+	boxes, err := parseBoxes(data)
+	if err != nil {
+		return
+	}
+
+	for _, b := range boxes {
+		if b.Type != "traf" {
+			continue
+		}
+
+		trafBoxes, err := parseBoxes(b.Data)
+		if err != nil {
+			return err
+		}
+
+		tfhd, ok := findBox(trafBoxes, "tfhd")
+		if !ok {
+			return errors.InvalidValue("mp4", "track fragment without a header")
+		}
+
+		r, _, flags := newFullBoxReader(tfhd)
+		track, ok := tracks[r.u32()]
+		if !ok {
+			return errors.InvalidValue("mp4", "track fragment for an unknown track")
+		}
+
+		// Samples are found relative to the start of the movie fragment
+		// unless there is an explicit base
+		base := offset
+		trackDefault := defaults[track.ID]
+		if flags&0x1 != 0 {
+			base = int64(r.u64())
+		}
+		if flags&0x2 != 0 {
+			r.skip(4)
+		}
+		if flags&0x8 != 0 {
+			trackDefault.duration = r.u32()
+		}
+		if flags&0x10 != 0 {
+			trackDefault.size = r.u32()
+		}
+		if flags&0x20 != 0 {
+			trackDefault.flags = r.u32()
+		}
+		if err = r.err("tfhd"); err != nil {
+			return err
+		}
+
+		decodeTime := track.Duration()
+		if len(track.Samples) > 0 {
+			decodeTime += track.Samples[0].DecodeTime
+		}
+		if tfdt, ok := findBox(trafBoxes, "tfdt"); ok {
+			r, version, _ := newFullBoxReader(tfdt)
+			decodeTime = r.versioned(version)
+			if err = r.err("tfdt"); err != nil {
+				return err
+			}
+		}
+
+		dataOffset := base
+		for _, trun := range trafBoxes {
+			if trun.Type != "trun" {
+				continue
+			}
+			if dataOffset, decodeTime, err = parseTrackRun(trun.Data, base, dataOffset, decodeTime, track, trackDefault); err != nil {
+				return err
+			}
+		}
+	}
+
+	return
+}
+
+// parseMovie returns the tracks in a movie and the defaults for the samples
+// in their fragments
+func parseMovie(data []byte) (tracks []*Track, defaults map[uint32]trackDefaults, err error) {
+	boxes, err := parseBoxes(data)
+	if err != nil {
+		return
+	}
+
+	defaults = map[uint32]trackDefaults{}
+	for _, b := range boxes {
+		switch b.Type {
+		case "trak":
+			track, err := parseTrack(b.Data)
+			if err != nil {
+				return nil, nil, err
+			}
+			tracks = append(tracks, track)
+		case "mvex":
+			mvexBoxes, err := parseBoxes(b.Data)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, trex := range mvexBoxes {
+				if trex.Type != "trex" {
+					continue
+				}
+
+				r, _, _ := newFullBoxReader(trex.Data)
+				trackID := r.u32()
+				r.skip(4)
+				defaults[trackID] = trackDefaults{
+					duration: r.u32(),
+					size:     r.u32(),
+					flags:    r.u32(),
+				}
+				if err = r.err("trex"); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// parseSampleTable sets the codec and the samples of the track from its
+// sample table
+func parseSampleTable(data []byte, track *Track) (err error) {
+	boxes, err := parseBoxes(data)
+	if err != nil {
+		return
+	}
+
+	stsd, ok := findBox(boxes, "stsd")
+	if !ok {
+		return errors.InvalidValue("mp4", "track without a sample description")
+	}
+	r, _, _ := newFullBoxReader(stsd)
+	if entries := r.u32(); entries != 1 {
+		return errors.NotImplemented("mp4", fmt.Sprintf("tracks with %d sample descriptions", entries))
+	}
+	r.skip(4)
+	track.Codec = string(r.bytes(4))
+	track.SampleDescriptions = stsd
+	if err = r.err("stsd"); err != nil {
+		return
+	}
+
+	if _, ok := findBox(boxes, "stz2"); ok {
+		return errors.NotImplemented("mp4", "compact sample sizes")
+	}
+
+	// Fragmented files have empty sample tables
+	stsz, ok := findBox(boxes, "stsz")
+	if !ok {
+		return
+	}
+	r, _, _ = newFullBoxReader(stsz)
+	sampleSize, count := r.u32(), r.u32()
+	if err = r.err("stsz"); err != nil || count == 0 {
+		return
+	}
+	if uint64(count) > uint64(len(stsz)) {
+		return errors.InvalidValue("mp4", "too many samples")
+	}
+
+	track.Samples = make([]Sample, count)
+	for i := range track.Samples {
+		track.Samples[i].Size = sampleSize
+		if sampleSize == 0 {
+			track.Samples[i].Size = r.u32()
+		}
+		track.Samples[i].Sync = true
+	}
+	if err = r.err("stsz"); err != nil {
+		return
+	}
+
+	if err = parseTimeToSample(boxes, track); err != nil {
+		return
+	}
+
+	return parseSampleToChunk(boxes, track)
+}
+
+// parseSampleToChunk sets the offsets of the samples of the track from the
+// chunks they are in
+func parseSampleToChunk(boxes []box, track *Track) (err error) {
+	var offsets []int64
+	if stco, ok := findBox(boxes, "stco"); ok {
+		r, _, _ := newFullBoxReader(stco)
+		count := r.u32()
+		for i := uint32(0); i < count && !r.truncated; i++ {
+			offsets = append(offsets, int64(r.u32()))
+		}
+		if err = r.err("stco"); err != nil {
+			return
+		}
+	} else if co64, ok := findBox(boxes, "co64"); ok {
+		r, _, _ := newFullBoxReader(co64)
+		count := r.u32()
+		for i := uint32(0); i < count && !r.truncated; i++ {
+			offsets = append(offsets, int64(r.u64()))
+		}
+		if err = r.err("co64"); err != nil {
+			return
+		}
+	} else {
+		return errors.InvalidValue("mp4", "track without chunk offsets")
+	}
+
+	stsc, ok := findBox(boxes, "stsc")
+	if !ok {
+		return errors.InvalidValue("mp4", "track without samples to chunks")
+	}
+	type entry struct{ firstChunk, samplesPerChunk uint32 }
+	var entries []entry
+	r, _, _ := newFullBoxReader(stsc)
+	count := r.u32()
+	for i := uint32(0); i < count && !r.truncated; i++ {
+		entries = append(entries, entry{firstChunk: r.u32(), samplesPerChunk: r.u32()})
+		r.skip(4)
+	}
+	if err = r.err("stsc"); err != nil {
+		return
+	}
+
+	sample := 0
+	for i, e := range entries {
+		lastChunk := uint32(len(offsets))
+		if i+1 < len(entries) {
+			lastChunk = entries[i+1].firstChunk - 1
+		}
+
+		// Chunks are numbered from one and a first chunk of zero in the next
+		// entry wraps the last chunk around
+		if e.firstChunk < 1 || e.firstChunk > uint32(len(offsets)) || lastChunk > uint32(len(offsets)) {
+			return errors.InvalidValue("mp4", fmt.Sprintf("samples to chunks entry %d is not in the %d chunks", i+1, len(offsets)))
+		}
+
+		for chunk := e.firstChunk; chunk <= lastChunk; chunk++ {
+			offset := offsets[chunk-1]
+			for j := uint32(0); j < e.samplesPerChunk; j++ {
+				if sample >= len(track.Samples) {
+					return errors.InvalidValue("mp4", "chunks have more samples than the track")
+				}
+				track.Samples[sample].Offset = offset
+				offset += int64(track.Samples[sample].Size)
+				sample++
+			}
+		}
+	}
+	if sample != len(track.Samples) {
+		return errors.InvalidValue("mp4", "chunks have fewer samples than the track")
+	}
+
+	return
+}
+
+// parseTimeToSample sets the durations, decode times, composition offsets
+// and sync of the samples of the track
+func parseTimeToSample(boxes []box, track *Track) (err error) {
+	stts, ok := findBox(boxes, "stts")
+	if !ok {
+		return errors.InvalidValue("mp4", "track without sample times")
+	}
+	r, _, _ := newFullBoxReader(stts)
+	count := r.u32()
+	sample := 0
+	decodeTime := uint64(0)
+	for i := uint32(0); i < count && !r.truncated; i++ {
+		samples, duration := r.u32(), r.u32()
+		for j := uint32(0); j < samples && sample < len(track.Samples); j++ {
+			track.Samples[sample].DecodeTime = decodeTime
+			track.Samples[sample].Duration = duration
+			decodeTime += uint64(duration)
+			sample++
+		}
+	}
+	if err = r.err("stts"); err != nil {
+		return
+	}
+
+	if ctts, ok := findBox(boxes, "ctts"); ok {
+		r, _, _ := newFullBoxReader(ctts)
+		count := r.u32()
+		sample := 0
+		for i := uint32(0); i < count && !r.truncated; i++ {
+			samples, offset := r.u32(), int32(r.u32())
+			for j := uint32(0); j < samples && sample < len(track.Samples); j++ {
+				track.Samples[sample].CompositionOffset = offset
+				sample++
+			}
+		}
+		if err = r.err("ctts"); err != nil {
+			return
+		}
+	}
+
+	if stss, ok := findBox(boxes, "stss"); ok {
+		for i := range track.Samples {
+			track.Samples[i].Sync = false
+		}
+
+		r, _, _ := newFullBoxReader(stss)
+		count := r.u32()
+		for i := uint32(0); i < count && !r.truncated; i++ {
+			if sample := r.u32(); sample >= 1 && int(sample) <= len(track.Samples) {
+				track.Samples[sample-1].Sync = true
+			}
+		}
+		if err = r.err("stss"); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// parseTrack returns the track in the payload of a track box
+func parseTrack(data []byte) (track *Track, err error) {
+	boxes, err := parseBoxes(data)
+	if err != nil {
+		return
+	}
+
+	track = &Track{}
+
+	tkhd, ok := findBox(boxes, "tkhd")
+	if !ok {
+		return nil, errors.InvalidValue("mp4", "track without a header")
+	}
+	r, version, _ := newFullBoxReader(tkhd)
+	r.versioned(version)
+	r.versioned(version)
+	track.ID = r.u32()
+	r.skip(4)
+	r.versioned(version)
+	r.skip(52)
+	track.Width = r.u32()
+	track.Height = r.u32()
+	if err = r.err("tkhd"); err != nil {
+		return nil, err
+	}
+
+	if edts, ok := findBox(boxes, "edts"); ok {
+		edtsBoxes, err := parseBoxes(edts)
+		if err != nil {
+			return nil, err
+		}
+		if elst, ok := findBox(edtsBoxes, "elst"); ok {
+			if track.MediaTime, err = parseEditList(elst); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	mdia, ok := findBox(boxes, "mdia")
+	if !ok {
+		return nil, errors.InvalidValue("mp4", "track without media")
+	}
+	mdiaBoxes, err := parseBoxes(mdia)
+	if err != nil {
+		return
+	}
+
+	mdhd, ok := findBox(mdiaBoxes, "mdhd")
+	if !ok {
+		return nil, errors.InvalidValue("mp4", "media without a header")
+	}
+	r, version, _ = newFullBoxReader(mdhd)
+	r.versioned(version)
+	r.versioned(version)
+	track.Timescale = r.u32()
+	r.versioned(version)
+	track.Language = r.u16()
+	if err = r.err("mdhd"); err != nil {
+		return nil, err
+	}
+	if track.Timescale == 0 {
+		return nil, errors.InvalidValue("mp4", "media with a timescale of zero")
+	}
+
+	if hdlr, ok := findBox(mdiaBoxes, "hdlr"); ok {
+		r, _, _ := newFullBoxReader(hdlr)
+		r.skip(4)
+		track.Handler = string(r.bytes(4))
+		if err = r.err("hdlr"); err != nil {
+			return nil, err
+		}
+	}
+
+	minf, ok := findBox(mdiaBoxes, "minf")
+	if !ok {
+		return nil, errors.InvalidValue("mp4", "media without information")
+	}
+	minfBoxes, err := parseBoxes(minf)
+	if err != nil {
+		return
+	}
+	stbl, ok := findBox(minfBoxes, "stbl")
+	if !ok {
+		return nil, errors.InvalidValue("mp4", "media without a sample table")
+	}
+	if err = parseSampleTable(stbl, track); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// parseTrackRun adds the samples in a run of a track fragment to the track
+// returning where the data for the next run and its decode time start
+func parseTrackRun(data []byte, base int64, dataOffset int64, decodeTime uint64, track *Track, defaults trackDefaults) (nextDataOffset int64, nextDecodeTime uint64, err error) {
+	r, _, flags := newFullBoxReader(data)
+	count := r.u32()
+	if flags&0x1 != 0 {
+		dataOffset = base + int64(int32(r.u32()))
+	}
+	firstSampleFlags, hasFirstSampleFlags := uint32(0), flags&0x4 != 0
+	if hasFirstSampleFlags {
+		firstSampleFlags = r.u32()
+	}
+	if uint64(count) > uint64(len(data)) {
+		return 0, 0, errors.InvalidValue("mp4", "too many samples in a track run")
+	}
+
+	for i := uint32(0); i < count && !r.truncated; i++ {
+		sample := Sample{
+			DecodeTime: decodeTime,
+			Duration:   defaults.duration,
+			Offset:     dataOffset,
+			Size:       defaults.size,
+		}
+		sampleFlags := defaults.flags
+
+		if flags&0x100 != 0 {
+			sample.Duration = r.u32()
+		}
+		if flags&0x200 != 0 {
+			sample.Size = r.u32()
+		}
+		if flags&0x400 != 0 {
+			sampleFlags = r.u32()
+		}
+		if i == 0 && hasFirstSampleFlags {
+			sampleFlags = firstSampleFlags
+		}
+		if flags&0x800 != 0 {
+			sample.CompositionOffset = int32(r.u32())
+		}
+		sample.Sync = sampleFlags&sampleIsNonSync == 0
+
+		track.Samples = append(track.Samples, sample)
+		dataOffset += int64(sample.Size)
+		decodeTime += uint64(sample.Duration)
+	}
+
+	return dataOffset, decodeTime, r.err("trun")
+}
@@ -0,0 +1,426 @@
+package mp4
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
+)
+
+const (
+	// MovieTimescale is the timescale of the movie written
+	MovieTimescale = 1000
+
+	// languageUndetermined is the packed ISO-639-2 code "und"
+	languageUndetermined = 0x55c4
+)
+
+var (
+	// ChunkDuration is the duration, in seconds, of the media of each track
+	// written together before moving on to the next track so that players
+	// read the tracks from nearby in the file
+	ChunkDuration = 1.0
+
+	// identityMatrix is the transformation matrix for video which is not
+	// transformed
+	identityMatrix = []uint32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000}
+)
+
+// chunk is a run of samples of a track written together
+type chunk struct {
+	first int
+	last  int
+	track int
+}
+
+// Write writes the tracks in to an MP4 with the movie ahead of the media data
+// (i.e. "faststart") copying the data of their samples from the files the
+// tracks were read from until the context is cancelled
+func Write(ctx context.Context, w io.Writer, tracks []*Track) (err error) {
+	if len(tracks) == 0 {
+		return errors.MissingField("tracks")
+	}
+	for _, track := range tracks {
+		if len(track.Samples) == 0 {
+			return errors.InvalidValue("tracks", "a track does not have any samples")
+		}
+	}
+
+	chunks := interleave(tracks)
+
+	mediaSize := int64(0)
+	for _, track := range tracks {
+		for _, sample := range track.Samples {
+			mediaSize += int64(sample.Size)
+		}
+	}
+	mdatHeader := mediaDataHeader(mediaSize)
+
+	ftyp := fileType()
+
+	// The chunk offsets depend on the size of the movie which only depends on
+	// whether the offsets need 64 bits
+	moov := movie(tracks, chunks, 0, false)
+	base := int64(len(ftyp) + len(moov) + len(mdatHeader))
+	if base+mediaSize > math.MaxUint32 {
+		moov = movie(tracks, chunks, 0, true)
+		base = int64(len(ftyp) + len(moov) + len(mdatHeader))
+		moov = movie(tracks, chunks, base, true)
+	} else {
+		moov = movie(tracks, chunks, base, false)
+	}
+
+	for _, data := range [][]byte{ftyp, moov, mdatHeader} {
+		if _, err = w.Write(data); err != nil {
+			return
+		}
+	}
+
+	for _, c := range chunks {
+		if err = ctx.Err(); err != nil {
+			return errors.Cancelled("mux", err.Error())
+		}
+
+		track := tracks[c.track]
+		for i := c.first; i <= c.last; {
+			// Samples next to each other in the source are copied at once
+			start := track.Samples[i].Offset
+			end := start + int64(track.Samples[i].Size)
+			for i++; i <= c.last && track.Samples[i].Offset == end; i++ {
+				end += int64(track.Samples[i].Size)
+			}
+
+			if _, err = io.Copy(w, io.NewSectionReader(track.source, start, end-start)); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// fileType returns the file type box of the MP4 written
+func fileType() []byte {
+	w := &writer{}
+	w.bytes([]byte("isom"))
+	w.u32(0x200)
+	w.bytes([]byte("isomiso2avc1mp41"))
+
+	return newBox("ftyp", w.data)
+}
+
+// interleave returns the chunks the samples of the tracks are written in
+// which alternate between the tracks every ChunkDuration seconds
+func interleave(tracks []*Track) (chunks []chunk) {
+	next := make([]int, len(tracks))
+	for window := 1; ; window++ {
+		done := true
+		for t, track := range tracks {
+			end := uint64(float64(window) * ChunkDuration * float64(track.Timescale))
+			start := track.Samples[0].DecodeTime
+
+			first := next[t]
+			for next[t] < len(track.Samples) && track.Samples[next[t]].DecodeTime-start < end {
+				next[t]++
+			}
+			if next[t] > first {
+				chunks = append(chunks, chunk{first: first, last: next[t] - 1, track: t})
+			}
+			if next[t] < len(track.Samples) {
+				done = false
+			}
+		}
+
+		if done {
+			return
+		}
+	}
+}
+
+// mediaDataHeader returns the header of the media data box for media of a
+// size
+func mediaDataHeader(size int64) []byte {
+	w := &writer{}
+	if size+8 > math.MaxUint32 {
+		w.u32(1)
+		w.bytes([]byte("mdat"))
+		w.u64(uint64(size + 16))
+	} else {
+		w.u32(uint32(size + 8))
+		w.bytes([]byte("mdat"))
+	}
+
+	return w.data
+}
+
+// movie returns the movie box for the tracks with their chunks at their
+// offsets in the media data which starts at the base
+func movie(tracks []*Track, chunks []chunk, base int64, co64 bool) []byte {
+	offsets := make([][]int64, len(tracks))
+	samplesPerChunk := make([][]uint32, len(tracks))
+	offset := base
+	for _, c := range chunks {
+		offsets[c.track] = append(offsets[c.track], offset)
+		samplesPerChunk[c.track] = append(samplesPerChunk[c.track], uint32(c.last-c.first+1))
+		for _, sample := range tracks[c.track].Samples[c.first : c.last+1] {
+			offset += int64(sample.Size)
+		}
+	}
+
+	duration := uint64(0)
+	traks := [][]byte{}
+	for t, track := range tracks {
+		presented := track.Duration()
+		if uint64(track.MediaTime) < presented {
+			presented -= uint64(track.MediaTime)
+		}
+		trackDuration := movieDuration(presented, track.Timescale)
+		if trackDuration > duration {
+			duration = trackDuration
+		}
+		traks = append(traks, trak(track, uint32(t+1), trackDuration, offsets[t], samplesPerChunk[t], co64))
+	}
+
+	version := uint8(0)
+	if duration > math.MaxUint32 {
+		version = 1
+	}
+	w := newFullBoxWriter(version, 0)
+	writeVersioned(w, version, 0)
+	writeVersioned(w, version, 0)
+	w.u32(MovieTimescale)
+	writeVersioned(w, version, duration)
+	w.u32(0x10000)
+	w.u16(0x100)
+	w.zeros(10)
+	for _, value := range identityMatrix {
+		w.u32(value)
+	}
+	w.zeros(24)
+	w.u32(uint32(len(tracks) + 1))
+
+	return newBox("moov", append([][]byte{newBox("mvhd", w.data)}, traks...)...)
+}
+
+// movieDuration returns a duration in a timescale in the timescale of the
+// movie
+func movieDuration(duration uint64, timescale uint32) uint64 {
+	return uint64(math.Round(float64(duration) * MovieTimescale / float64(timescale)))
+}
+
+// sampleTable returns the sample table box for the track with its chunks at
+// the offsets
+func sampleTable(track *Track, offsets []int64, samplesPerChunk []uint32, co64 bool) []byte {
+	stsd := newBox("stsd", track.SampleDescriptions)
+
+	// Sample durations and composition offsets are run length encoded
+	stts := &writer{}
+	sttsEntries := uint32(0)
+	ctts := &writer{}
+	cttsEntries := uint32(0)
+	cttsVersion := uint8(0)
+	hasCompositionOffsets := false
+	for i := 0; i < len(track.Samples); {
+		j := i + 1
+		for j < len(track.Samples) && track.Samples[j].Duration == track.Samples[i].Duration {
+			j++
+		}
+		stts.u32(uint32(j - i))
+		stts.u32(track.Samples[i].Duration)
+		sttsEntries++
+		i = j
+	}
+	for i := 0; i < len(track.Samples); {
+		j := i + 1
+		for j < len(track.Samples) && track.Samples[j].CompositionOffset == track.Samples[i].CompositionOffset {
+			j++
+		}
+		ctts.u32(uint32(j - i))
+		ctts.u32(uint32(track.Samples[i].CompositionOffset))
+		cttsEntries++
+		if track.Samples[i].CompositionOffset != 0 {
+			hasCompositionOffsets = true
+		}
+		if track.Samples[i].CompositionOffset < 0 {
+			cttsVersion = 1
+		}
+		i = j
+	}
+
+	sttsBox := newFullBoxWriter(0, 0)
+	sttsBox.u32(sttsEntries)
+	sttsBox.bytes(stts.data)
+	boxes := [][]byte{stsd, newBox("stts", sttsBox.data)}
+
+	// Only tracks which are not all sync samples list the sync samples
+	stss := &writer{}
+	syncSamples := uint32(0)
+	for i, sample := range track.Samples {
+		if sample.Sync {
+			stss.u32(uint32(i + 1))
+			syncSamples++
+		}
+	}
+	if int(syncSamples) != len(track.Samples) {
+		stssBox := newFullBoxWriter(0, 0)
+		stssBox.u32(syncSamples)
+		stssBox.bytes(stss.data)
+		boxes = append(boxes, newBox("stss", stssBox.data))
+	}
+
+	if hasCompositionOffsets {
+		cttsBox := newFullBoxWriter(cttsVersion, 0)
+		cttsBox.u32(cttsEntries)
+		cttsBox.bytes(ctts.data)
+		boxes = append(boxes, newBox("ctts", cttsBox.data))
+	}
+
+	stsc := &writer{}
+	stscEntries := uint32(0)
+	for i := range samplesPerChunk {
+		if i > 0 && samplesPerChunk[i] == samplesPerChunk[i-1] {
+			continue
+		}
+		stsc.u32(uint32(i + 1))
+		stsc.u32(samplesPerChunk[i])
+		stsc.u32(1)
+		stscEntries++
+	}
+	stscBox := newFullBoxWriter(0, 0)
+	stscBox.u32(stscEntries)
+	stscBox.bytes(stsc.data)
+	boxes = append(boxes, newBox("stsc", stscBox.data))
+
+	// A single size is given when every sample is the same size
+	stsz := newFullBoxWriter(0, 0)
+	sameSize := true
+	for _, sample := range track.Samples {
+		if sample.Size != track.Samples[0].Size {
+			sameSize = false
+			break
+		}
+	}
+	if sameSize {
+		stsz.u32(track.Samples[0].Size)
+		stsz.u32(uint32(len(track.Samples)))
+	} else {
+		stsz.u32(0)
+		stsz.u32(uint32(len(track.Samples)))
+		for _, sample := range track.Samples {
+			stsz.u32(sample.Size)
+		}
+	}
+	boxes = append(boxes, newBox("stsz", stsz.data))
+
+	chunkOffsets := newFullBoxWriter(0, 0)
+	chunkOffsets.u32(uint32(len(offsets)))
+	for _, offset := range offsets {
+		if co64 {
+			chunkOffsets.u64(uint64(offset))
+		} else {
+			chunkOffsets.u32(uint32(offset))
+		}
+	}
+	if co64 {
+		boxes = append(boxes, newBox("co64", chunkOffsets.data))
+	} else {
+		boxes = append(boxes, newBox("stco", chunkOffsets.data))
+	}
+
+	return newBox("stbl", boxes...)
+}
+
+// trak returns the track box for the track with the ID and its chunks at the
+// offsets
+func trak(track *Track, id uint32, duration uint64, offsets []int64, samplesPerChunk []uint32, co64 bool) []byte {
+	version := uint8(0)
+	if duration > math.MaxUint32 || track.Duration() > math.MaxUint32 {
+		version = 1
+	}
+
+	volume := uint16(0)
+	if track.Handler == HandlerSound {
+		volume = 0x100
+	}
+
+	tkhd := newFullBoxWriter(version, 0x3)
+	writeVersioned(tkhd, version, 0)
+	writeVersioned(tkhd, version, 0)
+	tkhd.u32(id)
+	tkhd.zeros(4)
+	writeVersioned(tkhd, version, duration)
+	tkhd.zeros(8)
+	tkhd.u16(0)
+	tkhd.u16(0)
+	tkhd.u16(volume)
+	tkhd.zeros(2)
+	for _, value := range identityMatrix {
+		tkhd.u32(value)
+	}
+	tkhd.u32(track.Width)
+	tkhd.u32(track.Height)
+	boxes := [][]byte{newBox("tkhd", tkhd.data)}
+
+	// The edit list skips the media before the media time (e.g. priming
+	// samples or the delay from B-frames)
+	if track.MediaTime > 0 {
+		elst := newFullBoxWriter(version, 0)
+		elst.u32(1)
+		writeVersioned(elst, version, duration)
+		writeVersioned(elst, version, uint64(track.MediaTime))
+		elst.u32(0x10000)
+		boxes = append(boxes, newBox("edts", newBox("elst", elst.data)))
+	}
+
+	language := track.Language
+	if language == 0 {
+		language = languageUndetermined
+	}
+	mdhd := newFullBoxWriter(version, 0)
+	writeVersioned(mdhd, version, 0)
+	writeVersioned(mdhd, version, 0)
+	mdhd.u32(track.Timescale)
+	writeVersioned(mdhd, version, track.Duration())
+	mdhd.u16(language)
+	mdhd.u16(0)
+
+	name, header := "SoundHandler", newFullBoxWriter(0, 0)
+	if track.Handler == HandlerSound {
+		header.u32(0)
+		header.data = newBox("smhd", header.data)
+	} else {
+		name = "VideoHandler"
+		header = newFullBoxWriter(0, 1)
+		header.zeros(8)
+		header.data = newBox("vmhd", header.data)
+	}
+	hdlr := newFullBoxWriter(0, 0)
+	hdlr.zeros(4)
+	hdlr.bytes([]byte(track.Handler))
+	hdlr.zeros(12)
+	hdlr.bytes(append([]byte(name), 0))
+
+	dref := newFullBoxWriter(0, 0)
+	dref.u32(1)
+	dref.bytes(newBox("url ", newFullBoxWriter(0, 1).data))
+
+	minf := newBox("minf",
+		header.data,
+		newBox("dinf", newBox("dref", dref.data)),
+		sampleTable(track, offsets, samplesPerChunk, co64),
+	)
+	mdia := newBox("mdia", newBox("mdhd", mdhd.data), newBox("hdlr", hdlr.data), minf)
+
+	return newBox("trak", append(boxes, mdia)...)
+}
+
+// writeVersioned writes a field which is 64 bits in version 1 of a box and
+// 32 bits otherwise
+func writeVersioned(w *writer, version uint8, value uint64) {
+	if version == 1 {
+		w.u64(value)
+	} else {
+		w.u32(uint32(value))
+	}
+}
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
+	"github.com/johnwyles/vrddt-droplets/interfaces/store"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+// Constructor provides functions for job creation operations.
+type Constructor struct {
+	logger.Logger
+
+	queue queue.Queue
+	store store.Store
+}
+
+// NewConstructor initializes a Constructor service object.
+func NewConstructor(loggerHandle logger.Logger, queue queue.Queue, store store.Store) *Constructor {
+	return &Constructor{
+		Logger: loggerHandle,
+
+		queue: queue,
+		store: store,
+	}
+}
+
+// Create records a new queued job for a clip of the Reddit URL in a quality
+// and format and pushes the request for its video on to the queue for a
+// worker to process
+func (cons *Constructor) Create(ctx context.Context, redditURL string, quality domain.Quality, format domain.Format, clip domain.Clip) (job *domain.Job, err error) {
+	videoRequest := domain.NewVideoRequest(redditURL, quality, format, clip)
+
+	if err = videoRequest.Validate(); err != nil {
+		return
+	}
+
+	if err = videoRequest.SetFinalURL(ctx); err != nil {
+		return
+	}
+
+	job = domain.NewJob()
+	job.Clip = clip
+	job.Format = format
+	job.Quality = quality
+	job.RedditURL = videoRequest.URL
+	if err = job.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err = cons.store.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	videoRequest.JobID = job.ID
+
+	cons.queue.MakeClient(ctx)
+
+	var message []byte
+	envelope, err := queue.NewEnvelope(queue.KindVideoRequest, videoRequest)
+	if err == nil {
+		message, err = envelope.Marshal()
+	}
+	if err == nil {
+		err = cons.queue.Push(ctx, message)
+	}
+	if err != nil {
+		cons.Errorf("Failed to push the video request for job '%s': %v", job.ID.Hex(), err)
+
+		// Nothing is ever going to work on the job so let anyone polling it
+		// know rather than leaving it queued forever
+		job.Error = err.Error()
+		job.Status = domain.JobStatusFailed
+		job.UpdatedAt = time.Now()
+		if updateErr := cons.store.UpdateJob(ctx, job); updateErr != nil {
+			cons.Errorf("Failed to mark job '%s' as failed: %v", job.ID.Hex(), updateErr)
+		}
+
+		return nil, err
+	}
+
+	return
+}
@@ -0,0 +1,3 @@
+// Package jobs has usecases around the Job domain entity. This includes
+// requesting a Reddit URL be processed and retrieving the progress of it.
+package jobs
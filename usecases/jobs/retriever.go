@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"context"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/johnwyles/vrddt-droplets/domain"
+	"github.com/johnwyles/vrddt-droplets/interfaces/store"
+	"github.com/johnwyles/vrddt-droplets/pkg/logger"
+)
+
+// Retriever provides functions for retrieving jobs and their results.
+type Retriever struct {
+	logger.Logger
+
+	store store.Store
+}
+
+// NewRetriever initializes an instance of Retriever with given store.
+func NewRetriever(loggerHandle logger.Logger, store store.Store) *Retriever {
+	return &Retriever{
+		Logger: loggerHandle,
+
+		store: store,
+	}
+}
+
+// GetByID finds a job by id along with the resulting vrddt videos once the
+// job is done, of which there are several when the Reddit post has several
+// media items (e.g. a gallery).
+func (ret *Retriever) GetByID(ctx context.Context, id bson.ObjectId) (job *domain.Job, vrddtVideos []*domain.VrddtVideo, err error) {
+	job, err = ret.store.GetJob(
+		ctx, store.Selector{
+			"_id": id,
+		},
+	)
+	if err != nil {
+		ret.Debugf("Failed to find job with ID '%s': %v", id.Hex(), err)
+		return nil, nil, err
+	}
+
+	if job.Status != domain.JobStatusDone {
+		return
+	}
+
+	vrddtVideoIDs := job.VrddtVideoIDs
+	if len(vrddtVideoIDs) == 0 {
+		vrddtVideoIDs = []bson.ObjectId{job.VrddtVideoID}
+	}
+
+	for _, vrddtVideoID := range vrddtVideoIDs {
+		vrddtVideo, err := ret.store.GetVrddtVideo(
+			ctx,
+			store.Selector{
+				"_id": vrddtVideoID,
+			},
+		)
+		if err != nil {
+			ret.Debugf("Failed to find vrddt video with ID '%s' for job '%s': %v", vrddtVideoID.Hex(), id.Hex(), err)
+			return nil, nil, err
+		}
+		vrddtVideos = append(vrddtVideos, vrddtVideo)
+	}
+
+	return
+}
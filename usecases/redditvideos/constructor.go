@@ -2,7 +2,6 @@ package redditvideos
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/johnwyles/vrddt-droplets/domain"
 	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
@@ -36,7 +35,7 @@ func (cons *Constructor) Create(ctx context.Context, redditVideo *domain.RedditV
 		return
 	}
 
-	if err = redditVideo.SetFinalURL(); err != nil {
+	if err = redditVideo.SetFinalURL(ctx); err != nil {
 		return
 	}
 
@@ -52,19 +51,25 @@ func (cons *Constructor) Create(ctx context.Context, redditVideo *domain.RedditV
 	return cons.store.CreateRedditVideo(ctx, redditVideo)
 }
 
-// Push pops a reddit video from the queue.
+// Push pushes the request for the video of a reddit video on to the queue in
+// an envelope.
 func (cons *Constructor) Push(ctx context.Context, redditVideo *domain.RedditVideo) (err error) {
 	if err = redditVideo.Validate(); err != nil {
 		return
 	}
 
-	if err = redditVideo.SetFinalURL(); err != nil {
+	if err = redditVideo.SetFinalURL(ctx); err != nil {
 		return
 	}
 
 	cons.queue.MakeClient(ctx)
 
-	message, err := json.Marshal(redditVideo)
+	envelope, err := queue.NewEnvelope(queue.KindVideoRequest, redditVideo.VideoRequest())
+	if err != nil {
+		return
+	}
+
+	message, err := envelope.Marshal()
 	if err != nil {
 		return
 	}
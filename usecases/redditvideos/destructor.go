@@ -2,14 +2,15 @@ package redditvideos
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/johnwyles/vrddt-droplets/domain"
 	"github.com/johnwyles/vrddt-droplets/interfaces/queue"
 	"github.com/johnwyles/vrddt-droplets/interfaces/store"
+	"github.com/johnwyles/vrddt-droplets/pkg/errors"
 	"github.com/johnwyles/vrddt-droplets/pkg/logger"
 )
 
@@ -41,18 +42,33 @@ func (d *Destructor) Delete(ctx context.Context, id bson.ObjectId) (err error) {
 	)
 }
 
-// Pop pops a reddit video off of the queue.
+// Pop pops a reddit video off of the queue and acknowledges it.
 func (d *Destructor) Pop(ctx context.Context) (redditVideo *domain.RedditVideo, err error) {
 	d.queue.MakeConsumer(ctx)
-	result, err := d.queue.Pop(ctx)
+	delivery, err := d.queue.Pop(ctx)
 	if err != nil {
 		d.Debugf("failed to pop reddit video: %v", err)
 		return nil, err
 	}
 
-	if redditVideo, ok := result.(*domain.RedditVideo); ok {
-		return redditVideo, nil
+	switch body := delivery.Body().(type) {
+	case *domain.RedditVideo:
+		redditVideo = body
+	case []byte:
+		redditVideo = &domain.RedditVideo{}
+		if err = json.Unmarshal(body, redditVideo); err != nil {
+			redditVideo = nil
+		}
+	}
+
+	if redditVideo == nil {
+		delivery.Nack(ctx, false)
+		return nil, errors.ResourceUnknown("result", fmt.Sprintf("%#v", delivery.Body()))
+	}
+
+	if err = delivery.Ack(ctx); err != nil {
+		return nil, err
 	}
 
-	return nil, errors.ResourceUnknown("result", fmt.Sprintf("#%v", result))
+	return redditVideo, nil
 }
@@ -49,8 +49,10 @@ func (ret *Retriever) GetByID(ctx context.Context, id bson.ObjectId) (redditVide
 	return
 }
 
-// GetByURL finds a reddit video by url.
-func (ret *Retriever) GetByURL(ctx context.Context, url string) (redditVideo *domain.RedditVideo, err error) {
+// GetByURL finds a reddit video by url in a quality, format and clip. For a
+// post with several media items (e.g. a gallery) it is the reddit video for
+// the first item.
+func (ret *Retriever) GetByURL(ctx context.Context, url string, quality domain.Quality, format domain.Format, clip domain.Clip) (redditVideo *domain.RedditVideo, err error) {
 	// TODO: If there is a way to do this entirely client-side we can save some time
 	finalURL, err := domain.GetFinalURL(url)
 	if err != nil {
@@ -60,11 +62,38 @@ func (ret *Retriever) GetByURL(ctx context.Context, url string) (redditVideo *do
 	redditVideo, err = ret.store.GetRedditVideo(
 		ctx,
 		store.Selector{
-			"url": finalURL,
+			"clip":    clip,
+			"format":  format,
+			"item":    0,
+			"quality": quality,
+			"url":     finalURL,
 		},
 	)
 	if err != nil {
-		ret.Debugf("Failed to find Reddit video with URL '%s': %v", url, err)
+		ret.Debugf("Failed to find Reddit video with URL '%s' in %s quality as %s clipped to '%s': %v", url, quality, format, clip, err)
+		return nil, err
+	}
+
+	return
+}
+
+// GetMedia resolves the title, the available renditions, and the video and
+// audio streams for the quality of every media item at a URL using the source
+// which supports it.
+func (ret *Retriever) GetMedia(ctx context.Context, url string, quality domain.Quality) (items []*domain.SourceMedia, err error) {
+	source, err := domain.SourceFor(url)
+	if err != nil {
+		return nil, err
+	}
+
+	finalURL, err := source.FinalURL(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err = source.Resolve(ctx, finalURL, quality)
+	if err != nil {
+		ret.Debugf("Failed to resolve media for URL '%s': %v", url, err)
 		return nil, err
 	}
 
@@ -29,6 +29,7 @@
     </form>
     <div id="convert-response">
       <h1>Converted Video Link:</h1>
+      <img id="convert-thumbnail" class="img-thumbnail mb-2" src="{{.ThumbnailURL}}" alt=""{{if not .ThumbnailURL}} style="display: none"{{end}} />
       <a id="convert-link" href="{{.VrddtURL}}">{{.VrddtURL}}</a>
     </div>
   </div>
@@ -41,32 +42,73 @@
   <script src="https://stackpath.bootstrapcdn.com/bootstrap/4.1.3/js/bootstrap.min.js" integrity="sha384-ChfqqxuZUCnJSK3+MXmPNIyE6ZbWh2IMqE241rYiqJxyMiZ6OW/JmZQ5stwEULTy"
     crossorigin="anonymous"></script>
   <script type="text/javascript">
+    // showVideo will link to the converted vrddt video
+    function showVideo(title, vrddt_video)
+    {
+      $('a#convert-link').html(title || vrddt_video.url);
+      $('a#convert-link').attr('href', vrddt_video.url);
+      if (vrddt_video.thumbnail_url) {
+        $('img#convert-thumbnail').attr('src', vrddt_video.thumbnail_url).show();
+      } else {
+        $('img#convert-thumbnail').hide();
+      }
+      $('div#convert-response').attr('style', '');
+    }
+
+    // pollJob will follow a queued job until its vrddt video is done
+    function pollJob(job_id)
+    {
+      $.ajax({
+        dataType: "json",
+        type: "GET",
+        url: '{{.VrddtAPIURI}}/jobs/'+job_id,
+        success: function(job)
+        {
+          console.log(job);
+          if (job.status === 'done') {
+            showVideo('', job.vrddt_video);
+          } else if (job.status === 'failed') {
+            $('img#convert-thumbnail').hide();
+            $('a#convert-link').html(job.error).removeAttr('href');
+            $('div#convert-response').attr('style', '');
+          } else {
+            setTimeout(function() { pollJob(job_id); }, 1000);
+          }
+        }
+      });
+    }
+
     $('#convert-form').submit(function(e){
       e.preventDefault();
-      var reddit_response = "";
       $.ajax({
         data: $(this).serializeArray(),
         dataType: "json",
         type: "GET",
         url: '{{.VrddtAPIURI}}/reddit_videos/',
-        success: function(reddit_response)
+        success: function(reddit_response, status, xhr)
         {
-          var vrddt_response = "";
+          // The Reddit video is converted by a job when it is not known yet
+          if (xhr.status === 202) {
+            pollJob(reddit_response.id);
+            return;
+          }
+
           $.ajax({
-            type: "GET", 
+            type: "GET",
             url: '{{.VrddtAPIURI}}/vrddt_videos/'+reddit_response.vrddt_video_id,
             success: function(vrddt_response)
             {
               console.log(reddit_response);
               console.log(vrddt_response);
-              $('a#convert-link').html(reddit_response.title);
-              $('a#convert-link').attr('href', vrddt_response.url);
-              $('div#convert-response').attr('style', '');
+              showVideo(reddit_response.title, vrddt_response);
             }
           });
         }
       });
     });
+{{if .JobID}}
+    pollJob('{{.JobID}}');
+{{end}}
   </script>
 </body>
 